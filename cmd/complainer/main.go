@@ -1,22 +1,41 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"math/rand"
+	"net/http"
 	"os"
+	"os/signal"
 	"regexp"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/config"
+	"github.com/cloudflare/complainer/election"
 	"github.com/cloudflare/complainer/flags"
+	"github.com/cloudflare/complainer/httpclient"
+	"github.com/cloudflare/complainer/logging"
 	"github.com/cloudflare/complainer/matcher"
 	"github.com/cloudflare/complainer/mesos"
+	"github.com/cloudflare/complainer/metrics"
 	"github.com/cloudflare/complainer/monitor"
+	"github.com/cloudflare/complainer/redact"
 	"github.com/cloudflare/complainer/reporter"
+	"github.com/cloudflare/complainer/state"
 	"github.com/cloudflare/complainer/uploader"
 )
 
+// shutdownCancelTimeout bounds waiting for the run after it is cancelled
+const shutdownCancelTimeout = time.Second * 5
+
+// validateTimeout bounds config validation at startup
+const validateTimeout = time.Second * 30
+
 type regexArrayFlags []*regexp.Regexp
 
 func (a *regexArrayFlags) String() string {
@@ -36,60 +55,420 @@ func (a *regexArrayFlags) Set(value string) error {
 }
 
 func main() {
-	name := flags.String("name", "COMPLAINER_NAME", monitor.DefaultName, "complainer name to use (default is implicit)")
+	rateLimit := flags.Int("rate-limit", "COMPLAINER_RATE_LIMIT", 0, "maximum number of reports per reporter instance in rate limit interval (0 is unlimited)")
+	rateLimitInterval := flags.Duration("rate-limit-interval", "COMPLAINER_RATE_LIMIT_INTERVAL", time.Minute, "rate limit interval")
+	failureCountWindow := flags.Duration("failure-count-window", "COMPLAINER_FAILURE_COUNT_WINDOW", time.Hour, "window to count failures of tasks with the same name in (0 is disabled)")
+	coalesceWindow := flags.Duration("coalesce-window", "COMPLAINER_COALESCE_WINDOW", 0, "window to coalesce repeated failures of tasks with the same name (0 is disabled)")
+	dryRun := flags.Bool("dry-run", "COMPLAINER_DRY_RUN", false, "log messages of reporters instead of sending them")
+	dryRunSkipUpload := flags.Bool("dry-run-skip-upload", "COMPLAINER_DRY_RUN_SKIP_UPLOAD", false, "skip uploading logs in dry-run mode")
+	logFormat := flags.String("log-format", "COMPLAINER_LOG_FORMAT", "text", "log format: text or json")
+	name := flags.String("name", "COMPLAINER_NAME", monitor.DefaultName, "complainer names to use, separated by comma (default is implicit)")
 	d := flags.Bool("default", "COMPLAINER_DEFAULT", true, "whether to use implicit default reporters")
-	u := flags.String("uploader", "COMPLAINER_UPLOADER", "", "uploader to use (example: s3aws,s3goamz,noop)")
+	u := flags.String("uploader", "COMPLAINER_UPLOADER", "noop", "uploader to use (example: s3aws,s3goamz,noop)")
 	r := flags.String("reporters", "COMPLAINER_REPORTERS", "", "reporters to use (example: sentry,hipchat,slack,file)")
 	masters := flags.String("masters", "COMPLAINER_MASTERS", "", "list of master urls: http://host:port,http://host:port")
+	mesosUsername := flags.String("mesos-username", "COMPLAINER_MESOS_USERNAME", "", "username for mesos http basic authentication")
+	mesosPassword := flags.String("mesos-password", "COMPLAINER_MESOS_PASSWORD", "", "password for mesos http basic authentication")
+	mesosCAFile := flags.String("mesos-ca-file", "COMPLAINER_MESOS_CA_FILE", "", "ca certificate file to verify mesos tls certificates, switches agents to https")
+	mesosCertFile := flags.String("mesos-cert-file", "COMPLAINER_MESOS_CERT_FILE", "", "client certificate file for mesos mutual tls, switches agents to https")
+	mesosKeyFile := flags.String("mesos-key-file", "COMPLAINER_MESOS_KEY_FILE", "", "client key file for mesos mutual tls, switches agents to https")
+	mesosAgentPort := flags.Int("mesos-agent-port", "COMPLAINER_MESOS_AGENT_PORT", mesos.DefaultAgentPort, "port to contact mesos agents on")
+	mesosAgentPid := flags.Bool("mesos-agent-address-from-pid", "COMPLAINER_MESOS_AGENT_ADDRESS_FROM_PID", false, "contact mesos agents on the address from their pid instead of hostname and agent port")
+	mesosRegistrationWindow := flags.Duration("mesos-registration-window", "COMPLAINER_MESOS_REGISTRATION_WINDOW", 0, "window after master election or framework registration to ignore replayed failures in (0 is disabled)")
+	mesosLogProxy := flags.String("mesos-log-proxy-url", "COMPLAINER_MESOS_LOG_PROXY_URL", "", "base url of complainer http interface to link logs that are not uploaded through")
+	httpDialTimeout := flags.Duration("http-dial-timeout", "COMPLAINER_HTTP_DIAL_TIMEOUT", httpclient.DefaultDialTimeout, "timeout of establishing outbound http connections")
+	httpTLSHandshakeTimeout := flags.Duration("http-tls-handshake-timeout", "COMPLAINER_HTTP_TLS_HANDSHAKE_TIMEOUT", httpclient.DefaultTLSHandshakeTimeout, "timeout of tls handshakes of outbound http connections")
+	httpResponseHeaderTimeout := flags.Duration("http-response-header-timeout", "COMPLAINER_HTTP_RESPONSE_HEADER_TIMEOUT", httpclient.DefaultResponseHeaderTimeout, "timeout of waiting for response headers of outbound http requests")
+	httpMaxIdleConnsPerHost := flags.Int("http-max-idle-conns-per-host", "COMPLAINER_HTTP_MAX_IDLE_CONNS_PER_HOST", httpclient.DefaultMaxIdleConnsPerHost, "number of idle outbound http connections kept per host")
+	userAgent := flags.String("user-agent", "COMPLAINER_USER_AGENT", "", "user agent of outbound http requests, followed by complainer names (default is complainer/<version>)")
+	mesosProxy := flags.String("mesos-proxy", "COMPLAINER_MESOS_PROXY", "", "proxy url for requests to mesos, direct to ignore proxy env variables")
+	reportersProxy := flags.String("reporters-proxy", "COMPLAINER_REPORTERS_PROXY", "", "proxy url for requests of reporters, direct to ignore proxy env variables")
+	uploaderProxy := flags.String("uploader-proxy", "COMPLAINER_UPLOADER_PROXY", "", "proxy url for requests of the uploader, direct to ignore proxy env variables")
+	mesosInsecure := flags.Bool("mesos-insecure-skip-verify", "COMPLAINER_MESOS_INSECURE_SKIP_VERIFY", false, "skip verification of mesos tls certificates, switches agents to https")
+	logBytes := flags.Int("log-bytes", "COMPLAINER_LOG_BYTES", 0, "fetch only this many last bytes of logs for uploader (0 is unlimited)")
+	logLines := flags.Int("log-lines", "COMPLAINER_LOG_LINES", 0, "fetch only this many last lines of logs for uploader (0 is unlimited)")
+	logHead := flags.Bool("log-head", "COMPLAINER_LOG_HEAD", false, "fetch the first bytes and lines of logs for uploader instead of the last ones")
+	minLogBytes := flags.Int("min-log-bytes", "COMPLAINER_MIN_LOG_BYTES", 0, "wait for stdout and stderr to have at least this many bytes together before reporting (0 is disabled)")
+	minLogRetries := flags.Int("min-log-retries", "COMPLAINER_MIN_LOG_RETRIES", monitor.DefaultMinLogRetries, "how many times to check the size of small logs again")
+	minLogDelay := flags.Duration("min-log-delay", "COMPLAINER_MIN_LOG_DELAY", monitor.DefaultMinLogDelay, "delay between checks of the size of small logs")
+	stderrTailLines := flags.Int("stderr-tail-lines", "COMPLAINER_STDERR_TAIL_LINES", 0, "number of last stderr lines available to reporters (0 is disabled)")
+	stderrTailBytes := flags.Int("stderr-tail-bytes", "COMPLAINER_STDERR_TAIL_BYTES", monitor.DefaultStderrTailBytes, "maximum size of stderr tail available to reporters")
+	failureStates := flags.String("failure-states", "COMPLAINER_FAILURE_STATES", strings.Join(mesos.DefaultFailureStates, ","), "list of task states considered failures")
 	listen := flags.String("listen", "COMPLAINER_LISTEN", "", "http listen address")
+	metricsListen := flags.String("metrics-listen", "COMPLAINER_METRICS_LISTEN", "", "separate http listen address for prometheus metrics")
+	healthThreshold := flags.Duration("health-threshold", "COMPLAINER_HEALTH_THRESHOLD", monitor.DefaultHealthThreshold, "maximum age of the last successful run to be considered healthy")
+	retryAttempts := flags.Int("retry-attempts", "COMPLAINER_RETRY_ATTEMPTS", monitor.DefaultRetryAttempts, "maximum number of attempts to send a report")
+	uploadAttempts := flags.Int("upload-attempts", "COMPLAINER_UPLOAD_ATTEMPTS", monitor.DefaultUploadAttempts, "maximum number of attempts to upload logs")
+	uploadFallback := flags.Bool("upload-fallback", "COMPLAINER_UPLOAD_FALLBACK", false, "report failures with mesos log urls if logs cannot be uploaded")
+	retryMaxDelay := flags.Duration("retry-max-delay", "COMPLAINER_RETRY_MAX_DELAY", monitor.DefaultRetryMaxDelay, "maximum delay between attempts to send a report")
+	stateFile := flags.String("state-file", "COMPLAINER_STATE_FILE", "", "file to persist seen failures across restarts")
+	seenTimeout := flags.Duration("seen-timeout", "COMPLAINER_SEEN_TIMEOUT", monitor.DefaultSeenTimeout, "how long seen failures are remembered")
+	staleTimeout := flags.Duration("stale-timeout", "COMPLAINER_STALE_TIMEOUT", monitor.DefaultStaleTimeout, "how old failures can be before they are skipped as stale")
+	configFile := flags.String("config-file", "COMPLAINER_CONFIG_FILE", "", "yaml file with default reporter instances and config")
+	templateTimezone := flags.String("template-timezone", "COMPLAINER_TEMPLATE_TIMEZONE", "UTC", "timezone of times formatted in templates (example: Europe/London)")
+	templateReloadInterval := flags.Duration("template-reload-interval", "COMPLAINER_TEMPLATE_RELOAD_INTERVAL", 0, "interval to read template files again at (0 is only on SIGHUP)")
+	strictEnv := flags.Bool("strict-env", "COMPLAINER_STRICT_ENV", false, "fail reports if labels reference environment variables that are not set")
+	leaderLockFile := flags.String("leader-lock-file", "COMPLAINER_LEADER_LOCK_FILE", "", "shared file for leader election between complainer replicas")
+	leaderLockTTL := flags.Duration("leader-lock-ttl", "COMPLAINER_LEADER_LOCK_TTL", time.Minute, "how long the leader lock is valid without renewal")
+	pollInterval := flags.Duration("poll-interval", "COMPLAINER_POLL_INTERVAL", time.Second*5, "delay between runs")
+	pollJitter := flags.Duration("poll-jitter", "COMPLAINER_POLL_JITTER", 0, "maximum random delay added to poll interval")
+	shutdownTimeout := flags.Duration("shutdown-timeout", "COMPLAINER_SHUTDOWN_TIMEOUT", time.Second*30, "how long to wait for the current run to finish on shutdown")
+	reportTimeout := flags.Duration("report-timeout", "COMPLAINER_REPORT_TIMEOUT", monitor.DefaultReportTimeout, "timeout of a single report attempt (0 is unlimited)")
+	reportTimeouts := flags.String("report-timeouts", "COMPLAINER_REPORT_TIMEOUTS", "", "report timeouts of specific reporters (example: slack=10s,jira=1m)")
+	resolveWindow := flags.Duration("resolve-window", "COMPLAINER_RESOLVE_WINDOW", 0, "how long to wait for tasks to recover to resolve reported failures (0 is disabled)")
+	selfTest := flags.Bool("self-test", "COMPLAINER_SELF_TEST", false, "send a test report through the uploader and all reporters and exit")
+	selfTestInterval := flags.Duration("self-test-interval", "COMPLAINER_SELF_TEST_INTERVAL", 0, "interval to send test reports at as a heartbeat (0 is disabled)")
+	firstRun := flags.String("first-run", "COMPLAINER_FIRST_RUN", monitor.FirstRunSuppressAll, "how to treat failures on the first run without seen failures: suppress-all, suppress-old or report-all")
+	firstRunWindow := flags.Duration("first-run-window", "COMPLAINER_FIRST_RUN_WINDOW", monitor.DefaultStaleTimeout, "failures finished within this window are reported on the first run with suppress-old")
+	dedupStrategy := flags.String("dedup-strategy", "COMPLAINER_DEDUP_STRATEGY", "id", "how to detect repeated failures: id or content (framework, task name and finished time)")
+	dedupPrecision := flags.Duration("dedup-precision", "COMPLAINER_DEDUP_PRECISION", time.Minute, "finished times of failures closer than this are the same with content dedup strategy")
+	dedup := flags.Bool("dedup-destinations", "COMPLAINER_DEDUP_DESTINATIONS", false, "send a single report to reporter instances with the same destination")
+	validate := flags.String("validate", "COMPLAINER_VALIDATE", "off", "validate uploader and reporter config at startup: off, warn or strict")
+	concurrency := flags.Int("concurrency", "COMPLAINER_CONCURRENCY", monitor.DefaultConcurrency, "maximum number of reports sent concurrently for a failure")
+	reporterOrder := flags.String("reporter-order", "COMPLAINER_REPORTER_ORDER", "", "comma separated list of reporters to send reports with first")
+	reporterStop := flags.Bool("reporter-stop-on-success", "COMPLAINER_REPORTER_STOP_ON_SUCCESS", false, "send reports one by one in order and stop after the first successful one")
 	var whitelist regexArrayFlags
 	var blacklist regexArrayFlags
+	var taskWhitelist regexArrayFlags
+	var taskBlacklist regexArrayFlags
+	var redactPatterns regexArrayFlags
 	flag.Var(&whitelist, "framework-whitelist", "list of regexes that if a framework name matches, will be reported")
 	flag.Var(&blacklist, "framework-blacklist", "list of regexes that if a framework name matches, is ignored")
+	flag.Var(&taskWhitelist, "task-whitelist", "list of regexes that if a task name matches, will be reported")
+	flag.Var(&taskBlacklist, "task-blacklist", "list of regexes that if a task name matches, is ignored")
+	redactSecrets := flags.Bool("redact", "COMPLAINER_REDACT", false, "replace secrets in logs with *** before upload")
+	flag.Var(&redactPatterns, "redact-pattern", "list of extra regexes of secrets to redact, only the first group is replaced if present")
+
+	version := flag.Bool("version", false, "print version and exit")
 
 	uploader.RegisterFlags()
 	reporter.RegisterFlags()
 
 	flag.Parse()
 
+	if *version {
+		fmt.Println(complainer.Version)
+		os.Exit(0)
+	}
+
+	if err := logging.SetFormat(*logFormat); err != nil {
+		log.Fatalf("Cannot set log format: %s", err)
+	}
+
 	if *u == "" || *r == "" || *masters == "" {
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
 
-	um, err := uploader.MakerByName(*u)
-	if err != nil {
-		log.Fatalf("Cannot create uploader by name %q: %s", *u, err)
+	httpclient.Configure(httpclient.Settings{
+		DialTimeout:           *httpDialTimeout,
+		TLSHandshakeTimeout:   *httpTLSHandshakeTimeout,
+		ResponseHeaderTimeout: *httpResponseHeaderTimeout,
+		MaxIdleConnsPerHost:   *httpMaxIdleConnsPerHost,
+		UserAgent:             userAgentWithNames(*userAgent, *name),
+	})
+
+	for component, proxy := range map[string]string{httpclient.Mesos: *mesosProxy, httpclient.Reporters: *reportersProxy, httpclient.Uploaders: *uploaderProxy} {
+		if err := httpclient.SetProxy(component, proxy); err != nil {
+			logging.Fatal(fmt.Sprintf("Cannot set proxy: %s", err), logging.Fields{"error": err})
+		}
+	}
+
+	if *staleTimeout > *seenTimeout {
+		logging.Fatal(fmt.Sprintf("Stale timeout (%s) cannot be longer than seen timeout (%s)", *staleTimeout, *seenTimeout), nil)
+	}
+
+	if *pollInterval <= 0 || *pollJitter < 0 {
+		logging.Fatal(fmt.Sprintf("Poll interval (%s) must be positive and poll jitter (%s) cannot be negative", *pollInterval, *pollJitter), nil)
+	}
+
+	if *pollInterval+*pollJitter >= *staleTimeout {
+		logging.Fatal(fmt.Sprintf("Poll interval (%s) with jitter (%s) must be shorter than stale timeout (%s)", *pollInterval, *pollJitter, *staleTimeout), nil)
 	}
 
-	up, err := um.Make()
+	if err := reporter.SetTemplateTimezone(*templateTimezone); err != nil {
+		logging.Fatal(fmt.Sprintf("Cannot load template timezone %q: %s", *templateTimezone, err), logging.Fields{"error": err})
+	}
+
+	reporter.SetTemplateReloadInterval(*templateReloadInterval)
+
+	up, err := uploader.NewUploader(*u)
 	if err != nil {
 		flag.PrintDefaults()
-		log.Fatalf("Cannot create uploader by name %q: %s", *u, err)
+		logging.Fatal(fmt.Sprintf("Cannot create uploader by name %q: %s", *u, err), logging.Fields{"error": err})
 	}
 
 	reporters, err := makeReporters(*r)
 	if err != nil {
-		log.Fatalf("Cannot create requested reporters: %s", err)
+		logging.Fatal(fmt.Sprintf("Cannot create requested reporters: %s", err), logging.Fields{"error": err})
 	}
 
-	matcher := matcher.RegexMatcher{Whitelist: whitelist, Blacklist: blacklist}
+	matcher := matcher.RegexMatcher{
+		Whitelist:     whitelist,
+		Blacklist:     blacklist,
+		TaskWhitelist: taskWhitelist,
+		TaskBlacklist: taskBlacklist,
+	}
 	cluster := mesos.NewCluster(strings.Split(*masters, ","))
+	cluster.SetFailureStates(strings.Split(*failureStates, ","))
+	cluster.SetCredentials(*mesosUsername, *mesosPassword)
+	cluster.SetAgentPort(*mesosAgentPort)
+	cluster.SetAgentAddressFromPid(*mesosAgentPid)
+	cluster.SetLogProxy(*mesosLogProxy)
+	cluster.SetRegistrationWindow(*mesosRegistrationWindow)
+
+	if *mesosCAFile != "" || *mesosCertFile != "" || *mesosKeyFile != "" || *mesosInsecure {
+		if err := cluster.SetTLS(*mesosCAFile, *mesosCertFile, *mesosKeyFile, *mesosInsecure); err != nil {
+			logging.Fatal(fmt.Sprintf("Cannot configure mesos tls: %s", err), logging.Fields{"error": err})
+		}
+	}
+
+	cluster.SetLogLimit(*logBytes, *logLines)
+	cluster.SetLogHead(*logHead)
+	uploader.SetDownloader(cluster.Download)
 
-	m := monitor.NewMonitor(*name, cluster, up, reporters, *d, &matcher)
+	var redactor *redact.Redactor
+	if *redactSecrets {
+		redactor = redact.NewDefaultRedactor(redactPatterns)
+		uploader.SetDownloader(func(ctx context.Context, url string) ([]byte, error) {
+			data, err := cluster.Download(ctx, url)
+			if err != nil {
+				return nil, err
+			}
+
+			return redactor.Redact(data), nil
+		})
+	}
+
+	var store state.Store
+	if *stateFile != "" {
+		store = state.NewFileStore(*stateFile)
+	}
+
+	names := strings.Split(*name, ",")
+
+	m := monitor.NewMonitor(names[0], cluster, up, reporters, *d, &matcher, store)
+	m.SetNames(names)
+
+	if err := m.SetFirstRun(*firstRun, *firstRunWindow); err != nil {
+		logging.Fatal(fmt.Sprintf("Cannot set first run mode: %s", err), logging.Fields{"error": err})
+	}
+
+	switch *dedupStrategy {
+	case "id":
+	case "content":
+		if *dedupPrecision <= 0 {
+			logging.Fatal(fmt.Sprintf("Dedup precision (%s) must be positive", *dedupPrecision), nil)
+		}
+
+		m.SetContentDedup(*dedupPrecision)
+	default:
+		logging.Fatal(fmt.Sprintf("Unknown dedup strategy %q, expected id or content", *dedupStrategy), nil)
+	}
+	m.SetTimeouts(*seenTimeout, *staleTimeout)
+	m.SetConcurrency(*concurrency)
+	m.SetReporterOrder(strings.Split(*reporterOrder, ","), *reporterStop)
+	m.SetRetry(*retryAttempts, *retryMaxDelay)
+	m.SetUploadRetry(*uploadAttempts, *uploadFallback)
+
+	timeouts, err := parseReportTimeouts(*reportTimeouts)
+	if err != nil {
+		logging.Fatal(fmt.Sprintf("Cannot parse report timeouts: %s", err), logging.Fields{"error": err})
+	}
+
+	m.SetReportTimeout(*reportTimeout, timeouts)
+	m.SetStderrTail(*stderrTailLines, *stderrTailBytes)
+	m.SetRedactor(redactor)
+	m.SetMinLogSize(int64(*minLogBytes), *minLogRetries, *minLogDelay)
+	m.SetHealthThreshold(*healthThreshold)
+	m.SetDryRun(*dryRun, *dryRunSkipUpload)
+	m.SetRateLimit(*rateLimit, *rateLimitInterval)
+	m.SetCoalesceWindow(*coalesceWindow)
+	m.SetFailureCountWindow(*failureCountWindow)
+	m.SetStrictEnv(*strictEnv)
+	m.SetDedup(*dedup)
+	m.SetResolveWindow(*resolveWindow)
+
+	var lock election.Lock
+	if *leaderLockFile != "" {
+		if *leaderLockTTL <= *pollInterval+*pollJitter {
+			logging.Fatal(fmt.Sprintf("Leader lock ttl (%s) must be longer than poll interval (%s) with jitter (%s)", *leaderLockTTL, *pollInterval, *pollJitter), nil)
+		}
+
+		lock = election.NewFileLock(*leaderLockFile, lockHolder(), *leaderLockTTL)
+		m.SetLock(lock)
+	}
+
+	if *configFile != "" {
+		f, err := config.Load(*configFile)
+		if err != nil {
+			logging.Fatal(fmt.Sprintf("Cannot load config file %s: %s", *configFile, err), logging.Fields{"error": err})
+		}
+
+		m.SetConfigFile(f)
+	}
+
+	validateConfig(m, *validate)
+
+	if *selfTest {
+		if err := m.SelfTest(context.Background()); err != nil {
+			logging.Fatal(fmt.Sprintf("Self test failed: %s", err), logging.Fields{"error": err})
+		}
+
+		logging.Info("Self test passed", nil)
+		return
+	}
 
 	serve(m, *listen)
+	serveMetrics(*metricsListen)
+
+	reloads := make(chan os.Signal, 1)
+	signal.Notify(reloads, syscall.SIGHUP)
+	go reload(reloads, m, *configFile)
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopping := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		run(ctx, m, *pollInterval, *pollJitter, *selfTestInterval, stopping)
+	}()
+
+	sig := <-signals
+	logging.Info(fmt.Sprintf("Received %s, waiting up to %s for the current run to finish", sig, *shutdownTimeout), nil)
+	close(stopping)
+
+	select {
+	case <-done:
+		release(lock)
+		logging.Info("Shut down gracefully", nil)
+		return
+	case <-time.After(*shutdownTimeout):
+		logging.Warning(fmt.Sprintf("Current run did not finish in %s, cancelling it", *shutdownTimeout), nil)
+	case sig = <-signals:
+		logging.Warning(fmt.Sprintf("Received %s again, cancelling the current run", sig), nil)
+	}
+
+	cancel()
+
+	// Cancelled run still saves recently seen failures before returning
+	select {
+	case <-done:
+		release(lock)
+	case <-time.After(shutdownCancelTimeout):
+		logging.Warning(fmt.Sprintf("Cancelled run did not finish in %s, exiting anyway", shutdownCancelTimeout), nil)
+	}
+}
+
+// validateConfig checks config of the uploader and reporters, in strict
+// mode complainer refuses to start if anything is broken
+func validateConfig(m *monitor.Monitor, mode string) {
+	switch mode {
+	case "off":
+		return
+	case "warn", "strict":
+	default:
+		logging.Fatal(fmt.Sprintf("Unknown validation mode %q, expected off, warn or strict", mode), nil)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), validateTimeout)
+	defer cancel()
+
+	errs := m.Validate(ctx)
+	for _, err := range errs {
+		logging.Error(fmt.Sprintf("Invalid config of %s", err), logging.Fields{"error": err})
+	}
+
+	if len(errs) > 0 && mode == "strict" {
+		logging.Fatal(fmt.Sprintf("Refusing to start with %d config errors", len(errs)), nil)
+	}
+}
+
+// reload reads the config file and template files again on every received
+// signal, broken config file is logged and the previous one is kept
+func reload(signals <-chan os.Signal, m *monitor.Monitor, configFile string) {
+	for sig := range signals {
+		logging.Info(fmt.Sprintf("Received %s, reloading config", sig), nil)
+		reporter.ReloadTemplateFiles()
+
+		if configFile == "" {
+			continue
+		}
+
+		f, err := config.Load(configFile)
+		if err != nil {
+			logging.Error(fmt.Sprintf("Cannot reload config file %s, keeping the previous one: %s", configFile, err), logging.Fields{"error": err})
+			continue
+		}
+
+		m.Reload(f)
+	}
+}
+
+// lockHolder returns the identity of this instance for leader election
+func lockHolder() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return fmt.Sprintf("%s/%d", hostname, os.Getpid())
+}
+
+// release gives up leadership on shutdown, so standby can take over
+func release(lock election.Lock) {
+	if lock == nil {
+		return
+	}
+
+	if err := lock.Release(); err != nil {
+		logging.Error(fmt.Sprintf("Error releasing leader lock: %s", err), logging.Fields{"error": err})
+	}
+}
+
+// run runs the monitor until stopping is closed, the current run
+// is not interrupted by stopping, only by the context being done.
+// Runs are separated by interval with up to jitter of random delay.
+// The leader sends a test report after runs once heartbeat passes.
+func run(ctx context.Context, m *monitor.Monitor, interval, jitter, heartbeat time.Duration, stopping <-chan struct{}) {
+	rand.Seed(time.Now().UnixNano())
+
+	tested := time.Time{}
 
 	for {
-		err := m.Run()
+		err := m.Run(ctx)
 		if err != nil {
-			log.Printf("Error running monitor: %s", err)
+			logging.Error(fmt.Sprintf("Error running monitor: %s", err), logging.Fields{"error": err})
 		}
 
-		time.Sleep(time.Second * 5)
+		if heartbeat > 0 && m.Leader() && time.Since(tested) >= heartbeat {
+			tested = time.Now()
+			if err := m.SelfTest(ctx); err != nil {
+				logging.Error(fmt.Sprintf("Self test failed: %s", err), logging.Fields{"error": err})
+			}
+		}
+
+		select {
+		case <-stopping:
+			return
+		case <-time.After(pollDelay(interval, jitter)):
+		}
 	}
 }
 
+// pollDelay returns the interval with random jitter added
+func pollDelay(interval, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return interval
+	}
+
+	return interval + time.Duration(rand.Int63n(int64(jitter)))
+}
+
 func serve(m *monitor.Monitor, listen string) {
 	if listen != "" || os.Getenv("PORT") != "" {
 		if listen == "" {
@@ -97,30 +476,75 @@ func serve(m *monitor.Monitor, listen string) {
 		}
 
 		go func() {
-			log.Printf("Serving http on %s", listen)
+			logging.Info(fmt.Sprintf("Serving http on %s", listen), nil)
 			if err := m.ListenAndServe(listen); err != nil {
-				log.Fatalf("Error serving: %s", err)
+				logging.Fatal(fmt.Sprintf("Error serving: %s", err), logging.Fields{"error": err})
 			}
 		}()
 	}
 }
 
+func serveMetrics(listen string) {
+	if listen == "" {
+		return
+	}
+
+	go func() {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+
+		logging.Info(fmt.Sprintf("Serving metrics on %s", listen), nil)
+		if err := http.ListenAndServe(listen, mux); err != nil {
+			logging.Fatal(fmt.Sprintf("Error serving metrics: %s", err), logging.Fields{"error": err})
+		}
+	}()
+}
+
 func makeReporters(requested string) (map[string]reporter.Reporter, error) {
 	reporters := map[string]reporter.Reporter{}
 
 	for _, n := range strings.Split(requested, ",") {
-		maker, err := reporter.MakerByName(n)
+		r, err := reporter.NewReporter(n)
 		if err != nil {
 			return nil, fmt.Errorf("cannot create reporter by name %q: %s", n, err)
 		}
 
-		r, err := maker.Make()
+		reporters[n] = r
+	}
+
+	return reporters, nil
+}
+
+// parseReportTimeouts parses reporter=timeout pairs separated by commas
+func parseReportTimeouts(value string) (map[string]time.Duration, error) {
+	timeouts := map[string]time.Duration{}
+	if value == "" {
+		return timeouts, nil
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid report timeout %q, expected reporter=timeout", pair)
+		}
+
+		timeout, err := time.ParseDuration(parts[1])
 		if err != nil {
-			return nil, fmt.Errorf("cannot create reporter by name %q: %s", n, err)
+			return nil, fmt.Errorf("invalid report timeout for %s: %s", parts[0], err)
 		}
 
-		reporters[n] = r
+		timeouts[parts[0]] = timeout
 	}
 
-	return reporters, nil
+	return timeouts, nil
+}
+
+// userAgentWithNames returns the user agent of outbound requests, which
+// identifies the version and names of complainer making them
+func userAgentWithNames(userAgent, names string) string {
+	if userAgent == "" {
+		userAgent = "complainer/" + complainer.Version
+	}
+
+	return fmt.Sprintf("%s (%s)", userAgent, names)
 }
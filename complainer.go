@@ -5,19 +5,63 @@ import (
 	"time"
 )
 
+// Version is the version of complainer, set at build time with
+// -ldflags "-X github.com/cloudflare/complainer.Version=v1.2.3"
+var Version = "dev"
+
 // Failure represents a failed Mesos task
 type Failure struct {
-	ID        string
-	Name      string
-	Slave     string
-	Framework string
-	Image     string
-	State     string
-	Started   time.Time
-	Finished  time.Time
-	Labels    map[string]string
+	ID         string
+	Name       string
+	Slave      string
+	Framework  string
+	Image      string
+	State      string
+	Reason     string
+	Message    string
+	Started    time.Time
+	Finished   time.Time
+	Labels     map[string]string
+	StderrTail string
+
+	// TaskLabels are labels of the task without complainer config labels
+	TaskLabels map[string]string
+	// Attributes are attributes of the agent the task ran on
+	Attributes map[string]string
+
+	// AgentID is the ID of the Mesos agent, its hostname is in Slave
+	AgentID string
+	// ExecutorID is the ID of the executor, empty for command tasks
+	ExecutorID string
+	// ContainerID is the ID of the container the task ran in
+	ContainerID string
+	// SandboxURL is the link to browse the sandbox of the task
+	// in the Mesos web interface of the leading master
+	SandboxURL string
+
+	// Complainer is the name of the complainer instance reporting the failure
+	Complainer string
+	// Cluster is the name of the Mesos cluster set on masters with --cluster
+	Cluster string
+	// Master is the url of the leading Mesos master the failure is from
+	Master string
+
+	// Occurrences is the number of failures of the task since the last
+	// report, it is more than one when repeated failures are coalesced
+	Occurrences int
+
+	// FailureCount is the number of failures of tasks with the same name
+	// within the failure count window, including this one
+	FailureCount int
+
+	// Test is set for synthetic failures of self tests
+	Test bool
 }
 
 func (f Failure) String() string {
+	if f.Test {
+		return fmt.Sprintf("[test] %s (%s) from %s", f.Name, f.ID, f.Slave)
+	}
+
 	return fmt.Sprintf("%s (%s) from %s", f.Name, f.ID, f.Slave)
 }
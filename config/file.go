@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/cloudflare/complainer/label"
+	"gopkg.in/yaml.v2"
+)
+
+// File holds default reporter config loaded from a yaml file:
+//
+//	slack:
+//	  instances: [default, ops]
+//	  hook_url: https://hooks.slack.com/services/...
+//	  channel: "#alerts"
+//	  instance:
+//	    ops:
+//	      channel: "#ops"
+//
+// Values at the top level of the reporter belong to the default instance,
+// named instances inherit them the same way as with labels.
+type File struct {
+	reporters map[string]fileReporter
+}
+
+type fileReporter struct {
+	Instances []string                     `yaml:"instances"`
+	Instance  map[string]map[string]string `yaml:"instance"`
+	Values    map[string]string            `yaml:",inline"`
+}
+
+// Load reads the config file from the path
+func Load(path string) (*File, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(b)
+}
+
+// Parse parses the config file contents
+func Parse(b []byte) (*File, error) {
+	reporters := map[string]fileReporter{}
+	if err := yaml.Unmarshal(b, &reporters); err != nil {
+		return nil, fmt.Errorf("cannot parse config file: %s", err)
+	}
+
+	return &File{reporters: reporters}, nil
+}
+
+// Instances returns default instances of the specific reporter,
+// the second value tells whether they are listed at all
+func (f *File) Instances(reporter string) ([]string, bool) {
+	r, ok := f.reporters[reporter]
+	if !ok || r.Instances == nil {
+		return nil, false
+	}
+
+	return r.Instances, true
+}
+
+// InstanceLabel returns config value for the specific reporter instance,
+// falling back to the value of the default instance
+func (f *File) InstanceLabel(reporter, instance, name string) string {
+	r := f.reporters[reporter]
+
+	if value := r.Instance[instance][name]; value != "" {
+		return value
+	}
+
+	if instance != label.DefaultInstance {
+		if value := r.Instance[label.DefaultInstance][name]; value != "" {
+			return value
+		}
+	}
+
+	return r.Values[name]
+}
+
+// InstanceKeys returns sorted names of the keys set for the specific
+// reporter instance, including keys inherited from the default instance
+func (f *File) InstanceKeys(reporter, instance string) []string {
+	r := f.reporters[reporter]
+
+	seen := map[string]bool{}
+	for _, values := range []map[string]string{r.Values, r.Instance[label.DefaultInstance], r.Instance[instance]} {
+		for name, value := range values {
+			if value != "" {
+				seen[name] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
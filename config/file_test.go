@@ -0,0 +1,69 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cloudflare/complainer/label"
+)
+
+func TestFile(t *testing.T) {
+	f, err := Parse([]byte(`
+slack:
+  instances: [default, ops]
+  hook_url: https://hooks.slack.com/abc
+  channel: "#alerts"
+  instance:
+    ops:
+      channel: "#ops"
+sentry:
+  dsn: https://sentry.example.com/1
+datadog:
+  instances: []
+  tags: 1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instances := map[string][]string{
+		"slack":   {label.DefaultInstance, "ops"},
+		"datadog": {},
+	}
+
+	for reporter, expected := range instances {
+		got, ok := f.Instances(reporter)
+		if !ok || !reflect.DeepEqual(expected, got) {
+			t.Errorf("invalid instances for %s; expected: %v, got: %v", reporter, expected, got)
+		}
+	}
+
+	if _, ok := f.Instances("sentry"); ok {
+		t.Errorf("sentry instances are not expected to be listed")
+	}
+
+	values := []struct {
+		reporter string
+		instance string
+		name     string
+		expected string
+	}{
+		{"slack", label.DefaultInstance, "channel", "#alerts"},
+		{"slack", "ops", "channel", "#ops"},
+		{"slack", "ops", "hook_url", "https://hooks.slack.com/abc"},
+		{"sentry", label.DefaultInstance, "dsn", "https://sentry.example.com/1"},
+		{"datadog", label.DefaultInstance, "tags", "1"},
+		{"hipchat", label.DefaultInstance, "room", ""},
+	}
+
+	for _, row := range values {
+		if got := f.InstanceLabel(row.reporter, row.instance, row.name); got != row.expected {
+			t.Errorf("invalid value for %s [instance=%s, key=%s]; expected: %q, got: %q", row.reporter, row.instance, row.name, row.expected, got)
+		}
+	}
+
+	expected := []string{"channel", "hook_url"}
+	if got := f.InstanceKeys("slack", "ops"); !reflect.DeepEqual(expected, got) {
+		t.Errorf("invalid instance keys; expected: %v, got: %v", expected, got)
+	}
+}
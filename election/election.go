@@ -0,0 +1,14 @@
+package election
+
+import "context"
+
+// Lock is held by at most one complainer instance at a time, the holder
+// of the lock is the leader and the only instance reporting failures
+type Lock interface {
+	// Acquire takes the lock or renews it if it is already held,
+	// returning whether the lock is held by this instance
+	Acquire(ctx context.Context) (bool, error)
+	// Release gives up the lock if it is held by this instance,
+	// so standby instances can take over without waiting
+	Release() error
+}
@@ -0,0 +1,120 @@
+package election
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileLock is a lease stored in a file shared by complainer instances.
+// The lease is taken over by another instance if the holder does not
+// renew it within the ttl, for example when the holder dies or hangs.
+type FileLock struct {
+	path   string
+	holder string
+	ttl    time.Duration
+}
+
+type fileLease struct {
+	Holder  string    `json:"holder"`
+	Expires time.Time `json:"expires"`
+}
+
+// NewFileLock creates a new file lock with the provided file path,
+// holder uniquely identifies this instance among the competing ones
+func NewFileLock(path, holder string, ttl time.Duration) *FileLock {
+	return &FileLock{
+		path:   path,
+		holder: holder,
+		ttl:    ttl,
+	}
+}
+
+// Acquire takes the lease if it is missing, expired or held by us
+func (l *FileLock) Acquire(ctx context.Context) (bool, error) {
+	lease, err := l.read()
+	if err != nil {
+		return false, err
+	}
+
+	if lease != nil && lease.Holder != l.holder && time.Now().Before(lease.Expires) {
+		return false, nil
+	}
+
+	if err = l.write(fileLease{Holder: l.holder, Expires: time.Now().Add(l.ttl)}); err != nil {
+		return false, err
+	}
+
+	// Another instance could have taken the expired lease at the same time,
+	// the last write wins and the other instance backs off
+	lease, err = l.read()
+	if err != nil {
+		return false, err
+	}
+
+	return lease != nil && lease.Holder == l.holder, nil
+}
+
+// Release removes the lease if it is held by us
+func (l *FileLock) Release() error {
+	lease, err := l.read()
+	if err != nil {
+		return err
+	}
+
+	if lease == nil || lease.Holder != l.holder {
+		return nil
+	}
+
+	err = os.Remove(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+// read returns the current lease, nil is returned if there is none
+func (l *FileLock) read() (*fileLease, error) {
+	b, err := ioutil.ReadFile(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	lease := &fileLease{}
+
+	return lease, json.Unmarshal(b, lease)
+}
+
+// write replaces the lease atomically
+func (l *FileLock) write(lease fileLease) error {
+	b, err := json.Marshal(lease)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(l.path), filepath.Base(l.path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.Write(b); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return err
+	}
+
+	if err = f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), l.path)
+}
@@ -0,0 +1,78 @@
+package election
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "complainer-election")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	path := filepath.Join(dir, "leader.json")
+
+	first := NewFileLock(path, "first", time.Hour)
+	second := NewFileLock(path, "second", time.Hour)
+
+	expect := func(l *FileLock, expected bool) {
+		leader, err := l.Acquire(context.Background())
+		if err != nil {
+			t.Fatalf("error acquiring lock for %s: %s", l.holder, err)
+		}
+
+		if leader != expected {
+			t.Errorf("unexpected leadership of %s; expected: %v, got: %v", l.holder, expected, leader)
+		}
+	}
+
+	expect(first, true)
+	expect(second, false)
+
+	// Renewal keeps the lock
+	expect(first, true)
+
+	// Release by the standby does not affect the leader
+	if err = second.Release(); err != nil {
+		t.Fatal(err)
+	}
+
+	expect(second, false)
+
+	if err = first.Release(); err != nil {
+		t.Fatal(err)
+	}
+
+	expect(second, true)
+	expect(first, false)
+}
+
+func TestFileLockExpired(t *testing.T) {
+	dir, err := ioutil.TempDir("", "complainer-election")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	path := filepath.Join(dir, "leader.json")
+
+	if leader, err := NewFileLock(path, "dead", -time.Second).Acquire(context.Background()); err != nil || !leader {
+		t.Fatalf("expected dead instance to take the lock, got: %v, %v", leader, err)
+	}
+
+	if leader, err := NewFileLock(path, "standby", time.Hour).Acquire(context.Background()); err != nil || !leader {
+		t.Errorf("expected standby to take over expired lock, got: %v, %v", leader, err)
+	}
+}
@@ -22,6 +22,23 @@ func Bool(name, env string, fallback bool, help string) *bool {
 	return flag.Bool(name, value, help)
 }
 
+// Int registers a flag and returns the pointer to the resulting int.
+// The default value is passed as fallback and env sets the env variable
+// that can override the default.
+func Int(name, env string, fallback int, help string) *int {
+	value := fallback
+	if v := os.Getenv(env); v != "" {
+		vv, err := strconv.Atoi(v)
+		if err != nil {
+			log.Fatalf("Error parsing int from env variable %s: %s", env, v)
+		}
+
+		value = vv
+	}
+
+	return flag.Int(name, value, help)
+}
+
 // String registers a flag and returns the pointer to the resulting string.
 // The default value is passed as fallback and env sets the env variable
 // that can override the default.
@@ -0,0 +1,208 @@
+// Package googleauth gets oauth2 access tokens for google cloud apis,
+// either for a service account from json key file or from the metadata
+// server when complainer runs on google cloud
+package googleauth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/complainer/httpclient"
+)
+
+// metadataTokenURL is the metadata server endpoint for default credentials
+var metadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+const (
+	defaultTokenURL     = "https://oauth2.googleapis.com/token"
+	tokenExpiryLeeway   = time.Minute
+	serviceAccountGrant = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+)
+
+// ServiceAccount is the subset of service account json key file
+type ServiceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+	ProjectID   string `json:"project_id"`
+
+	// Key is the parsed private key
+	Key *rsa.PrivateKey `json:"-"`
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// TokenSource returns oauth2 access tokens, caching them until expiration
+type TokenSource struct {
+	account *ServiceAccount
+	scope   string
+	client  http.Client
+	token   string
+	expires time.Time
+	mu      sync.Mutex
+}
+
+// ReadServiceAccount reads and validates service account json key file
+func ReadServiceAccount(file string) (*ServiceAccount, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	account := &ServiceAccount{}
+	if err = json.Unmarshal(b, account); err != nil {
+		return nil, fmt.Errorf("cannot decode service account file %s: %s", file, err)
+	}
+
+	if account.ClientEmail == "" || account.PrivateKey == "" {
+		return nil, fmt.Errorf("service account file %s is incomplete", file)
+	}
+
+	if account.TokenURI == "" {
+		account.TokenURI = defaultTokenURL
+	}
+
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if block == nil {
+		return nil, errors.New("cannot decode service account private key")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse service account private key: %s", err)
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("service account private key is not rsa")
+	}
+
+	account.Key = key
+
+	return account, nil
+}
+
+// Sign returns RSA SHA256 signature of the data
+func (a *ServiceAccount) Sign(data []byte) ([]byte, error) {
+	sum := sha256.Sum256(data)
+	return rsa.SignPKCS1v15(rand.Reader, a.Key, crypto.SHA256, sum[:])
+}
+
+// NewTokenSource returns token source for the scope, the metadata server
+// is used if account is nil. Requests are made with the http client
+// of the component, see httpclient package.
+func NewTokenSource(account *ServiceAccount, scope, component string) *TokenSource {
+	return &TokenSource{
+		account: account,
+		scope:   scope,
+		client: http.Client{
+			Transport: httpclient.Transport(component),
+			Timeout:   time.Second * 30,
+		},
+	}
+}
+
+// Token returns valid access token, service account is used if present,
+// otherwise the token is requested from the metadata server
+func (s *TokenSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && time.Now().Add(tokenExpiryLeeway).Before(s.expires) {
+		return s.token, nil
+	}
+
+	var resp *http.Response
+	var err error
+
+	if s.account != nil {
+		resp, err = s.serviceAccountToken()
+	} else {
+		resp, err = s.metadataToken()
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("cannot get google access token, status %d: %s", resp.StatusCode, body)
+	}
+
+	token := tokenResponse{}
+	if err = json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+
+	s.token = token.AccessToken
+	s.expires = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+
+	return s.token, nil
+}
+
+func (s *TokenSource) metadataToken() (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, metadataTokenURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	return s.client.Do(req)
+}
+
+func (s *TokenSource) serviceAccountToken() (*http.Response, error) {
+	now := time.Now()
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   s.account.ClientEmail,
+		"scope": s.scope,
+		"aud":   s.account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	signature, err := s.account.Sign([]byte(unsigned))
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type": {serviceAccountGrant},
+		"assertion":  {unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)},
+	}
+
+	return s.client.Post(s.account.TokenURI, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+}
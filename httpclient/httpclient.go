@@ -0,0 +1,236 @@
+// Package httpclient builds http clients for outbound requests of
+// complainer components, so proxies and timeouts are configured
+// in one place and connections are reused across requests
+package httpclient
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// Mesos is the component talking to mesos masters and agents
+	Mesos = "mesos"
+	// Reporters is the component sending reports
+	Reporters = "reporters"
+	// Uploaders is the component uploading logs
+	Uploaders = "uploaders"
+
+	// Direct is the proxy to connect directly, ignoring proxy env variables
+	Direct = "direct"
+
+	// DefaultDialTimeout bounds establishing connections
+	DefaultDialTimeout = time.Second * 10
+	// DefaultTLSHandshakeTimeout bounds tls handshakes
+	DefaultTLSHandshakeTimeout = time.Second * 10
+	// DefaultResponseHeaderTimeout bounds waiting for response headers
+	// after the request is sent, servers hanging forever hold connections
+	DefaultResponseHeaderTimeout = time.Second * 30
+	// DefaultMaxIdleConnsPerHost is the number of idle connections kept per
+	// host, bursts of reports to the same service reuse them instead of
+	// opening new connections each time
+	DefaultMaxIdleConnsPerHost = 16
+	// DefaultUserAgent is sent with requests unless configured otherwise
+	DefaultUserAgent = "complainer"
+)
+
+// Settings tune transports of http clients
+type Settings struct {
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	MaxIdleConnsPerHost   int
+	UserAgent             string
+}
+
+// DefaultSettings are used for transports unless changed with Configure
+var DefaultSettings = Settings{
+	DialTimeout:           DefaultDialTimeout,
+	TLSHandshakeTimeout:   DefaultTLSHandshakeTimeout,
+	ResponseHeaderTimeout: DefaultResponseHeaderTimeout,
+	MaxIdleConnsPerHost:   DefaultMaxIdleConnsPerHost,
+	UserAgent:             DefaultUserAgent,
+}
+
+// shared keeps transport settings, explicit proxies of components and
+// clients shared by components. Components without explicit proxy
+// use HTTP_PROXY, HTTPS_PROXY and NO_PROXY env variables.
+var shared = struct {
+	sync.Mutex
+	settings Settings
+	urls     map[string]*url.URL
+	clients  map[string]*http.Client
+}{
+	settings: DefaultSettings,
+	urls:     map[string]*url.URL{},
+	clients:  map[string]*http.Client{},
+}
+
+// Configure sets transport settings, zero values keep defaults. It should
+// be called at startup, clients made before keep their settings.
+func Configure(settings Settings) {
+	if settings.DialTimeout <= 0 {
+		settings.DialTimeout = DefaultDialTimeout
+	}
+
+	if settings.TLSHandshakeTimeout <= 0 {
+		settings.TLSHandshakeTimeout = DefaultTLSHandshakeTimeout
+	}
+
+	if settings.ResponseHeaderTimeout <= 0 {
+		settings.ResponseHeaderTimeout = DefaultResponseHeaderTimeout
+	}
+
+	if settings.MaxIdleConnsPerHost <= 0 {
+		settings.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	}
+
+	if settings.UserAgent == "" {
+		settings.UserAgent = DefaultUserAgent
+	}
+
+	shared.Lock()
+	defer shared.Unlock()
+
+	shared.settings = settings
+	shared.clients = map[string]*http.Client{}
+}
+
+// SetProxy sets the proxy url for requests of the component, Direct
+// disables proxies, empty proxy means proxy from environment variables
+func SetProxy(component, proxy string) error {
+	var u *url.URL
+
+	switch proxy {
+	case "":
+	case Direct:
+		u = &url.URL{}
+	default:
+		parsed, err := url.Parse(proxy)
+		if err != nil {
+			return fmt.Errorf("invalid proxy url for %s: %s", component, err)
+		}
+
+		if parsed.Scheme == "" || parsed.Host == "" {
+			return fmt.Errorf("invalid proxy url for %s: %q is not absolute", component, proxy)
+		}
+
+		u = parsed
+	}
+
+	shared.Lock()
+	defer shared.Unlock()
+
+	if u == nil {
+		delete(shared.urls, component)
+	} else {
+		shared.urls[component] = u
+	}
+
+	return nil
+}
+
+// Proxy returns the proxy function of the component for http.Transport
+func Proxy(component string) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		shared.Lock()
+		u, ok := shared.urls[component]
+		shared.Unlock()
+
+		if !ok {
+			return http.ProxyFromEnvironment(req)
+		}
+
+		if u.Host == "" {
+			return nil, nil
+		}
+
+		return u, nil
+	}
+}
+
+// NewTransport returns a new transport with the proxy of the component
+// and configured settings, for clients that need their own tls config.
+// Unlike http.DefaultTransport it does not wait for response headers forever.
+// Wrap it with WithUserAgent before use, so requests are identified.
+func NewTransport(component string) *http.Transport {
+	shared.Lock()
+	settings := shared.settings
+	shared.Unlock()
+
+	return newTransport(component, settings)
+}
+
+func newTransport(component string, settings Settings) *http.Transport {
+	return &http.Transport{
+		Proxy: Proxy(component),
+		DialContext: (&net.Dialer{
+			Timeout:   settings.DialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   settings.MaxIdleConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   settings.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: settings.ResponseHeaderTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// WithUserAgent wraps the transport, so every request carries the configured
+// user agent. User agents set by libraries are kept after complainer's one.
+func WithUserAgent(transport *http.Transport) http.RoundTripper {
+	return &userAgentTransport{transport}
+}
+
+type userAgentTransport struct {
+	*http.Transport
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	shared.Lock()
+	userAgent := shared.settings.UserAgent
+	shared.Unlock()
+
+	if existing := req.Header.Get("User-Agent"); existing != "" {
+		userAgent += " " + existing
+	}
+
+	// Round trippers must not modify the request they are given
+	clone := new(http.Request)
+	*clone = *req
+
+	clone.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		clone.Header[k] = v
+	}
+
+	clone.Header.Set("User-Agent", userAgent)
+
+	return t.Transport.RoundTrip(clone)
+}
+
+// Transport returns the transport shared by the component, for clients
+// with their own timeouts, idle connections are reused across them
+func Transport(component string) http.RoundTripper {
+	return Client(component).Transport
+}
+
+// Client returns the client shared by the component. Clients are safe
+// for concurrent use, callers bound requests with contexts.
+func Client(component string) *http.Client {
+	shared.Lock()
+	defer shared.Unlock()
+
+	client, ok := shared.clients[component]
+	if !ok {
+		client = &http.Client{Transport: WithUserAgent(newTransport(component, shared.settings))}
+		shared.clients[component] = client
+	}
+
+	return client
+}
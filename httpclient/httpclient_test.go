@@ -0,0 +1,137 @@
+package httpclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestProxy(t *testing.T) {
+	os.Setenv("HTTP_PROXY", "http://env-proxy.example.com:3128")
+	defer os.Unsetenv("HTTP_PROXY")
+
+	defer func() {
+		for _, component := range []string{Mesos, Reporters, Uploaders} {
+			_ = SetProxy(component, "")
+		}
+	}()
+
+	if err := SetProxy(Reporters, "http://proxy.example.com:8080"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetProxy(Uploaders, Direct); err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "http://hooks.example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for component, expected := range map[string]string{Reporters: "http://proxy.example.com:8080", Uploaders: "", Mesos: "http://env-proxy.example.com:3128"} {
+		u, err := Proxy(component)(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		proxy := ""
+		if u != nil {
+			proxy = u.String()
+		}
+
+		if proxy != expected {
+			t.Errorf("unexpected proxy for %s; expected: %q, got: %q", component, expected, proxy)
+		}
+	}
+
+	for _, proxy := range []string{"proxy.example.com", "http://[::1"} {
+		if err := SetProxy(Mesos, proxy); err == nil {
+			t.Errorf("expected error for proxy %q", proxy)
+		}
+	}
+}
+
+func TestClientShared(t *testing.T) {
+	if Client(Reporters) != Client(Reporters) {
+		t.Error("expected the client of the component to be shared")
+	}
+
+	if Client(Reporters) == Client(Uploaders) {
+		t.Error("expected components to have separate clients")
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	defer Configure(Settings{})
+
+	Configure(Settings{ResponseHeaderTimeout: time.Second, MaxIdleConnsPerHost: 4})
+
+	wrapped, ok := Transport(Mesos).(*userAgentTransport)
+	if !ok {
+		t.Fatalf("unexpected transport: %T", Transport(Mesos))
+	}
+
+	transport := wrapped.Transport
+
+	if transport.ResponseHeaderTimeout != time.Second || transport.MaxIdleConnsPerHost != 4 || transport.TLSHandshakeTimeout != DefaultTLSHandshakeTimeout {
+		t.Errorf("unexpected transport settings: %+v", transport)
+	}
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Second * 2)
+	}))
+	defer slow.Close()
+
+	if _, err := Client(Mesos).Get(slow.URL); err == nil {
+		t.Error("expected error waiting for response headers")
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	defer Configure(Settings{})
+
+	agents := make(chan string, 2)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents <- r.Header.Get("User-Agent")
+	}))
+	defer server.Close()
+
+	Configure(Settings{UserAgent: "complainer/1.0 (default)"})
+
+	resp, err := Client(Reporters).Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = resp.Body.Close()
+
+	if agent := <-agents; agent != "complainer/1.0 (default)" {
+		t.Errorf("unexpected user agent: %q", agent)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("User-Agent", "aws-sdk-go/1.4.20")
+
+	resp, err = (&http.Client{Transport: WithUserAgent(NewTransport(Uploaders))}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = resp.Body.Close()
+
+	if agent := <-agents; agent != "complainer/1.0 (default) aws-sdk-go/1.4.20" {
+		t.Errorf("unexpected user agent: %q", agent)
+	}
+
+	if req.Header.Get("User-Agent") != "aws-sdk-go/1.4.20" {
+		t.Error("request of the caller is modified")
+	}
+}
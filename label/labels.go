@@ -2,6 +2,7 @@ package label
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
@@ -24,8 +25,41 @@ func NewLabels(complainer string, labels map[string]string, defaults bool) Label
 	}
 }
 
+// Complainer returns the name of the complainer instance
+func (l Labels) Complainer() string {
+	return l.complainer
+}
+
 // Instances returns configured instances of the specific reporter
 func (l Labels) Instances(reporter string) []string {
+	if instances, ok := l.ExplicitInstances(reporter); ok {
+		return instances
+	}
+
+	if l.defaults {
+		return []string{DefaultInstance}
+	}
+
+	return []string{}
+}
+
+// Mentioned tells whether any label is addressed to the complainer
+// instance, labels of the default instance can also skip its name
+func (l Labels) Mentioned() bool {
+	prefix := fmt.Sprintf("complainer_%s_", l.complainer)
+
+	for k := range l.labels {
+		if strings.HasPrefix(k, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ExplicitInstances returns instances of the specific reporter listed
+// in labels, the second value tells whether they are listed at all
+func (l Labels) ExplicitInstances(reporter string) ([]string, bool) {
 	keys := []string{fmt.Sprintf("complainer_%s_%s_instances", l.complainer, reporter)}
 
 	if l.complainer == DefaultInstance {
@@ -35,21 +69,77 @@ func (l Labels) Instances(reporter string) []string {
 	for _, k := range keys {
 		if instances, ok := l.labels[k]; ok {
 			if instances == "" {
-				return []string{}
+				return []string{}, true
 			}
-			return strings.Split(instances, ",")
+			return strings.Split(instances, ","), true
 		}
 	}
 
-	if l.defaults {
-		return []string{DefaultInstance}
+	return nil, false
+}
+
+// InstanceLabel returns label value for the specific reporter instance,
+// named instances inherit values of the default instance of the reporter
+func (l Labels) InstanceLabel(reporter, instance, name string) string {
+	for _, k := range l.keys(reporter, instance, name) {
+		if l.labels[k] != "" {
+			return l.labels[k]
+		}
 	}
 
-	return []string{}
+	if instance != DefaultInstance {
+		return l.InstanceLabel(reporter, DefaultInstance, name)
+	}
+
+	return ""
 }
 
-// InstanceLabel returns label value for the specific reporter instance
-func (l Labels) InstanceLabel(reporter, instance, name string) string {
+// Disabled tells whether the specific reporter instance is disabled
+// with the disable key. Disabling the default instance disables all
+// instances of the reporter, unless they are enabled explicitly.
+func (l Labels) Disabled(reporter, instance string) bool {
+	return l.InstanceLabel(reporter, instance, "disable") == "true"
+}
+
+// InstanceKeys returns sorted names of the keys set for the specific
+// reporter instance, including keys inherited from the default instance
+func (l Labels) InstanceKeys(reporter, instance string) []string {
+	instances := []string{instance}
+	if instance != DefaultInstance {
+		instances = append(instances, DefaultInstance)
+	}
+
+	seen := map[string]bool{}
+	for _, i := range instances {
+		for _, prefix := range l.keys(reporter, i, "") {
+			for k, v := range l.labels {
+				if v == "" || !strings.HasPrefix(k, prefix) {
+					continue
+				}
+
+				// Short prefixes match long forms of other instances
+				name := strings.TrimPrefix(k, prefix)
+				if name == "" || name == "instances" || strings.HasPrefix(name, "instance_") {
+					continue
+				}
+
+				seen[name] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// keys returns label names to look up in the order of preference
+func (l Labels) keys(reporter, instance, name string) []string {
 	// complainer_default_sentry_instance_default_dsn
 	keys := []string{fmt.Sprintf("complainer_%s_%s_instance_%s_%s", l.complainer, reporter, instance, name)}
 
@@ -68,13 +158,7 @@ func (l Labels) InstanceLabel(reporter, instance, name string) string {
 		keys = append(keys, fmt.Sprintf("complainer_%s_%s", reporter, name))
 	}
 
-	for _, k := range keys {
-		if l.labels[k] != "" {
-			return l.labels[k]
-		}
-	}
-
-	return ""
+	return keys
 }
 
 func (l Labels) String() string {
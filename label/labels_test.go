@@ -129,6 +129,40 @@ func TestTable(t *testing.T) {
 				},
 			},
 		},
+		{
+			complainer: "default",
+			labels: map[string]string{
+				"complainer_slack_instances": "default,ops",
+
+				"complainer_slack_hook_url": "https://hooks.slack.com/abc",
+				"complainer_slack_channel":  "#alerts",
+
+				"complainer_slack_instance_ops_channel": "#ops",
+			},
+			defaults: true,
+
+			instances: map[string][]string{
+				"slack": {DefaultInstance, "ops"},
+			},
+
+			configs: map[string]map[string]map[string]string{
+				"slack": {
+					DefaultInstance: {
+						"hook_url": "https://hooks.slack.com/abc",
+						"channel":  "#alerts",
+					},
+					"ops": {
+						"hook_url": "https://hooks.slack.com/abc",
+						"channel":  "#ops",
+					},
+				},
+				"sentry": {
+					"ops": {
+						"dsn": "",
+					},
+				},
+			},
+		},
 		{
 			complainer: "dogfood",
 			labels: map[string]string{
@@ -168,3 +202,67 @@ func TestTable(t *testing.T) {
 		}
 	}
 }
+
+func TestInstanceKeys(t *testing.T) {
+	l := NewLabels(DefaultInstance, map[string]string{
+		"complainer_slack_instances":            "default,ops",
+		"complainer_slack_hook_url":             "https://hooks.slack.com/abc",
+		"complainer_slack_instance_ops_channel": "#ops",
+		"complainer_slack_instance_dev_token":   "dev",
+		"complainer_sentry_dsn":                 "dsn",
+	}, true)
+
+	expected := []string{"channel", "hook_url"}
+	if got := l.InstanceKeys("slack", "ops"); !reflect.DeepEqual(expected, got) {
+		t.Errorf("invalid instance keys; expected: %v, got: %v", expected, got)
+	}
+
+	expected = []string{"hook_url"}
+	if got := l.InstanceKeys("slack", DefaultInstance); !reflect.DeepEqual(expected, got) {
+		t.Errorf("invalid instance keys; expected: %v, got: %v", expected, got)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	l := NewLabels(DefaultInstance, map[string]string{
+		"complainer_pagerduty_instances":             "default,ops",
+		"complainer_pagerduty_disable":               "true",
+		"complainer_pagerduty_instance_ops_disable":  "false",
+		"complainer_slack_instances":                 "default,ops",
+		"complainer_slack_instance_ops_disable":      "true",
+		"complainer_wow_sentry_disable":              "true",
+		"complainer_sentry_instance_default_disable": "nope",
+	}, true)
+
+	table := []struct {
+		reporter string
+		instance string
+		disabled bool
+	}{
+		{"pagerduty", DefaultInstance, true},
+		{"pagerduty", "ops", false},
+		{"slack", DefaultInstance, false},
+		{"slack", "ops", true},
+		{"sentry", DefaultInstance, false},
+		{"hipchat", DefaultInstance, false},
+	}
+
+	for _, row := range table {
+		if got := l.Disabled(row.reporter, row.instance); got != row.disabled {
+			t.Errorf("invalid disabled for %s [instance=%s]; expected: %v, got: %v", row.reporter, row.instance, row.disabled, got)
+		}
+	}
+}
+
+func TestMentioned(t *testing.T) {
+	labels := map[string]string{
+		"complainer_slack_hook_url":        "https://hooks.slack.com/services/default",
+		"complainer_team-a_slack_hook_url": "https://hooks.slack.com/services/team-a",
+	}
+
+	for complainer, expected := range map[string]bool{"team-a": true, "team-b": false, "team": false} {
+		if mentioned := NewLabels(complainer, labels, true).Mentioned(); mentioned != expected {
+			t.Errorf("unexpected mentioned for %s; expected: %v, got: %v", complainer, expected, mentioned)
+		}
+	}
+}
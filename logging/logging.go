@@ -0,0 +1,100 @@
+// Package logging implements leveled logging with fields, either
+// in the free-form text format of the standard logger or in JSON
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	jsonFormat bool
+	out        io.Writer = os.Stderr
+	mu         sync.Mutex
+)
+
+// Fields are extra values attached to log messages in JSON format
+type Fields map[string]interface{}
+
+// SetFormat sets logging format, either "text" (default) or "json".
+// JSON format applies to the standard logger as well.
+func SetFormat(format string) error {
+	switch format {
+	case "text":
+		jsonFormat = false
+		log.SetFlags(log.LstdFlags)
+		log.SetOutput(out)
+	case "json":
+		jsonFormat = true
+		log.SetFlags(0)
+		log.SetOutput(stdWriter{})
+	default:
+		return fmt.Errorf("unknown log format: %q", format)
+	}
+
+	return nil
+}
+
+// Info logs informational message
+func Info(message string, fields Fields) {
+	write("info", message, fields)
+}
+
+// Warning logs message about something that may need attention
+func Warning(message string, fields Fields) {
+	write("warning", message, fields)
+}
+
+// Error logs message about an error
+func Error(message string, fields Fields) {
+	write("error", message, fields)
+}
+
+// Fatal logs message about an error and exits
+func Fatal(message string, fields Fields) {
+	write("fatal", message, fields)
+	os.Exit(1)
+}
+
+func write(level, message string, fields Fields) {
+	if !jsonFormat {
+		log.Print(message)
+		return
+	}
+
+	entry := map[string]interface{}{}
+	for k, v := range fields {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+
+		entry[k] = v
+	}
+
+	entry["time"] = time.Now().Format(time.RFC3339Nano)
+	entry["level"] = level
+	entry["message"] = message
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		b, _ = json.Marshal(map[string]string{"level": level, "message": message})
+	}
+
+	mu.Lock()
+	_, _ = out.Write(append(b, '\n'))
+	mu.Unlock()
+}
+
+// stdWriter turns messages of the standard logger into JSON
+type stdWriter struct{}
+
+func (stdWriter) Write(p []byte) (int, error) {
+	write("info", strings.TrimSuffix(string(p), "\n"), nil)
+	return len(p), nil
+}
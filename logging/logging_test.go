@@ -0,0 +1,56 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	buf := bytes.NewBuffer([]byte{})
+	out = buf
+
+	defer func() {
+		out = os.Stderr
+		_ = SetFormat("text")
+	}()
+
+	if err := SetFormat("json"); err != nil {
+		t.Fatal(err)
+	}
+
+	Error("Cannot report", Fields{"failure_id": "task.1", "error": errors.New("boom")})
+	log.Printf("Serving http on %s", ":8080")
+
+	expected := []map[string]string{
+		{"level": "error", "message": "Cannot report", "failure_id": "task.1", "error": "boom"},
+		{"level": "info", "message": "Serving http on :8080"},
+	}
+
+	decoder := json.NewDecoder(buf)
+	for _, fields := range expected {
+		entry := map[string]string{}
+		if err := decoder.Decode(&entry); err != nil {
+			t.Fatalf("error decoding log entry: %s", err)
+		}
+
+		if entry["time"] == "" {
+			t.Errorf("expected time in log entry: %v", entry)
+		}
+
+		for k, v := range fields {
+			if entry[k] != v {
+				t.Errorf("unexpected %s in log entry; expected: %q, got: %q", k, v, entry[k])
+			}
+		}
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if err := SetFormat("xml"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
@@ -2,32 +2,42 @@ package matcher
 
 import (
 	"regexp"
+
+	"github.com/cloudflare/complainer"
 )
 
 // FailureMatcher is responsible for filtering out undesired Failures for reporting
 type FailureMatcher interface {
-	Match(string) bool
+	Match(failure complainer.Failure) bool
 }
 
 type NoopMatcher struct{}
 
-func (c *NoopMatcher) Match(_ string) bool { return true }
+func (c *NoopMatcher) Match(_ complainer.Failure) bool { return true }
 
+// RegexMatcher matches failures by framework and task names,
+// blacklists are applied first, then whitelists
 type RegexMatcher struct {
-	Whitelist []*regexp.Regexp
-	Blacklist []*regexp.Regexp
+	Whitelist     []*regexp.Regexp
+	Blacklist     []*regexp.Regexp
+	TaskWhitelist []*regexp.Regexp
+	TaskBlacklist []*regexp.Regexp
+}
+
+func (r *RegexMatcher) Match(failure complainer.Failure) bool {
+	return match(failure.Framework, r.Whitelist, r.Blacklist) && match(failure.Name, r.TaskWhitelist, r.TaskBlacklist)
 }
 
-func (r *RegexMatcher) Match(name string) bool {
-	for _, regex := range r.Blacklist {
+func match(name string, whitelist, blacklist []*regexp.Regexp) bool {
+	for _, regex := range blacklist {
 		if regex.MatchString(name) {
 			return false
 		}
 	}
-	for _, regex := range r.Whitelist {
+	for _, regex := range whitelist {
 		if regex.MatchString(name) {
 			return true
 		}
 	}
-	return len(r.Whitelist) == 0
+	return len(whitelist) == 0
 }
@@ -0,0 +1,65 @@
+package matcher
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestRegexMatcher(t *testing.T) {
+	matcher := RegexMatcher{
+		Whitelist:     []*regexp.Regexp{regexp.MustCompile("^marathon")},
+		Blacklist:     []*regexp.Regexp{regexp.MustCompile("^marathon-dev$")},
+		TaskWhitelist: []*regexp.Regexp{regexp.MustCompile("^web"), regexp.MustCompile("^db")},
+		TaskBlacklist: []*regexp.Regexp{regexp.MustCompile("canary")},
+	}
+
+	table := []struct {
+		framework string
+		name      string
+		expected  bool
+	}{
+		{
+			framework: "marathon",
+			name:      "web.frontend",
+			expected:  true,
+		},
+		{
+			framework: "marathon-prod",
+			name:      "db.postgres",
+			expected:  true,
+		},
+		{
+			framework: "marathon-dev",
+			name:      "web.frontend",
+			expected:  false,
+		},
+		{
+			framework: "chronos",
+			name:      "web.frontend",
+			expected:  false,
+		},
+		{
+			framework: "marathon",
+			name:      "cache.redis",
+			expected:  false,
+		},
+		{
+			framework: "marathon",
+			name:      "web.frontend-canary",
+			expected:  false,
+		},
+	}
+
+	for _, row := range table {
+		failure := complainer.Failure{Framework: row.framework, Name: row.name}
+		if got := matcher.Match(failure); got != row.expected {
+			t.Errorf("invalid match for %s from %s; expected: %v, got: %v", row.name, row.framework, row.expected, got)
+		}
+	}
+
+	if !(&RegexMatcher{}).Match(complainer.Failure{Framework: "marathon", Name: "web"}) {
+		t.Error("empty matcher is expected to match everything")
+	}
+}
@@ -1,16 +1,25 @@
 package mesos
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
+	"path"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/httpclient"
+	"github.com/cloudflare/complainer/logging"
 )
 
 // ErrNoMesosMaster indicates that no alive mesos masters are found
@@ -18,12 +27,43 @@ var ErrNoMesosMaster = errors.New("mesos master not found")
 
 const (
 	unknownState = "UNKNOWN"
+
+	// DefaultAgentPort is the port mesos agents listen on by default
+	DefaultAgentPort = 5051
 )
 
+// DefaultFailureStates is the list of task states considered failures by default.
+// States like TASK_KILLED and TASK_FINISHED are usually caused by frameworks
+// intentionally, so they are not reported unless explicitly requested.
+var DefaultFailureStates = []string{"TASK_FAILED", "TASK_ERROR", "TASK_LOST"}
+
+// HealthyTask is a task seen running or finished successfully
+type HealthyTask struct {
+	ID        string
+	Name      string
+	Framework string
+	Started   time.Time
+}
+
 // Cluster represents Mesos cluster
 type Cluster struct {
-	masters []string
-	client  http.Client
+	masters       []string
+	leader        string
+	mutex         sync.Mutex
+	client        http.Client
+	agentScheme   string
+	agentPort     int
+	pidAddress    bool
+	agents        map[string]string
+	logProxy      string
+	username      string
+	password      string
+	logBytes      int
+	logLines      int
+	logHead       bool
+	failureStates map[string]bool
+	registration  time.Duration
+	healthy       []HealthyTask
 }
 
 // NewCluster creates a new cluster with the provided list of masters
@@ -33,73 +73,294 @@ func NewCluster(masters []string) *Cluster {
 		cleanMasters = append(cleanMasters, strings.TrimSuffix(master, "/"))
 	}
 
-	return &Cluster{
+	cluster := &Cluster{
 		masters: cleanMasters,
 		client: http.Client{
-			Timeout: time.Second * 30,
+			Transport: httpclient.Transport(httpclient.Mesos),
+			Timeout:   time.Second * 30,
 		},
+		agentScheme: "http",
+		agentPort:   DefaultAgentPort,
 	}
+
+	cluster.SetFailureStates(DefaultFailureStates)
+
+	return cluster
 }
 
-// Failures returns the list of known failes tasks
-func (c *Cluster) Failures() ([]complainer.Failure, error) {
-	state := &masterState{}
+// SetCredentials sets credentials for http basic authentication,
+// used for both master and agent requests
+func (c *Cluster) SetCredentials(username, password string) {
+	c.username = username
+	c.password = password
+}
 
-	for _, master := range c.masters {
-		resp, err := c.client.Get(master + "/master/state")
+// SetAgentPort sets the port to contact mesos agents on
+func (c *Cluster) SetAgentPort(port int) {
+	c.agentPort = port
+}
+
+// SetAgentAddressFromPid makes agents contacted on the address from their
+// pid in the master state (ex: slave(1)@10.0.0.1:5051) instead of their
+// hostname and agent port, for agents with hostnames that do not resolve
+func (c *Cluster) SetAgentAddressFromPid(enabled bool) {
+	c.pidAddress = enabled
+}
+
+// SetTLS configures tls for both master and agent requests. Agents are
+// contacted over https after this is called. Custom CA certificate is
+// loaded from caFile, client certificate and key are loaded from certFile
+// and keyFile for mutual tls. Empty paths are ignored.
+func (c *Cluster) SetTLS(caFile, certFile, keyFile string, insecureSkipVerify bool) error {
+	config := &tls.Config{
+		InsecureSkipVerify: insecureSkipVerify,
+	}
+
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
 		if err != nil {
-			log.Printf("Error fetching state from %s: %s", master, err)
-			continue
+			return fmt.Errorf("cannot read ca certificate: %s", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", caFile)
 		}
 
-		defer func() {
-			_ = resp.Body.Close()
-		}()
+		config.RootCAs = pool
+	}
 
-		err = json.NewDecoder(resp.Body).Decode(state)
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
 		if err != nil {
-			log.Printf("Error decoding state from %s: %s", master, err)
+			return fmt.Errorf("cannot load client certificate: %s", err)
+		}
+
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := httpclient.NewTransport(httpclient.Mesos)
+	transport.TLSClientConfig = config
+
+	c.client.Transport = httpclient.WithUserAgent(transport)
+
+	c.agentScheme = "https"
+
+	return nil
+}
+
+// SetFailureStates sets the list of task states considered failures
+func (c *Cluster) SetFailureStates(states []string) {
+	c.failureStates = map[string]bool{}
+	for _, state := range states {
+		c.failureStates[strings.TrimSpace(state)] = true
+	}
+}
+
+// SetRegistrationWindow makes failures ignored while the leading master was
+// elected or the framework of the task (re)registered within the window,
+// when masters replay old completed tasks after failover. Zero disables it.
+func (c *Cluster) SetRegistrationWindow(window time.Duration) {
+	c.registration = window
+}
+
+// Failures returns the list of known failes tasks. Masters are tried in order,
+// starting with the last known leader. When a master is not the leader,
+// the leader it knows about is asked instead. Requests are cancelled
+// when the context is done.
+func (c *Cluster) Failures(ctx context.Context) ([]complainer.Failure, error) {
+	for _, master := range c.candidates() {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		state, err := c.masterState(ctx, master)
+		if err != nil {
+			logging.Error(fmt.Sprintf("Error fetching state from %s: %s", master, err), logging.Fields{"master": master, "error": err})
 			continue
 		}
 
 		if state.Pid != state.Leader {
-			continue
+			leader := leaderURL(master, state)
+			if leader == "" || leader == master {
+				continue
+			}
+
+			state, err = c.masterState(ctx, leader)
+			if err != nil {
+				logging.Error(fmt.Sprintf("Error fetching state from leader %s: %s", leader, err), logging.Fields{"master": leader, "error": err})
+				continue
+			}
+
+			if state.Pid != state.Leader {
+				continue
+			}
+
+			master = leader
 		}
 
-		return c.failuresFromLeader(state), nil
+		c.mutex.Lock()
+		c.leader = master
+		c.healthy = healthyFromLeader(state)
+		c.agents = c.agentAddrs(state)
+		c.mutex.Unlock()
+
+		failures := c.failuresFromLeader(state)
+		for i := range failures {
+			failures[i].Master = master
+		}
+
+		return failures, nil
 	}
 
 	return nil, ErrNoMesosMaster
 }
 
+// Healthy returns tasks that were running or finished successfully
+// in the state fetched from the leader by the last call to Failures
+func (c *Cluster) Healthy() []HealthyTask {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.healthy
+}
+
+// Ping checks that at least one of the masters is reachable and healthy
+func (c *Cluster) Ping(ctx context.Context) error {
+	for _, master := range c.candidates() {
+		resp, err := c.get(ctx, master+"/master/health")
+		if err != nil {
+			continue
+		}
+
+		_ = resp.Body.Close()
+
+		if resp.StatusCode == http.StatusOK {
+			return nil
+		}
+	}
+
+	return ErrNoMesosMaster
+}
+
+// candidates returns the list of masters to try, last known leader first
+func (c *Cluster) candidates() []string {
+	c.mutex.Lock()
+	leader := c.leader
+	c.mutex.Unlock()
+
+	if leader == "" {
+		return c.masters
+	}
+
+	candidates := []string{leader}
+	for _, master := range c.masters {
+		if master != leader {
+			candidates = append(candidates, master)
+		}
+	}
+
+	return candidates
+}
+
+func (c *Cluster) masterState(ctx context.Context, master string) (*masterState, error) {
+	resp, err := c.get(ctx, master+"/master/state")
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+
+	state, err := decodeMasterState(resp.Body, c.failureStates)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode state: %s", err)
+	}
+
+	return state, nil
+}
+
+// leaderURL returns the url of the leader known to the master,
+// keeping the scheme of the master url
+func leaderURL(master string, state *masterState) string {
+	if state.LeaderInfo.Hostname == "" || state.LeaderInfo.Port == 0 {
+		return ""
+	}
+
+	u, err := url.Parse(master)
+	if err != nil {
+		return ""
+	}
+
+	return (&url.URL{
+		Scheme: u.Scheme,
+		Host:   fmt.Sprintf("%s:%d", state.LeaderInfo.Hostname, state.LeaderInfo.Port),
+	}).String()
+}
+
 func (c *Cluster) failuresFromLeader(state *masterState) []complainer.Failure {
 	failures := []complainer.Failure{}
 
 	hosts := map[string]string{}
+	attributes := map[string]map[string]string{}
 	for _, slave := range state.Slaves {
 		hosts[slave.ID] = slave.Host
+		attributes[slave.ID] = slaveAttributes(slave)
+	}
+
+	// Task state shadows the master state below
+	name := state.Cluster
+	now := time.Now()
+
+	if c.recentlyRegistered(state.ElectedTime, now) {
+		logging.Info("Ignoring failures from the master that was elected recently", logging.Fields{"elected_time": unixTime(state.ElectedTime)})
+		return failures
 	}
 
 	for _, framework := range state.Frameworks {
+		if c.recentlyRegistered(framework.RegisteredTime, now) || c.recentlyRegistered(framework.ReregisteredTime, now) {
+			logging.Info(fmt.Sprintf("Ignoring failures from framework %s that registered recently", framework.Name), logging.Fields{"framework": framework.Name})
+			continue
+		}
+
 		for _, task := range framework.CompletedTasks {
-			if task.State != "TASK_FAILED" && task.State != "TASK_ERROR" && task.State != "TASK_LOST" {
+			if !c.failureStates[task.State] {
 				continue
 			}
 
 			labels := map[string]string{}
+			taskLabels := map[string]string{}
 			for _, label := range task.Labels {
 				labels[label.Key] = label.Value
+				if !strings.HasPrefix(label.Key, "complainer_") {
+					taskLabels[label.Key] = label.Value
+				}
 			}
 
 			// The following is to handle the case where mesos tasks don't have any statuses
 			var startedAt int64
 			var finishedAt int64
 			var state = unknownState
+			var reason, message, containerID string
+
+			for _, status := range task.Statuses {
+				if status.ContainerStatus.ContainerID.Value != "" {
+					containerID = status.ContainerStatus.ContainerID.Value
+				}
+			}
 
 			if len(task.Statuses) > 0 {
+				last := task.Statuses[len(task.Statuses)-1]
 				startedAt = int64(task.Statuses[0].Timestamp)
-				finishedAt = int64(task.Statuses[len(task.Statuses)-1].Timestamp)
-				state = task.Statuses[len(task.Statuses)-1].State
+				finishedAt = int64(last.Timestamp)
+				state = last.State
+				reason = last.Reason
+				message = last.Message
 			}
 
 			failures = append(failures, complainer.Failure{
@@ -109,9 +370,22 @@ func (c *Cluster) failuresFromLeader(state *masterState) []complainer.Failure {
 				Framework: framework.Name,
 				Image:     task.Container.Docker.Image,
 				State:     state,
+				Reason:    reason,
+				Message:   message,
 				Started:   time.Unix(startedAt, 0),
 				Finished:  time.Unix(finishedAt, 0),
 				Labels:    labels,
+
+				TaskLabels: taskLabels,
+				Attributes: attributes[task.SlaveID],
+
+				AgentID:     task.SlaveID,
+				ExecutorID:  task.ExecutorID,
+				ContainerID: containerID,
+
+				Cluster: name,
+
+				Occurrences: 1,
 			})
 		}
 	}
@@ -119,9 +393,89 @@ func (c *Cluster) failuresFromLeader(state *masterState) []complainer.Failure {
 	return failures
 }
 
+// recentlyRegistered returns whether the registration window is enabled
+// and the timestamp from the master state is within the window
+func (c *Cluster) recentlyRegistered(timestamp float64, now time.Time) bool {
+	return c.registration > 0 && timestamp > 0 && now.Sub(unixTime(timestamp)) < c.registration
+}
+
+// unixTime converts a timestamp in fractional seconds from the master state
+func unixTime(timestamp float64) time.Time {
+	return time.Unix(0, int64(timestamp*float64(time.Second)))
+}
+
+func healthyFromLeader(state *masterState) []HealthyTask {
+	healthy := []HealthyTask{}
+
+	for _, framework := range state.Frameworks {
+		for _, task := range append(framework.Tasks, framework.CompletedTasks...) {
+			if !healthyTask(task) {
+				continue
+			}
+
+			healthy = append(healthy, HealthyTask{
+				ID:        task.ID,
+				Name:      task.Name,
+				Framework: framework.Name,
+				Started:   time.Unix(int64(task.Statuses[0].Timestamp), 0),
+			})
+		}
+	}
+
+	return healthy
+}
+
+// healthyTask returns whether the task is running or finished successfully
+func healthyTask(task masterTask) bool {
+	return len(task.Statuses) > 0 && (task.State == "TASK_RUNNING" || task.State == "TASK_FINISHED")
+}
+
+// slaveAttributes returns attributes of the agent as strings,
+// scalar attributes are numbers in the state json
+func slaveAttributes(slave masterSlave) map[string]string {
+	attributes := map[string]string{}
+	for k, v := range slave.Attributes {
+		attributes[k] = fmt.Sprint(v)
+	}
+
+	return attributes
+}
+
+// agentAddrs returns addresses of agents from the master state by agent id
+func (c *Cluster) agentAddrs(state *masterState) map[string]string {
+	addrs := map[string]string{}
+	for _, slave := range state.Slaves {
+		addrs[slave.ID] = c.agentAddr(slave.Host)
+
+		if c.pidAddress {
+			if i := strings.LastIndex(slave.Pid, "@"); i >= 0 && i < len(slave.Pid)-1 {
+				addrs[slave.ID] = slave.Pid[i+1:]
+			}
+		}
+	}
+
+	return addrs
+}
+
+// failureAgentAddr returns the address of the agent the task ran on,
+// agents missing in the last master state are contacted by hostname
+func (c *Cluster) failureAgentAddr(failure complainer.Failure) string {
+	c.mutex.Lock()
+	addr, ok := c.agents[failure.AgentID]
+	c.mutex.Unlock()
+
+	if ok {
+		return addr
+	}
+
+	return c.agentAddr(failure.Slave)
+}
+
 // Logs returns stdout and stderr urls fot the specified task
-func (c *Cluster) Logs(failure complainer.Failure) (stdoutURL, stderrURL string, err error) {
-	state, err := c.slaveState(failure.Slave)
+func (c *Cluster) Logs(ctx context.Context, failure complainer.Failure) (stdoutURL, stderrURL string, err error) {
+	addr := c.failureAgentAddr(failure)
+
+	state, err := c.slaveState(ctx, addr)
 	if err != nil {
 		return "", "", err
 	}
@@ -131,8 +485,8 @@ func (c *Cluster) Logs(failure complainer.Failure) (stdoutURL, stderrURL string,
 		// that's why we need to look at current executors too.
 		for _, executor := range append(framework.Executors, framework.CompletedExecutors...) {
 			if executor.ID == failure.ID {
-				stdoutURL = sandboxURL(failure.Slave, executor.Directory, "stdout")
-				stderrURL = sandboxURL(failure.Slave, executor.Directory, "stderr")
+				stdoutURL = sandboxURL(c.agentScheme, addr, executor.Directory, "stdout")
+				stderrURL = sandboxURL(c.agentScheme, addr, executor.Directory, "stderr")
 
 				return stdoutURL, stderrURL, nil
 			}
@@ -142,10 +496,36 @@ func (c *Cluster) Logs(failure complainer.Failure) (stdoutURL, stderrURL string,
 	return "", "", fmt.Errorf("cannot find executor by ID (%s)", failure.ID)
 }
 
-func (c *Cluster) slaveState(host string) (*slaveState, error) {
+// SandboxURL returns the url to browse the sandbox of the task in the mesos
+// web interface of the leader, the sandbox directory is taken from the
+// stdout or stderr url returned by Logs. Empty string is returned if the
+// sandbox or the leader is not known.
+func (c *Cluster) SandboxURL(failure complainer.Failure, logURL string) string {
+	u, err := url.Parse(logURL)
+	if err != nil || failure.AgentID == "" {
+		return ""
+	}
+
+	directory := u.Query().Get("path")
+	if directory == "" {
+		return ""
+	}
+
+	c.mutex.Lock()
+	leader := c.leader
+	c.mutex.Unlock()
+
+	if leader == "" {
+		return ""
+	}
+
+	return leader + "/#/agents/" + url.PathEscape(failure.AgentID) + "/browse?path=" + url.QueryEscape(path.Dir(directory))
+}
+
+func (c *Cluster) slaveState(ctx context.Context, addr string) (*slaveState, error) {
 	state := &slaveState{}
 
-	resp, err := c.client.Get("http://" + host + ":5051/state")
+	resp, err := c.get(ctx, c.agentScheme+"://"+addr+"/state")
 	if err != nil {
 		return state, err
 	}
@@ -157,10 +537,32 @@ func (c *Cluster) slaveState(host string) (*slaveState, error) {
 	return state, json.NewDecoder(resp.Body).Decode(state)
 }
 
-func sandboxURL(host, directory, file string) string {
+// get makes a GET request with credentials if they are set,
+// the request is cancelled when the context is done
+func (c *Cluster) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.WithContext(ctx)
+
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	return c.client.Do(req)
+}
+
+// agentAddr returns the address of the agent api on the host
+func (c *Cluster) agentAddr(host string) string {
+	return net.JoinHostPort(host, strconv.Itoa(c.agentPort))
+}
+
+func sandboxURL(scheme, addr, directory, file string) string {
 	return (&url.URL{
-		Scheme:   "http",
-		Host:     host + ":5051",
+		Scheme:   scheme,
+		Host:     addr,
 		Path:     "files/download",
 		RawQuery: "path=" + directory + "/" + file,
 	}).String()
@@ -1,8 +1,30 @@
 package mesos
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
 )
 
 func TestNewCluster(t *testing.T) {
@@ -28,3 +50,643 @@ func TestNewCluster(t *testing.T) {
 		t.Errorf("Master list is not equal. Got %+v, expected %+v", cluster.masters, expectedMasters)
 	}
 }
+
+func TestFailureStates(t *testing.T) {
+	state := &masterState{
+		Frameworks: []masterFramework{
+			{
+				Name: "marathon",
+				CompletedTasks: []masterTask{
+					{ID: "failed", State: "TASK_FAILED"},
+					{ID: "killed", State: "TASK_KILLED"},
+					{ID: "finished", State: "TASK_FINISHED"},
+					{ID: "lost", State: "TASK_LOST"},
+				},
+			},
+		},
+	}
+
+	table := []struct {
+		states   []string
+		expected []string
+	}{
+		{
+			states:   DefaultFailureStates,
+			expected: []string{"failed", "lost"},
+		},
+		{
+			states:   []string{"TASK_FAILED", " TASK_KILLED"},
+			expected: []string{"failed", "killed"},
+		},
+	}
+
+	for _, row := range table {
+		cluster := NewCluster([]string{"http://master1.com"})
+		cluster.SetFailureStates(row.states)
+
+		got := []string{}
+		for _, failure := range cluster.failuresFromLeader(state) {
+			got = append(got, failure.ID)
+		}
+
+		if !reflect.DeepEqual(got, row.expected) {
+			t.Errorf("invalid failures for states %v; expected: %v, got: %v", row.states, row.expected, got)
+		}
+	}
+}
+
+func TestRegistrationWindow(t *testing.T) {
+	now := float64(time.Now().Unix())
+	old := now - 3600
+
+	state := &masterState{
+		ElectedTime: old,
+		Frameworks: []masterFramework{
+			{Name: "marathon", RegisteredTime: old, CompletedTasks: []masterTask{{ID: "web.1", State: "TASK_FAILED"}}},
+			{Name: "chronos", RegisteredTime: now - 10, CompletedTasks: []masterTask{{ID: "cron.1", State: "TASK_FAILED"}}},
+			{Name: "aurora", RegisteredTime: old, ReregisteredTime: now - 10, CompletedTasks: []masterTask{{ID: "job.1", State: "TASK_FAILED"}}},
+		},
+	}
+
+	cluster := NewCluster([]string{"http://master1.com"})
+
+	if failures := cluster.failuresFromLeader(state); len(failures) != 3 {
+		t.Errorf("expected all failures without registration window, got: %+v", failures)
+	}
+
+	cluster.SetRegistrationWindow(time.Minute)
+
+	if failures := cluster.failuresFromLeader(state); len(failures) != 1 || failures[0].ID != "web.1" {
+		t.Errorf("expected failures of recently registered frameworks to be ignored, got: %+v", failures)
+	}
+
+	state.ElectedTime = now - 10
+
+	if failures := cluster.failuresFromLeader(state); len(failures) != 0 {
+		t.Errorf("expected failures to be ignored after master election, got: %+v", failures)
+	}
+}
+
+func TestFailureLabelsAndAttributes(t *testing.T) {
+	state := &masterState{}
+	if err := json.Unmarshal([]byte(`{
+		"slaves": [{"id": "agent1", "hostname": "host1", "attributes": {"rack": "r1", "cores": 16}}],
+		"frameworks": [{
+			"name": "marathon",
+			"completed_tasks": [{
+				"id": "web.1",
+				"state": "TASK_FAILED",
+				"slave_id": "agent1",
+				"labels": [{"key": "team", "value": "ops"}, {"key": "complainer_slack_channel", "value": "#ops"}]
+			}]
+		}]
+	}`), state); err != nil {
+		t.Fatal(err)
+	}
+
+	failures := NewCluster([]string{"http://master1.com"}).failuresFromLeader(state)
+	if len(failures) != 1 {
+		t.Fatalf("expected one failure, got: %v", failures)
+	}
+
+	if expected := map[string]string{"team": "ops"}; !reflect.DeepEqual(failures[0].TaskLabels, expected) {
+		t.Errorf("unexpected task labels; expected: %v, got: %v", expected, failures[0].TaskLabels)
+	}
+
+	if len(failures[0].Labels) != 2 {
+		t.Errorf("expected all labels to be kept, got: %v", failures[0].Labels)
+	}
+
+	if expected := map[string]string{"rack": "r1", "cores": "16"}; !reflect.DeepEqual(failures[0].Attributes, expected) {
+		t.Errorf("unexpected attributes; expected: %v, got: %v", expected, failures[0].Attributes)
+	}
+}
+
+func TestFailureAgentMetadata(t *testing.T) {
+	state := &masterState{}
+	if err := json.Unmarshal([]byte(`{
+		"slaves": [{"id": "agent1", "hostname": "host1"}],
+		"frameworks": [{
+			"name": "marathon",
+			"completed_tasks": [{
+				"id": "web.1",
+				"state": "TASK_FAILED",
+				"slave_id": "agent1",
+				"executor_id": "executor1",
+				"statuses": [
+					{"state": "TASK_RUNNING", "container_status": {"container_id": {"value": "container1"}}},
+					{"state": "TASK_FAILED"}
+				]
+			}]
+		}]
+	}`), state); err != nil {
+		t.Fatal(err)
+	}
+
+	failures := NewCluster([]string{"http://master1.com"}).failuresFromLeader(state)
+	if len(failures) != 1 {
+		t.Fatalf("expected one failure, got: %v", failures)
+	}
+
+	f := failures[0]
+	if f.Slave != "host1" || f.AgentID != "agent1" || f.ExecutorID != "executor1" || f.ContainerID != "container1" {
+		t.Errorf("unexpected agent metadata: host=%s, agent=%s, executor=%s, container=%s", f.Slave, f.AgentID, f.ExecutorID, f.ContainerID)
+	}
+}
+
+func TestHealthyFromLeader(t *testing.T) {
+	state := &masterState{
+		Frameworks: []masterFramework{
+			{
+				Name: "marathon",
+				Tasks: []masterTask{
+					{ID: "running", Name: "web", State: "TASK_RUNNING", Statuses: []masterTaskStatus{{State: "TASK_RUNNING", Timestamp: 1480000000}}},
+					{ID: "staging", Name: "web", State: "TASK_STAGING", Statuses: []masterTaskStatus{{State: "TASK_STAGING"}}},
+				},
+				CompletedTasks: []masterTask{
+					{ID: "finished", Name: "cron", State: "TASK_FINISHED", Statuses: []masterTaskStatus{{State: "TASK_RUNNING", Timestamp: 1480000042}, {State: "TASK_FINISHED"}}},
+					{ID: "failed", Name: "cron", State: "TASK_FAILED", Statuses: []masterTaskStatus{{State: "TASK_FAILED"}}},
+				},
+			},
+		},
+	}
+
+	expected := []HealthyTask{
+		{ID: "running", Name: "web", Framework: "marathon", Started: time.Unix(1480000000, 0)},
+		{ID: "finished", Name: "cron", Framework: "marathon", Started: time.Unix(1480000042, 0)},
+	}
+
+	if healthy := healthyFromLeader(state); !reflect.DeepEqual(healthy, expected) {
+		t.Errorf("unexpected healthy tasks; expected: %+v, got: %+v", expected, healthy)
+	}
+}
+
+func TestFailover(t *testing.T) {
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(masterState{
+			Pid:     "master@leader",
+			Leader:  "master@leader",
+			Cluster: "prod",
+			Frameworks: []masterFramework{
+				{
+					Name:           "marathon",
+					CompletedTasks: []masterTask{{ID: "failed", State: "TASK_FAILED"}},
+				},
+			},
+		})
+	}))
+	defer leader.Close()
+
+	u, err := url.Parse(leader.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host, portString, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port, err := strconv.Atoi(portString)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	follower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(masterState{
+			Pid:        "master@follower",
+			Leader:     "master@leader",
+			LeaderInfo: masterInfo{Hostname: host, Port: port},
+		})
+	}))
+	defer follower.Close()
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	cluster := NewCluster([]string{down.URL, follower.URL})
+
+	failures, err := cluster.Failures(context.Background())
+	if err != nil {
+		t.Fatalf("error getting failures: %s", err)
+	}
+
+	if len(failures) != 1 || failures[0].ID != "failed" {
+		t.Errorf("unexpected failures: %+v", failures)
+	}
+
+	if failures[0].Master != leader.URL || failures[0].Cluster != "prod" {
+		t.Errorf("unexpected origin of the failure; master: %s, cluster: %s", failures[0].Master, failures[0].Cluster)
+	}
+
+	if cluster.leader != leader.URL {
+		t.Errorf("expected leader %s to be remembered, got %s", leader.URL, cluster.leader)
+	}
+
+	expected := []string{leader.URL, down.URL, follower.URL}
+	if got := cluster.candidates(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected candidates; expected: %v, got: %v", expected, got)
+	}
+
+	leader.Close()
+	follower.Close()
+
+	if _, err := cluster.Failures(context.Background()); err != ErrNoMesosMaster {
+		t.Errorf("expected %s when all masters are down, got %v", ErrNoMesosMaster, err)
+	}
+}
+
+func TestMalformedState(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{
+			"pid": "master@leader",
+			"leader": "master@leader",
+			"slaves": [{"id": "agent1", "hostname": "host1"}, {"id": "agent2", "hostname": 2}],
+			"frameworks": [
+				{
+					"name": "marathon",
+					"tasks": [{"id": "running", "statuses": "bogus"}],
+					"completed_tasks": [
+						{"id": "web.1", "state": "TASK_FAILED", "slave_id": "agent1"},
+						{"id": "web.2", "state": "TASK_FAILED", "statuses": [{"timestamp": "yesterday"}]},
+						{"id": 3, "state": "TASK_FAILED"},
+						{"id": "web.4", "state": "TASK_LOST", "labels": [{"key": "team", "value": "ops"}]}
+					]
+				},
+				{"name": {"nested": true}, "completed_tasks": [{"id": "lost.1", "state": "TASK_FAILED"}]},
+				{"name": "chronos", "completed_tasks": [{"id": "cron.1", "state": "TASK_FAILED"}]}
+			]
+		}`))
+	}))
+	defer server.Close()
+
+	failures, err := NewCluster([]string{server.URL}).Failures(context.Background())
+	if err != nil {
+		t.Fatalf("error getting failures: %s", err)
+	}
+
+	ids := []string{}
+	for _, failure := range failures {
+		ids = append(ids, failure.ID)
+	}
+
+	if expected := []string{"web.1", "web.4", "cron.1"}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("unexpected failures; expected: %v, got: %v", expected, ids)
+	}
+
+	if failures[0].Slave != "host1" {
+		t.Errorf("expected well-formed agent to be known, got: %q", failures[0].Slave)
+	}
+}
+
+func TestDecodeMasterState(t *testing.T) {
+	state := []byte(`{
+		"version": "1.11.0",
+		"cluster": "prod",
+		"pid": "master@leader",
+		"leader": "master@leader",
+		"leader_info": {"hostname": "leader", "port": 5050},
+		"flags": {"cluster": "prod", "quorum": "2"},
+		"slaves": [{"id": "agent1", "hostname": "host1", "pid": "slave(1)@10.0.0.1:5051", "attributes": {"rack": "r1"}}],
+		"frameworks": [
+			{
+				"id": "f1",
+				"name": "marathon",
+				"resources": {"cpus": 1.5, "ports": "[31000-32000]"},
+				"tasks": [
+					{"id": "web.3", "name": "web", "state": "TASK_RUNNING", "labels": [{"key": "team", "value": "ops"}], "statuses": [{"state": "TASK_STARTING", "timestamp": 10}, {"state": "TASK_RUNNING", "timestamp": 11}]},
+					{"id": "web.4", "name": "web", "state": "TASK_STAGING"}
+				],
+				"completed_tasks": [
+					{"id": "web.1", "name": "web", "state": "TASK_FAILED", "slave_id": "agent1", "executor_id": "web.1", "labels": [{"key": "team", "value": "ops"}], "container": {"docker": {"image": "web:1"}}, "statuses": [{"state": "TASK_RUNNING", "timestamp": 1}, {"state": "TASK_FAILED", "reason": "REASON_COMMAND_EXECUTOR_FAILED", "message": "exit 1", "timestamp": 2, "container_status": {"container_id": {"value": "c1"}}}]},
+					{"id": "web.2", "name": "web", "state": "TASK_KILLED", "statuses": [{"state": "TASK_KILLED", "timestamp": 3}]},
+					{"id": "web.0", "name": "web", "state": "TASK_FINISHED", "statuses": [{"state": "TASK_RUNNING", "timestamp": 0}, {"state": "TASK_FINISHED", "timestamp": 1}]}
+				],
+				"unreachable_tasks": [[{"id": "nested"}]]
+			},
+			null,
+			{"id": "f2", "name": "chronos", "tasks": null, "completed_tasks": [{"id": "cron.1", "name": "cron", "state": "TASK_LOST"}]}
+		],
+		"completed_frameworks": [{"id": "f0", "completed_tasks": [{"id": "old.1", "state": "TASK_FAILED"}]}],
+		"orphan_tasks": []
+	}`)
+
+	full := &masterState{}
+	if err := json.Unmarshal(state, full); err != nil {
+		t.Fatal(err)
+	}
+
+	cluster := NewCluster([]string{"http://master1.com"})
+
+	streamed, err := decodeMasterState(bytes.NewReader(state), cluster.failureStates)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if streamed.Pid != full.Pid || streamed.Leader != full.Leader || streamed.LeaderInfo != full.LeaderInfo || !reflect.DeepEqual(streamed.Slaves, full.Slaves) {
+		t.Errorf("unexpected master info; expected: %+v, got: %+v", full, streamed)
+	}
+
+	if expected, got := cluster.failuresFromLeader(full), cluster.failuresFromLeader(streamed); !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected failures; expected: %+v, got: %+v", expected, got)
+	}
+
+	if expected, got := healthyFromLeader(full), healthyFromLeader(streamed); !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected healthy tasks; expected: %+v, got: %+v", expected, got)
+	}
+
+	if tasks := streamed.Frameworks[0].CompletedTasks; len(tasks) != 2 || tasks[1].ID != "web.0" || len(tasks[1].Statuses) != 1 {
+		t.Errorf("expected only failed and trimmed healthy tasks to be kept, got: %+v", tasks)
+	}
+
+	for _, invalid := range []string{`{"frameworks": [`, `{"pid": 1}`, `[]`, `{"frameworks": [{"name": "marathon"}]`} {
+		if _, err := decodeMasterState(strings.NewReader(invalid), cluster.failureStates); err == nil {
+			t.Errorf("expected error decoding %s", invalid)
+		}
+	}
+}
+
+// agentPort returns the port of the test server url
+func agentPort(t *testing.T, serverURL string) int {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, portString, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port, err := strconv.Atoi(portString)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return port
+}
+
+func TestCredentials(t *testing.T) {
+	requests := map[string]bool{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "complainer" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		requests[r.URL.Path] = true
+
+		switch r.URL.Path {
+		case "/master/state":
+			_ = json.NewEncoder(w).Encode(masterState{
+				Pid:    "master@leader",
+				Leader: "master@leader",
+				Slaves: []masterSlave{{ID: "agent1", Host: "127.0.0.1"}},
+				Frameworks: []masterFramework{
+					{
+						Name:           "marathon",
+						CompletedTasks: []masterTask{{ID: "web.1", State: "TASK_FAILED", SlaveID: "agent1"}},
+					},
+				},
+			})
+		case "/state":
+			_ = json.NewEncoder(w).Encode(slaveState{
+				Frameworks: []slaveFramework{
+					{
+						CompletedExecutors: []slaveExecutor{{ID: "web.1", Directory: "/sandbox"}},
+					},
+				},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cluster := NewCluster([]string{server.URL})
+	cluster.SetCredentials("complainer", "secret")
+	cluster.SetAgentPort(agentPort(t, server.URL))
+
+	failures, err := cluster.Failures(context.Background())
+	if err != nil {
+		t.Fatalf("error getting failures: %s", err)
+	}
+
+	if len(failures) != 1 {
+		t.Fatalf("expected 1 failure, got %+v", failures)
+	}
+
+	stdoutURL, _, err := cluster.Logs(context.Background(), failures[0])
+	if err != nil {
+		t.Fatalf("error getting logs: %s", err)
+	}
+
+	if expected := sandboxURL("http", cluster.agentAddr("127.0.0.1"), "/sandbox", "stdout"); stdoutURL != expected {
+		t.Errorf("unexpected stdout url; expected: %s, got: %s", expected, stdoutURL)
+	}
+
+	for _, path := range []string{"/master/state", "/state"} {
+		if !requests[path] {
+			t.Errorf("expected authenticated request to %s", path)
+		}
+	}
+
+	cluster.SetCredentials("", "")
+
+	if _, err = cluster.Failures(context.Background()); err == nil {
+		t.Error("expected error without credentials")
+	}
+}
+
+func TestSandboxURL(t *testing.T) {
+	cluster := NewCluster([]string{"http://master1.com"})
+	failure := complainer.Failure{ID: "web.1", AgentID: "agent-1"}
+	logURL := sandboxURL("http", "host1:5051", "/var/lib/mesos/slaves/agent-1/runs/latest", "stdout")
+
+	if sandbox := cluster.SandboxURL(failure, logURL); sandbox != "" {
+		t.Errorf("expected no sandbox url without known leader, got: %s", sandbox)
+	}
+
+	cluster.leader = "http://master1.com"
+
+	if expected, sandbox := "http://master1.com/#/agents/agent-1/browse?path=%2Fvar%2Flib%2Fmesos%2Fslaves%2Fagent-1%2Fruns%2Flatest", cluster.SandboxURL(failure, logURL); sandbox != expected {
+		t.Errorf("unexpected sandbox url; expected: %s, got: %s", expected, sandbox)
+	}
+
+	if sandbox := cluster.SandboxURL(failure, "http://host1:5051/files/download"); sandbox != "" {
+		t.Errorf("expected no sandbox url without sandbox directory, got: %s", sandbox)
+	}
+}
+
+// testCA issues certificates signed by a throwaway ca,
+// pem files are written into a temporary directory
+type testCA struct {
+	t      *testing.T
+	dir    string
+	key    *rsa.PrivateKey
+	cert   *x509.Certificate
+	serial int64
+}
+
+func newTestCA(t *testing.T) *testCA {
+	dir, err := ioutil.TempDir("", "mesos-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca := &testCA{t: t, dir: dir}
+	ca.key, ca.cert = ca.issue("ca", nil)
+
+	return ca
+}
+
+func (ca *testCA) issue(name string, usage []x509.ExtKeyUsage) (*rsa.PrivateKey, *x509.Certificate) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+
+	ca.serial++
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  usage,
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	parent, signer := template, key
+	if ca.cert == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		parent, signer = ca.cert, ca.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+
+	ca.write(name+".pem", "CERTIFICATE", der)
+	ca.write(name+"-key.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))
+
+	return key, cert
+}
+
+func (ca *testCA) write(name, kind string, der []byte) {
+	if err := ioutil.WriteFile(ca.path(name), pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0600); err != nil {
+		ca.t.Fatal(err)
+	}
+}
+
+func (ca *testCA) path(name string) string {
+	return filepath.Join(ca.dir, name)
+}
+
+func (ca *testCA) server(clientAuth tls.ClientAuthType) *httptest.Server {
+	ca.issue("server", []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth})
+
+	cert, err := tls.LoadX509KeyPair(ca.path("server.pem"), ca.path("server-key.pem"))
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   clientAuth,
+	}
+
+	server.StartTLS()
+
+	return server
+}
+
+func TestSetTLS(t *testing.T) {
+	ca := newTestCA(t)
+	defer os.RemoveAll(ca.dir)
+
+	server := ca.server(tls.NoClientCert)
+	defer server.Close()
+
+	ca.issue("client", []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth})
+
+	mutual := ca.server(tls.RequireAndVerifyClientCert)
+	defer mutual.Close()
+
+	table := []struct {
+		name     string
+		master   string
+		caFile   string
+		certFile string
+		keyFile  string
+		insecure bool
+		ok       bool
+	}{
+		{name: "unknown ca", master: server.URL},
+		{name: "custom ca", master: server.URL, caFile: ca.path("ca.pem"), ok: true},
+		{name: "insecure", master: server.URL, insecure: true, ok: true},
+		{name: "mutual without client cert", master: mutual.URL, caFile: ca.path("ca.pem")},
+		{name: "mutual", master: mutual.URL, caFile: ca.path("ca.pem"), certFile: ca.path("client.pem"), keyFile: ca.path("client-key.pem"), ok: true},
+	}
+
+	for _, row := range table {
+		cluster := NewCluster([]string{row.master})
+
+		if row.caFile != "" || row.certFile != "" || row.insecure {
+			if err := cluster.SetTLS(row.caFile, row.certFile, row.keyFile, row.insecure); err != nil {
+				t.Errorf("%s: error setting tls: %s", row.name, err)
+				continue
+			}
+
+			if cluster.agentScheme != "https" {
+				t.Errorf("%s: expected agents to be contacted over https, got %s", row.name, cluster.agentScheme)
+			}
+		}
+
+		if err := cluster.Ping(context.Background()); (err == nil) != row.ok {
+			t.Errorf("%s: unexpected ping result: %v", row.name, err)
+		}
+	}
+}
+
+func TestSetTLSErrors(t *testing.T) {
+	ca := newTestCA(t)
+	defer os.RemoveAll(ca.dir)
+
+	if err := ioutil.WriteFile(ca.path("empty.pem"), []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, row := range [][3]string{
+		{ca.path("missing.pem"), "", ""},
+		{ca.path("empty.pem"), "", ""},
+		{"", ca.path("ca.pem"), ""},
+		{"", ca.path("ca.pem"), ca.path("missing.pem")},
+	} {
+		if err := NewCluster(nil).SetTLS(row[0], row[1], row[2], false); err == nil {
+			t.Errorf("expected error for ca=%q cert=%q key=%q", row[0], row[1], row[2])
+		}
+	}
+}
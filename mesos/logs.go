@@ -0,0 +1,407 @@
+package mesos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	// logChunkSize is how much is read at once when looking for log lines
+	logChunkSize = 64 * 1024
+	// proxyChunkSize is how much is read at once when proxying logs
+	proxyChunkSize = 1024 * 1024
+	// truncatedPrefix starts the line prepended to logs cut by Download
+	truncatedPrefix = "[complainer: "
+)
+
+// ErrLogNotFound indicates that the proxied log is not a log of a known agent
+var ErrLogNotFound = errors.New("log not found")
+
+type filesRead struct {
+	Data   string `json:"data"`
+	Offset int64  `json:"offset"`
+}
+
+// SetLogLimit limits logs fetched by Download to the last bytes
+// and the last lines of the file, zero means no limit
+func (c *Cluster) SetLogLimit(bytes, lines int) {
+	c.logBytes = bytes
+	c.logLines = lines
+}
+
+// SetLogHead makes Download keep the beginning of logs instead of
+// the end when they are cut to log limits
+func (c *Cluster) SetLogHead(head bool) {
+	c.logHead = head
+}
+
+// Download returns the content of the log by the sandbox url returned
+// from Logs, fetching only the tail (or the head) of the log if limits
+// are set. Cut logs start with a line telling how many bytes are dropped.
+func (c *Cluster) Download(ctx context.Context, logURL string) ([]byte, error) {
+	read, part := c.tail, "beginning"
+	if c.logHead {
+		read, part = c.head, "end"
+	}
+
+	data, size, err := read(ctx, logURL, c.logBytes, c.logLines)
+	if err != nil {
+		return nil, err
+	}
+
+	if dropped := size - int64(len(data)); dropped > 0 {
+		marker := fmt.Sprintf("%s%d bytes dropped from the %s of the log]\n", truncatedPrefix, dropped, part)
+		data = append([]byte(marker), data...)
+	}
+
+	return data, nil
+}
+
+// DownloadedTail returns the last bytes and the last lines of the log
+// content returned from Download, like Tail does for the log itself.
+// False is returned if the content lacks the end of the log.
+func (c *Cluster) DownloadedTail(data []byte, bytes, lines int) ([]byte, bool) {
+	if len(data) >= len(truncatedPrefix) && string(data[:len(truncatedPrefix)]) == truncatedPrefix {
+		if c.logHead {
+			return nil, false
+		}
+
+		// The marker line is not a part of the log
+		data = data[len(firstLines(data, 1)):]
+	}
+
+	if bytes > 0 && len(data) > bytes {
+		data = data[len(data)-bytes:]
+	}
+
+	if lines > 0 {
+		data = lastLines(data, lines)
+	}
+
+	return data, true
+}
+
+// Tail returns the last bytes and the last lines of the log by the sandbox
+// url returned from Logs, zero means no limit. Limited logs are fetched
+// with the files/read endpoint of the agent, so only the tail is transferred.
+func (c *Cluster) Tail(ctx context.Context, logURL string, bytes, lines int) ([]byte, error) {
+	data, _, err := c.tail(ctx, logURL, bytes, lines)
+	return data, err
+}
+
+// tail returns the tail of the log and the size of the whole log,
+// which is the size of data if the whole log is downloaded
+func (c *Cluster) tail(ctx context.Context, logURL string, bytes, lines int) ([]byte, int64, error) {
+	u, err := url.Parse(logURL)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if (bytes == 0 && lines == 0) || u.Path != "/files/download" {
+		data, err := c.download(ctx, logURL)
+		return data, int64(len(data)), err
+	}
+
+	file := u.Query().Get("path")
+
+	info, err := c.readFile(ctx, u, file, -1, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	size := info.Offset
+	start := int64(0)
+	if bytes > 0 && size > int64(bytes) {
+		start = size - int64(bytes)
+	}
+
+	if lines == 0 {
+		data, err := c.readRange(ctx, u, file, start, size-start)
+		return data, size, err
+	}
+
+	data := []byte{}
+	for offset := size; offset > start; {
+		length := int64(logChunkSize)
+		if offset-start < length {
+			length = offset - start
+		}
+
+		offset -= length
+
+		chunk, err := c.readRange(ctx, u, file, offset, length)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		data = append(chunk, data...)
+		if len(lastLines(data, lines)) < len(data) {
+			break
+		}
+	}
+
+	return lastLines(data, lines), size, nil
+}
+
+// head returns the first bytes and the first lines of the log
+// and the size of the whole log, the same way tail does
+func (c *Cluster) head(ctx context.Context, logURL string, bytes, lines int) ([]byte, int64, error) {
+	u, err := url.Parse(logURL)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if (bytes == 0 && lines == 0) || u.Path != "/files/download" {
+		data, err := c.download(ctx, logURL)
+		return data, int64(len(data)), err
+	}
+
+	file := u.Query().Get("path")
+
+	info, err := c.readFile(ctx, u, file, -1, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	size := info.Offset
+	end := size
+	if bytes > 0 && size > int64(bytes) {
+		end = int64(bytes)
+	}
+
+	if lines == 0 {
+		data, err := c.readRange(ctx, u, file, 0, end)
+		return data, size, err
+	}
+
+	data := []byte{}
+	for offset := int64(0); offset < end; {
+		length := int64(logChunkSize)
+		if end-offset < length {
+			length = end - offset
+		}
+
+		chunk, err := c.readRange(ctx, u, file, offset, length)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		// Logs can be rotated while they are read
+		if len(chunk) == 0 {
+			break
+		}
+
+		data = append(data, chunk...)
+		offset += int64(len(chunk))
+
+		if len(firstLines(data, lines)) < len(data) {
+			break
+		}
+	}
+
+	return firstLines(data, lines), size, nil
+}
+
+// Size returns the size of the log by the sandbox url returned from Logs
+func (c *Cluster) Size(ctx context.Context, logURL string) (int64, error) {
+	u, err := url.Parse(logURL)
+	if err != nil {
+		return 0, err
+	}
+
+	if u.Path != "/files/download" {
+		return 0, fmt.Errorf("cannot get size of %s: not a sandbox url", logURL)
+	}
+
+	info, err := c.readFile(ctx, u, u.Query().Get("path"), -1, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Offset, nil
+}
+
+// SetLogProxy makes PublicURL point to the log proxy at the base url
+// instead of the agent, for agents people reading reports cannot reach.
+// The proxy is served by complainer at /logs and reads logs with ReadLog.
+func (c *Cluster) SetLogProxy(baseURL string) {
+	c.logProxy = strings.TrimSuffix(baseURL, "/")
+}
+
+// PublicURL returns the url of the log proxy for the sandbox url returned
+// from Logs if the proxy is set, other urls are returned as is
+func (c *Cluster) PublicURL(logURL string) string {
+	if c.logProxy == "" {
+		return logURL
+	}
+
+	u, err := url.Parse(logURL)
+	if err != nil || u.Path != "/files/download" || !c.knownAgent(u.Host) {
+		return logURL
+	}
+
+	query := url.Values{}
+	query.Set("agent", u.Host)
+	query.Set("path", u.Query().Get("path"))
+
+	return c.logProxy + "/logs?" + query.Encode()
+}
+
+// ReadLog returns stdout or stderr in the sandbox of the agent by address
+// with the files/read endpoint of the agent. Only logs of agents known from
+// the master state can be read, ErrLogNotFound is returned for other files.
+func (c *Cluster) ReadLog(ctx context.Context, addr, file string) ([]byte, error) {
+	if base := path.Base(file); (base != "stdout" && base != "stderr") || !c.knownAgent(addr) {
+		return nil, ErrLogNotFound
+	}
+
+	u := &url.URL{Scheme: c.agentScheme, Host: addr}
+
+	info, err := c.readFile(ctx, u, file, -1, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	data := []byte{}
+	for offset := int64(0); offset < info.Offset; {
+		length := int64(proxyChunkSize)
+		if info.Offset-offset < length {
+			length = info.Offset - offset
+		}
+
+		chunk, err := c.readRange(ctx, u, file, offset, length)
+		if err != nil {
+			return nil, err
+		}
+
+		// Logs can be rotated while they are read
+		if len(chunk) == 0 {
+			break
+		}
+
+		data = append(data, chunk...)
+		offset += int64(len(chunk))
+	}
+
+	return data, nil
+}
+
+// knownAgent tells if the address belongs to an agent from the master state
+func (c *Cluster) knownAgent(addr string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, known := range c.agents {
+		if known == addr {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *Cluster) download(ctx context.Context, logURL string) ([]byte, error) {
+	resp, err := c.get(ctx, logURL)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status for %s: %s", logURL, resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (c *Cluster) readRange(ctx context.Context, u *url.URL, file string, offset, length int64) ([]byte, error) {
+	read, err := c.readFile(ctx, u, file, offset, length)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(read.Data), nil
+}
+
+func (c *Cluster) readFile(ctx context.Context, u *url.URL, file string, offset, length int64) (*filesRead, error) {
+	query := url.Values{}
+	query.Set("path", file)
+	query.Set("offset", strconv.FormatInt(offset, 10))
+	if length > 0 {
+		query.Set("length", strconv.FormatInt(length, 10))
+	}
+
+	readURL := (&url.URL{
+		Scheme:   u.Scheme,
+		Host:     u.Host,
+		Path:     "/files/read",
+		RawQuery: query.Encode(),
+	}).String()
+
+	resp, err := c.get(ctx, readURL)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status for %s: %s", readURL, resp.Status)
+	}
+
+	read := &filesRead{}
+	if err := json.NewDecoder(resp.Body).Decode(read); err != nil {
+		return nil, fmt.Errorf("cannot decode %s: %s", readURL, err)
+	}
+
+	return read, nil
+}
+
+// lastLines returns the last n lines of data, trailing newline
+// does not count as a separate line
+func lastLines(data []byte, n int) []byte {
+	end := len(data)
+	if end > 0 && data[end-1] == '\n' {
+		end--
+	}
+
+	count := 0
+	for i := end - 1; i >= 0; i-- {
+		if data[i] == '\n' {
+			count++
+			if count == n {
+				return data[i+1:]
+			}
+		}
+	}
+
+	return data
+}
+
+// firstLines returns the first n lines of data with the trailing newline
+func firstLines(data []byte, n int) []byte {
+	count := 0
+	for i, b := range data {
+		if b == '\n' {
+			count++
+			if count == n {
+				return data[:i+1]
+			}
+		}
+	}
+
+	return data
+}
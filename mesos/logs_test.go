@@ -0,0 +1,294 @@
+package mesos
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLastLines(t *testing.T) {
+	table := []struct {
+		data     string
+		lines    int
+		expected string
+	}{
+		{data: "", lines: 2, expected: ""},
+		{data: "one", lines: 2, expected: "one"},
+		{data: "one\ntwo\nthree", lines: 2, expected: "two\nthree"},
+		{data: "one\ntwo\nthree\n", lines: 2, expected: "two\nthree\n"},
+		{data: "one\ntwo\n", lines: 5, expected: "one\ntwo\n"},
+	}
+
+	for _, row := range table {
+		got := string(lastLines([]byte(row.data), row.lines))
+		if got != row.expected {
+			t.Errorf("invalid last %d lines of %q; expected: %q, got: %q", row.lines, row.data, row.expected, got)
+		}
+	}
+}
+
+// testLogAgent serves the content as /sandbox/stderr with files api
+func testLogAgent(content string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/files/download":
+			_, _ = w.Write([]byte(content))
+		case "/files/read":
+			if r.URL.Query().Get("path") != "/sandbox/stderr" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+			length, _ := strconv.Atoi(r.URL.Query().Get("length"))
+
+			read := filesRead{Offset: int64(offset)}
+			if offset < 0 {
+				read.Offset = int64(len(content))
+			} else {
+				read.Data = content[offset : offset+length]
+			}
+
+			_ = json.NewEncoder(w).Encode(read)
+		}
+	}))
+}
+
+func TestTail(t *testing.T) {
+	content := "one\ntwo\nthree\nfour\n"
+
+	agent := testLogAgent(content)
+	defer agent.Close()
+
+	logURL := agent.URL + "/files/download?path=/sandbox/stderr"
+
+	table := []struct {
+		bytes    int
+		lines    int
+		expected string
+	}{
+		{bytes: 0, lines: 0, expected: content},
+		{bytes: 6, lines: 0, expected: "\nfour\n"},
+		{bytes: 0, lines: 2, expected: "three\nfour\n"},
+		{bytes: 8, lines: 3, expected: "ee\nfour\n"},
+	}
+
+	cluster := NewCluster([]string{"http://master1.com"})
+
+	for _, row := range table {
+		got, err := cluster.Tail(context.Background(), logURL, row.bytes, row.lines)
+		if err != nil {
+			t.Errorf("error getting tail with bytes=%d lines=%d: %s", row.bytes, row.lines, err)
+			continue
+		}
+
+		if string(got) != row.expected {
+			t.Errorf("invalid tail with bytes=%d lines=%d; expected: %q, got: %q", row.bytes, row.lines, row.expected, got)
+		}
+	}
+}
+
+func TestDownloadLimit(t *testing.T) {
+	content := "one\ntwo\nthree\nfour\n"
+
+	agent := testLogAgent(content)
+	defer agent.Close()
+
+	logURL := agent.URL + "/files/download?path=/sandbox/stderr"
+
+	table := []struct {
+		bytes    int
+		lines    int
+		head     bool
+		expected string
+	}{
+		{expected: content},
+		{bytes: 100, expected: content},
+		{lines: 2, expected: "[complainer: 8 bytes dropped from the beginning of the log]\nthree\nfour\n"},
+		{bytes: 6, head: true, expected: "[complainer: 13 bytes dropped from the end of the log]\none\ntw"},
+		{lines: 3, head: true, expected: "[complainer: 5 bytes dropped from the end of the log]\none\ntwo\nthree\n"},
+		{bytes: 10, lines: 1, head: true, expected: "[complainer: 15 bytes dropped from the end of the log]\none\n"},
+	}
+
+	for _, row := range table {
+		cluster := NewCluster([]string{"http://master1.com"})
+		cluster.SetLogLimit(row.bytes, row.lines)
+		cluster.SetLogHead(row.head)
+
+		got, err := cluster.Download(context.Background(), logURL)
+		if err != nil {
+			t.Errorf("error downloading with bytes=%d lines=%d head=%v: %s", row.bytes, row.lines, row.head, err)
+			continue
+		}
+
+		if string(got) != row.expected {
+			t.Errorf("invalid download with bytes=%d lines=%d head=%v; expected: %q, got: %q", row.bytes, row.lines, row.head, row.expected, got)
+		}
+	}
+}
+
+func TestDownloadedTail(t *testing.T) {
+	cut := "[complainer: 8 bytes dropped from the beginning of the log]\nthree\nfour\n"
+
+	table := []struct {
+		data     string
+		bytes    int
+		lines    int
+		head     bool
+		expected string
+		ok       bool
+	}{
+		{data: "one\ntwo\nthree\n", expected: "one\ntwo\nthree\n", ok: true},
+		{data: "one\ntwo\nthree\n", lines: 1, expected: "three\n", ok: true},
+		{data: "one\ntwo\nthree\n", bytes: 8, expected: "o\nthree\n", ok: true},
+		{data: "one\ntwo\nthree\n", bytes: 8, lines: 5, expected: "o\nthree\n", ok: true},
+		{data: cut, lines: 5, expected: "three\nfour\n", ok: true},
+		{data: cut, lines: 5, head: true},
+		{data: "one\ntwo\n", lines: 5, head: true, expected: "one\ntwo\n", ok: true},
+	}
+
+	for _, row := range table {
+		cluster := NewCluster([]string{"http://master1.com"})
+		cluster.SetLogHead(row.head)
+
+		got, ok := cluster.DownloadedTail([]byte(row.data), row.bytes, row.lines)
+		if ok != row.ok || string(got) != row.expected {
+			t.Errorf("invalid tail of %q with bytes=%d lines=%d head=%v; expected: %q (%v), got: %q (%v)", row.data, row.bytes, row.lines, row.head, row.expected, row.ok, got, ok)
+		}
+	}
+}
+
+func TestSize(t *testing.T) {
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/files/read" || r.URL.Query().Get("offset") != "-1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(filesRead{Offset: int64(len(r.URL.Query().Get("path")))})
+	}))
+	defer agent.Close()
+
+	cluster := NewCluster([]string{"http://master1.com"})
+
+	size, err := cluster.Size(context.Background(), agent.URL+"/files/download?path=/sandbox/stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if size != int64(len("/sandbox/stderr")) {
+		t.Errorf("unexpected size: %d", size)
+	}
+
+	if _, err = cluster.Size(context.Background(), "https://logs.example.com/stderr"); err == nil {
+		t.Error("expected error for url outside of sandbox")
+	}
+}
+
+func TestDownloadCancel(t *testing.T) {
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer agent.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	if _, err := NewCluster(nil).Download(ctx, agent.URL+"/files/download?path=/sandbox/stdout"); err == nil {
+		t.Error("expected error for cancelled download")
+	}
+}
+
+func TestLogProxy(t *testing.T) {
+	content := "one\ntwo\n"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/master/state":
+			_ = json.NewEncoder(w).Encode(masterState{
+				Pid:    "master@leader",
+				Leader: "master@leader",
+				Slaves: []masterSlave{{ID: "agent1", Host: "agent1.invalid", Pid: "slave(1)@" + r.Host}},
+				Frameworks: []masterFramework{
+					{
+						Name:           "marathon",
+						CompletedTasks: []masterTask{{ID: "web.1", State: "TASK_FAILED", SlaveID: "agent1"}},
+					},
+				},
+			})
+		case "/state":
+			_ = json.NewEncoder(w).Encode(slaveState{
+				Frameworks: []slaveFramework{
+					{
+						CompletedExecutors: []slaveExecutor{{ID: "web.1", Directory: "/sandbox"}},
+					},
+				},
+			})
+		case "/files/read":
+			offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+			length, _ := strconv.Atoi(r.URL.Query().Get("length"))
+
+			read := filesRead{Offset: int64(offset)}
+			if offset < 0 {
+				read.Offset = int64(len(content))
+			} else {
+				read.Data = content[offset : offset+length]
+			}
+
+			_ = json.NewEncoder(w).Encode(read)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cluster := NewCluster([]string{server.URL})
+	cluster.SetAgentAddressFromPid(true)
+	cluster.SetLogProxy("https://complainer.example.com/")
+
+	failures, err := cluster.Failures(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hostname of the agent does not resolve, address from pid is used
+	stdoutURL, _, err := cluster.Logs(context.Background(), failures[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	if expected := sandboxURL("http", addr, "/sandbox", "stdout"); stdoutURL != expected {
+		t.Errorf("unexpected stdout url; expected: %s, got: %s", expected, stdoutURL)
+	}
+
+	if expected := "https://complainer.example.com/logs?agent=" + url.QueryEscape(addr) + "&path=%2Fsandbox%2Fstdout"; cluster.PublicURL(stdoutURL) != expected {
+		t.Errorf("unexpected public url; expected: %s, got: %s", expected, cluster.PublicURL(stdoutURL))
+	}
+
+	if uploaded := "https://logs.example.com/web.1/stdout"; cluster.PublicURL(uploaded) != uploaded {
+		t.Errorf("expected uploaded url to stay, got: %s", cluster.PublicURL(uploaded))
+	}
+
+	data, err := cluster.ReadLog(context.Background(), addr, "/sandbox/stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != content {
+		t.Errorf("unexpected proxied log: %q", data)
+	}
+
+	for _, row := range []struct{ addr, file string }{{addr, "/etc/passwd"}, {"10.0.0.1:5051", "/sandbox/stdout"}} {
+		if _, err = cluster.ReadLog(context.Background(), row.addr, row.file); err != ErrLogNotFound {
+			t.Errorf("expected %s from %s to be not found, got: %v", row.file, row.addr, err)
+		}
+	}
+}
@@ -1,25 +1,44 @@
 package mesos
 
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/cloudflare/complainer/logging"
+)
+
 type masterState struct {
-	Frameworks []masterFramework `json:"frameworks"`
-	Slaves     []masterSlave     `json:"slaves"`
-	Pid        string            `json:"pid"`
-	Leader     string            `json:"leader"`
+	Frameworks  []masterFramework `json:"frameworks"`
+	Slaves      masterSlaves      `json:"slaves"`
+	Pid         string            `json:"pid"`
+	Leader      string            `json:"leader"`
+	LeaderInfo  masterInfo        `json:"leader_info"`
+	ElectedTime float64           `json:"elected_time"`
+	Cluster     string            `json:"cluster"`
+}
+
+type masterInfo struct {
+	Hostname string `json:"hostname"`
+	Port     int    `json:"port"`
 }
 
 type masterFramework struct {
-	Name           string       `json:"name"`
-	CompletedTasks []masterTask `json:"completed_tasks"`
+	Name             string       `json:"name"`
+	RegisteredTime   float64      `json:"registered_time"`
+	ReregisteredTime float64      `json:"reregistered_time"`
+	Tasks            []masterTask `json:"tasks"`
+	CompletedTasks   []masterTask `json:"completed_tasks"`
 }
 
 type masterTask struct {
-	ID        string             `json:"id"`
-	Name      string             `json:"name"`
-	State     string             `json:"state"`
-	SlaveID   string             `json:"slave_id"`
-	Labels    []masterLabel      `json:"labels"`
-	Container masterContainer    `json:"container"`
-	Statuses  []masterTaskStatus `json:"statuses"`
+	ID         string             `json:"id"`
+	Name       string             `json:"name"`
+	State      string             `json:"state"`
+	SlaveID    string             `json:"slave_id"`
+	ExecutorID string             `json:"executor_id"`
+	Labels     []masterLabel      `json:"labels"`
+	Container  masterContainer    `json:"container"`
+	Statuses   []masterTaskStatus `json:"statuses"`
 }
 
 type masterContainer struct {
@@ -32,13 +51,84 @@ type masterDocker struct {
 }
 
 type masterTaskStatus struct {
-	State     string  `json:"state"`
-	Timestamp float64 `json:"timestamp"`
+	State           string                `json:"state"`
+	Reason          string                `json:"reason"`
+	Message         string                `json:"message"`
+	Timestamp       float64               `json:"timestamp"`
+	ContainerStatus masterContainerStatus `json:"container_status"`
+}
+
+type masterContainerStatus struct {
+	ContainerID masterContainerID `json:"container_id"`
+}
+
+type masterContainerID struct {
+	Value string `json:"value"`
 }
 
 type masterSlave struct {
-	ID   string `json:"id"`
-	Host string `json:"hostname"`
+	ID         string                 `json:"id"`
+	Host       string                 `json:"hostname"`
+	Pid        string                 `json:"pid"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// masterSlaves are agents that could be decoded,
+// malformed agents are logged and skipped
+type masterSlaves []masterSlave
+
+func (s *masterSlaves) UnmarshalJSON(b []byte) error {
+	*s = nil
+
+	return decodeEach(b, "agent", func(raw json.RawMessage) error {
+		slave := masterSlave{}
+		if err := json.Unmarshal(raw, &slave); err != nil {
+			return err
+		}
+
+		*s = append(*s, slave)
+
+		return nil
+	})
+}
+
+// decodeEach calls decode for every element of the json array, elements
+// that cannot be decoded are logged and skipped, so a single malformed
+// entry does not prevent the rest of the state from being used
+func decodeEach(b []byte, kind string, decode func(json.RawMessage) error) error {
+	elements := []json.RawMessage{}
+	if err := json.Unmarshal(b, &elements); err != nil {
+		return err
+	}
+
+	for i, raw := range elements {
+		if err := decode(raw); err != nil {
+			logMalformed(kind, i, rawID(raw), err)
+		}
+	}
+
+	return nil
+}
+
+// rawID returns the id of the json object if it has one
+func rawID(raw json.RawMessage) interface{} {
+	id := struct {
+		ID interface{} `json:"id"`
+	}{}
+
+	_ = json.Unmarshal(raw, &id)
+
+	return id.ID
+}
+
+// logMalformed logs the skipped element of the state, with its id if it has one
+func logMalformed(kind string, i int, id interface{}, err error) {
+	ref := fmt.Sprintf("#%d", i)
+	if id != nil {
+		ref += fmt.Sprintf(" (%v)", id)
+	}
+
+	logging.Warning(fmt.Sprintf("Skipping malformed %s %s in mesos state: %s", kind, ref, err), logging.Fields{"kind": kind, "index": i, "error": err})
 }
 
 type masterLabel struct {
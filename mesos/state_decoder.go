@@ -0,0 +1,263 @@
+package mesos
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// errUnexpectedValue indicates a json value of unexpected kind,
+// like a string where an object is expected
+var errUnexpectedValue = errors.New("unexpected value")
+
+// stateDecoder decodes the master state from a stream element by element,
+// keeping only tasks that can be reported as failures or healthy tasks,
+// so memory use does not grow with the size of the whole state document
+type stateDecoder struct {
+	dec           *json.Decoder
+	failureStates map[string]bool
+}
+
+func decodeMasterState(r io.Reader, failureStates map[string]bool) (*masterState, error) {
+	d := &stateDecoder{
+		dec:           json.NewDecoder(r),
+		failureStates: failureStates,
+	}
+
+	state := &masterState{}
+
+	err := d.object(func(key string) error {
+		switch key {
+		case "pid":
+			return d.dec.Decode(&state.Pid)
+		case "leader":
+			return d.dec.Decode(&state.Leader)
+		case "leader_info":
+			return d.dec.Decode(&state.LeaderInfo)
+		case "elected_time":
+			return d.dec.Decode(&state.ElectedTime)
+		case "cluster":
+			return d.dec.Decode(&state.Cluster)
+		case "slaves":
+			return d.dec.Decode(&state.Slaves)
+		case "frameworks":
+			return d.array(func(i int) error {
+				return d.framework(i, state)
+			})
+		default:
+			return d.skip()
+		}
+	})
+
+	return state, err
+}
+
+// framework decodes a framework, malformed frameworks are logged and skipped
+func (d *stateDecoder) framework(i int, state *masterState) error {
+	framework := masterFramework{}
+
+	ok, err := d.open('{')
+	if !ok {
+		if malformed(err) {
+			logMalformed("framework", i, nil, err)
+			return nil
+		}
+
+		return err
+	}
+
+	var id interface{}
+
+	err = d.fields(func(key string) error {
+		switch key {
+		case "id":
+			return d.dec.Decode(&id)
+		case "name":
+			return d.dec.Decode(&framework.Name)
+		case "registered_time":
+			return d.dec.Decode(&framework.RegisteredTime)
+		case "reregistered_time":
+			return d.dec.Decode(&framework.ReregisteredTime)
+		case "tasks":
+			return d.tasks(&framework.Tasks, false)
+		case "completed_tasks":
+			return d.tasks(&framework.CompletedTasks, true)
+		default:
+			return d.skip()
+		}
+	})
+
+	if err != nil {
+		if !malformed(err) {
+			return err
+		}
+
+		// The framework is consumed up to the malformed value at this point
+		if err := d.skipRest(); err != nil {
+			return err
+		}
+
+		logMalformed("framework", i, id, err)
+
+		return nil
+	}
+
+	state.Frameworks = append(state.Frameworks, framework)
+
+	return nil
+}
+
+// tasks decodes tasks one by one, appending the ones worth keeping
+func (d *stateDecoder) tasks(tasks *[]masterTask, completed bool) error {
+	return d.array(func(i int) error {
+		raw := json.RawMessage{}
+		if err := d.dec.Decode(&raw); err != nil {
+			return err
+		}
+
+		task := masterTask{}
+		if err := json.Unmarshal(raw, &task); err != nil {
+			logMalformed("task", i, rawID(raw), err)
+			return nil
+		}
+
+		if completed && d.failureStates[task.State] {
+			*tasks = append(*tasks, task)
+		} else if healthyTask(task) {
+			// Only the first status is needed to know when a healthy task started
+			*tasks = append(*tasks, masterTask{
+				ID:       task.ID,
+				Name:     task.Name,
+				State:    task.State,
+				Statuses: []masterTaskStatus{task.Statuses[0]},
+			})
+		}
+
+		return nil
+	})
+}
+
+// object calls field for every key of the json object, field must consume
+// the value of the key. Null is treated as an empty object.
+func (d *stateDecoder) object(field func(key string) error) error {
+	if ok, err := d.open('{'); !ok {
+		return err
+	}
+
+	return d.fields(field)
+}
+
+// fields calls field for every key of the object that is already opened
+func (d *stateDecoder) fields(field func(key string) error) error {
+	for d.dec.More() {
+		t, err := d.dec.Token()
+		if err != nil {
+			return err
+		}
+
+		key, ok := t.(string)
+		if !ok {
+			return fmt.Errorf("unexpected object key: %v", t)
+		}
+
+		if err = field(key); err != nil {
+			return err
+		}
+	}
+
+	_, err := d.dec.Token()
+
+	return err
+}
+
+// array calls element for every element of the json array, element
+// must consume the value. Null is treated as an empty array.
+func (d *stateDecoder) array(element func(i int) error) error {
+	if ok, err := d.open('['); !ok {
+		return err
+	}
+
+	for i := 0; d.dec.More(); i++ {
+		if err := element(i); err != nil {
+			return err
+		}
+	}
+
+	_, err := d.dec.Token()
+
+	return err
+}
+
+// open consumes the opening delimiter, returning false for null and for
+// values of other kinds, which are consumed with errUnexpectedValue
+func (d *stateDecoder) open(delim json.Delim) (bool, error) {
+	t, err := d.dec.Token()
+	if err != nil {
+		return false, err
+	}
+
+	switch t {
+	case nil:
+		return false, nil
+	case delim:
+		return true, nil
+	case json.Delim('{'), json.Delim('['):
+		if err = d.skipNested(1); err != nil {
+			return false, err
+		}
+	}
+
+	return false, errUnexpectedValue
+}
+
+// skip consumes the next value without decoding it
+func (d *stateDecoder) skip() error {
+	return d.skipNested(0)
+}
+
+// skipRest consumes the rest of the object or array being decoded
+func (d *stateDecoder) skipRest() error {
+	for d.dec.More() {
+		if err := d.skip(); err != nil {
+			return err
+		}
+	}
+
+	_, err := d.dec.Token()
+
+	return err
+}
+
+// skipNested consumes tokens until depth levels of nesting are closed
+func (d *stateDecoder) skipNested(depth int) error {
+	for {
+		t, err := d.dec.Token()
+		if err != nil {
+			return err
+		}
+
+		switch t {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// malformed returns whether the error is caused by a value that has
+// unexpected type, the decoder can continue after such errors
+func malformed(err error) bool {
+	if err == errUnexpectedValue {
+		return true
+	}
+
+	_, ok := err.(*json.UnmarshalTypeError)
+
+	return ok
+}
@@ -0,0 +1,200 @@
+// Package metrics implements counters and histograms exposed
+// in Prometheus text exposition format
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	registry   []collector
+	registryMu sync.Mutex
+)
+
+type collector interface {
+	write(buf *bytes.Buffer)
+}
+
+func register(c collector) {
+	registryMu.Lock()
+	registry = append(registry, c)
+	registryMu.Unlock()
+}
+
+// Handler returns http handler exposing all registered metrics
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := bytes.NewBuffer([]byte{})
+
+		registryMu.Lock()
+		for _, c := range registry {
+			c.write(buf)
+		}
+		registryMu.Unlock()
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_, _ = w.Write(buf.Bytes())
+	})
+}
+
+// Counter is a monotonically increasing counter with optional labels
+type Counter struct {
+	name   string
+	help   string
+	labels []string
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounter creates and registers a new counter
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: map[string]float64{},
+	}
+
+	if len(labels) == 0 {
+		c.values[""] = 0
+	}
+
+	register(c)
+
+	return c
+}
+
+// Inc increments the counter for the specified label values
+func (c *Counter) Inc(values ...string) {
+	key := formatLabels(c.labels, values)
+
+	c.mu.Lock()
+	c.values[key]++
+	c.mu.Unlock()
+}
+
+// Value returns the current value for the specified label values
+func (c *Counter) Value(values ...string) float64 {
+	key := formatLabels(c.labels, values)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.values[key]
+}
+
+func (c *Counter) write(buf *bytes.Buffer) {
+	writeHeader(buf, c.name, c.help, "counter")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fmt.Fprintf(buf, "%s%s %s\n", c.name, key, formatValue(c.values[key]))
+	}
+}
+
+// Histogram counts observations in configurable buckets
+type Histogram struct {
+	name    string
+	help    string
+	buckets []float64
+	mu      sync.Mutex
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+// NewHistogram creates and registers a new histogram with upper bounds
+// of buckets in increasing order
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	h := &Histogram{
+		name:    name,
+		help:    help,
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+
+	register(h)
+
+	return h
+}
+
+// Observe adds an observation to the histogram
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, bound := range h.buckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+
+	h.sum += v
+	h.count++
+}
+
+func (h *Histogram) write(buf *bytes.Buffer) {
+	writeHeader(buf, h.name, h.help, "histogram")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, bound := range h.buckets {
+		fmt.Fprintf(buf, "%s_bucket{le=\"%s\"} %d\n", h.name, formatValue(bound), h.counts[i])
+	}
+
+	fmt.Fprintf(buf, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(buf, "%s_sum %s\n", h.name, formatValue(h.sum))
+	fmt.Fprintf(buf, "%s_count %d\n", h.name, h.count)
+}
+
+func writeHeader(buf *bytes.Buffer, name, help, kind string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(buf, "# TYPE %s %s\n", name, kind)
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+
+		pairs[i] = fmt.Sprintf("%s=\"%s\"", name, escapeLabelValue(value))
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	counter := NewCounter("test_reports_total", "Reports sent.", "reporter", "result")
+	plain := NewCounter("test_errors_total", "Errors seen.")
+	histogram := NewHistogram("test_duration_seconds", "Run duration.", []float64{0.5, 1})
+
+	counter.Inc("slack", "success")
+	counter.Inc("slack", "success")
+	counter.Inc("sen\"try", "error")
+	histogram.Observe(0.2)
+	histogram.Observe(0.7)
+	histogram.Observe(3)
+
+	if v := counter.Value("slack", "success"); v != 2 {
+		t.Errorf("unexpected counter value: %v", v)
+	}
+
+	if v := plain.Value(); v != 0 {
+		t.Errorf("unexpected counter value: %v", v)
+	}
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	expected := []string{
+		"# TYPE test_reports_total counter",
+		`test_reports_total{reporter="sen\"try",result="error"} 1`,
+		`test_reports_total{reporter="slack",result="success"} 2`,
+		"test_errors_total 0",
+		"# TYPE test_duration_seconds histogram",
+		`test_duration_seconds_bucket{le="0.5"} 1`,
+		`test_duration_seconds_bucket{le="1"} 2`,
+		`test_duration_seconds_bucket{le="+Inf"} 3`,
+		"test_duration_seconds_sum 3.9",
+		"test_duration_seconds_count 3",
+	}
+
+	body := rec.Body.String()
+	for _, line := range expected {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected line %q in output:\n%s", line, body)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package monitor
+
+import "time"
+
+// coalescer suppresses repeated failures of the same task within a window,
+// counting them to be reported with the next failure after the window
+type coalescer struct {
+	window time.Duration
+	tasks  map[string]*occurrences
+}
+
+type occurrences struct {
+	reported   time.Time
+	suppressed int
+	previous   *occurrences
+}
+
+func newCoalescer(window time.Duration) *coalescer {
+	return &coalescer{
+		window: window,
+		tasks:  map[string]*occurrences{},
+	}
+}
+
+// add registers a failure of the named task at the specified time and
+// returns whether it should be reported, along with the number of
+// occurrences since the previous report, including the current one
+func (c *coalescer) add(name string, at time.Time) (bool, int) {
+	o, ok := c.tasks[name]
+	if ok && at.Sub(o.reported) < c.window {
+		o.suppressed++
+		return false, 0
+	}
+
+	count := 1
+	if ok {
+		count += o.suppressed
+		o.previous = nil
+	}
+
+	c.tasks[name] = &occurrences{reported: at, previous: o}
+
+	return true, count
+}
+
+// rollback forgets the last reported failure of the named task,
+// so it is not coalesced with itself when it is processed again
+func (c *coalescer) rollback(name string) {
+	o, ok := c.tasks[name]
+	if !ok {
+		return
+	}
+
+	if o.previous != nil {
+		c.tasks[name] = o.previous
+	} else {
+		delete(c.tasks, name)
+	}
+}
+
+// cleanup forgets tasks that were not reported within the window
+func (c *coalescer) cleanup(now time.Time) {
+	for name, o := range c.tasks {
+		if now.Sub(o.reported) > c.window && o.suppressed == 0 {
+			delete(c.tasks, name)
+		}
+	}
+}
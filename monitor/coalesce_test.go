@@ -0,0 +1,62 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCoalescer(t *testing.T) {
+	c := newCoalescer(time.Minute)
+	start := time.Now()
+
+	table := []struct {
+		name        string
+		offset      time.Duration
+		report      bool
+		occurrences int
+	}{
+		{name: "web", offset: 0, report: true, occurrences: 1},
+		{name: "web", offset: time.Second * 10, report: false},
+		{name: "web", offset: time.Second * 20, report: false},
+		{name: "worker", offset: time.Second * 20, report: true, occurrences: 1},
+		{name: "web", offset: time.Minute, report: true, occurrences: 3},
+		{name: "web", offset: time.Minute * 3, report: true, occurrences: 1},
+	}
+
+	for _, row := range table {
+		report, occurrences := c.add(row.name, start.Add(row.offset))
+		if report != row.report || occurrences != row.occurrences {
+			t.Errorf("unexpected result for %s at %s; expected: %v, %d, got: %v, %d", row.name, row.offset, row.report, row.occurrences, report, occurrences)
+		}
+	}
+
+	c.cleanup(start.Add(time.Minute * 5))
+	if len(c.tasks) != 0 {
+		t.Errorf("expected all tasks to be cleaned up, got: %v", c.tasks)
+	}
+}
+
+func TestCoalescerRollback(t *testing.T) {
+	c := newCoalescer(time.Minute)
+	start := time.Now()
+
+	c.add("web", start)
+	c.add("web", start.Add(time.Second*10))
+
+	if report, _ := c.add("web", start.Add(time.Minute*2)); !report {
+		t.Fatal("expected failure after the window to be reported")
+	}
+
+	c.rollback("web")
+
+	if report, occurrences := c.add("web", start.Add(time.Minute*2)); !report || occurrences != 2 {
+		t.Errorf("expected rolled back failure to be reported again with 2 occurrences, got: %v, %d", report, occurrences)
+	}
+
+	c.rollback("web")
+	c.rollback("web")
+
+	if len(c.tasks) != 0 {
+		t.Errorf("expected rolling back the first failure to forget the task, got: %v", c.tasks)
+	}
+}
@@ -0,0 +1,80 @@
+package monitor
+
+import (
+	"strings"
+
+	"github.com/cloudflare/complainer/label"
+	"github.com/cloudflare/complainer/reporter"
+)
+
+// instance is a reporter instance a failure is reported with
+type instance struct {
+	reporter string
+	instance string
+}
+
+// fallback returns the instance set in "fallback" config of the instance,
+// as reporter or reporter:instance, the second value is false if none is set
+func (m *Monitor) fallback(labels label.Labels, from instance) (instance, bool) {
+	value := strings.TrimSpace(reporter.NewConfigProvider(labels, from.reporter, from.instance, m.configSources()...)("fallback"))
+	if value == "" {
+		return instance{}, false
+	}
+
+	to := instance{reporter: value, instance: label.DefaultInstance}
+	if i := strings.Index(value, ":"); i >= 0 {
+		to = instance{reporter: value[:i], instance: value[i+1:]}
+	}
+
+	if _, ok := m.reporters[to.reporter]; !ok || to.instance == "" || labels.Disabled(to.reporter, to.instance) {
+		return instance{}, false
+	}
+
+	return to, true
+}
+
+// fallbackChains groups instances into chains by their fallback config,
+// an instance in a chain is only reported with if the previous one fails.
+// Instances that are fallbacks of others do not start chains of their own,
+// unless they are not reachable otherwise, like in fallback loops.
+func (m *Monitor) fallbackChains(labels label.Labels, candidates []instance) [][]instance {
+	fallbacks := map[instance]bool{}
+	for _, c := range candidates {
+		if to, ok := m.fallback(labels, c); ok && to != c {
+			fallbacks[to] = true
+		}
+	}
+
+	chains := [][]instance{}
+	covered := map[instance]bool{}
+
+	chain := func(head instance) []instance {
+		chain := []instance{head}
+		seen := map[instance]bool{head: true}
+
+		for next, ok := m.fallback(labels, head); ok && !seen[next]; next, ok = m.fallback(labels, next) {
+			chain = append(chain, next)
+			seen[next] = true
+		}
+
+		for _, c := range chain {
+			covered[c] = true
+		}
+
+		return chain
+	}
+
+	for _, c := range candidates {
+		if !fallbacks[c] {
+			chains = append(chains, chain(c))
+		}
+	}
+
+	for _, c := range candidates {
+		if !covered[c] {
+			chains = append(chains, chain(c))
+		}
+	}
+
+	return chains
+}
@@ -0,0 +1,74 @@
+package monitor
+
+import "time"
+
+// history tracks recent failures of tasks with the same name,
+// counting how many times a task failed within a window
+type history struct {
+	window time.Duration
+	tasks  map[string][]time.Time
+}
+
+func newHistory(window time.Duration) *history {
+	return &history{
+		window: window,
+		tasks:  map[string][]time.Time{},
+	}
+}
+
+// add registers a failure of the named task at the specified time and
+// returns the number of failures within the window, including the current one
+func (h *history) add(name string, at time.Time) int {
+	times := append(h.recent(h.tasks[name], at), at)
+	h.tasks[name] = times
+
+	count := 0
+	for _, t := range times {
+		if !t.After(at) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// rollback forgets a failure of the named task at the specified time,
+// so it is not counted twice when it is processed again
+func (h *history) rollback(name string, at time.Time) {
+	times := h.tasks[name]
+	for i := len(times) - 1; i >= 0; i-- {
+		if times[i].Equal(at) {
+			times = append(times[:i], times[i+1:]...)
+			break
+		}
+	}
+
+	if len(times) == 0 {
+		delete(h.tasks, name)
+	} else {
+		h.tasks[name] = times
+	}
+}
+
+// cleanup forgets failures that are out of the window
+func (h *history) cleanup(now time.Time) {
+	for name, times := range h.tasks {
+		if times = h.recent(times, now); len(times) == 0 {
+			delete(h.tasks, name)
+		} else {
+			h.tasks[name] = times
+		}
+	}
+}
+
+// recent returns failures that are within the window of the specified time
+func (h *history) recent(times []time.Time, now time.Time) []time.Time {
+	recent := times[:0]
+	for _, t := range times {
+		if now.Sub(t) < h.window {
+			recent = append(recent, t)
+		}
+	}
+
+	return recent
+}
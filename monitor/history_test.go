@@ -0,0 +1,55 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	h := newHistory(time.Minute * 10)
+	start := time.Now()
+
+	table := []struct {
+		name   string
+		offset time.Duration
+		count  int
+	}{
+		{name: "web", offset: 0, count: 1},
+		{name: "web", offset: time.Minute, count: 2},
+		{name: "worker", offset: time.Minute * 2, count: 1},
+		{name: "web", offset: time.Minute * 5, count: 3},
+		{name: "web", offset: time.Minute * 10, count: 3},
+		{name: "web", offset: time.Minute * 30, count: 1},
+	}
+
+	for _, row := range table {
+		if count := h.add(row.name, start.Add(row.offset)); count != row.count {
+			t.Errorf("unexpected count for %s at %s; expected: %d, got: %d", row.name, row.offset, row.count, count)
+		}
+	}
+
+	h.cleanup(start.Add(time.Hour))
+	if len(h.tasks) != 0 {
+		t.Errorf("expected all tasks to be cleaned up, got: %v", h.tasks)
+	}
+}
+
+func TestHistoryRollback(t *testing.T) {
+	h := newHistory(time.Minute * 10)
+	start := time.Now()
+
+	h.add("web", start)
+	h.add("web", start.Add(time.Minute))
+	h.rollback("web", start.Add(time.Minute))
+
+	if count := h.add("web", start.Add(time.Minute)); count != 2 {
+		t.Errorf("expected rolled back failure to be counted once, got: %d", count)
+	}
+
+	h.rollback("web", start.Add(time.Minute))
+	h.rollback("web", start)
+
+	if len(h.tasks) != 0 {
+		t.Errorf("expected rolling back all failures to forget the task, got: %v", h.tasks)
+	}
+}
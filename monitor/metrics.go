@@ -0,0 +1,14 @@
+package monitor
+
+import "github.com/cloudflare/complainer/metrics"
+
+var (
+	failuresSeen     = metrics.NewCounter("complainer_failures_seen_total", "Number of new failures seen in Mesos.")
+	failuresReported = metrics.NewCounter("complainer_failures_reported_total", "Number of failures sent to reporters.")
+	reports          = metrics.NewCounter("complainer_reports_total", "Number of reports by reporter and result.", "reporter", "result")
+	resolutions      = metrics.NewCounter("complainer_resolutions_total", "Number of resolutions of reported failures by reporter and result.", "reporter", "result")
+	reportsDropped   = metrics.NewCounter("complainer_reports_dropped_total", "Number of reports dropped by rate limit.", "reporter")
+	uploadErrors     = metrics.NewCounter("complainer_upload_errors_total", "Number of errors uploading logs.")
+	mesosErrors      = metrics.NewCounter("complainer_mesos_errors_total", "Number of errors fetching data from Mesos.")
+	runDuration      = metrics.NewHistogram("complainer_run_duration_seconds", "Duration of monitor runs.", []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60})
+)
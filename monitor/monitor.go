@@ -1,55 +1,385 @@
 package monitor
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"log"
 	"net/http"
 	"net/http/pprof"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/config"
+	"github.com/cloudflare/complainer/election"
 	"github.com/cloudflare/complainer/label"
+	"github.com/cloudflare/complainer/logging"
 	"github.com/cloudflare/complainer/matcher"
 	"github.com/cloudflare/complainer/mesos"
+	"github.com/cloudflare/complainer/metrics"
+	"github.com/cloudflare/complainer/redact"
 	"github.com/cloudflare/complainer/reporter"
+	"github.com/cloudflare/complainer/state"
 	"github.com/cloudflare/complainer/uploader"
 )
 
 const (
 	// DefaultName is the default name of the complainer instance
 	DefaultName = "default"
-	// timeout before purging old seen tasks
-	timeout = time.Minute
+	// DefaultConcurrency is the default number of reports sent concurrently
+	DefaultConcurrency = 4
+	// DefaultRetryAttempts is the default number of attempts to send a report
+	DefaultRetryAttempts = 3
+	// DefaultUploadAttempts is the default number of attempts to upload logs
+	DefaultUploadAttempts = 3
+	// DefaultRetryMaxDelay is the default maximum delay between attempts
+	DefaultRetryMaxDelay = time.Second * 30
+	// DefaultSeenTimeout is the default timeout before purging old seen tasks
+	DefaultSeenTimeout = time.Minute
+	// DefaultStaleTimeout is the default age of failures considered stale
+	DefaultStaleTimeout = DefaultSeenTimeout / 2
+	// FirstRunSuppressAll skips all failures on the first run
+	FirstRunSuppressAll = "suppress-all"
+	// FirstRunSuppressOld skips failures on the first run,
+	// unless they finished within the first run window
+	FirstRunSuppressOld = "suppress-old"
+	// FirstRunReportAll reports failures on the first run as usual
+	FirstRunReportAll = "report-all"
+	// DefaultHealthThreshold is the default maximum age of the last successful run
+	// for the monitor to be considered healthy
+	DefaultHealthThreshold = time.Minute
+	// DefaultStderrTailBytes is the default maximum size of stderr tail
+	DefaultStderrTailBytes = 2048
+	// DefaultMinLogRetries is the default number of times to fetch logs
+	// again when they are smaller than the minimum size
+	DefaultMinLogRetries = 2
+	// DefaultMinLogDelay is the default delay between fetches of small logs
+	DefaultMinLogDelay = time.Second * 2
+	// DefaultReportTimeout is the default timeout of a single report attempt
+	DefaultReportTimeout = time.Second * 30
+	// initial delay between attempts, doubled after every attempt
+	retryBaseDelay = time.Second
 )
 
+// unresolvedFailures are reported failures of a task waiting for it to recover,
+// every failure is resolved separately, as reporters key alerts by task id
+type unresolvedFailures struct {
+	failures []complainer.Failure
+	// failed is the time of the last failure of the task
+	failed time.Time
+}
+
 // Monitor is responsible for routing failed tasks to the configured reporters
 type Monitor struct {
-	name      string
-	mesos     *mesos.Cluster
-	uploader  uploader.Uploader
-	matcher   matcher.FailureMatcher
-	reporters map[string]reporter.Reporter
-	defaults  bool
-	recent    map[string]time.Time
-	mu        sync.Mutex
-	err       error
-}
-
-// NewMonitor creates the new monitor with a name, uploader and reporters
-func NewMonitor(name string, cluster *mesos.Cluster, up uploader.Uploader, reporters map[string]reporter.Reporter, defaults bool, match matcher.FailureMatcher) *Monitor {
+	name        string
+	names       []string
+	mesos       *mesos.Cluster
+	uploader    uploader.Uploader
+	matcher     matcher.FailureMatcher
+	reporters   map[string]reporter.Reporter
+	defaults    bool
+	concurrency int
+	order       []string
+	stopOnFirst bool
+	attempts    int
+	maxDelay    time.Duration
+	timeout     time.Duration
+	timeouts    map[string]time.Duration
+	store       state.Store
+	seen        time.Duration
+	stale       time.Duration
+	tailLines   int
+	tailBytes   int
+	redactor    *redact.Redactor
+	uploadTries int
+	uploadFall  bool
+	minLogBytes int64
+	minLogTries int
+	minLogDelay time.Duration
+	dryRun      bool
+	limiter     *rateLimiter
+	coalescer   *coalescer
+	history     *history
+	skipUpload  bool
+	strictEnv   bool
+	dedup       bool
+	configFile  *config.File
+	reloaded    *config.File
+	lock        election.Lock
+	leader      bool
+	recent      map[string]time.Time
+	contentTime time.Duration
+	firstRun    string
+	firstWindow time.Duration
+	resolve     time.Duration
+	unresolved  map[string]*unresolvedFailures
+	mu          sync.Mutex
+	err         error
+	started     time.Time
+	lastRun     time.Time
+	lastSuccess time.Time
+	threshold   time.Duration
+}
+
+// NewMonitor creates the new monitor with a name, uploader and reporters.
+// Seen failures are persisted across restarts if store is not nil.
+func NewMonitor(name string, cluster *mesos.Cluster, up uploader.Uploader, reporters map[string]reporter.Reporter, defaults bool, match matcher.FailureMatcher, store state.Store) *Monitor {
 	if match == nil {
 		match = &matcher.NoopMatcher{}
 	}
 
 	return &Monitor{
-		name:      name,
-		mesos:     cluster,
-		uploader:  up,
-		matcher:   match,
-		reporters: reporters,
-		defaults:  defaults,
+		name:        name,
+		names:       []string{name},
+		mesos:       cluster,
+		uploader:    up,
+		matcher:     match,
+		reporters:   reporters,
+		defaults:    defaults,
+		concurrency: DefaultConcurrency,
+		attempts:    DefaultRetryAttempts,
+		maxDelay:    DefaultRetryMaxDelay,
+		uploadTries: DefaultUploadAttempts,
+		timeout:     DefaultReportTimeout,
+		store:       store,
+		seen:        DefaultSeenTimeout,
+		stale:       DefaultStaleTimeout,
+		firstRun:    FirstRunSuppressAll,
+		tailBytes:   DefaultStderrTailBytes,
+		started:     time.Now(),
+		threshold:   DefaultHealthThreshold,
+	}
+}
+
+// SetTimeouts sets how long seen failures are remembered and
+// how old failures can be before they are considered stale and skipped
+func (m *Monitor) SetTimeouts(seen, stale time.Duration) {
+	m.seen = seen
+	m.stale = stale
+}
+
+// SetHealthThreshold sets the maximum age of the last successful run
+// for the monitor to be considered healthy
+func (m *Monitor) SetHealthThreshold(threshold time.Duration) {
+	m.threshold = threshold
+}
+
+// SetRateLimit limits the number of reports sent by every reporter instance
+// to max per interval, reports over the limit are dropped. Zero max disables
+// rate limiting.
+func (m *Monitor) SetRateLimit(max int, interval time.Duration) {
+	if max < 1 {
+		m.limiter = nil
+		return
+	}
+
+	m.limiter = newRateLimiter(max, interval)
+}
+
+// SetCoalesceWindow enables coalescing of repeated failures of tasks with
+// the same name: after a report, failures of the task are not reported
+// within the window and counted in occurrences of the next report instead.
+// Zero window disables coalescing.
+func (m *Monitor) SetCoalesceWindow(window time.Duration) {
+	if window <= 0 {
+		m.coalescer = nil
+		return
+	}
+
+	m.coalescer = newCoalescer(window)
+}
+
+// SetFailureCountWindow enables counting of failures of tasks with the same
+// name within the window, the count is set in FailureCount of each failure.
+// Zero window disables counting.
+func (m *Monitor) SetFailureCountWindow(window time.Duration) {
+	if window <= 0 {
+		m.history = nil
+		return
+	}
+
+	m.history = newHistory(window)
+}
+
+// SetDryRun enables dry-run mode, where messages of reporters are logged
+// instead of being sent, uploads are skipped as well if skipUpload is set
+func (m *Monitor) SetDryRun(dryRun, skipUpload bool) {
+	m.dryRun = dryRun
+	m.skipUpload = skipUpload
+}
+
+// SetConfigFile sets the config file with default reporter instances and
+// config values, which are used when task labels do not have them
+func (m *Monitor) SetConfigFile(f *config.File) {
+	m.configFile = f
+}
+
+// Reload replaces the config file while complainer is running. Reporter
+// config is swapped at the start of the next run, so the run in progress
+// keeps using the config it started with. Seen failures are kept.
+func (m *Monitor) Reload(f *config.File) {
+	m.mu.Lock()
+	m.reloaded = f
+	m.mu.Unlock()
+}
+
+// applyReload swaps in the config file reloaded since the last run
+func (m *Monitor) applyReload() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.reloaded != nil {
+		m.configFile = m.reloaded
+		m.reloaded = nil
+	}
+}
+
+// SetResolveWindow enables resolution of reported failures: if a task with
+// the same name is seen healthy within the window after the failure,
+// reporter instances with resolve config set to true are told about it.
+// Zero window disables resolution.
+func (m *Monitor) SetResolveWindow(window time.Duration) {
+	m.resolve = window
+	m.unresolved = map[string]*unresolvedFailures{}
+}
+
+// SetDedup enables deduplication of reports by destination: instances
+// of a reporter resolving to the same destination get a single report
+func (m *Monitor) SetDedup(dedup bool) {
+	m.dedup = dedup
+}
+
+// SetLock enables leader election, only the instance holding the lock
+// reports failures, while others stand by and take over if it is lost
+func (m *Monitor) SetLock(lock election.Lock) {
+	m.lock = lock
+}
+
+// SetNames sets complainer names to evaluate labels of failures for, so
+// a single process can report failures for several teams. The first name
+// is the primary one and works the same way as the only name. Other names
+// only report failures of tasks that have labels for them.
+func (m *Monitor) SetNames(names []string) {
+	m.name = names[0]
+	m.names = names
+}
+
+// SetFirstRun sets how failures are treated on the first run without
+// remembered seen failures, when complainer cannot know which of them
+// were already reported. Window is only used with FirstRunSuppressOld.
+func (m *Monitor) SetFirstRun(mode string, window time.Duration) error {
+	switch mode {
+	case FirstRunSuppressAll, FirstRunSuppressOld, FirstRunReportAll:
+	default:
+		return fmt.Errorf("unknown first run mode %q, expected %s, %s or %s", mode, FirstRunSuppressAll, FirstRunSuppressOld, FirstRunReportAll)
 	}
+
+	m.firstRun = mode
+	m.firstWindow = window
+
+	return nil
+}
+
+// SetContentDedup makes failures with the same framework, task name and
+// finished time, rounded to precision, duplicates even if task ids differ.
+// Agents that reregister can bring back failures under new ids.
+// Zero precision disables it, failures are then only deduplicated by id.
+func (m *Monitor) SetContentDedup(precision time.Duration) {
+	m.contentTime = precision
+}
+
+// SetStrictEnv makes reports fail if reporter config in labels references
+// environment variables that are not set, instead of using empty values
+func (m *Monitor) SetStrictEnv(strict bool) {
+	m.strictEnv = strict
+}
+
+// SetStderrTail enables fetching of the last lines of stderr for reporters,
+// tail is also cut to the specified number of bytes to keep messages small
+func (m *Monitor) SetStderrTail(lines, bytes int) {
+	m.tailLines = lines
+	m.tailBytes = bytes
+}
+
+// SetRedactor sets the redactor for secrets in stderr tail
+func (m *Monitor) SetRedactor(redactor *redact.Redactor) {
+	m.redactor = redactor
+}
+
+// SetMinLogSize makes the monitor wait for logs to be flushed: if stdout
+// and stderr together are smaller than bytes, their size is checked again
+// up to retries times with the delay before reporting. Zero bytes disables it.
+func (m *Monitor) SetMinLogSize(bytes int64, retries int, delay time.Duration) {
+	m.minLogBytes = bytes
+	m.minLogTries = retries
+	m.minLogDelay = delay
+}
+
+// SetConcurrency sets the maximum number of reports sent concurrently
+// for a single failure, values below one make reports sequential
+func (m *Monitor) SetConcurrency(concurrency int) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	m.concurrency = concurrency
+}
+
+// SetReporterOrder sets the order reports of a failure are sent in, reporters
+// that are not listed go after listed ones in alphabetical order. With
+// stopOnSuccess reports are sent one by one and the first successful one
+// stops the rest from being sent.
+func (m *Monitor) SetReporterOrder(order []string, stopOnSuccess bool) {
+	m.order = nil
+	for _, n := range order {
+		if n = strings.TrimSpace(n); n != "" {
+			m.order = append(m.order, n)
+		}
+	}
+
+	m.stopOnFirst = stopOnSuccess
+}
+
+// SetRetry sets the maximum number of attempts to send a report
+// and the maximum delay between attempts for exponential backoff
+func (m *Monitor) SetRetry(attempts int, maxDelay time.Duration) {
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	m.attempts = attempts
+	m.maxDelay = maxDelay
+}
+
+// SetUploadRetry sets the maximum number of attempts to upload logs,
+// retried with the same backoff as reports. With fallback failures
+// are reported with mesos log urls if logs cannot be uploaded at all.
+func (m *Monitor) SetUploadRetry(attempts int, fallback bool) {
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	m.uploadTries = attempts
+	m.uploadFall = fallback
+}
+
+// SetReportTimeout sets the timeout of a single report attempt, reporters
+// listed in overrides use their own timeouts. Zero timeout disables it.
+func (m *Monitor) SetReportTimeout(timeout time.Duration, overrides map[string]time.Duration) {
+	m.timeout = timeout
+	m.timeouts = overrides
+}
+
+// reportTimeout returns the timeout of a single report attempt of the reporter
+func (m *Monitor) reportTimeout(reporter string) time.Duration {
+	if timeout, ok := m.timeouts[reporter]; ok {
+		return timeout
+	}
+
+	return m.timeout
 }
 
 // ListenAndServe launches an http server on the requested address.
@@ -60,6 +390,16 @@ func (m *Monitor) ListenAndServe(addr string) error {
 	// health check
 	mux.HandleFunc("/health", m.handleHealthCheck)
 
+	// liveness and readiness probes
+	mux.HandleFunc("/healthz", m.handleLiveness)
+	mux.HandleFunc("/readyz", m.handleReadiness)
+
+	// logs of agents that are not reachable directly
+	mux.HandleFunc("/logs", m.handleLogs)
+
+	// prometheus metrics
+	mux.Handle("/metrics", metrics.Handler())
+
 	// pprof
 	mux.Handle("/debug/pprof/", http.HandlerFunc(pprof.Index))
 	mux.Handle("/debug/pprof/cmdline", http.HandlerFunc(pprof.Cmdline))
@@ -77,7 +417,7 @@ func (m *Monitor) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
 
 	if err == nil {
 		if _, err = w.Write([]byte("I am mostly okay, thanks.\n")); err != nil {
-			log.Printf("Error responding that we're okay: %s", err)
+			logging.Error(fmt.Sprintf("Error responding that we're okay: %s", err), logging.Fields{"error": err})
 		}
 
 		return
@@ -85,107 +425,1000 @@ func (m *Monitor) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusInternalServerError)
 	if _, err = w.Write([]byte(fmt.Sprintf("Something is fishy: %s\n", err))); err != nil {
-		log.Printf("Error responding that we're not okay: %s", err)
+		logging.Error(fmt.Sprintf("Error responding that we're not okay: %s", err), logging.Fields{"error": err})
+	}
+}
+
+// handleLiveness responds with success if the last successful run
+// happened within the health threshold, time since start counts
+// as success to give the first run a chance to complete
+func (m *Monitor) handleLiveness(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	err := m.err
+	lastRun := m.lastRun
+	lastSuccess := m.lastSuccess
+	m.mu.Unlock()
+
+	since := lastSuccess
+	if since.IsZero() {
+		since = m.started
+	}
+
+	if time.Since(since) <= m.threshold {
+		respond(w, http.StatusOK, fmt.Sprintf("ok, last run at %s\n", lastRun.Format(time.RFC3339)))
+		return
+	}
+
+	respond(w, http.StatusInternalServerError, fmt.Sprintf("no successful runs since %s, last error: %v\n", since.Format(time.RFC3339), err))
+}
+
+// handleReadiness responds with success if mesos masters are reachable
+func (m *Monitor) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	if err := m.mesos.Ping(r.Context()); err != nil {
+		respond(w, http.StatusServiceUnavailable, fmt.Sprintf("mesos is not reachable: %s\n", err))
+		return
+	}
+
+	respond(w, http.StatusOK, "ok\n")
+}
+
+// handleLogs proxies stdout and stderr of tasks from agents
+func (m *Monitor) handleLogs(w http.ResponseWriter, r *http.Request) {
+	data, err := m.mesos.ReadLog(r.Context(), r.URL.Query().Get("agent"), r.URL.Query().Get("path"))
+	if err == mesos.ErrLogNotFound {
+		respond(w, http.StatusNotFound, "log not found\n")
+		return
+	}
+
+	if err != nil {
+		respond(w, http.StatusBadGateway, fmt.Sprintf("cannot read log from agent: %s\n", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if _, err := w.Write(data); err != nil {
+		logging.Error(fmt.Sprintf("Error serving log: %s", err), logging.Fields{"error": err})
+	}
+}
+
+func respond(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	if _, err := w.Write([]byte(message)); err != nil {
+		logging.Error(fmt.Sprintf("Error responding to probe: %s", err), logging.Fields{"error": err})
 	}
 }
 
-// Run does one run across failed tasks and reports any new failures
-func (m *Monitor) Run() error {
-	failures, err := m.mesos.Failures()
+// Run does one run across failed tasks and reports any new failures.
+// Once the context is done, requests to mesos are cancelled and
+// failures that are not processed yet are left for the next run.
+func (m *Monitor) Run(ctx context.Context) error {
+	started := time.Now()
+	defer func() {
+		runDuration.Observe(time.Since(started).Seconds())
+	}()
+
+	m.applyReload()
+
+	if m.lock != nil {
+		leader, err := m.lead(ctx)
+		if err != nil || !leader {
+			m.recordRun(err)
+			return err
+		}
+	}
+
+	failures, err := m.mesos.Failures(ctx)
 	defer func() {
-		m.mu.Lock()
-		m.err = err
-		m.mu.Unlock()
+		m.recordRun(err)
 	}()
 
 	if err != nil {
+		mesosErrors.Inc()
 		return err
 	}
 
 	first := false
 	if m.recent == nil {
-		m.recent = map[string]time.Time{}
-		first = true
+		m.recent = m.loadRecent()
+		first = m.recent == nil
+		if first {
+			m.recent = map[string]time.Time{}
+		}
 	}
 
 	for _, failure := range failures {
+		// Failures left unchecked are picked up by the next run
+		if ctx.Err() != nil {
+			break
+		}
+
 		if m.checkFailure(failure, first) {
-			if err := m.processFailure(failure); err != nil {
-				log.Printf("Error reporting failure of %s: %s", failure.ID, err)
+			m.failedAgain(failure)
+
+			if m.history != nil {
+				failure.FailureCount = m.history.add(failure.Name, failure.Finished)
+			}
+
+			if !m.coalesce(&failure) {
+				continue
+			}
+
+			if err := m.processFailure(ctx, failure); err != nil {
+				// Interrupted failures are picked up by the next run
+				if ctx.Err() != nil {
+					m.rollback(failure)
+				}
+
+				logging.Error(fmt.Sprintf("Error reporting failure of %s: %s", failure.ID, err), logging.Fields{
+					"failure_id": failure.ID,
+					"error":      err,
+				})
 			}
 		}
 	}
 
 	m.cleanupRecent()
+	m.saveRecent()
+
+	if m.resolve > 0 {
+		m.resolveRecovered(ctx)
+	}
+
+	if m.coalescer != nil {
+		m.coalescer.cleanup(time.Now())
+	}
+
+	if m.history != nil {
+		m.history.cleanup(time.Now())
+	}
 
 	return nil
 }
 
+// recordRun remembers the result of the run for health checks
+func (m *Monitor) recordRun(err error) {
+	m.mu.Lock()
+	m.err = err
+	m.lastRun = time.Now()
+	if err == nil {
+		m.lastSuccess = m.lastRun
+	}
+	m.mu.Unlock()
+}
+
+// lead acquires or renews the lock, returning whether we are the leader.
+// Seen failures are forgotten on losing leadership, so they are loaded
+// from the store shared with the leader after taking over.
+func (m *Monitor) lead(ctx context.Context) (bool, error) {
+	leader, err := m.lock.Acquire(ctx)
+	if err != nil {
+		leader = false
+		err = fmt.Errorf("cannot acquire leader lock: %s", err)
+	}
+
+	if leader != m.leader {
+		if leader {
+			logging.Info(fmt.Sprintf("Complainer %s became the leader", m.name), nil)
+		} else {
+			logging.Warning(fmt.Sprintf("Complainer %s is not the leader, standing by", m.name), nil)
+			m.recent = nil
+		}
+	}
+
+	m.leader = leader
+
+	return leader, err
+}
+
+// Leader returns whether this instance reports failures, which is
+// always the case without leader election. It is only updated by Run.
+func (m *Monitor) Leader() bool {
+	return m.lock == nil || m.leader
+}
+
+// rollback forgets the failure was seen, so it is processed again
+func (m *Monitor) rollback(failure complainer.Failure) {
+	delete(m.recent, failure.ID)
+
+	if m.contentTime > 0 {
+		delete(m.recent, m.contentKey(failure, 0))
+	}
+
+	if m.coalescer != nil {
+		m.coalescer.rollback(failure.Name)
+	}
+
+	if m.history != nil {
+		m.history.rollback(failure.Name, failure.Finished)
+	}
+}
+
+// loadRecent returns seen failures from the store,
+// nil is returned if there is nothing to load
+func (m *Monitor) loadRecent() map[string]time.Time {
+	if m.store == nil {
+		return nil
+	}
+
+	recent, err := m.store.Load()
+	if err != nil {
+		logging.Error(fmt.Sprintf("Error loading seen failures: %s", err), logging.Fields{"error": err})
+		return nil
+	}
+
+	return recent
+}
+
+func (m *Monitor) saveRecent() {
+	if m.store == nil {
+		return
+	}
+
+	if err := m.store.Save(m.recent); err != nil {
+		logging.Error(fmt.Sprintf("Error saving seen failures: %s", err), logging.Fields{"error": err})
+	}
+}
+
 func (m *Monitor) cleanupRecent() {
 	for n, ts := range m.recent {
-		if time.Since(ts) > timeout {
+		if time.Since(ts) > m.seen {
 			delete(m.recent, n)
 		}
 	}
 }
 
 func (m *Monitor) checkFailure(failure complainer.Failure, first bool) bool {
-	if !m.matcher.Match(failure.Framework) {
+	if !m.recent[failure.ID].IsZero() {
 		return false
 	}
 
-	if !m.recent[failure.ID].IsZero() {
+	m.recent[failure.ID] = failure.Finished
+	failuresSeen.Inc()
+
+	if m.contentTime > 0 && m.duplicate(failure) {
+		logging.Info(fmt.Sprintf("Skipping %s: same failure was seen with another task id", failure), logging.Fields{"failure_id": failure.ID})
 		return false
 	}
 
-	m.recent[failure.ID] = failure.Finished
+	if !m.matcher.Match(failure) {
+		return false
+	}
 
-	if time.Since(failure.Finished) > timeout/2 {
+	if time.Since(failure.Finished) > m.stale {
 		return false
 	}
 
 	if first {
+		switch m.firstRun {
+		case FirstRunReportAll:
+			return true
+		case FirstRunSuppressOld:
+			return time.Since(failure.Finished) <= m.firstWindow
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// duplicate returns whether the same failure was seen with another id,
+// neighbouring intervals are checked as well, so failures finished
+// within precision from each other are always duplicates
+func (m *Monitor) duplicate(failure complainer.Failure) bool {
+	for _, shift := range []int{-1, 1} {
+		if !m.recent[m.contentKey(failure, shift)].IsZero() {
+			return true
+		}
+	}
+
+	key := m.contentKey(failure, 0)
+	if !m.recent[key].IsZero() {
+		return true
+	}
+
+	m.recent[key] = failure.Finished
+
+	return false
+}
+
+// contentKey returns the key of the failure for content deduplication,
+// shift moves finished time to neighbouring intervals of precision
+func (m *Monitor) contentKey(failure complainer.Failure, shift int) string {
+	finished := failure.Finished.Truncate(m.contentTime).Add(m.contentTime * time.Duration(shift))
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%d", failure.Framework, failure.Name, finished.Unix())))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// coalesce returns whether the failure should be reported,
+// setting the number of occurrences since the last report
+func (m *Monitor) coalesce(failure *complainer.Failure) bool {
+	if m.coalescer == nil {
+		return true
+	}
+
+	report, occurrences := m.coalescer.add(failure.Name, failure.Finished)
+	if !report {
+		logging.Info(fmt.Sprintf("Coalescing %s with previous failures", failure), logging.Fields{"failure_id": failure.ID})
 		return false
 	}
 
+	failure.Occurrences = occurrences
+
 	return true
 }
 
-func (m *Monitor) processFailure(failure complainer.Failure) error {
-	labels := label.NewLabels(m.name, failure.Labels, m.defaults)
+// labels returns labels of the failure for every complainer name
+// that the failure is addressed to, the primary name always gets it
+func (m *Monitor) labels(failure complainer.Failure) []label.Labels {
+	sets := []label.Labels{label.NewLabels(m.name, failure.Labels, m.defaults)}
+
+	for _, name := range m.names[1:] {
+		if labels := label.NewLabels(name, failure.Labels, m.defaults); labels.Mentioned() {
+			sets = append(sets, labels)
+		}
+	}
+
+	return sets
+}
+
+func (m *Monitor) processFailure(ctx context.Context, failure complainer.Failure) error {
+	sets := m.labels(failure)
+	failure.Complainer = sets[0].Complainer()
 
 	skip := true
-	for n := range m.reporters {
-		for range labels.Instances(n) {
-			skip = false
+	for _, labels := range sets {
+		for n := range m.reporters {
+			for range m.instances(labels, n) {
+				skip = false
+			}
 		}
 	}
 
 	if skip {
-		log.Printf("Skipping %s", failure)
+		logging.Info(fmt.Sprintf("Skipping %s", failure), logging.Fields{"failure_id": failure.ID})
 		return nil
 	}
 
-	log.Printf("Reporting %s", failure)
+	logging.Info(fmt.Sprintf("Reporting %s", failure), logging.Fields{"failure_id": failure.ID})
 
-	stdoutURL, stderrURL, err := m.mesos.Logs(failure)
+	stdoutURL, stderrURL, err := m.mesos.Logs(ctx, failure)
 	if err != nil {
+		mesosErrors.Inc()
 		return fmt.Errorf("cannot get stdout and stderr urls from mesos: %s", err)
 	}
 
-	stdoutURL, stderrURL, err = m.uploader.Upload(failure, stdoutURL, stderrURL)
-	if err != nil {
-		return fmt.Errorf("cannot get stdout and stderr urls from uploader: %s", err)
+	failure.SandboxURL = m.mesos.SandboxURL(failure, stdoutURL)
+
+	if m.minLogBytes > 0 {
+		m.waitForLogs(ctx, failure, stdoutURL, stderrURL)
 	}
 
-	for n, r := range m.reporters {
-		for _, i := range labels.Instances(n) {
-			config := reporter.NewConfigProvider(labels, n, i)
-			if err := r.Report(failure, config, stdoutURL, stderrURL); err != nil {
-				log.Printf("Cannot generate report with %s [instance=%s] for task with ID %s: %s", n, i, failure.ID, err)
+	// Logs are downloaded once for all upload attempts and the stderr tail
+	logs := uploader.NewLogs()
+	sandboxStderrURL := stderrURL
+
+	if !m.dryRun || !m.skipUpload {
+		uploadedStdoutURL, uploadedStderrURL, err := m.upload(uploader.WithLogs(ctx, logs), failure, stdoutURL, stderrURL)
+		if err != nil {
+			uploadErrors.Inc()
+
+			if !m.uploadFall || ctx.Err() != nil {
+				return fmt.Errorf("cannot get stdout and stderr urls from uploader: %s", err)
 			}
+
+			logging.Error(fmt.Sprintf("Cannot upload logs of task with ID %s, reporting with mesos urls: %s", failure.ID, err), logging.Fields{
+				"failure_id": failure.ID,
+				"error":      err,
+			})
+		} else {
+			stdoutURL, stderrURL = uploadedStdoutURL, uploadedStderrURL
 		}
 	}
 
+	if m.tailLines > 0 {
+		m.addStderrTail(ctx, &failure, logs, sandboxStderrURL)
+	}
+
+	// Logs that are not uploaded are linked through the log proxy if it is set
+	stdoutURL, stderrURL = m.mesos.PublicURL(stdoutURL), m.mesos.PublicURL(stderrURL)
+
+	for _, labels := range sets {
+		failure.Complainer = labels.Complainer()
+		m.dispatch(ctx, failure, labels, stdoutURL, stderrURL)
+	}
+
+	// Reports abandoned because of cancellation are not complete
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	failuresReported.Inc()
+
+	if m.resolve > 0 {
+		m.addUnresolved(failure)
+	}
+
 	return nil
 }
+
+func resolveKey(framework, name string) string {
+	return framework + "/" + name
+}
+
+// addUnresolved remembers the reported failure until the task recovers,
+// earlier failures of the same task stay to be resolved too
+func (m *Monitor) addUnresolved(failure complainer.Failure) {
+	key := resolveKey(failure.Framework, failure.Name)
+
+	u, ok := m.unresolved[key]
+	if !ok {
+		u = &unresolvedFailures{}
+		m.unresolved[key] = u
+	}
+
+	for i, f := range u.failures {
+		if f.ID == failure.ID {
+			u.failures = append(u.failures[:i], u.failures[i+1:]...)
+			break
+		}
+	}
+
+	u.failures = append(u.failures, failure)
+
+	if failure.Finished.After(u.failed) {
+		u.failed = failure.Finished
+	}
+}
+
+// failedAgain remembers that the task of the unresolved failure failed again,
+// so healthy tasks started before that do not resolve the failure
+func (m *Monitor) failedAgain(failure complainer.Failure) {
+	if u, ok := m.unresolved[resolveKey(failure.Framework, failure.Name)]; ok && failure.Finished.After(u.failed) {
+		u.failed = failure.Finished
+	}
+}
+
+// resolveRecovered resolves failures of tasks that are healthy again,
+// failures not resolved within the resolve window are forgotten
+func (m *Monitor) resolveRecovered(ctx context.Context) {
+	for _, task := range m.mesos.Healthy() {
+		key := resolveKey(task.Framework, task.Name)
+
+		u, ok := m.unresolved[key]
+		if !ok || task.Started.Before(u.failed) {
+			continue
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		delete(m.unresolved, key)
+
+		for _, failure := range u.failures {
+			m.resolveFailure(ctx, failure)
+		}
+	}
+
+	for key, u := range m.unresolved {
+		if time.Since(u.failed) > m.resolve {
+			delete(m.unresolved, key)
+		}
+	}
+}
+
+// resolveFailure tells reporter instances with resolve enabled
+// that the task of the failure recovered
+func (m *Monitor) resolveFailure(ctx context.Context, failure complainer.Failure) {
+	for _, labels := range m.labels(failure) {
+		failure.Complainer = labels.Complainer()
+		m.resolveInstances(ctx, failure, labels)
+	}
+}
+
+// resolveInstances resolves the failure with instances for the labels
+func (m *Monitor) resolveInstances(ctx context.Context, failure complainer.Failure, labels label.Labels) {
+	for n, r := range m.reporters {
+		rr, ok := r.(reporter.Resolver)
+		if !ok {
+			continue
+		}
+
+		for _, i := range m.instances(labels, n) {
+			config := reporter.NewConfigProvider(labels, n, i, m.configSources()...)
+			if config("resolve") != "true" {
+				continue
+			}
+
+			// Instances that did not report the failure have nothing to resolve
+			if report, err := reporter.Condition(failure, config, "", ""); err != nil || !report {
+				continue
+			}
+
+			fields := logging.Fields{
+				"failure_id": failure.ID,
+				"reporter":   n,
+				"instance":   i,
+			}
+
+			if m.dryRun {
+				logging.Info(fmt.Sprintf("Dry run: would resolve task with ID %s with %s [instance=%s]", failure.ID, n, i), fields)
+				continue
+			}
+
+			if err := rr.Resolve(ctx, failure, config); err != nil {
+				resolutions.Inc(n, "error")
+				fields["error"] = err
+				logging.Error(fmt.Sprintf("Cannot resolve task with ID %s with %s [instance=%s]: %s", failure.ID, n, i, err), fields)
+				continue
+			}
+
+			resolutions.Inc(n, "success")
+			logging.Info(fmt.Sprintf("Resolved task with ID %s with %s [instance=%s]", failure.ID, n, i), fields)
+		}
+	}
+}
+
+// addStderrTail sets the stderr tail of the failure, taking it from stderr
+// downloaded by the uploader if it has the end of the log, so it is not
+// fetched again
+func (m *Monitor) addStderrTail(ctx context.Context, failure *complainer.Failure, logs *uploader.Logs, stderrURL string) {
+	var tail []byte
+	found := false
+
+	if data, ok := logs.Downloaded(stderrURL); ok {
+		tail, found = m.mesos.DownloadedTail(data, m.tailBytes, m.tailLines)
+	}
+
+	if !found {
+		var err error
+		if tail, err = m.mesos.Tail(ctx, stderrURL, m.tailBytes, m.tailLines); err != nil {
+			logging.Error(fmt.Sprintf("Cannot get stderr tail for task with ID %s: %s", failure.ID, err), logging.Fields{
+				"failure_id": failure.ID,
+				"error":      err,
+			})
+
+			return
+		}
+	}
+
+	if m.redactor != nil {
+		tail = m.redactor.Redact(tail)
+	}
+
+	failure.StderrTail = string(tail)
+}
+
+// waitForLogs waits for logs to reach the minimum size, agents may not
+// have flushed them right after the failure. Failures are reported
+// anyway if logs are still small after all retries.
+func (m *Monitor) waitForLogs(ctx context.Context, failure complainer.Failure, stdoutURL, stderrURL string) {
+	fields := logging.Fields{"failure_id": failure.ID}
+
+	for retry := 0; ; retry++ {
+		size := int64(0)
+		for _, u := range []string{stdoutURL, stderrURL} {
+			s, err := m.mesos.Size(ctx, u)
+			if err != nil {
+				fields["error"] = err
+				logging.Warning(fmt.Sprintf("Cannot get log size for task with ID %s: %s", failure.ID, err), fields)
+				return
+			}
+
+			size += s
+		}
+
+		if size >= m.minLogBytes {
+			return
+		}
+
+		if retry >= m.minLogTries {
+			logging.Warning(fmt.Sprintf("Logs of task with ID %s are %d bytes, less than %d bytes after %d retries, reporting anyway", failure.ID, size, m.minLogBytes, retry), fields)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(m.minLogDelay):
+		}
+	}
+}
+
+// dispatch sends reports to all configured reporter instances, running
+// up to the configured number of reports concurrently, and waits for
+// all of them to complete. Reports are abandoned when the context is done.
+// Returned is the number of reports that failed.
+func (m *Monitor) dispatch(ctx context.Context, failure complainer.Failure, labels label.Labels, stdoutURL, stderrURL string) int {
+	wg := sync.WaitGroup{}
+	slots := make(chan struct{}, m.concurrency)
+
+	mu := sync.Mutex{}
+	failed := 0
+	fail := func() {
+		mu.Lock()
+		failed++
+		mu.Unlock()
+	}
+
+	// send reports the failure with the reporter instance
+	// and returns whether the report was sent successfully
+	send := func(n, i string, r reporter.Reporter) bool {
+		if m.limiter != nil && !m.limiter.allow(labels.Complainer()+"/"+n+"/"+i, time.Now()) {
+			reportsDropped.Inc(n)
+			logging.Warning(fmt.Sprintf("Dropping report with %s [instance=%s] for task with ID %s: rate limit exceeded", n, i, failure.ID), logging.Fields{
+				"failure_id": failure.ID,
+				"reporter":   n,
+				"instance":   i,
+			})
+			return false
+		}
+
+		if m.strictEnv {
+			if err := reporter.CheckConfigEnv(labels, n, i, m.configSources()...); err != nil {
+				fail()
+				reports.Inc(n, "error")
+				logging.Error(fmt.Sprintf("Cannot generate report with %s [instance=%s] for task with ID %s: %s", n, i, failure.ID, err), logging.Fields{
+					"failure_id": failure.ID,
+					"reporter":   n,
+					"instance":   i,
+					"error":      err,
+				})
+				return false
+			}
+		}
+
+		config := reporter.NewConfigProvider(labels, n, i, m.configSources()...)
+		if m.dryRun {
+			m.preview(n, i, r, failure, config, stdoutURL, stderrURL)
+			return true
+		}
+
+		if err := m.report(ctx, n, r, failure, config, stdoutURL, stderrURL); err != nil {
+			result := "error"
+			if _, ok := err.(timeoutError); ok {
+				result = "timeout"
+			}
+
+			fail()
+			reports.Inc(n, result)
+			logging.Error(fmt.Sprintf("Cannot generate report with %s [instance=%s] for task with ID %s: %s", n, i, failure.ID, err), logging.Fields{
+				"failure_id": failure.ID,
+				"reporter":   n,
+				"instance":   i,
+				"error":      err,
+			})
+			return false
+		}
+
+		reports.Inc(n, "success")
+
+		return true
+	}
+
+	candidates := []instance{}
+
+	for _, n := range m.reporterNames() {
+		r := m.reporters[n]
+		destinations := map[string]string{}
+
+		for _, i := range m.instances(labels, n) {
+			report, err := m.condition(failure, labels, n, i, stdoutURL, stderrURL)
+			if err != nil {
+				fail()
+				reports.Inc(n, "error")
+				logging.Error(fmt.Sprintf("Cannot evaluate condition of %s [instance=%s] for task with ID %s: %s", n, i, failure.ID, err), logging.Fields{
+					"failure_id": failure.ID,
+					"reporter":   n,
+					"instance":   i,
+					"error":      err,
+				})
+				continue
+			}
+
+			if !report {
+				logging.Info(fmt.Sprintf("Skipping report with %s [instance=%s] for task with ID %s: condition is false", n, i, failure.ID), logging.Fields{
+					"failure_id": failure.ID,
+					"reporter":   n,
+					"instance":   i,
+				})
+				continue
+			}
+
+			if key := m.dedupKey(labels, n, i, r); key != "" {
+				if previous, ok := destinations[key]; ok {
+					logging.Info(fmt.Sprintf("Skipping report with %s [instance=%s] for task with ID %s: same destination as instance %s", n, i, failure.ID, previous), logging.Fields{
+						"failure_id": failure.ID,
+						"reporter":   n,
+						"instance":   i,
+					})
+					continue
+				}
+
+				destinations[key] = i
+			}
+
+			candidates = append(candidates, instance{reporter: n, instance: i})
+		}
+	}
+
+	// sendChain reports with instances of the chain one by one
+	// until one of them succeeds, returning whether one did
+	sendChain := func(chain []instance) bool {
+		for k, c := range chain {
+			if send(c.reporter, c.instance, m.reporters[c.reporter]) {
+				return true
+			}
+
+			if k < len(chain)-1 && ctx.Err() == nil {
+				next := chain[k+1]
+				logging.Warning(fmt.Sprintf("Falling back from %s [instance=%s] to %s [instance=%s] for task with ID %s", c.reporter, c.instance, next.reporter, next.instance, failure.ID), logging.Fields{
+					"failure_id": failure.ID,
+					"reporter":   c.reporter,
+					"instance":   c.instance,
+				})
+			}
+		}
+
+		return false
+	}
+
+	for _, chain := range m.fallbackChains(labels, candidates) {
+		if m.stopOnFirst {
+			if sendChain(chain) {
+				break
+			}
+
+			continue
+		}
+
+		wg.Add(1)
+		slots <- struct{}{}
+
+		go func(chain []instance) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+
+			sendChain(chain)
+		}(chain)
+	}
+
+	wg.Wait()
+
+	return failed
+}
+
+// reporterNames returns names of reporters in the order reports are sent:
+// reporters listed in the order first, then the rest in alphabetical order
+func (m *Monitor) reporterNames() []string {
+	names := []string{}
+	listed := map[string]bool{}
+
+	for _, n := range m.order {
+		if _, ok := m.reporters[n]; ok && !listed[n] {
+			names = append(names, n)
+			listed[n] = true
+		}
+	}
+
+	rest := []string{}
+	for n := range m.reporters {
+		if !listed[n] {
+			rest = append(rest, n)
+		}
+	}
+
+	sort.Strings(rest)
+
+	return append(names, rest...)
+}
+
+// condition tells whether the reporter instance reports the failure
+// according to its condition, it is checked before deduplication,
+// so skipped instances do not hide instances with the same destination
+func (m *Monitor) condition(failure complainer.Failure, labels label.Labels, n, i, stdoutURL, stderrURL string) (bool, error) {
+	return reporter.Condition(failure, reporter.NewConfigProvider(labels, n, i, m.configSources()...), stdoutURL, stderrURL)
+}
+
+// dedupKey returns the destination of the reporter instance if
+// deduplication is enabled and the reporter can tell it
+func (m *Monitor) dedupKey(labels label.Labels, n, i string, r reporter.Reporter) string {
+	if !m.dedup {
+		return ""
+	}
+
+	d, ok := r.(reporter.Deduplicator)
+	if !ok {
+		return ""
+	}
+
+	return d.DedupKey(reporter.NewConfigProvider(labels, n, i, m.configSources()...))
+}
+
+// instances returns instances of the reporter for the failure: listed in
+// labels, listed in the config file or implicit ones, in that order.
+// Instances disabled in labels of the task are left out.
+func (m *Monitor) instances(labels label.Labels, reporter string) []string {
+	instances := labels.Instances(reporter)
+
+	if m.configFile != nil {
+		if _, ok := labels.ExplicitInstances(reporter); !ok {
+			if listed, ok := m.configFile.Instances(reporter); ok {
+				instances = listed
+			}
+		}
+	}
+
+	enabled := []string{}
+	for _, i := range instances {
+		if !labels.Disabled(reporter, i) {
+			enabled = append(enabled, i)
+		}
+	}
+
+	return enabled
+}
+
+// Validate checks config of the uploader and of reporter instances that
+// are known without task labels: default instances and instances listed
+// in the config file. Returned errors describe every broken instance.
+func (m *Monitor) Validate(ctx context.Context) []error {
+	errs := []error{}
+
+	if v, ok := m.uploader.(uploader.Validator); ok {
+		if err := v.Validate(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("uploader: %s", err))
+		}
+	}
+
+	labels := label.NewLabels(m.name, map[string]string{}, m.defaults)
+
+	for n, r := range m.reporters {
+		v, ok := r.(reporter.Validator)
+		if !ok {
+			continue
+		}
+
+		for _, i := range m.instances(labels, n) {
+			if err := v.Validate(ctx, reporter.NewConfigProvider(labels, n, i, m.configSources()...)); err != nil {
+				errs = append(errs, fmt.Errorf("reporter %s [instance=%s]: %s", n, i, err))
+			}
+		}
+	}
+
+	return errs
+}
+
+// configSources returns config sources to consult after labels
+func (m *Monitor) configSources() []reporter.ConfigSource {
+	if m.configFile == nil {
+		return nil
+	}
+
+	return []reporter.ConfigSource{m.configFile}
+}
+
+// preview logs the message the reporter would send in dry-run mode
+func (m *Monitor) preview(n, i string, r reporter.Reporter, failure complainer.Failure, config reporter.ConfigProvider, stdoutURL, stderrURL string) {
+	fields := logging.Fields{
+		"failure_id": failure.ID,
+		"reporter":   n,
+		"instance":   i,
+	}
+
+	p, ok := r.(reporter.Previewer)
+	if !ok {
+		logging.Info(fmt.Sprintf("Dry run: would report task with ID %s with %s [instance=%s]", failure.ID, n, i), fields)
+		return
+	}
+
+	message, err := p.Preview(failure, config, stdoutURL, stderrURL)
+	if err != nil {
+		fields["error"] = err
+		logging.Error(fmt.Sprintf("Dry run: cannot render report with %s [instance=%s] for task with ID %s: %s", n, i, failure.ID, err), fields)
+		return
+	}
+
+	fields["message"] = message
+	logging.Info(fmt.Sprintf("Dry run: would report task with ID %s with %s [instance=%s]:\n%s", failure.ID, n, i, message), fields)
+}
+
+// timeoutError is returned when a report attempt exceeds the timeout
+type timeoutError struct {
+	timeout time.Duration
+	err     error
+}
+
+func (e timeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s: %s", e.timeout, e.err)
+}
+
+// upload uploads logs, retrying with exponential backoff on errors
+func (m *Monitor) upload(ctx context.Context, failure complainer.Failure, stdoutURL, stderrURL string) (string, string, error) {
+	delay := retryBaseDelay
+
+	for attempt := 1; ; attempt++ {
+		uploadedStdoutURL, uploadedStderrURL, err := m.uploader.Upload(ctx, failure, stdoutURL, stderrURL)
+		if err == nil || attempt >= m.uploadTries {
+			return uploadedStdoutURL, uploadedStderrURL, err
+		}
+
+		if delay > m.maxDelay {
+			delay = m.maxDelay
+		}
+
+		logging.Warning(fmt.Sprintf("Error uploading logs of task with ID %s [attempt=%d], retrying in %s: %s", failure.ID, attempt, delay, err), logging.Fields{
+			"failure_id": failure.ID,
+			"attempt":    attempt,
+			"error":      err,
+		})
+
+		select {
+		case <-ctx.Done():
+			return "", "", err
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+	}
+}
+
+// report sends a report, retrying with exponential backoff on errors,
+// unless the reporter says that the error is not worth retrying
+// or the context is done. Every attempt is cancelled after the
+// report timeout of the reporter, timed out attempts are retried.
+func (m *Monitor) report(ctx context.Context, n string, r reporter.Reporter, failure complainer.Failure, config reporter.ConfigProvider, stdoutURL, stderrURL string) error {
+	delay := retryBaseDelay
+
+	for attempt := 1; ; attempt++ {
+		err := m.attempt(ctx, n, r, failure, config, stdoutURL, stderrURL)
+		if err == nil || attempt >= m.attempts {
+			return err
+		}
+
+		if _, ok := err.(timeoutError); !ok {
+			if rr, ok := r.(reporter.RetryableReporter); ok && !rr.Retryable(err) {
+				return err
+			}
+		}
+
+		if delay > m.maxDelay {
+			delay = m.maxDelay
+		}
+
+		logging.Warning(fmt.Sprintf("Error reporting task with ID %s [attempt=%d], retrying in %s: %s", failure.ID, attempt, delay, err), logging.Fields{
+			"failure_id": failure.ID,
+			"attempt":    attempt,
+			"error":      err,
+		})
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+	}
+}
+
+// attempt sends a report once, cancelling it after the report timeout
+func (m *Monitor) attempt(ctx context.Context, n string, r reporter.Reporter, failure complainer.Failure, config reporter.ConfigProvider, stdoutURL, stderrURL string) error {
+	timeout := m.reportTimeout(n)
+	if timeout <= 0 {
+		return r.Report(ctx, failure, config, stdoutURL, stderrURL)
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := r.Report(attemptCtx, failure, config, stdoutURL, stderrURL)
+	if err != nil && ctx.Err() == nil && attemptCtx.Err() == context.DeadlineExceeded {
+		return timeoutError{timeout: timeout, err: err}
+	}
+
+	return err
+}
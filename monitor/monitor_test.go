@@ -0,0 +1,1107 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/config"
+	"github.com/cloudflare/complainer/label"
+	"github.com/cloudflare/complainer/mesos"
+	"github.com/cloudflare/complainer/reporter"
+	"github.com/cloudflare/complainer/uploader"
+)
+
+type passthroughUploader struct{}
+
+func (passthroughUploader) Upload(ctx context.Context, failure complainer.Failure, stdoutURL, stderrURL string) (string, string, error) {
+	return stdoutURL, stderrURL, nil
+}
+
+// blockingReporter blocks the first report until the context is done
+type blockingReporter struct {
+	started  chan struct{}
+	mu       sync.Mutex
+	calls    int
+	reported []string
+}
+
+func (r *blockingReporter) Report(ctx context.Context, failure complainer.Failure, config reporter.ConfigProvider, stdoutURL, stderrURL string) error {
+	r.mu.Lock()
+	r.calls++
+	first := r.calls == 1
+	r.mu.Unlock()
+
+	if first {
+		close(r.started)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	r.mu.Lock()
+	r.reported = append(r.reported, failure.ID)
+	r.mu.Unlock()
+
+	return nil
+}
+
+// testCluster serves mesos master and agent apis, failed task
+// is only listed once failing is set
+func testCluster(t *testing.T, failing *bool, mu *sync.Mutex) (*httptest.Server, *mesos.Cluster) {
+	return testClusterTasks(t, func() (string, string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if !*failing {
+			return "[]", "[]"
+		}
+
+		return "[]", testFailedTask("web.1", time.Now())
+	})
+}
+
+// testFailedTask returns json array with the failed web task
+func testFailedTask(id string, finished time.Time) string {
+	return fmt.Sprintf(`[{"id":%q,"name":"web","state":"TASK_FAILED","slave_id":"agent1","statuses":[{"state":"TASK_FAILED","timestamp":%d}]}]`, id, finished.Unix())
+}
+
+// testClusterTasks serves mesos master and agent apis,
+// tasks returns json arrays of active and completed tasks
+func testClusterTasks(t *testing.T, tasks func() (string, string)) (*httptest.Server, *mesos.Cluster) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		active, completed := tasks()
+
+		switch r.URL.Path {
+		case "/master/state":
+			_, _ = fmt.Fprintf(w, `{"pid":"master@leader","leader":"master@leader","slaves":[{"id":"agent1","hostname":"127.0.0.1"}],"frameworks":[{"name":"marathon","tasks":%s,"completed_tasks":%s}]}`, active, completed)
+		case "/state":
+			_, _ = w.Write([]byte(`{"frameworks":[{"completed_executors":[{"id":"web.1","directory":"/sandbox"},{"id":"web.2","directory":"/sandbox"},{"id":"web.3","directory":"/sandbox"},{"id":"web.4","directory":"/sandbox"}]}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	agentPort, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cluster := mesos.NewCluster([]string{server.URL})
+	cluster.SetAgentPort(agentPort)
+
+	return server, cluster
+}
+
+func TestRunCancelledReportIsRetried(t *testing.T) {
+	mu := sync.Mutex{}
+	failing := false
+
+	server, cluster := testCluster(t, &failing, &mu)
+	defer server.Close()
+
+	r := &blockingReporter{started: make(chan struct{})}
+
+	m := NewMonitor(DefaultName, cluster, passthroughUploader{}, map[string]reporter.Reporter{"blocking": r}, true, nil, nil)
+	m.SetCoalesceWindow(time.Hour)
+	m.SetFailureCountWindow(time.Hour)
+
+	// The first run only remembers failures that are already there
+	if err := m.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	failing = true
+	mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-r.started
+		cancel()
+	}()
+
+	if err := m.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if !m.recent["web.1"].IsZero() {
+		t.Error("expected interrupted failure to be forgotten")
+	}
+
+	if err := m.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.reported) != 1 || r.reported[0] != "web.1" {
+		t.Errorf("expected interrupted failure to be reported by the next run, got: %v", r.reported)
+	}
+
+	if m.recent["web.1"].IsZero() {
+		t.Error("expected reported failure to be remembered")
+	}
+
+	if len(m.history.tasks["web"]) != 1 {
+		t.Errorf("expected interrupted failure to be counted once, got: %v", m.history.tasks["web"])
+	}
+}
+
+// hangingReporter blocks every report until the context is done
+type hangingReporter struct {
+	calls int
+}
+
+func (r *hangingReporter) Report(ctx context.Context, failure complainer.Failure, config reporter.ConfigProvider, stdoutURL, stderrURL string) error {
+	r.calls++
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestReportTimeout(t *testing.T) {
+	r := &hangingReporter{}
+
+	m := NewMonitor(DefaultName, nil, passthroughUploader{}, map[string]reporter.Reporter{"hanging": r}, true, nil, nil)
+	m.SetRetry(2, time.Millisecond)
+	m.SetReportTimeout(time.Hour, map[string]time.Duration{"hanging": time.Millisecond * 10})
+
+	err := m.report(context.Background(), "hanging", r, complainer.Failure{ID: "web.1"}, nil, "", "")
+	if _, ok := err.(timeoutError); !ok {
+		t.Fatalf("expected timeout error, got: %v", err)
+	}
+
+	if r.calls != 2 {
+		t.Errorf("expected timed out report to be retried, got %d calls", r.calls)
+	}
+
+	if timeout := m.reportTimeout("slack"); timeout != time.Hour {
+		t.Errorf("expected global timeout for reporters without override, got: %s", timeout)
+	}
+}
+
+func TestReportTimeoutCancelled(t *testing.T) {
+	r := &hangingReporter{}
+
+	m := NewMonitor(DefaultName, nil, passthroughUploader{}, map[string]reporter.Reporter{"hanging": r}, true, nil, nil)
+	m.SetRetry(1, time.Millisecond)
+	m.SetReportTimeout(time.Hour, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+
+	err := m.report(ctx, "hanging", r, complainer.Failure{ID: "web.1"}, nil, "", "")
+	if _, ok := err.(timeoutError); ok || err == nil {
+		t.Errorf("expected cancellation not to be reported as timeout, got: %v", err)
+	}
+}
+
+type fakeLock struct {
+	leader bool
+}
+
+func (l *fakeLock) Acquire(ctx context.Context) (bool, error) {
+	return l.leader, nil
+}
+
+func (l *fakeLock) Release() error {
+	return nil
+}
+
+func TestRunStandby(t *testing.T) {
+	mu := sync.Mutex{}
+	failing := false
+
+	server, cluster := testCluster(t, &failing, &mu)
+	defer server.Close()
+
+	r := &blockingReporter{started: make(chan struct{})}
+	lock := &fakeLock{}
+
+	m := NewMonitor(DefaultName, cluster, passthroughUploader{}, map[string]reporter.Reporter{"blocking": r}, true, nil, nil)
+	m.SetLock(lock)
+
+	// Standby does not look at failures and stays healthy
+	if err := m.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if m.recent != nil || m.lastSuccess.IsZero() {
+		t.Errorf("expected standby to skip the run successfully, recent: %v, last success: %s", m.recent, m.lastSuccess)
+	}
+
+	lock.leader = true
+
+	if err := m.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if m.recent == nil {
+		t.Error("expected leader to look at failures")
+	}
+
+	lock.leader = false
+
+	if err := m.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if m.recent != nil {
+		t.Error("expected seen failures to be forgotten after losing leadership")
+	}
+}
+
+// channelReporter records channels of reports, channel is the destination
+type channelReporter struct {
+	mu       sync.Mutex
+	channels []string
+}
+
+func (r *channelReporter) Report(ctx context.Context, failure complainer.Failure, config reporter.ConfigProvider, stdoutURL, stderrURL string) error {
+	r.mu.Lock()
+	r.channels = append(r.channels, config("channel"))
+	r.mu.Unlock()
+
+	return nil
+}
+
+func (r *channelReporter) DedupKey(config reporter.ConfigProvider) string {
+	return config("channel")
+}
+
+func TestDispatchDedup(t *testing.T) {
+	labels := label.NewLabels(DefaultName, map[string]string{
+		"complainer_chat_instances":               "first,second,third,fourth",
+		"complainer_chat_instance_first_channel":  "#ops",
+		"complainer_chat_instance_second_channel": "#ops",
+		"complainer_chat_instance_third_channel":  "#dev",
+	}, true)
+
+	for _, row := range []struct {
+		dedup    bool
+		expected int
+	}{
+		{dedup: false, expected: 4},
+		{dedup: true, expected: 3},
+	} {
+		r := &channelReporter{}
+
+		m := NewMonitor(DefaultName, nil, passthroughUploader{}, map[string]reporter.Reporter{"chat": r}, true, nil, nil)
+		m.SetDedup(row.dedup)
+		m.dispatch(context.Background(), complainer.Failure{ID: "web.1"}, labels, "", "")
+
+		if len(r.channels) != row.expected {
+			t.Errorf("unexpected reports with dedup=%v; expected: %d, got: %v", row.dedup, row.expected, r.channels)
+		}
+	}
+}
+
+// resolvingReporter records reported and resolved failures
+type resolvingReporter struct {
+	mu       sync.Mutex
+	reported []string
+	resolved []string
+}
+
+func (r *resolvingReporter) Report(ctx context.Context, failure complainer.Failure, config reporter.ConfigProvider, stdoutURL, stderrURL string) error {
+	r.mu.Lock()
+	r.reported = append(r.reported, failure.ID)
+	r.mu.Unlock()
+
+	return nil
+}
+
+func (r *resolvingReporter) Resolve(ctx context.Context, failure complainer.Failure, config reporter.ConfigProvider) error {
+	r.mu.Lock()
+	r.resolved = append(r.resolved, failure.ID)
+	r.mu.Unlock()
+
+	return nil
+}
+
+func TestRunResolve(t *testing.T) {
+	mu := sync.Mutex{}
+	active := "[]"
+	completed := "[]"
+
+	server, cluster := testClusterTasks(t, func() (string, string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return active, completed
+	})
+	defer server.Close()
+
+	set := func(a, c string) {
+		mu.Lock()
+		active, completed = a, c
+		mu.Unlock()
+	}
+
+	running := func(id string, started time.Time) string {
+		return fmt.Sprintf(`[{"id":%q,"name":"web","state":"TASK_RUNNING","statuses":[{"state":"TASK_RUNNING","timestamp":%d}]}]`, id, started.Unix())
+	}
+
+	// Resolution is opt-in per instance
+	f, err := config.Parse([]byte("chat:\n  resolve: \"true\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chat := &resolvingReporter{}
+	pager := &resolvingReporter{}
+
+	m := NewMonitor(DefaultName, cluster, passthroughUploader{}, map[string]reporter.Reporter{"chat": chat, "pager": pager}, true, nil, nil)
+	m.SetResolveWindow(time.Hour)
+	m.SetConfigFile(f)
+
+	if err = m.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	failed := time.Now()
+	set(running("web.0", failed.Add(-time.Hour)), testFailedTask("web.1", failed))
+
+	if err = m.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(chat.reported) != 1 || len(chat.resolved) != 0 {
+		t.Fatalf("expected failure to be reported and not resolved by older task, reported: %v, resolved: %v", chat.reported, chat.resolved)
+	}
+
+	set(running("web.2", failed.Add(time.Second)), testFailedTask("web.1", failed))
+
+	for i := 0; i < 2; i++ {
+		if err = m.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(chat.resolved) != 1 || chat.resolved[0] != "web.1" {
+		t.Errorf("expected failure to be resolved once, got: %v", chat.resolved)
+	}
+
+	if len(pager.reported) != 1 || len(pager.resolved) != 0 {
+		t.Errorf("expected failure to be reported and not resolved without resolve config, reported: %v, resolved: %v", pager.reported, pager.resolved)
+	}
+
+	// Every failure before recovery is resolved, not only the last one
+	first, second := testFailedTask("web.3", failed.Add(2*time.Second)), testFailedTask("web.4", failed.Add(3*time.Second))
+	set(running("web.2", failed.Add(time.Second)), first)
+
+	if err = m.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	set(running("web.2", failed.Add(time.Second)), first[:len(first)-1]+","+second[1:])
+
+	if err = m.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(chat.reported) != 3 || len(chat.resolved) != 1 {
+		t.Fatalf("expected both failures to be reported and not resolved by older task, reported: %v, resolved: %v", chat.reported, chat.resolved)
+	}
+
+	set(running("web.5", failed.Add(4*time.Second)), "[]")
+
+	if err = m.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	resolved := append([]string{}, chat.resolved[1:]...)
+	sort.Strings(resolved)
+
+	if !reflect.DeepEqual(resolved, []string{"web.3", "web.4"}) {
+		t.Errorf("expected both failures to be resolved, got: %v", chat.resolved)
+	}
+}
+
+func TestWaitForLogs(t *testing.T) {
+	mu := sync.Mutex{}
+	reads := 0
+
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		// Logs grow by 10 bytes on every check of both files
+		reads++
+		_, _ = fmt.Fprintf(w, `{"data":"","offset":%d}`, reads/2*5)
+	}))
+	defer agent.Close()
+
+	m := NewMonitor(DefaultName, mesos.NewCluster([]string{agent.URL}), passthroughUploader{}, nil, true, nil, nil)
+
+	stdoutURL := agent.URL + "/files/download?path=/sandbox/stdout"
+	stderrURL := agent.URL + "/files/download?path=/sandbox/stderr"
+
+	m.SetMinLogSize(20, 5, time.Millisecond)
+	m.waitForLogs(context.Background(), complainer.Failure{ID: "web.1"}, stdoutURL, stderrURL)
+
+	if reads != 6 {
+		t.Errorf("expected to stop once logs are big enough, got %d reads", reads)
+	}
+
+	reads = 0
+
+	m.SetMinLogSize(1000, 2, time.Millisecond)
+	m.waitForLogs(context.Background(), complainer.Failure{ID: "web.1"}, stdoutURL, stderrURL)
+
+	if reads != 6 {
+		t.Errorf("expected to give up after retries, got %d reads", reads)
+	}
+}
+
+// flakyUploader fails the first failures uploads
+type flakyUploader struct {
+	failures int
+	calls    int
+}
+
+func (u *flakyUploader) Upload(ctx context.Context, failure complainer.Failure, stdoutURL, stderrURL string) (string, string, error) {
+	u.calls++
+	if u.calls <= u.failures {
+		return "", "", fmt.Errorf("upload %d failed", u.calls)
+	}
+
+	return "https://logs.example.com/stdout", "https://logs.example.com/stderr", nil
+}
+
+// urlReporter remembers stdout urls of reports
+type urlReporter struct {
+	urls []string
+}
+
+func (r *urlReporter) Report(ctx context.Context, failure complainer.Failure, config reporter.ConfigProvider, stdoutURL, stderrURL string) error {
+	r.urls = append(r.urls, stdoutURL)
+	return nil
+}
+
+func TestUploadRetry(t *testing.T) {
+	server, cluster := testClusterTasks(t, func() (string, string) {
+		return "[]", "[]"
+	})
+	defer server.Close()
+
+	failure := complainer.Failure{ID: "web.1", Name: "web", Slave: "127.0.0.1"}
+
+	table := []struct {
+		failures int
+		fallback bool
+		url      string
+		err      bool
+	}{
+		{failures: 2, url: "https://logs.example.com/stdout"},
+		{failures: 3, err: true},
+		{failures: 3, fallback: true, url: "/files/download?path=/sandbox/stdout"},
+	}
+
+	for i, row := range table {
+		u := &flakyUploader{failures: row.failures}
+		r := &urlReporter{}
+
+		m := NewMonitor(DefaultName, cluster, u, map[string]reporter.Reporter{"url": r}, true, nil, nil)
+		m.SetRetry(1, time.Millisecond)
+		m.SetUploadRetry(3, row.fallback)
+
+		err := m.processFailure(context.Background(), failure)
+		if (err != nil) != row.err {
+			t.Errorf("row %d: unexpected error: %v", i, err)
+			continue
+		}
+
+		if u.calls != 3 {
+			t.Errorf("row %d: expected 3 upload attempts, got %d", i, u.calls)
+		}
+
+		if row.err {
+			if len(r.urls) != 0 {
+				t.Errorf("row %d: expected no reports, got: %v", i, r.urls)
+			}
+
+			continue
+		}
+
+		if len(r.urls) != 1 || !strings.HasSuffix(r.urls[0], row.url) {
+			t.Errorf("row %d: expected report with url %s, got: %v", i, row.url, r.urls)
+		}
+	}
+}
+
+// downloadingUploader downloads logs and fails the first upload
+type downloadingUploader struct {
+	calls int
+}
+
+func (u *downloadingUploader) Upload(ctx context.Context, failure complainer.Failure, stdoutURL, stderrURL string) (string, string, error) {
+	u.calls++
+
+	for _, logURL := range []string{stdoutURL, stderrURL} {
+		if _, err := uploader.Download(ctx, logURL); err != nil {
+			return "", "", err
+		}
+	}
+
+	if u.calls == 1 {
+		return "", "", fmt.Errorf("upload %d failed", u.calls)
+	}
+
+	return stdoutURL, stderrURL, nil
+}
+
+// tailReporter remembers stderr tails of reports
+type tailReporter struct {
+	tails []string
+}
+
+func (r *tailReporter) Report(ctx context.Context, failure complainer.Failure, config reporter.ConfigProvider, stdoutURL, stderrURL string) error {
+	r.tails = append(r.tails, failure.StderrTail)
+	return nil
+}
+
+func TestProcessFailureDownloadsOnce(t *testing.T) {
+	server, cluster := testClusterTasks(t, func() (string, string) {
+		return "[]", "[]"
+	})
+	defer server.Close()
+
+	downloads := map[string]int{}
+	uploader.SetDownloader(func(ctx context.Context, logURL string) ([]byte, error) {
+		downloads[logURL]++
+		return []byte("one\ntwo\nthree\n"), nil
+	})
+
+	u := &downloadingUploader{}
+	r := &tailReporter{}
+
+	m := NewMonitor(DefaultName, cluster, u, map[string]reporter.Reporter{"tail": r}, true, nil, nil)
+	m.SetRetry(1, time.Millisecond)
+	m.SetUploadRetry(2, false)
+	m.SetStderrTail(2, 0)
+
+	if err := m.processFailure(context.Background(), complainer.Failure{ID: "web.1", Name: "web", Slave: "127.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if u.calls != 2 {
+		t.Errorf("expected 2 upload attempts, got %d", u.calls)
+	}
+
+	if len(downloads) != 2 {
+		t.Errorf("expected stdout and stderr downloads, got: %v", downloads)
+	}
+
+	for logURL, n := range downloads {
+		if n != 1 {
+			t.Errorf("expected %s to be downloaded once, got %d downloads", logURL, n)
+		}
+	}
+
+	if len(r.tails) != 1 || r.tails[0] != "two\nthree\n" {
+		t.Errorf("expected stderr tail from downloaded stderr, got: %q", r.tails)
+	}
+}
+
+// validatingReporter fails validation of instances without a token
+type validatingReporter struct{}
+
+func (validatingReporter) Report(ctx context.Context, failure complainer.Failure, config reporter.ConfigProvider, stdoutURL, stderrURL string) error {
+	return nil
+}
+
+func (validatingReporter) Validate(ctx context.Context, config reporter.ConfigProvider) error {
+	if config("token") == "" {
+		return fmt.Errorf("token is not set")
+	}
+
+	return nil
+}
+
+func TestValidate(t *testing.T) {
+	f, err := config.Parse([]byte("chat:\n  instances: [ops, dev]\n  instance:\n    ops:\n      token: secret\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMonitor(DefaultName, nil, passthroughUploader{}, map[string]reporter.Reporter{"chat": validatingReporter{}, "plain": &urlReporter{}}, true, nil, nil)
+	m.SetConfigFile(f)
+
+	errs := m.Validate(context.Background())
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "instance=dev") {
+		t.Errorf("expected only dev instance to be invalid, got: %v", errs)
+	}
+}
+
+// complainerReporter remembers complainer names and hook urls of reports
+type complainerReporter struct {
+	mu      sync.Mutex
+	reports []string
+}
+
+func (r *complainerReporter) Report(ctx context.Context, failure complainer.Failure, config reporter.ConfigProvider, stdoutURL, stderrURL string) error {
+	r.mu.Lock()
+	r.reports = append(r.reports, failure.Complainer+"="+config("hook_url"))
+	r.mu.Unlock()
+
+	return nil
+}
+
+func TestProcessFailureNames(t *testing.T) {
+	server, cluster := testClusterTasks(t, func() (string, string) {
+		return "[]", "[]"
+	})
+	defer server.Close()
+
+	r := &complainerReporter{}
+
+	m := NewMonitor(DefaultName, cluster, passthroughUploader{}, map[string]reporter.Reporter{"chat": r}, true, nil, nil)
+	m.SetNames([]string{DefaultName, "team-a", "team-b"})
+
+	failure := complainer.Failure{ID: "web.1", Name: "web", Slave: "127.0.0.1", Labels: map[string]string{
+		"complainer_chat_hook_url":        "default-hook",
+		"complainer_team-a_chat_hook_url": "team-a-hook",
+	}}
+
+	if err := m.processFailure(context.Background(), failure); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(r.reports)
+
+	if expected := []string{"default=default-hook", "team-a=team-a-hook"}; !reflect.DeepEqual(r.reports, expected) {
+		t.Errorf("unexpected reports; expected: %v, got: %v", expected, r.reports)
+	}
+}
+
+func TestRunContentDedup(t *testing.T) {
+	for _, precision := range []time.Duration{0, time.Minute} {
+		mu := sync.Mutex{}
+		completed := "[]"
+
+		server, cluster := testClusterTasks(t, func() (string, string) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			return "[]", completed
+		})
+
+		r := &urlReporter{}
+
+		m := NewMonitor(DefaultName, cluster, passthroughUploader{}, map[string]reporter.Reporter{"url": r}, true, nil, nil)
+		m.SetContentDedup(precision)
+
+		if err := m.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		finished := time.Now()
+
+		for _, tasks := range []string{
+			testFailedTask("web.1", finished),
+			// The same failure after agent reregistration
+			strings.TrimSuffix(testFailedTask("web.1", finished), "]") + "," + strings.TrimPrefix(testFailedTask("web.2", finished.Add(time.Second*10)), "["),
+		} {
+			mu.Lock()
+			completed = tasks
+			mu.Unlock()
+
+			if err := m.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		server.Close()
+
+		expected := 2
+		if precision > 0 {
+			expected = 1
+		}
+
+		if len(r.urls) != expected {
+			t.Errorf("expected %d reports with precision %s, got %d", expected, precision, len(r.urls))
+		}
+	}
+}
+
+func TestCheckFailureFirstRun(t *testing.T) {
+	now := time.Now()
+
+	table := []struct {
+		mode     string
+		finished time.Time
+		report   bool
+	}{
+		{mode: FirstRunSuppressAll, finished: now, report: false},
+		{mode: FirstRunSuppressOld, finished: now.Add(-time.Second), report: true},
+		{mode: FirstRunSuppressOld, finished: now.Add(-time.Second * 20), report: false},
+		{mode: FirstRunReportAll, finished: now.Add(-time.Second * 20), report: true},
+		// Stale failures are skipped in every mode
+		{mode: FirstRunReportAll, finished: now.Add(-time.Minute), report: false},
+	}
+
+	for i, row := range table {
+		m := NewMonitor(DefaultName, nil, passthroughUploader{}, nil, true, nil, nil)
+		m.recent = map[string]time.Time{}
+
+		if err := m.SetFirstRun(row.mode, time.Second*10); err != nil {
+			t.Fatal(err)
+		}
+
+		failure := complainer.Failure{ID: "web.1", Name: "web", Finished: row.finished}
+
+		if report := m.checkFailure(failure, true); report != row.report {
+			t.Errorf("row %d: unexpected first run result with %s; expected: %v, got: %v", i, row.mode, row.report, report)
+		}
+
+		if !m.checkFailure(complainer.Failure{ID: "web.2", Finished: now}, false) {
+			t.Errorf("row %d: expected fresh failure to be reported after the first run", i)
+		}
+	}
+
+	m := NewMonitor(DefaultName, nil, passthroughUploader{}, nil, true, nil, nil)
+	if err := m.SetFirstRun("report-some", 0); err == nil {
+		t.Error("expected error for unknown first run mode")
+	}
+}
+
+func TestRunReload(t *testing.T) {
+	mu := sync.Mutex{}
+	completed := "[]"
+
+	server, cluster := testClusterTasks(t, func() (string, string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return "[]", completed
+	})
+	defer server.Close()
+
+	before, err := config.Parse([]byte("chat:\n  hook_url: before\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := config.Parse([]byte("chat:\n  hook_url: after\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &complainerReporter{}
+
+	m := NewMonitor(DefaultName, cluster, passthroughUploader{}, map[string]reporter.Reporter{"chat": r}, true, nil, nil)
+	m.SetConfigFile(before)
+
+	if err = m.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	completed = testFailedTask("web.1", time.Now())
+	mu.Unlock()
+
+	if err = m.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	m.Reload(after)
+
+	if m.configFile != before {
+		t.Error("expected reloaded config to wait for the next run")
+	}
+
+	mu.Lock()
+	completed = strings.TrimSuffix(testFailedTask("web.1", time.Now()), "]") + "," + strings.TrimPrefix(testFailedTask("web.2", time.Now()), "[")
+	mu.Unlock()
+
+	if err = m.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Seen failures survive reload, so web.1 is not reported again
+	if expected := []string{"default=before", "default=after"}; !reflect.DeepEqual(r.reports, expected) {
+		t.Errorf("unexpected reports; expected: %v, got: %v", expected, r.reports)
+	}
+}
+
+func TestDispatchCondition(t *testing.T) {
+	r := &complainerReporter{}
+
+	m := NewMonitor(DefaultName, nil, passthroughUploader{}, map[string]reporter.Reporter{"chat": r}, true, nil, nil)
+
+	for _, env := range []string{"production", "staging"} {
+		failure := complainer.Failure{ID: "web." + env, Name: "web", Complainer: DefaultName, TaskLabels: map[string]string{"env": env}, Labels: map[string]string{
+			"complainer_chat_instances":                "default,pager",
+			"complainer_chat_hook_url":                 "all-" + env,
+			"complainer_chat_instance_pager_hook_url":  "pager-" + env,
+			"complainer_chat_instance_pager_condition": `{{ eq .failure.TaskLabels.env "production" }}`,
+		}}
+
+		if failed := m.dispatch(context.Background(), failure, label.NewLabels(DefaultName, failure.Labels, true), "", ""); failed != 0 {
+			t.Errorf("unexpected failed reports for %s: %d", env, failed)
+		}
+	}
+
+	sort.Strings(r.reports)
+
+	if expected := []string{"default=all-production", "default=all-staging", "default=pager-production"}; !reflect.DeepEqual(r.reports, expected) {
+		t.Errorf("unexpected reports; expected: %v, got: %v", expected, r.reports)
+	}
+
+	broken := complainer.Failure{ID: "web.1", Labels: map[string]string{"complainer_chat_condition": "{{ .failure.Name }}"}}
+	if failed := m.dispatch(context.Background(), broken, label.NewLabels(DefaultName, broken.Labels, true), "", ""); failed != 1 {
+		t.Errorf("expected broken condition to fail the report, got %d failed", failed)
+	}
+}
+
+// orderReporter records its name in the shared log of reports, failing if err is set
+type orderReporter struct {
+	name string
+	log  *[]string
+	err  error
+}
+
+func (r orderReporter) Report(ctx context.Context, failure complainer.Failure, config reporter.ConfigProvider, stdoutURL, stderrURL string) error {
+	*r.log = append(*r.log, r.name)
+	return r.err
+}
+
+func TestDispatchOrder(t *testing.T) {
+	log := []string{}
+	reporters := map[string]reporter.Reporter{
+		"chat":  orderReporter{name: "chat", log: &log},
+		"email": orderReporter{name: "email", log: &log},
+		"pager": orderReporter{name: "pager", log: &log, err: fmt.Errorf("pager is down")},
+		"wiki":  orderReporter{name: "wiki", log: &log},
+	}
+
+	m := NewMonitor(DefaultName, nil, passthroughUploader{}, reporters, true, nil, nil)
+	m.SetConcurrency(1)
+	m.SetRetry(1, 0)
+
+	failure := complainer.Failure{ID: "web.1", Name: "web", Complainer: DefaultName}
+	labels := label.NewLabels(DefaultName, failure.Labels, true)
+
+	m.SetReporterOrder([]string{"pager", " wiki", "missing"}, false)
+
+	if failed := m.dispatch(context.Background(), failure, labels, "", ""); failed != 1 {
+		t.Errorf("expected failed pager report, got %d failed", failed)
+	}
+
+	if expected := []string{"pager", "wiki", "chat", "email"}; !reflect.DeepEqual(log, expected) {
+		t.Errorf("unexpected order of reports; expected: %v, got: %v", expected, log)
+	}
+
+	log = log[:0]
+	m.SetConcurrency(4)
+	m.SetReporterOrder([]string{"pager", "wiki"}, true)
+
+	m.dispatch(context.Background(), failure, labels, "", "")
+
+	if expected := []string{"pager", "wiki"}; !reflect.DeepEqual(log, expected) {
+		t.Errorf("expected reports to stop after the first success; expected: %v, got: %v", expected, log)
+	}
+}
+
+func TestDispatchFallback(t *testing.T) {
+	log := []string{}
+
+	for _, row := range []struct {
+		err      error
+		expected []string
+	}{
+		{err: fmt.Errorf("webhook is down"), expected: []string{"chat", "webhook", "email"}},
+		{expected: []string{"chat", "webhook"}},
+	} {
+		log = log[:0]
+
+		m := NewMonitor(DefaultName, nil, passthroughUploader{}, map[string]reporter.Reporter{
+			"chat":    orderReporter{name: "chat", log: &log},
+			"email":   orderReporter{name: "email", log: &log},
+			"webhook": orderReporter{name: "webhook", log: &log, err: row.err},
+		}, true, nil, nil)
+		m.SetConcurrency(1)
+		m.SetRetry(1, 0)
+
+		failure := complainer.Failure{ID: "web.1", Name: "web", Complainer: DefaultName, Labels: map[string]string{
+			"complainer_webhook_fallback": "email:default",
+		}}
+
+		m.dispatch(context.Background(), failure, label.NewLabels(DefaultName, failure.Labels, true), "", "")
+
+		if !reflect.DeepEqual(log, row.expected) {
+			t.Errorf("unexpected reports with webhook error %v; expected: %v, got: %v", row.err, row.expected, log)
+		}
+	}
+}
+
+func TestFallbackChains(t *testing.T) {
+	m := NewMonitor(DefaultName, nil, passthroughUploader{}, map[string]reporter.Reporter{
+		"chat":  orderReporter{},
+		"email": orderReporter{},
+		"pager": orderReporter{},
+	}, true, nil, nil)
+
+	labels := label.NewLabels(DefaultName, map[string]string{
+		"complainer_chat_instances":             "default,ops",
+		"complainer_chat_fallback":              "email",
+		"complainer_chat_instance_ops_fallback": "chat:default",
+		"complainer_email_fallback":             "chat",
+		"complainer_pager_fallback":             "missing",
+	}, true)
+
+	chat := instance{reporter: "chat", instance: label.DefaultInstance}
+	ops := instance{reporter: "chat", instance: "ops"}
+	email := instance{reporter: "email", instance: label.DefaultInstance}
+	pager := instance{reporter: "pager", instance: label.DefaultInstance}
+
+	chains := m.fallbackChains(labels, []instance{chat, ops, email, pager})
+	if expected := [][]instance{{ops, chat, email}, {pager}}; !reflect.DeepEqual(chains, expected) {
+		t.Errorf("unexpected chains; expected: %v, got: %v", expected, chains)
+	}
+
+	chains = m.fallbackChains(labels, []instance{email, chat})
+	if expected := [][]instance{{email, chat}}; !reflect.DeepEqual(chains, expected) {
+		t.Errorf("expected fallback loop to be reported once; expected: %v, got: %v", expected, chains)
+	}
+}
+
+func TestLiveness(t *testing.T) {
+	m := NewMonitor(DefaultName, mesos.NewCluster(nil), passthroughUploader{}, nil, true, nil, nil)
+	m.SetHealthThreshold(time.Minute)
+
+	table := []struct {
+		started     time.Time
+		lastSuccess time.Time
+		status      int
+	}{
+		{started: time.Now(), status: http.StatusOK},
+		{started: time.Now().Add(-time.Hour), status: http.StatusInternalServerError},
+		{started: time.Now().Add(-time.Hour), lastSuccess: time.Now(), status: http.StatusOK},
+		{started: time.Now().Add(-time.Hour), lastSuccess: time.Now().Add(-time.Hour), status: http.StatusInternalServerError},
+	}
+
+	for i, row := range table {
+		m.started = row.started
+		m.mu.Lock()
+		m.lastSuccess = row.lastSuccess
+		m.err = fmt.Errorf("mesos is down")
+		m.mu.Unlock()
+
+		w := httptest.NewRecorder()
+		m.handleLiveness(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+		if w.Code != row.status {
+			t.Errorf("row %d: expected status %d, got %d: %s", i, row.status, w.Code, w.Body.String())
+		}
+
+		if w.Code != http.StatusOK && !strings.Contains(w.Body.String(), "mesos is down") {
+			t.Errorf("row %d: expected last error in response, got: %s", i, w.Body.String())
+		}
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	healthy := true
+
+	master := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/master/health" || !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer master.Close()
+
+	m := NewMonitor(DefaultName, mesos.NewCluster([]string{master.URL}), passthroughUploader{}, nil, true, nil, nil)
+
+	for _, row := range []struct {
+		healthy bool
+		status  int
+	}{
+		{healthy: true, status: http.StatusOK},
+		{healthy: false, status: http.StatusServiceUnavailable},
+	} {
+		healthy = row.healthy
+
+		w := httptest.NewRecorder()
+		m.handleReadiness(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		if w.Code != row.status {
+			t.Errorf("expected status %d with healthy=%v master, got %d: %s", row.status, row.healthy, w.Code, w.Body.String())
+		}
+	}
+}
+
+// previewingReporter remembers reports and previews of failures
+type previewingReporter struct {
+	reported []string
+	previews []string
+}
+
+func (r *previewingReporter) Report(ctx context.Context, failure complainer.Failure, config reporter.ConfigProvider, stdoutURL, stderrURL string) error {
+	r.reported = append(r.reported, failure.ID)
+	return nil
+}
+
+func (r *previewingReporter) Preview(failure complainer.Failure, config reporter.ConfigProvider, stdoutURL, stderrURL string) (string, error) {
+	r.previews = append(r.previews, failure.ID+" "+stdoutURL)
+	return "", nil
+}
+
+func TestDryRun(t *testing.T) {
+	server, cluster := testClusterTasks(t, func() (string, string) {
+		return "[]", "[]"
+	})
+	defer server.Close()
+
+	failure := complainer.Failure{ID: "web.1", Name: "web", Slave: "127.0.0.1"}
+
+	for _, row := range []struct {
+		skipUpload bool
+		uploads    int
+		url        string
+	}{
+		{skipUpload: true, uploads: 0, url: "/files/download?path=/sandbox/stdout"},
+		{skipUpload: false, uploads: 1, url: "https://logs.example.com/stdout"},
+	} {
+		u := &flakyUploader{}
+		r := &previewingReporter{}
+
+		m := NewMonitor(DefaultName, cluster, u, map[string]reporter.Reporter{"chat": r}, true, nil, nil)
+		m.SetDryRun(true, row.skipUpload)
+
+		if err := m.processFailure(context.Background(), failure); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(r.reported) != 0 {
+			t.Errorf("expected nothing to be reported in dry run, got: %v", r.reported)
+		}
+
+		if u.calls != row.uploads {
+			t.Errorf("expected %d uploads with skip upload %v, got %d", row.uploads, row.skipUpload, u.calls)
+		}
+
+		if len(r.previews) != 1 || !strings.HasPrefix(r.previews[0], "web.1 ") || !strings.HasSuffix(r.previews[0], row.url) {
+			t.Errorf("expected preview with %s, got: %q", row.url, r.previews)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package monitor
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter allows up to max events per sliding interval for each key
+type rateLimiter struct {
+	max      int
+	interval time.Duration
+	mu       sync.Mutex
+	events   map[string][]time.Time
+}
+
+func newRateLimiter(max int, interval time.Duration) *rateLimiter {
+	return &rateLimiter{
+		max:      max,
+		interval: interval,
+		events:   map[string][]time.Time{},
+	}
+}
+
+// allow records an event for the key if it fits into the limit
+func (r *rateLimiter) allow(key string, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events := r.events[key]
+
+	i := 0
+	for i < len(events) && now.Sub(events[i]) >= r.interval {
+		i++
+	}
+
+	events = events[i:]
+
+	if len(events) >= r.max {
+		r.events[key] = events
+		return false
+	}
+
+	r.events[key] = append(events, now)
+
+	return true
+}
@@ -0,0 +1,31 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(2, time.Minute)
+	start := time.Now()
+
+	table := []struct {
+		key      string
+		offset   time.Duration
+		expected bool
+	}{
+		{key: "slack/default", offset: 0, expected: true},
+		{key: "slack/default", offset: time.Second, expected: true},
+		{key: "slack/default", offset: time.Second * 2, expected: false},
+		{key: "slack/infra", offset: time.Second * 2, expected: true},
+		{key: "slack/default", offset: time.Minute, expected: true},
+		{key: "slack/default", offset: time.Minute + time.Second/2, expected: false},
+		{key: "slack/default", offset: time.Minute + time.Second, expected: true},
+	}
+
+	for _, row := range table {
+		if got := limiter.allow(row.key, start.Add(row.offset)); got != row.expected {
+			t.Errorf("unexpected result for %s at %s; expected: %v, got: %v", row.key, row.offset, row.expected, got)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/label"
+	"github.com/cloudflare/complainer/logging"
+)
+
+const (
+	// SelfTestName is the task name of synthetic failures of self tests
+	SelfTestName = "complainer-self-test"
+	// selfTestMessage marks reports of self tests for humans
+	selfTestMessage = "This is a test report from complainer, no task actually failed"
+)
+
+// SelfTest fabricates a failure marked as a test and runs it through the
+// uploader and all reporter instances known without task labels, so the
+// whole pipeline can be checked without waiting for a real failure.
+// Logs of the failure are served locally for the uploader to fetch.
+// Seen failures, coalescing and resolving are not affected.
+func (m *Monitor) SelfTest(ctx context.Context) error {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("cannot listen to serve self test logs: %s", err)
+	}
+
+	server := &http.Server{Handler: http.HandlerFunc(serveSelfTestLogs)}
+	go func() {
+		_ = server.Serve(l)
+	}()
+
+	defer func() {
+		_ = server.Close()
+	}()
+
+	failure := selfTestFailure(m.name, time.Now())
+	stdoutURL := fmt.Sprintf("http://%s/stdout", l.Addr())
+	stderrURL := fmt.Sprintf("http://%s/stderr", l.Addr())
+
+	logging.Info(fmt.Sprintf("Reporting self test %s", failure), logging.Fields{"failure_id": failure.ID})
+
+	if !m.dryRun || !m.skipUpload {
+		stdoutURL, stderrURL, err = m.upload(ctx, failure, stdoutURL, stderrURL)
+		if err != nil {
+			uploadErrors.Inc()
+			return fmt.Errorf("cannot get stdout and stderr urls from uploader: %s", err)
+		}
+	}
+
+	labels := label.NewLabels(m.name, failure.Labels, m.defaults)
+	if failed := m.dispatch(ctx, failure, labels, stdoutURL, stderrURL); failed > 0 {
+		return fmt.Errorf("%d reports of self test failed", failed)
+	}
+
+	return ctx.Err()
+}
+
+// selfTestFailure returns the synthetic failure of the self test
+func selfTestFailure(name string, now time.Time) complainer.Failure {
+	return complainer.Failure{
+		ID:          fmt.Sprintf("%s.%d", SelfTestName, now.Unix()),
+		Name:        SelfTestName,
+		Slave:       "localhost",
+		State:       "TASK_FAILED",
+		Message:     selfTestMessage,
+		Started:     now,
+		Finished:    now,
+		Labels:      map[string]string{},
+		Complainer:  name,
+		Occurrences: 1,
+		Test:        true,
+	}
+}
+
+func serveSelfTestLogs(w http.ResponseWriter, r *http.Request) {
+	_, _ = fmt.Fprintf(w, "%s: %s\n", r.URL.Path[1:], selfTestMessage)
+}
@@ -0,0 +1,88 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/reporter"
+)
+
+// fetchingUploader downloads logs like real uploaders do
+type fetchingUploader struct {
+	logs []string
+}
+
+func (u *fetchingUploader) Upload(ctx context.Context, failure complainer.Failure, stdoutURL, stderrURL string) (string, string, error) {
+	for _, url := range []string{stdoutURL, stderrURL} {
+		resp, err := http.Get(url)
+		if err != nil {
+			return "", "", err
+		}
+
+		b, err := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return "", "", err
+		}
+
+		u.logs = append(u.logs, string(b))
+	}
+
+	return "https://logs.example.com/stdout", "https://logs.example.com/stderr", nil
+}
+
+// testReporter records reported failures and fails if err is set
+type testReporter struct {
+	mu       sync.Mutex
+	err      error
+	reported []complainer.Failure
+}
+
+func (r *testReporter) Report(ctx context.Context, failure complainer.Failure, config reporter.ConfigProvider, stdoutURL, stderrURL string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.reported = append(r.reported, failure)
+
+	return r.err
+}
+
+func TestSelfTest(t *testing.T) {
+	u := &fetchingUploader{}
+	r := &testReporter{}
+
+	m := NewMonitor(DefaultName, nil, u, map[string]reporter.Reporter{"chat": r}, true, nil, nil)
+	m.SetRetry(1, 0)
+
+	if err := m.SelfTest(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(u.logs) != 2 || !strings.HasPrefix(u.logs[0], "stdout: ") || !strings.HasPrefix(u.logs[1], "stderr: ") {
+		t.Errorf("unexpected uploaded logs: %q", u.logs)
+	}
+
+	if len(r.reported) != 1 || !r.reported[0].Test || r.reported[0].Name != SelfTestName {
+		t.Fatalf("expected one test failure to be reported, got: %+v", r.reported)
+	}
+
+	if s := r.reported[0].String(); !strings.HasPrefix(s, "[test] ") {
+		t.Errorf("test failure is not marked as a test: %s", s)
+	}
+
+	if m.recent != nil {
+		t.Errorf("self test touched seen failures: %v", m.recent)
+	}
+
+	r.err = errors.New("broken")
+
+	if err := m.SelfTest(context.Background()); err == nil {
+		t.Error("expected self test to fail with broken reporter")
+	}
+}
@@ -0,0 +1,186 @@
+package reporter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+	"github.com/cloudflare/complainer/googleauth"
+	"github.com/cloudflare/complainer/httpclient"
+)
+
+const (
+	bigqueryBaseURL = "https://bigquery.googleapis.com/bigquery/v2"
+	bigqueryScope   = "https://www.googleapis.com/auth/bigquery.insertdata"
+
+	// bigqueryTimestampFormat is the canonical format of TIMESTAMP columns
+	bigqueryTimestampFormat = "2006-01-02T15:04:05.999999Z07:00"
+)
+
+func init() {
+	var (
+		credentials *string
+		project     *string
+		table       *string
+	)
+
+	RegisterReporter("bigquery", Maker{
+		RegisterFlags: func() {
+			credentials = flags.String("bigquery.credentials", "BIGQUERY_CREDENTIALS", "", "path to service account json, metadata server is used if empty")
+			project = flags.String("bigquery.project", "BIGQUERY_PROJECT", "", "default bigquery project, taken from service account if empty")
+			table = flags.String("bigquery.table", "BIGQUERY_TABLE", "", "default bigquery table to insert into (ex: dataset.table)")
+		},
+
+		Make: func() (Reporter, error) {
+			return newBigQueryReporter(*credentials, *project, *table)
+		},
+	})
+}
+
+type bigqueryReporter struct {
+	httpRetryable
+
+	baseURL string
+	project string
+	table   string
+	tokens  bigqueryTokenSource
+}
+
+// bigqueryTokenSource is implemented by googleauth.TokenSource
+type bigqueryTokenSource interface {
+	Token() (string, error)
+}
+
+// bigqueryRow is a row of the failures table, see README for the schema
+type bigqueryRow struct {
+	TaskID     string `json:"task_id"`
+	Name       string `json:"name"`
+	Framework  string `json:"framework"`
+	Host       string `json:"host"`
+	State      string `json:"state"`
+	Reason     string `json:"reason"`
+	Finished   string `json:"finished"`
+	StdoutURL  string `json:"stdout_url"`
+	StderrURL  string `json:"stderr_url"`
+	Complainer string `json:"complainer"`
+}
+
+type bigqueryInsertRequest struct {
+	Rows []bigqueryInsertRow `json:"rows"`
+}
+
+type bigqueryInsertRow struct {
+	InsertID string      `json:"insertId"`
+	JSON     bigqueryRow `json:"json"`
+}
+
+// bigqueryInsertResponse lists rows that are not inserted, the response
+// status is 200 even if all of them are rejected
+type bigqueryInsertResponse struct {
+	InsertErrors []struct {
+		Index  int `json:"index"`
+		Errors []struct {
+			Reason   string `json:"reason"`
+			Location string `json:"location"`
+			Message  string `json:"message"`
+		} `json:"errors"`
+	} `json:"insertErrors"`
+}
+
+func newBigQueryReporter(credentials, project, table string) (*bigqueryReporter, error) {
+	var account *googleauth.ServiceAccount
+	if credentials != "" {
+		var err error
+		if account, err = googleauth.ReadServiceAccount(credentials); err != nil {
+			return nil, err
+		}
+
+		if project == "" {
+			project = account.ProjectID
+		}
+	}
+
+	return &bigqueryReporter{
+		baseURL: bigqueryBaseURL,
+		project: project,
+		table:   table,
+		tokens:  googleauth.NewTokenSource(account, bigqueryScope, httpclient.Reporters),
+	}, nil
+}
+
+func (b *bigqueryReporter) Report(ctx context.Context, failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
+	table := configWithFallback(config, "table", b.table)
+	if table == "" {
+		return nil
+	}
+
+	parts := strings.Split(table, ".")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("bigquery table %q is not in dataset.table format", table)
+	}
+
+	project := configWithFallback(config, "project", b.project)
+	if project == "" {
+		return errors.New("bigquery project is not configured")
+	}
+
+	token, err := b.tokens.Token()
+	if err != nil {
+		return err
+	}
+
+	request := bigqueryInsertRequest{
+		Rows: []bigqueryInsertRow{
+			{
+				// Insert id lets bigquery drop duplicates of retried inserts
+				InsertID: failure.ID + "-" + strconv.FormatInt(failure.Finished.UnixNano(), 10),
+				JSON: bigqueryRow{
+					TaskID:     failure.ID,
+					Name:       failure.Name,
+					Framework:  failure.Framework,
+					Host:       failure.Slave,
+					State:      failure.State,
+					Reason:     failure.Reason,
+					Finished:   failure.Finished.UTC().Format(bigqueryTimestampFormat),
+					StdoutURL:  stdoutURL,
+					StderrURL:  stderrURL,
+					Complainer: failure.Complainer,
+				},
+			},
+		},
+	}
+
+	insertURL := fmt.Sprintf("%s/projects/%s/datasets/%s/tables/%s/insertAll", b.baseURL, url.PathEscape(project), url.PathEscape(parts[0]), url.PathEscape(parts[1]))
+
+	respBody, err := sendJSON(ctx, http.MethodPost, insertURL, map[string]string{"Authorization": "Bearer " + token}, request)
+	if err != nil {
+		return err
+	}
+
+	resp := bigqueryInsertResponse{}
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return fmt.Errorf("error decoding bigquery insert response: %s", err)
+	}
+
+	for _, insertError := range resp.InsertErrors {
+		messages := []string{}
+		for _, e := range insertError.Errors {
+			if e.Location != "" {
+				messages = append(messages, fmt.Sprintf("%s: %s (%s)", e.Reason, e.Message, e.Location))
+			} else {
+				messages = append(messages, fmt.Sprintf("%s: %s", e.Reason, e.Message))
+			}
+		}
+
+		return fmt.Errorf("error inserting into bigquery table %s.%s: %s", project, table, strings.Join(messages, "; "))
+	}
+
+	return nil
+}
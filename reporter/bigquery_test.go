@@ -0,0 +1,124 @@
+package reporter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+type bigqueryTestTokens string
+
+func (t bigqueryTestTokens) Token() (string, error) {
+	return string(t), nil
+}
+
+func TestBigQueryReport(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	inserts := make(chan bigqueryInsertRequest, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		insert := bigqueryInsertRequest{}
+		_ = json.NewDecoder(r.Body).Decode(&insert)
+
+		requests <- r
+		inserts <- insert
+
+		if insert.Rows[0].JSON.State == "TASK_LOST" {
+			_, _ = w.Write([]byte(`{"kind":"bigquery#tableDataInsertAllResponse","insertErrors":[{"index":0,"errors":[{"reason":"invalid","location":"state","message":"no such field"}]}]}`))
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"kind":"bigquery#tableDataInsertAllResponse"}`))
+	}))
+	defer server.Close()
+
+	b, err := newBigQueryReporter("", "analytics", "mesos.failures")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.baseURL = server.URL
+	b.tokens = bigqueryTestTokens("ya29.token")
+
+	failure := complainer.Failure{
+		ID:        "web.1",
+		Name:      "web",
+		Framework: "marathon",
+		Slave:     "agent1",
+		State:     "TASK_FAILED",
+		Finished:  time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC),
+	}
+
+	config := func(key string) string {
+		return ""
+	}
+
+	if err = b.Report(context.Background(), failure, config, "http://stdout", "http://stderr"); err != nil {
+		t.Fatalf("error reporting: %s", err)
+	}
+
+	r := <-requests
+	if r.URL.Path != "/projects/analytics/datasets/mesos/tables/failures/insertAll" {
+		t.Errorf("unexpected path: %s", r.URL.Path)
+	}
+
+	if auth := r.Header.Get("Authorization"); auth != "Bearer ya29.token" {
+		t.Errorf("unexpected authorization: %s", auth)
+	}
+
+	row := (<-inserts).Rows[0]
+	if row.InsertID == "" || row.JSON.TaskID != "web.1" || row.JSON.Host != "agent1" || row.JSON.Finished != "2024-01-10T00:00:00Z" || row.JSON.StderrURL != "http://stderr" {
+		t.Errorf("unexpected row: %+v", row)
+	}
+
+	failure.State = "TASK_LOST"
+
+	err = b.Report(context.Background(), failure, config, "http://stdout", "http://stderr")
+	if err == nil || !strings.Contains(err.Error(), "no such field (state)") {
+		t.Errorf("expected insert error to be surfaced, got: %v", err)
+	}
+
+	<-requests
+	<-inserts
+
+	if b.Retryable(err) {
+		t.Error("rejected rows should not be retried")
+	}
+}
+
+func TestBigQueryTableConfig(t *testing.T) {
+	b, err := newBigQueryReporter("", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := ""
+	config := func(key string) string {
+		if key == "table" {
+			return table
+		}
+
+		return ""
+	}
+
+	if err = b.Report(context.Background(), complainer.Failure{}, config, "", ""); err != nil {
+		t.Errorf("expected unconfigured table to be skipped, got: %s", err)
+	}
+
+	for _, table = range []string{"failures", "mesos.", "a.b.c"} {
+		if err = b.Report(context.Background(), complainer.Failure{}, config, "", ""); err == nil {
+			t.Errorf("expected error for table %q", table)
+		}
+	}
+
+	table = "mesos.failures"
+	if err = b.Report(context.Background(), complainer.Failure{}, config, "", ""); err == nil {
+		t.Error("expected error for missing project")
+	}
+}
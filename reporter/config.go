@@ -1,13 +1,127 @@
 package reporter
 
-import "github.com/cloudflare/complainer/label"
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cloudflare/complainer/label"
+)
 
 // ConfigProvider is a function that returns the value of the config key
 type ConfigProvider func(key string) string
 
-// NewConfigProvider returns ConfigProvider implementation based labels
-func NewConfigProvider(labels label.Labels, reporter, instance string) ConfigProvider {
+// ConfigSource is a source of reporter instance config values,
+// like task labels or the config file with defaults
+type ConfigSource interface {
+	InstanceLabel(reporter, instance, name string) string
+	InstanceKeys(reporter, instance string) []string
+}
+
+// NewConfigProvider returns ConfigProvider implementation based labels,
+// falling back to the extra sources in order for keys missing in labels.
+// ${NAME} references in values are expanded from the environment.
+func NewConfigProvider(labels label.Labels, reporter, instance string, sources ...ConfigSource) ConfigProvider {
+	sources = append([]ConfigSource{labels}, sources...)
+
 	return func(key string) string {
-		return labels.InstanceLabel(reporter, instance, key)
+		value, _ := expandEnv(lookupConfig(sources, reporter, instance, key))
+		return value
+	}
+}
+
+// CheckConfigEnv returns an error if any config value of the reporter
+// instance references an environment variable that is not set
+func CheckConfigEnv(labels label.Labels, reporter, instance string, sources ...ConfigSource) error {
+	sources = append([]ConfigSource{labels}, sources...)
+
+	for _, source := range sources {
+		for _, key := range source.InstanceKeys(reporter, instance) {
+			if _, missing := expandEnv(lookupConfig(sources, reporter, instance, key)); len(missing) > 0 {
+				return fmt.Errorf("config key %q references undefined environment variables: %s", key, strings.Join(missing, ", "))
+			}
+		}
+	}
+
+	return nil
+}
+
+// lookupConfig returns the first non-empty value of the key in sources
+func lookupConfig(sources []ConfigSource, reporter, instance, key string) string {
+	for _, source := range sources {
+		if value := source.InstanceLabel(reporter, instance, key); value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// expandEnv replaces ${NAME} references with values of environment
+// variables, returning names of the missing ones. Anything else,
+// including $NAME without braces, is left as is.
+func expandEnv(value string) (string, []string) {
+	if !strings.Contains(value, "${") {
+		return value, nil
+	}
+
+	result := ""
+	missing := []string{}
+
+	for {
+		start := strings.Index(value, "${")
+		if start == -1 {
+			break
+		}
+
+		end := strings.Index(value[start:], "}")
+		if end == -1 {
+			break
+		}
+
+		name := value[start+2 : start+end]
+		if !validEnvName(name) {
+			result += value[:start+2]
+			value = value[start+2:]
+			continue
+		}
+
+		env, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+
+		result += value[:start] + env
+		value = value[start+end+1:]
 	}
+
+	return result + value, missing
+}
+
+// validEnvName tells if the name is a valid environment variable name
+func validEnvName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for i, c := range name {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// configWithFallback returns the value of the config key or the fallback
+// value if the key is not set
+func configWithFallback(config ConfigProvider, key, fallback string) string {
+	if value := config(key); value != "" {
+		return value
+	}
+
+	return fallback
 }
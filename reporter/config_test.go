@@ -0,0 +1,72 @@
+package reporter
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/cloudflare/complainer/label"
+)
+
+func TestExpandEnv(t *testing.T) {
+	if err := os.Setenv("COMPLAINER_TEST_TOKEN", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = os.Unsetenv("COMPLAINER_TEST_TOKEN")
+	}()
+
+	table := []struct {
+		value    string
+		expected string
+		missing  []string
+	}{
+		{
+			value:    "https://hooks.example.com/abc",
+			expected: "https://hooks.example.com/abc",
+		},
+		{
+			value:    "https://hooks.example.com/${COMPLAINER_TEST_TOKEN}",
+			expected: "https://hooks.example.com/secret",
+			missing:  []string{},
+		},
+		{
+			value:    "$COMPLAINER_TEST_TOKEN costs $5 ${not valid} ${",
+			expected: "$COMPLAINER_TEST_TOKEN costs $5 ${not valid} ${",
+			missing:  []string{},
+		},
+		{
+			value:    "${COMPLAINER_TEST_MISSING}:${COMPLAINER_TEST_TOKEN}",
+			expected: ":secret",
+			missing:  []string{"COMPLAINER_TEST_MISSING"},
+		},
+	}
+
+	for _, row := range table {
+		got, missing := expandEnv(row.value)
+		if got != row.expected || !reflect.DeepEqual(missing, row.missing) {
+			t.Errorf("invalid expansion of %q; expected: %q %v, got: %q %v", row.value, row.expected, row.missing, got, missing)
+		}
+	}
+}
+
+func TestCheckConfigEnv(t *testing.T) {
+	labels := label.NewLabels(label.DefaultInstance, map[string]string{
+		"complainer_slack_hook_url":          "${COMPLAINER_TEST_MISSING}",
+		"complainer_sentry_dsn":              "dsn",
+		"complainer_sentry_instance_ops_dsn": "${COMPLAINER_TEST_MISSING}",
+	}, true)
+
+	if err := CheckConfigEnv(labels, "slack", label.DefaultInstance); err == nil {
+		t.Error("expected error for missing environment variable")
+	}
+
+	if err := CheckConfigEnv(labels, "sentry", label.DefaultInstance); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	if config := NewConfigProvider(labels, "slack", label.DefaultInstance); config("hook_url") != "" {
+		t.Errorf("missing environment variables are expected to expand to empty values")
+	}
+}
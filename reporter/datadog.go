@@ -0,0 +1,144 @@
+package reporter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+)
+
+// Limits imposed by Datadog on events
+const (
+	datadogMaxTitleLength = 100
+	datadogMaxTextLength  = 4000
+)
+
+// datadogURLFormat is the format of events api url of datadog sites
+var datadogURLFormat = "https://api.%s/api/v1/events"
+
+func init() {
+	var (
+		apiKey *string
+		site   *string
+		tags   *string
+		title  *string
+		format *string
+	)
+
+	RegisterReporter("datadog", Maker{
+		RegisterFlags: func() {
+			apiKey = flags.String("datadog.api_key", "DATADOG_API_KEY", "", "default datadog api key")
+			site = flags.String("datadog.site", "DATADOG_SITE", "datadoghq.com", "default datadog site")
+			tags = flags.String("datadog.tags", "DATADOG_TAGS", "", "extra comma separated datadog event tags")
+			title = flags.String("datadog.title", "DATADOG_TITLE", "Task {{ .failure.Name }} died with status {{ .failure.State }}", "event title format")
+			format = flags.String("datadog.format", "DATADOG_FORMAT", "Task {{ .failure.Name }} ({{ .failure.ID }}) died with status {{ .failure.State }}:{{ .nl }}  * {{ .stdoutURL }}{{ .nl }}  * {{ .stderrURL }}{{ .nl }}", "event text format")
+		},
+
+		Make: func() (Reporter, error) {
+			return newDatadogReporter(*apiKey, *site, *tags, *title, *format), nil
+		},
+	})
+}
+
+type datadogReporter struct {
+	httpRetryable
+
+	apiKey string
+	site   string
+	tags   string
+	title  string
+	format string
+}
+
+type datadogEvent struct {
+	Title          string   `json:"title"`
+	Text           string   `json:"text"`
+	AlertType      string   `json:"alert_type"`
+	Host           string   `json:"host"`
+	AggregationKey string   `json:"aggregation_key"`
+	SourceTypeName string   `json:"source_type_name"`
+	DateHappened   int64    `json:"date_happened"`
+	Tags           []string `json:"tags"`
+}
+
+func newDatadogReporter(apiKey, site, tags, title, format string) *datadogReporter {
+	return &datadogReporter{
+		apiKey: apiKey,
+		site:   site,
+		tags:   tags,
+		title:  title,
+		format: format,
+	}
+}
+
+func (d *datadogReporter) Report(ctx context.Context, failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
+	apiKey := configWithFallback(config, "api_key", d.apiKey)
+	site := configWithFallback(config, "site", d.site)
+
+	if apiKey == "" || site == "" {
+		return nil
+	}
+
+	title, err := fillTemplate(failure, config, stdoutURL, stderrURL, d.title)
+	if err != nil {
+		return err
+	}
+
+	text, err := fillMessage(failure, config, stdoutURL, stderrURL, d.format)
+	if err != nil {
+		return err
+	}
+
+	tags := []string{
+		"framework:" + failure.Framework,
+		"host:" + failure.Slave,
+		"complainer:" + failure.Complainer,
+	}
+
+	for _, tag := range strings.Split(configWithFallback(config, "tags", d.tags), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	event := datadogEvent{
+		Title:          truncate(title, datadogMaxTitleLength),
+		Text:           truncate(text, datadogMaxTextLength),
+		AlertType:      "error",
+		Host:           failure.Slave,
+		AggregationKey: failure.ID,
+		SourceTypeName: "complainer",
+		DateHappened:   failure.Finished.Unix(),
+		Tags:           tags,
+	}
+
+	headers := map[string]string{
+		"DD-API-KEY": apiKey,
+	}
+
+	_, err = sendJSON(ctx, http.MethodPost, datadogEventsURL(site), headers, event)
+	return err
+}
+
+// datadogEventsURL returns events api url of the datadog site
+func datadogEventsURL(site string) string {
+	return fmt.Sprintf(datadogURLFormat, site)
+}
+
+// Preview renders the message without sending it
+func (d *datadogReporter) Preview(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) (string, error) {
+	title, err := fillTemplate(failure, config, stdoutURL, stderrURL, d.title)
+	if err != nil {
+		return "", err
+	}
+
+	text, err := fillMessage(failure, config, stdoutURL, stderrURL, d.format)
+	if err != nil {
+		return "", err
+	}
+
+	return title + "\n\n" + text, nil
+}
@@ -0,0 +1,104 @@
+package reporter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestDatadogEventsURL(t *testing.T) {
+	table := map[string]string{
+		"datadoghq.com":     "https://api.datadoghq.com/api/v1/events",
+		"datadoghq.eu":      "https://api.datadoghq.eu/api/v1/events",
+		"us3.datadoghq.com": "https://api.us3.datadoghq.com/api/v1/events",
+		"ddog-gov.com":      "https://api.ddog-gov.com/api/v1/events",
+	}
+
+	for site, expected := range table {
+		if got := datadogEventsURL(site); got != expected {
+			t.Errorf("unexpected url for %s; expected: %s, got: %s", site, expected, got)
+		}
+	}
+}
+
+func TestDatadogReport(t *testing.T) {
+	var event datadogEvent
+	var path string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("DD-API-KEY") != "key" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		path = r.URL.Path
+
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("error decoding event: %s", err)
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	defer func(f string) {
+		datadogURLFormat = f
+	}(datadogURLFormat)
+	datadogURLFormat = server.URL + "/%s/api/v1/events"
+
+	d := newDatadogReporter("key", "datadoghq.com", "team:infra, ,env:prod", "Task {{ .failure.Name }} died "+strings.Repeat("!", 200), "{{ .failure.ID }}")
+
+	finished := time.Unix(1500000000, 0)
+	failure := complainer.Failure{ID: "web.1", Name: "web", Framework: "marathon", Slave: "host1", Finished: finished, Complainer: "default"}
+
+	if err := d.Report(context.Background(), failure, func(string) string { return "" }, "http://stdout", "http://stderr"); err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/datadoghq.com/api/v1/events" {
+		t.Errorf("unexpected path: %s", path)
+	}
+
+	expected := datadogEvent{
+		Title:          truncate("Task web died "+strings.Repeat("!", 200), datadogMaxTitleLength),
+		Text:           "web.1",
+		AlertType:      "error",
+		Host:           "host1",
+		AggregationKey: "web.1",
+		SourceTypeName: "complainer",
+		DateHappened:   1500000000,
+		Tags:           []string{"framework:marathon", "host:host1", "complainer:default", "team:infra", "env:prod"},
+	}
+
+	if !reflect.DeepEqual(event, expected) {
+		t.Errorf("unexpected event; expected: %+v, got: %+v", expected, event)
+	}
+
+	if len(event.Title) > datadogMaxTitleLength {
+		t.Errorf("expected title to be cut to %d bytes, got %d", datadogMaxTitleLength, len(event.Title))
+	}
+
+	config := func(key string) string {
+		if key == "api_key" {
+			return "wrong"
+		}
+
+		return ""
+	}
+
+	err := d.Report(context.Background(), failure, config, "http://stdout", "http://stderr")
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Fatalf("expected error for rejected api key, got: %v", err)
+	}
+
+	if d.Retryable(err) {
+		t.Errorf("expected rejected api key not to be retried: %s", err)
+	}
+}
@@ -0,0 +1,163 @@
+package reporter
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+)
+
+// Limits imposed by Discord on embeds
+const (
+	discordMaxTitleLength       = 256
+	discordMaxDescriptionLength = 4096
+	discordMaxFieldNameLength   = 256
+	discordMaxFieldValueLength  = 1024
+	discordMaxEmbedLength       = 6000
+)
+
+func init() {
+	var (
+		webhookURL *string
+		username   *string
+		color      *string
+		format     *string
+	)
+
+	RegisterReporter("discord", Maker{
+		RegisterFlags: func() {
+			webhookURL = flags.String("discord.webhook_url", "DISCORD_WEBHOOK_URL", "", "default discord webhook url")
+			username = flags.String("discord.username", "DISCORD_USERNAME", "", "default discord username")
+			color = flags.String("discord.color", "DISCORD_COLOR", "#d70000", "default discord embed color")
+			format = flags.String("discord.format", "DISCORD_FORMAT", "Task {{ .failure.Name }} died with status {{ .failure.State }}", "embed description format")
+		},
+
+		Make: func() (Reporter, error) {
+			if _, err := parseDiscordColor(*color); err != nil {
+				return nil, err
+			}
+
+			return newDiscordReporter(*webhookURL, *username, *color, *format), nil
+		},
+	})
+}
+
+type discordReporter struct {
+	httpRetryable
+
+	webhookURL string
+	username   string
+	color      string
+	format     string
+}
+
+type discordMessage struct {
+	Username string         `json:"username,omitempty"`
+	Embeds   []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Color       int64          `json:"color"`
+	Fields      []discordField `json:"fields"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+func newDiscordReporter(webhookURL, username, color, format string) *discordReporter {
+	return &discordReporter{
+		webhookURL: webhookURL,
+		username:   username,
+		color:      color,
+		format:     format,
+	}
+}
+
+func (d *discordReporter) Report(ctx context.Context, failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
+	webhookURL := configWithFallback(config, "webhook_url", d.webhookURL)
+	if webhookURL == "" {
+		return nil
+	}
+
+	color, err := parseDiscordColor(configWithFallback(config, "color", d.color))
+	if err != nil {
+		return err
+	}
+
+	description, err := fillMessage(failure, config, stdoutURL, stderrURL, d.format)
+	if err != nil {
+		return err
+	}
+
+	embed := discordEmbed{
+		Title:       truncate(failure.ID, discordMaxTitleLength),
+		Description: truncate(description, discordMaxDescriptionLength),
+		Color:       color,
+		Fields: []discordField{
+			discordInlineField("Framework", failure.Framework),
+			discordInlineField("Host", failure.Slave),
+			discordInlineField("Finished", failure.Finished.Format(time.RFC3339)),
+			{
+				Name:  "Logs",
+				Value: truncate(fmt.Sprintf("[stdout](%s), [stderr](%s)", stdoutURL, stderrURL), discordMaxFieldValueLength),
+			},
+		},
+	}
+
+	// Description is the only thing that can be large enough
+	// to overflow the total limit, so it gets cut to fit
+	if excess := discordEmbedLength(embed) - discordMaxEmbedLength; excess > 0 {
+		embed.Description = truncate(embed.Description, len(embed.Description)-excess)
+	}
+
+	return postJSON(ctx, webhookURL, discordMessage{
+		Username: configWithFallback(config, "username", d.username),
+		Embeds:   []discordEmbed{embed},
+	})
+}
+
+func discordInlineField(name, value string) discordField {
+	return discordField{
+		Name:   truncate(name, discordMaxFieldNameLength),
+		Value:  truncate(value, discordMaxFieldValueLength),
+		Inline: true,
+	}
+}
+
+func discordEmbedLength(embed discordEmbed) int {
+	length := len(embed.Title) + len(embed.Description)
+	for _, field := range embed.Fields {
+		length += len(field.Name) + len(field.Value)
+	}
+
+	return length
+}
+
+// parseDiscordColor parses color in "#rrggbb" format
+func parseDiscordColor(color string) (int64, error) {
+	c, err := strconv.ParseInt(strings.TrimPrefix(color, "#"), 16, 32)
+	if err != nil || c < 0 || c > 0xffffff {
+		return 0, fmt.Errorf("invalid discord color %q, expected #rrggbb", color)
+	}
+
+	return c, nil
+}
+
+// Preview renders the message without sending it
+func (d *discordReporter) Preview(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) (string, error) {
+	return fillMessage(failure, config, stdoutURL, stderrURL, d.format)
+}
+
+// DedupKey returns the webhook url
+func (d *discordReporter) DedupKey(config ConfigProvider) string {
+	return configWithFallback(config, "webhook_url", d.webhookURL)
+}
@@ -0,0 +1,195 @@
+package reporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+)
+
+func init() {
+	var (
+		url      *string
+		index    *string
+		apiKey   *string
+		username *string
+		password *string
+		bulk     *string
+	)
+
+	RegisterReporter("elasticsearch", Maker{
+		RegisterFlags: func() {
+			url = flags.String("elasticsearch.url", "ELASTICSEARCH_URL", "", "default elasticsearch url (ex: https://es.example.com:9200)")
+			index = flags.String("elasticsearch.index", "ELASTICSEARCH_INDEX", `complainer-{{ .failure.Finished.UTC.Format "2006.01" }}`, "elasticsearch index name format")
+			apiKey = flags.String("elasticsearch.api_key", "ELASTICSEARCH_API_KEY", "", "default elasticsearch api key")
+			username = flags.String("elasticsearch.username", "ELASTICSEARCH_USERNAME", "", "default elasticsearch basic auth username")
+			password = flags.String("elasticsearch.password", "ELASTICSEARCH_PASSWORD", "", "default elasticsearch basic auth password")
+			bulk = flags.String("elasticsearch.bulk", "ELASTICSEARCH_BULK", "false", "whether to index documents with the bulk api")
+		},
+
+		Make: func() (Reporter, error) {
+			return newElasticsearchReporter(*url, *index, *apiKey, *username, *password, *bulk), nil
+		},
+	})
+}
+
+type elasticsearchReporter struct {
+	httpRetryable
+
+	url      string
+	index    string
+	apiKey   string
+	username string
+	password string
+	bulk     string
+}
+
+type elasticsearchDocument struct {
+	Timestamp   time.Time         `json:"@timestamp"`
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Host        string            `json:"host"`
+	Framework   string            `json:"framework"`
+	Image       string            `json:"image"`
+	State       string            `json:"state"`
+	Reason      string            `json:"reason"`
+	Message     string            `json:"message"`
+	Started     time.Time         `json:"started"`
+	Finished    time.Time         `json:"finished"`
+	Labels      map[string]string `json:"labels"`
+	StderrTail  string            `json:"stderr_tail,omitempty"`
+	Occurrences int               `json:"occurrences"`
+	StdoutURL   string            `json:"stdout_url"`
+	StderrURL   string            `json:"stderr_url"`
+	Complainer  string            `json:"complainer"`
+}
+
+type elasticsearchBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+func newElasticsearchReporter(url, index, apiKey, username, password, bulk string) *elasticsearchReporter {
+	return &elasticsearchReporter{
+		url:      url,
+		index:    index,
+		apiKey:   apiKey,
+		username: username,
+		password: password,
+		bulk:     bulk,
+	}
+}
+
+func (e *elasticsearchReporter) Report(ctx context.Context, failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
+	url := strings.TrimSuffix(configWithFallback(config, "url", e.url), "/")
+	if url == "" {
+		return nil
+	}
+
+	index, err := fillTemplate(failure, config, stdoutURL, stderrURL, configWithFallback(config, "index", e.index))
+	if err != nil {
+		return err
+	}
+
+	document, err := json.Marshal(elasticsearchDocument{
+		Timestamp:   failure.Finished,
+		ID:          failure.ID,
+		Name:        failure.Name,
+		Host:        failure.Slave,
+		Framework:   failure.Framework,
+		Image:       failure.Image,
+		State:       failure.State,
+		Reason:      failure.Reason,
+		Message:     failure.Message,
+		Started:     failure.Started,
+		Finished:    failure.Finished,
+		Labels:      failure.Labels,
+		StderrTail:  failure.StderrTail,
+		Occurrences: failure.Occurrences,
+		StdoutURL:   stdoutURL,
+		StderrURL:   stderrURL,
+		Complainer:  failure.Complainer,
+	})
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{}
+
+	// Api key takes precedence over basic auth if both are configured
+	if apiKey := configWithFallback(config, "api_key", e.apiKey); apiKey != "" {
+		headers["Authorization"] = "ApiKey " + apiKey
+	} else if username := configWithFallback(config, "username", e.username); username != "" {
+		credentials := username + ":" + configWithFallback(config, "password", e.password)
+		headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+	}
+
+	if configWithFallback(config, "bulk", e.bulk) == "true" {
+		return elasticsearchBulkIndex(ctx, url, index, headers, document)
+	}
+
+	_, err = send(ctx, http.MethodPost, fmt.Sprintf("%s/%s/_doc", url, index), "application/json", headers, document)
+	return err
+}
+
+// elasticsearchBulkIndex indexes the document with the bulk api, which
+// responds with 200 even if indexing fails, so items need to be checked
+func elasticsearchBulkIndex(ctx context.Context, url, index string, headers map[string]string, document []byte) error {
+	action, err := json.Marshal(map[string]map[string]string{
+		"index": {"_index": index},
+	})
+	if err != nil {
+		return err
+	}
+
+	body := bytes.Buffer{}
+	body.Write(action)
+	body.WriteByte('\n')
+	body.Write(document)
+	body.WriteByte('\n')
+
+	respBody, err := send(ctx, http.MethodPost, url+"/_bulk", "application/x-ndjson", headers, body.Bytes())
+	if err != nil {
+		return err
+	}
+
+	resp := elasticsearchBulkResponse{}
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return fmt.Errorf("error decoding elasticsearch bulk response: %s", err)
+	}
+
+	if !resp.Errors {
+		return nil
+	}
+
+	for _, item := range resp.Items {
+		for _, result := range item {
+			if result.Status < 200 || result.Status >= 300 {
+				return &statusError{
+					code:    result.Status,
+					message: fmt.Sprintf("error indexing into %s with status %d: %s: %s", index, result.Status, result.Error.Type, result.Error.Reason),
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Preview renders the index name without sending anything
+func (e *elasticsearchReporter) Preview(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) (string, error) {
+	return fillTemplate(failure, config, stdoutURL, stderrURL, configWithFallback(config, "index", e.index))
+}
@@ -0,0 +1,98 @@
+package reporter
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestElasticsearchReport(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	bodies := make(chan string, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- r
+		bodies <- string(body)
+
+		if r.URL.Path == "/_bulk" {
+			_, _ = w.Write([]byte(`{"errors":true,"items":[{"index":{"status":403,"error":{"type":"cluster_block_exception","reason":"index read-only"}}}]}`))
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	e := newElasticsearchReporter(server.URL, `complainer-{{ .failure.Finished.UTC.Format "2006.01" }}`, "", "user", "secret", "false")
+
+	failure := complainer.Failure{
+		ID:         "web.1",
+		Name:       "web",
+		Finished:   time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC),
+		Complainer: "default",
+	}
+
+	config := func(key string) string {
+		return ""
+	}
+
+	if err := e.Report(context.Background(), failure, config, "http://stdout", "http://stderr"); err != nil {
+		t.Fatalf("error reporting: %s", err)
+	}
+
+	r := <-requests
+	if r.URL.Path != "/complainer-2024.01/_doc" {
+		t.Errorf("unexpected path: %s", r.URL.Path)
+	}
+
+	if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "secret" {
+		t.Errorf("unexpected basic auth: %q %q", username, password)
+	}
+
+	document := elasticsearchDocument{}
+	if err := json.Unmarshal([]byte(<-bodies), &document); err != nil {
+		t.Fatalf("error decoding document: %s", err)
+	}
+
+	if document.ID != "web.1" || document.StdoutURL != "http://stdout" || document.Complainer != "default" {
+		t.Errorf("unexpected document: %+v", document)
+	}
+
+	bulkConfig := func(key string) string {
+		switch key {
+		case "bulk":
+			return "true"
+		case "api_key":
+			return "key"
+		}
+
+		return ""
+	}
+
+	err := e.Report(context.Background(), failure, bulkConfig, "http://stdout", "http://stderr")
+	if err == nil || !strings.Contains(err.Error(), "index read-only") {
+		t.Errorf("expected bulk item error, got: %v", err)
+	}
+
+	if (httpRetryable{}).Retryable(err) {
+		t.Errorf("rejected bulk item is not expected to be retryable")
+	}
+
+	r = <-requests
+	if r.Header.Get("Authorization") != "ApiKey key" {
+		t.Errorf("unexpected authorization header: %q", r.Header.Get("Authorization"))
+	}
+
+	lines := strings.Split(strings.TrimSpace(<-bodies), "\n")
+	if len(lines) != 2 || lines[0] != `{"index":{"_index":"complainer-2024.01"}}` {
+		t.Errorf("unexpected bulk body: %q", lines)
+	}
+}
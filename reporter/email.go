@@ -0,0 +1,248 @@
+package reporter
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+)
+
+const (
+	emailTLSModeNone     = "none"
+	emailTLSModeStartTLS = "starttls"
+	emailTLSModeTLS      = "tls"
+)
+
+func init() {
+	var (
+		host        *string
+		port        *string
+		username    *string
+		password    *string
+		from        *string
+		to          *string
+		tlsMode     *string
+		contentType *string
+		subject     *string
+		format      *string
+	)
+
+	RegisterReporter("email", Maker{
+		RegisterFlags: func() {
+			host = flags.String("email.host", "EMAIL_HOST", "", "default smtp host")
+			port = flags.String("email.port", "EMAIL_PORT", "25", "default smtp port")
+			username = flags.String("email.username", "EMAIL_USERNAME", "", "default smtp username")
+			password = flags.String("email.password", "EMAIL_PASSWORD", "", "default smtp password")
+			from = flags.String("email.from", "EMAIL_FROM", "", "default sender address")
+			to = flags.String("email.to", "EMAIL_TO", "", "default comma separated recipient addresses")
+			tlsMode = flags.String("email.tls_mode", "EMAIL_TLS_MODE", emailTLSModeStartTLS, "smtp tls mode (none, starttls, tls)")
+			contentType = flags.String("email.content_type", "EMAIL_CONTENT_TYPE", "text/plain", "email content type (text/plain, text/html)")
+			subject = flags.String("email.subject", "EMAIL_SUBJECT", "Task {{ .failure.Name }} died with status {{ .failure.State }}", "email subject format")
+			format = flags.String("email.format", "EMAIL_FORMAT", "Task {{ .failure.Name }} ({{ .failure.ID }}) died with status {{ .failure.State }} on {{ .failure.Slave }} at {{ .failure.Finished }}:{{ .nl }}{{ .nl }}{{ if .failure.Message }}{{ .failure.Message }}{{ .nl }}{{ .nl }}{{ end }}  * {{ .stdoutURL }}{{ .nl }}  * {{ .stderrURL }}{{ .nl }}", "email body format")
+		},
+
+		Make: func() (Reporter, error) {
+			return &emailReporter{
+				host:        *host,
+				port:        *port,
+				username:    *username,
+				password:    *password,
+				from:        *from,
+				to:          *to,
+				tlsMode:     *tlsMode,
+				contentType: *contentType,
+				subject:     *subject,
+				format:      *format,
+			}, nil
+		},
+	})
+}
+
+type emailReporter struct {
+	host        string
+	port        string
+	username    string
+	password    string
+	from        string
+	to          string
+	tlsMode     string
+	contentType string
+	subject     string
+	format      string
+}
+
+func (e *emailReporter) Report(ctx context.Context, failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
+	host := configWithFallback(config, "host", e.host)
+	from := configWithFallback(config, "from", e.from)
+	to := splitAddresses(configWithFallback(config, "to", e.to))
+
+	if host == "" || from == "" || len(to) == 0 {
+		return nil
+	}
+
+	subject, err := fillTemplate(failure, config, stdoutURL, stderrURL, e.subject)
+	if err != nil {
+		return err
+	}
+
+	body, err := fillMessage(failure, config, stdoutURL, stderrURL, e.format)
+	if err != nil {
+		return err
+	}
+
+	message := emailMessage(from, to, subject, configWithFallback(config, "content_type", e.contentType), body)
+
+	client, err := e.dial(ctx, host, configWithFallback(config, "port", e.port), configWithFallback(config, "tls_mode", e.tlsMode))
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = client.Close()
+	}()
+
+	if username := configWithFallback(config, "username", e.username); username != "" {
+		auth := smtp.PlainAuth("", username, configWithFallback(config, "password", e.password), host)
+		if err = client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err = client.Mail(from); err != nil {
+		return err
+	}
+
+	for _, rcpt := range to {
+		if err = client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err = w.Write(message); err != nil {
+		return err
+	}
+
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// dial connects to the smtp server, the whole conversation
+// is limited by the deadline of the context if it has one
+func (e *emailReporter) dial(ctx context.Context, host, port, tlsMode string) (*smtp.Client, error) {
+	addr := net.JoinHostPort(host, port)
+	tlsConfig := &tls.Config{ServerName: host}
+
+	deadline, _ := ctx.Deadline()
+	dialer := &net.Dialer{Deadline: deadline}
+
+	switch tlsMode {
+	case emailTLSModeNone:
+		return emailClient(dialer, addr, host, nil)
+	case emailTLSModeStartTLS:
+		client, err := emailClient(dialer, addr, host, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			_ = client.Close()
+			return nil, errors.New("smtp server does not support starttls")
+		}
+
+		if err = client.StartTLS(tlsConfig); err != nil {
+			_ = client.Close()
+			return nil, err
+		}
+
+		return client, nil
+	case emailTLSModeTLS:
+		return emailClient(dialer, addr, host, tlsConfig)
+	default:
+		return nil, fmt.Errorf("unknown smtp tls mode: %q", tlsMode)
+	}
+}
+
+// emailClient makes smtp client over plain or tls connection
+func emailClient(dialer *net.Dialer, addr, host string, tlsConfig *tls.Config) (*smtp.Client, error) {
+	var conn net.Conn
+	var err error
+	if tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !dialer.Deadline.IsZero() {
+		_ = conn.SetDeadline(dialer.Deadline)
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func emailMessage(from string, to []string, subject, contentType, body string) []byte {
+	buf := bytes.NewBuffer([]byte{})
+
+	fmt.Fprintf(buf, "From: %s\r\n", from)
+	fmt.Fprintf(buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(buf, "Content-Type: %s; charset=utf-8\r\n", contentType)
+	fmt.Fprintf(buf, "\r\n")
+	buf.WriteString(strings.Replace(body, "\n", "\r\n", -1))
+
+	return buf.Bytes()
+}
+
+func splitAddresses(addresses string) []string {
+	result := []string{}
+	for _, address := range strings.Split(addresses, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			result = append(result, address)
+		}
+	}
+
+	return result
+}
+
+// Preview renders the message without sending it
+func (e *emailReporter) Preview(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) (string, error) {
+	subject, err := fillTemplate(failure, config, stdoutURL, stderrURL, e.subject)
+	if err != nil {
+		return "", err
+	}
+
+	body, err := fillMessage(failure, config, stdoutURL, stderrURL, e.format)
+	if err != nil {
+		return "", err
+	}
+
+	return subject + "\n\n" + body, nil
+}
@@ -0,0 +1,255 @@
+package reporter
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+// fakeSMTPServer accepts plain smtp sessions without extensions, rejecting
+// recipients in the rejected domain and keeping commands and messages
+type fakeSMTPServer struct {
+	listener net.Listener
+	rejected string
+
+	mu       sync.Mutex
+	commands []string
+	messages []string
+}
+
+func newFakeSMTPServer(t *testing.T, rejected string) *fakeSMTPServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &fakeSMTPServer{listener: l, rejected: rejected}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		_, _ = conn.Write([]byte(line + "\r\n"))
+	}
+
+	reply("220 localhost ESMTP")
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		command := strings.TrimSpace(line)
+
+		s.mu.Lock()
+		s.commands = append(s.commands, command)
+		s.mu.Unlock()
+
+		switch {
+		case strings.HasPrefix(command, "EHLO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "RCPT") && s.rejected != "" && strings.Contains(command, s.rejected):
+			reply("550 no such user")
+		case command == "DATA":
+			reply("354 go ahead")
+
+			data := []string{}
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+
+				if line == ".\r\n" {
+					break
+				}
+
+				data = append(data, line)
+			}
+
+			s.mu.Lock()
+			s.messages = append(s.messages, strings.Join(data, ""))
+			s.mu.Unlock()
+
+			reply("250 queued")
+		case command == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func (s *fakeSMTPServer) close() {
+	_ = s.listener.Close()
+}
+
+func TestEmailReport(t *testing.T) {
+	server := newFakeSMTPServer(t, "nowhere.example.com")
+	defer server.close()
+
+	_, port, _ := net.SplitHostPort(server.listener.Addr().String())
+
+	e := &emailReporter{
+		host:        "127.0.0.1",
+		port:        port,
+		from:        "complainer@example.com",
+		to:          "ops@example.com, ,dev@example.com",
+		tlsMode:     emailTLSModeNone,
+		contentType: "text/plain",
+		subject:     "Task {{ .failure.Name }} died",
+		format:      "{{ .failure.ID }}{{ .nl }}{{ .stdoutURL }}",
+	}
+
+	failure := complainer.Failure{ID: "web.1", Name: "web"}
+
+	if err := e.Report(context.Background(), failure, func(string) string { return "" }, "http://stdout", "http://stderr"); err != nil {
+		t.Fatal(err)
+	}
+
+	server.mu.Lock()
+	commands := append([]string{}, server.commands...)
+	messages := append([]string{}, server.messages...)
+	server.mu.Unlock()
+
+	expected := []string{
+		"MAIL FROM:<complainer@example.com>",
+		"RCPT TO:<ops@example.com>",
+		"RCPT TO:<dev@example.com>",
+		"DATA",
+		"QUIT",
+	}
+
+	if len(commands) < len(expected) || !reflect.DeepEqual(commands[len(commands)-len(expected):], expected) {
+		t.Errorf("unexpected smtp commands; expected to end with: %q, got: %q", expected, commands)
+	}
+
+	if len(messages) != 1 || !strings.Contains(messages[0], "Subject: Task web died\r\n") || !strings.HasSuffix(messages[0], "\r\n\r\nweb.1\r\nhttp://stdout\r\n") {
+		t.Errorf("unexpected messages: %q", messages)
+	}
+
+	config := func(key string) string {
+		if key == "to" {
+			return "ops@nowhere.example.com"
+		}
+
+		return ""
+	}
+
+	if err := e.Report(context.Background(), failure, config, "http://stdout", "http://stderr"); err == nil || !strings.Contains(err.Error(), "550") {
+		t.Errorf("expected rejected recipient error, got: %v", err)
+	}
+}
+
+func TestEmailTLSMode(t *testing.T) {
+	server := newFakeSMTPServer(t, "")
+	defer server.close()
+
+	_, port, _ := net.SplitHostPort(server.listener.Addr().String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	table := []struct {
+		mode string
+		err  string
+	}{
+		{mode: emailTLSModeNone},
+		{mode: emailTLSModeStartTLS, err: "does not support starttls"},
+		{mode: emailTLSModeTLS, err: "tls"},
+		{mode: "ssl", err: "unknown smtp tls mode"},
+	}
+
+	e := &emailReporter{}
+
+	for _, row := range table {
+		client, err := e.dial(ctx, "127.0.0.1", port, row.mode)
+		if client != nil {
+			_ = client.Close()
+		}
+
+		if row.err == "" {
+			if err != nil {
+				t.Errorf("unexpected error for %s mode: %s", row.mode, err)
+			}
+
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), row.err) {
+			t.Errorf("expected error with %q for %s mode, got: %v", row.err, row.mode, err)
+		}
+	}
+}
+
+func TestEmailMessage(t *testing.T) {
+	message := string(emailMessage("complainer@example.com", []string{"ops@example.com", "dev@example.com"}, "Задача web", "text/html", "one\ntwo"))
+
+	headers, body := message, ""
+	if i := strings.Index(message, "\r\n\r\n"); i >= 0 {
+		headers, body = message[:i], message[i+4:]
+	}
+
+	for _, header := range []string{
+		"From: complainer@example.com",
+		"To: ops@example.com, dev@example.com",
+		"Subject: =?utf-8?q?=D0=97=D0=B0=D0=B4=D0=B0=D1=87=D0=B0_web?=",
+		"MIME-Version: 1.0",
+		"Content-Type: text/html; charset=utf-8",
+	} {
+		if !strings.Contains(headers+"\r\n", header+"\r\n") {
+			t.Errorf("expected header %q in: %q", header, headers)
+		}
+	}
+
+	if !strings.Contains(headers, "\r\nDate: ") {
+		t.Errorf("expected date header in: %q", headers)
+	}
+
+	if body != "one\r\ntwo" {
+		t.Errorf("unexpected body: %q", body)
+	}
+}
+
+func TestSplitAddresses(t *testing.T) {
+	table := []struct {
+		addresses string
+		expected  []string
+	}{
+		{addresses: "", expected: []string{}},
+		{addresses: "ops@example.com", expected: []string{"ops@example.com"}},
+		{addresses: " ops@example.com , ,dev@example.com,", expected: []string{"ops@example.com", "dev@example.com"}},
+	}
+
+	for _, row := range table {
+		if got := splitAddresses(row.addresses); !reflect.DeepEqual(got, row.expected) {
+			t.Errorf("unexpected addresses for %q; expected: %q, got: %q", row.addresses, row.expected, got)
+		}
+	}
+}
@@ -1,7 +1,12 @@
 package reporter
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/cloudflare/complainer"
 	"github.com/cloudflare/complainer/flags"
@@ -9,45 +14,196 @@ import (
 
 func init() {
 	var (
-		file   *string
-		format *string
+		file     *string
+		format   *string
+		output   *string
+		maxSize  *int
+		maxFiles *int
 	)
 
-	registerMaker("file", Maker{
+	RegisterReporter("file", Maker{
 		RegisterFlags: func() {
 			file = flags.String("file.name", "FILE_NAME", "/dev/stderr", "file to log failures")
 			format = flags.String("file.format", "FILE_FORMAT", "Task {{ .failure.Name }} ({{ .failure.ID }}) died with status {{ .failure.State }}:{{ .nl }}  * {{ .stdoutURL }}{{ .nl }}  * {{ .stderrURL }}{{ .nl }}", "log format")
+			output = flags.String("file.output", "FILE_OUTPUT", "text", "output type: text (rendered format) or json (one object per line)")
+			maxSize = flags.Int("file.max_size", "FILE_MAX_SIZE", 0, "size in bytes to rotate the file at, 0 disables rotation")
+			maxFiles = flags.Int("file.max_files", "FILE_MAX_FILES", 5, "number of rotated files to keep")
 		},
 
 		Make: func() (Reporter, error) {
-			return newFileReporter(*file, *format)
+			return newFileReporter(fileConfig{
+				name:     *file,
+				format:   *format,
+				output:   *output,
+				maxSize:  int64(*maxSize),
+				maxFiles: *maxFiles,
+			})
 		},
 	})
 }
 
 type fileReporter struct {
-	file   *os.File
-	format string
+	config fileConfig
+
+	mutex sync.Mutex
+	file  *os.File
+	size  int64
 }
 
-func newFileReporter(file, format string) (*fileReporter, error) {
-	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
-	if err != nil {
+type fileConfig struct {
+	name     string
+	format   string
+	output   string
+	maxSize  int64
+	maxFiles int
+}
+
+type fileEvent struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Host        string            `json:"host"`
+	Framework   string            `json:"framework"`
+	Image       string            `json:"image"`
+	State       string            `json:"state"`
+	Reason      string            `json:"reason"`
+	Message     string            `json:"message"`
+	Started     time.Time         `json:"started"`
+	Finished    time.Time         `json:"finished"`
+	Labels      map[string]string `json:"labels"`
+	Occurrences int               `json:"occurrences"`
+	StdoutURL   string            `json:"stdout_url"`
+	StderrURL   string            `json:"stderr_url"`
+	Complainer  string            `json:"complainer"`
+}
+
+func newFileReporter(config fileConfig) (*fileReporter, error) {
+	if config.output != "text" && config.output != "json" {
+		return nil, fmt.Errorf("unknown file output: %q", config.output)
+	}
+
+	f := &fileReporter{
+		config: config,
+	}
+
+	if err := f.open(); err != nil {
 		return nil, err
 	}
 
-	return &fileReporter{
-		file:   f,
-		format: format,
-	}, nil
+	return f, nil
 }
 
-func (f *fileReporter) Report(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
-	s, err := fillTemplate(failure, config, stdoutURL, stderrURL, f.format)
+func (f *fileReporter) Report(ctx context.Context, failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
+	s, err := f.render(failure, config, stdoutURL, stderrURL)
 	if err != nil {
 		return err
 	}
 
-	_, err = f.file.WriteString(s)
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.config.maxSize > 0 && f.size > 0 && f.size+int64(len(s)) > f.config.maxSize {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := f.file.WriteString(s)
+	f.size += int64(n)
+
 	return err
 }
+
+func (f *fileReporter) render(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) (string, error) {
+	if f.config.output == "text" {
+		return fillMessage(failure, config, stdoutURL, stderrURL, f.config.format)
+	}
+
+	b, err := json.Marshal(fileEvent{
+		ID:          failure.ID,
+		Name:        failure.Name,
+		Host:        failure.Slave,
+		Framework:   failure.Framework,
+		Image:       failure.Image,
+		State:       failure.State,
+		Reason:      failure.Reason,
+		Message:     failure.Message,
+		Started:     failure.Started,
+		Finished:    failure.Finished,
+		Labels:      failure.Labels,
+		Occurrences: failure.Occurrences,
+		StdoutURL:   stdoutURL,
+		StderrURL:   stderrURL,
+		Complainer:  failure.Complainer,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return string(b) + "\n", nil
+}
+
+// open opens the file for appending, rotation is only
+// enabled for regular files, so /dev/stderr works as is
+func (f *fileReporter) open() error {
+	file, err := os.OpenFile(f.config.name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	if !stat.Mode().IsRegular() {
+		f.config.maxSize = 0
+	}
+
+	f.file = file
+	f.size = stat.Size()
+
+	return nil
+}
+
+// rotate moves the current file away and opens the new one,
+// the file is reopened even if shifting fails to keep reporting
+func (f *fileReporter) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+
+	if err := f.shift(); err != nil {
+		_ = f.open()
+		return err
+	}
+
+	return f.open()
+}
+
+// shift moves name.1 to name.2 and so on, then the current file
+// to name.1, only keeping maxFiles rotated files
+func (f *fileReporter) shift() error {
+	if f.config.maxFiles < 1 {
+		return os.Remove(f.config.name)
+	}
+
+	oldest := fmt.Sprintf("%s.%d", f.config.name, f.config.maxFiles)
+	if err := os.Remove(oldest); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for i := f.config.maxFiles - 1; i > 0; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", f.config.name, i), fmt.Sprintf("%s.%d", f.config.name, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return os.Rename(f.config.name, f.config.name+".1")
+}
+
+// Preview renders the message without sending it
+func (f *fileReporter) Preview(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) (string, error) {
+	return f.render(failure, config, stdoutURL, stderrURL)
+}
@@ -0,0 +1,122 @@
+package reporter
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestFileRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "complainer-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	name := filepath.Join(dir, "failures.log")
+
+	f, err := newFileReporter(fileConfig{
+		name:     name,
+		format:   "{{ .failure.ID }}{{ .nl }}",
+		output:   "text",
+		maxSize:  10,
+		maxFiles: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := func(string) string { return "" }
+
+	for _, id := range []string{"task.1", "task.2", "task.3", "task.4"} {
+		if err := f.Report(context.Background(), complainer.Failure{ID: id}, config, "", ""); err != nil {
+			t.Fatalf("error reporting: %s", err)
+		}
+	}
+
+	expected := map[string]string{
+		name:        "task.4\n",
+		name + ".1": "task.3\n",
+		name + ".2": "task.2\n",
+	}
+
+	for file, contents := range expected {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Errorf("error reading %s: %s", file, err)
+			continue
+		}
+
+		if string(b) != contents {
+			t.Errorf("unexpected contents of %s: %q", file, b)
+		}
+	}
+
+	if _, err := os.Stat(name + ".3"); !os.IsNotExist(err) {
+		t.Errorf("only %d rotated files are expected to be kept", 2)
+	}
+}
+
+func TestFileJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "complainer-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	name := filepath.Join(dir, "failures.log")
+
+	f, err := newFileReporter(fileConfig{name: name, output: "json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := func(key string) string {
+		return ""
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := f.Report(context.Background(), complainer.Failure{ID: "web.1", Complainer: "default"}, config, "http://stdout", "http://stderr"); err != nil {
+				t.Errorf("error reporting: %s", err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 20 {
+		t.Fatalf("unexpected number of lines: %d", len(lines))
+	}
+
+	event := fileEvent{}
+	if err := json.Unmarshal([]byte(lines[0]), &event); err != nil {
+		t.Fatalf("error decoding line: %s", err)
+	}
+
+	if event.ID != "web.1" || event.StderrURL != "http://stderr" || event.Complainer != "default" {
+		t.Errorf("unexpected event: %+v", event)
+	}
+}
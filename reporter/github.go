@@ -0,0 +1,325 @@
+package reporter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+	"github.com/cloudflare/complainer/httpclient"
+)
+
+const (
+	// githubMaxLabelLength is the maximum label name length accepted by GitHub
+	githubMaxLabelLength = 50
+	// githubMaxBodyLength is the maximum issue and comment body length
+	githubMaxBodyLength = 65536
+	// githubSecondaryRateLimitDelay is the wait after hitting secondary
+	// rate limits without Retry-After header, as GitHub docs suggest
+	githubSecondaryRateLimitDelay = time.Minute
+)
+
+func init() {
+	var (
+		apiURL  *string
+		token   *string
+		repo    *string
+		label   *string
+		labels  *string
+		title   *string
+		format  *string
+		comment *string
+	)
+
+	RegisterReporter("github", Maker{
+		RegisterFlags: func() {
+			apiURL = flags.String("github.api_url", "GITHUB_API_URL", "https://api.github.com", "default github api url, change for github enterprise")
+			token = flags.String("github.token", "GITHUB_TOKEN", "", "default github token")
+			repo = flags.String("github.repo", "GITHUB_REPO", "", "default github repository in owner/repo format")
+			label = flags.String("github.label", "GITHUB_LABEL", "complainer:{{ .failure.Name }}", "label format to find open issues of the failure")
+			labels = flags.String("github.labels", "GITHUB_LABELS", "", "extra labels of created issues, separated by comma")
+			title = flags.String("github.title", "GITHUB_TITLE", "Task {{ .failure.Name }} died with status {{ .failure.State }}", "issue title format")
+			format = flags.String("github.format", "GITHUB_FORMAT", "Task `{{ .failure.Name }}` ({{ .failure.ID }}) died with status {{ .failure.State }} on {{ .failure.Slave }}.{{ .nl }}{{ .nl }}* [stdout]({{ .stdoutURL }}){{ .nl }}* [stderr]({{ .stderrURL }}){{ .nl }}", "issue body format")
+			comment = flags.String("github.comment", "GITHUB_COMMENT", "Task `{{ .failure.Name }}` ({{ .failure.ID }}) died again with status {{ .failure.State }} on {{ .failure.Slave }}.{{ .nl }}{{ .nl }}* [stdout]({{ .stdoutURL }}){{ .nl }}* [stderr]({{ .stderrURL }}){{ .nl }}", "comment format for open issues")
+		},
+
+		Make: func() (Reporter, error) {
+			return newGitHubReporter(*apiURL, *token, *repo, *label, *labels, *title, *format, *comment), nil
+		},
+	})
+}
+
+type githubReporter struct {
+	httpRetryable
+
+	apiURL  string
+	token   string
+	repo    string
+	label   string
+	labels  string
+	title   string
+	format  string
+	comment string
+
+	// resets keep when rate limits of api url and token pairs reset,
+	// requests are not sent until then
+	mutex  sync.Mutex
+	resets map[string]time.Time
+}
+
+type githubIssue struct {
+	Number int      `json:"number,omitempty"`
+	Title  string   `json:"title,omitempty"`
+	Body   string   `json:"body,omitempty"`
+	Labels []string `json:"labels,omitempty"`
+}
+
+type githubComment struct {
+	Body string `json:"body"`
+}
+
+func newGitHubReporter(apiURL, token, repo, label, labels, title, format, comment string) *githubReporter {
+	return &githubReporter{
+		apiURL:  apiURL,
+		token:   token,
+		repo:    repo,
+		label:   label,
+		labels:  labels,
+		title:   title,
+		format:  format,
+		comment: comment,
+		resets:  map[string]time.Time{},
+	}
+}
+
+func (g *githubReporter) Report(ctx context.Context, failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
+	token := configWithFallback(config, "token", g.token)
+	repo := configWithFallback(config, "repo", g.repo)
+
+	if token == "" || repo == "" {
+		return nil
+	}
+
+	if err := checkGitHubRepo(repo); err != nil {
+		return err
+	}
+
+	label, err := fillTemplate(failure, config, stdoutURL, stderrURL, configWithFallback(config, "label", g.label))
+	if err != nil {
+		return err
+	}
+
+	// Empty label would match any open issue of the repository
+	if label = githubLabel(label); label == "" {
+		return errors.New("github label is empty")
+	}
+
+	apiURL := strings.TrimSuffix(configWithFallback(config, "api_url", g.apiURL), "/")
+
+	// Repeated failures are commented on the open issue instead of new ones
+	number, err := g.openIssue(ctx, apiURL, token, repo, label)
+	if err != nil {
+		return err
+	}
+
+	if number != 0 {
+		body, err := fillTemplate(failure, config, stdoutURL, stderrURL, configWithFallback(config, "comment", g.comment))
+		if err != nil {
+			return err
+		}
+
+		_, err = g.request(ctx, apiURL, token, http.MethodPost, fmt.Sprintf("/repos/%s/issues/%d/comments", repo, number), githubComment{Body: truncate(body, githubMaxBodyLength)})
+		return err
+	}
+
+	title, err := fillTemplate(failure, config, stdoutURL, stderrURL, configWithFallback(config, "title", g.title))
+	if err != nil {
+		return err
+	}
+
+	body, err := fillMessage(failure, config, stdoutURL, stderrURL, configWithFallback(config, "format", g.format))
+	if err != nil {
+		return err
+	}
+
+	issue := githubIssue{
+		Title:  title,
+		Body:   truncate(body, githubMaxBodyLength),
+		Labels: []string{label},
+	}
+
+	for _, extra := range strings.Split(configWithFallback(config, "labels", g.labels), ",") {
+		if extra = strings.TrimSpace(extra); extra != "" {
+			issue.Labels = append(issue.Labels, extra)
+		}
+	}
+
+	_, err = g.request(ctx, apiURL, token, http.MethodPost, "/repos/"+repo+"/issues", issue)
+	return err
+}
+
+// Validate checks that the token can access the repository
+func (g *githubReporter) Validate(ctx context.Context, config ConfigProvider) error {
+	token := configWithFallback(config, "token", g.token)
+	repo := configWithFallback(config, "repo", g.repo)
+
+	if token == "" || repo == "" {
+		return errors.New("github token and repo are required")
+	}
+
+	if err := checkGitHubRepo(repo); err != nil {
+		return err
+	}
+
+	_, err := g.request(ctx, strings.TrimSuffix(configWithFallback(config, "api_url", g.apiURL), "/"), token, http.MethodGet, "/repos/"+repo, nil)
+	return err
+}
+
+// Preview renders the issue title and body without sending them
+func (g *githubReporter) Preview(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) (string, error) {
+	title, err := fillTemplate(failure, config, stdoutURL, stderrURL, configWithFallback(config, "title", g.title))
+	if err != nil {
+		return "", err
+	}
+
+	body, err := fillMessage(failure, config, stdoutURL, stderrURL, configWithFallback(config, "format", g.format))
+	if err != nil {
+		return "", err
+	}
+
+	return title + "\n\n" + body, nil
+}
+
+// openIssue returns the number of an open issue with the label, zero if none
+func (g *githubReporter) openIssue(ctx context.Context, apiURL, token, repo, label string) (int, error) {
+	query := url.Values{
+		"state":    {"open"},
+		"labels":   {label},
+		"per_page": {"1"},
+	}
+
+	body, err := g.request(ctx, apiURL, token, http.MethodGet, "/repos/"+repo+"/issues?"+query.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	issues := []githubIssue{}
+	if err = json.Unmarshal(body, &issues); err != nil {
+		return 0, fmt.Errorf("error decoding github issues: %s", err)
+	}
+
+	if len(issues) == 0 {
+		return 0, nil
+	}
+
+	return issues[0].Number, nil
+}
+
+// request sends the payload to github api, unless the rate limit is known
+// to be exceeded. Rate limit errors are turned into retryable errors.
+func (g *githubReporter) request(ctx context.Context, apiURL, token, method, path string, payload interface{}) ([]byte, error) {
+	key := apiURL + "\x00" + token
+
+	if reset := g.reset(key); time.Now().Before(reset) {
+		return nil, &statusError{
+			code:    http.StatusTooManyRequests,
+			message: fmt.Sprintf("github rate limit is exceeded until %s", reset.UTC().Format(time.RFC3339)),
+		}
+	}
+
+	var body []byte
+	if payload != nil {
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return nil, err
+		}
+	}
+
+	headers := map[string]string{
+		"Authorization":        "Bearer " + token,
+		"Accept":               "application/vnd.github+json",
+		"X-GitHub-Api-Version": "2022-11-28",
+	}
+
+	respBody, header, err := exchange(ctx, httpclient.Client(httpclient.Reporters), method, apiURL+path, "application/json", headers, body)
+
+	e, failed := err.(*statusError)
+	if failed && e.code != http.StatusForbidden && e.code != http.StatusTooManyRequests {
+		return respBody, err
+	}
+
+	reset, limited := githubRateLimit(header, time.Now())
+	if !limited && failed && strings.Contains(strings.ToLower(e.message), "rate limit") {
+		reset, limited = time.Now().Add(githubSecondaryRateLimitDelay), true
+	}
+
+	if limited {
+		g.mutex.Lock()
+		g.resets[key] = reset
+		g.mutex.Unlock()
+
+		if failed {
+			return respBody, &statusError{
+				code:    http.StatusTooManyRequests,
+				message: fmt.Sprintf("github rate limit is exceeded until %s: %s", reset.UTC().Format(time.RFC3339), e.message),
+			}
+		}
+	}
+
+	return respBody, err
+}
+
+// reset returns when the rate limit exceeded for the key resets
+func (g *githubReporter) reset(key string) time.Time {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return g.resets[key]
+}
+
+// githubRateLimit returns when requests can be sent again if response
+// headers say that the limit is exhausted: Retry-After is used for
+// secondary limits, X-RateLimit-Reset once no requests remain
+func githubRateLimit(header http.Header, now time.Time) (time.Time, bool) {
+	if header == nil {
+		return time.Time{}, false
+	}
+
+	if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil && seconds >= 0 {
+		return now.Add(time.Duration(seconds) * time.Second), true
+	}
+
+	if header.Get("X-RateLimit-Remaining") != "0" {
+		return time.Time{}, false
+	}
+
+	reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(reset, 0), true
+}
+
+// githubLabel makes the label acceptable for github and usable in the
+// labels filter of issues api, which separates labels with commas
+func githubLabel(label string) string {
+	return truncate(strings.TrimSpace(strings.Replace(label, ",", "_", -1)), githubMaxLabelLength)
+}
+
+func checkGitHubRepo(repo string) error {
+	parts := strings.Split(repo, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("github repo %q is not in owner/repo format", repo)
+	}
+
+	return nil
+}
@@ -0,0 +1,178 @@
+package reporter
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestGitHubReport(t *testing.T) {
+	open := map[string]int{}
+	requests := []string{}
+	bodies := []string{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		bodies = append(bodies, string(body))
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/infra/failures/issues":
+			if number, ok := open[r.URL.Query().Get("labels")]; ok && r.URL.Query().Get("state") == "open" {
+				_, _ = w.Write([]byte(`[{"number":` + strconv.Itoa(number) + `}]`))
+				return
+			}
+
+			_, _ = w.Write([]byte(`[]`))
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/infra/failures/issues":
+			issue := githubIssue{}
+			_ = json.Unmarshal(body, &issue)
+			open[issue.Labels[0]] = 42
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"number":42}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/infra/failures/issues/42/comments":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id":1}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	g := newGitHubReporter(server.URL, "", "", "complainer:{{ .failure.Name }}", "infra, mesos", "Task {{ .failure.Name }} died", "Logs: {{ .stdoutURL }}", "Again: {{ .failure.ID }}")
+
+	config := func(key string) string {
+		return map[string]string{"token": "token", "repo": "infra/failures"}[key]
+	}
+
+	failure := complainer.Failure{ID: "web.1", Name: "web"}
+
+	if err := g.Report(context.Background(), failure, config, "http://stdout", "http://stderr"); err != nil {
+		t.Fatalf("error reporting: %s", err)
+	}
+
+	issue := githubIssue{}
+	if err := json.Unmarshal([]byte(bodies[len(bodies)-1]), &issue); err != nil {
+		t.Fatal(err)
+	}
+
+	if issue.Title != "Task web died" || issue.Body != "Logs: http://stdout" || strings.Join(issue.Labels, ",") != "complainer:web,infra,mesos" {
+		t.Errorf("unexpected issue: %+v", issue)
+	}
+
+	failure.ID = "web.2"
+
+	if err := g.Report(context.Background(), failure, config, "http://stdout", "http://stderr"); err != nil {
+		t.Fatalf("error reporting: %s", err)
+	}
+
+	expected := []string{
+		"GET /repos/infra/failures/issues",
+		"POST /repos/infra/failures/issues",
+		"GET /repos/infra/failures/issues",
+		"POST /repos/infra/failures/issues/42/comments",
+	}
+
+	if strings.Join(requests, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected requests: %q", requests)
+	}
+
+	if bodies[3] != `{"body":"Again: web.2"}` {
+		t.Errorf("unexpected comment: %s", bodies[3])
+	}
+
+	// Empty label would match any open issue, so nothing is sent
+	emptyLabel := func(key string) string {
+		return map[string]string{"token": "token", "repo": "infra/failures", "label": `{{ config "missing" }}`}[key]
+	}
+
+	if err := g.Report(context.Background(), failure, emptyLabel, "http://stdout", "http://stderr"); err == nil || len(requests) != len(expected) {
+		t.Errorf("expected error without requests for empty label, got: %v, requests: %q", err, requests[len(expected):])
+	}
+
+	if err := g.Validate(context.Background(), func(key string) string { return map[string]string{"token": "wrong", "repo": "infra/failures"}[key] }); err == nil {
+		t.Error("expected validation error for wrong token")
+	}
+}
+
+func TestGitHubRateLimit(t *testing.T) {
+	requests := 0
+	reset := time.Now().Add(time.Hour).Unix()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"message":"API rate limit exceeded"}`))
+	}))
+	defer server.Close()
+
+	g := newGitHubReporter(server.URL, "token", "infra/failures", "complainer:{{ .failure.Name }}", "", "", "", "")
+
+	for i := 0; i < 2; i++ {
+		err := g.Report(context.Background(), complainer.Failure{Name: "web"}, func(string) string { return "" }, "", "")
+		if err == nil || !strings.Contains(err.Error(), "rate limit is exceeded until") {
+			t.Fatalf("expected rate limit error, got: %v", err)
+		}
+
+		if !g.Retryable(err) {
+			t.Errorf("expected rate limit error to be retryable: %s", err)
+		}
+	}
+
+	if requests != 1 {
+		t.Errorf("expected no requests until rate limit reset, got %d", requests)
+	}
+}
+
+func TestGitHubRateLimitHeaders(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	table := []struct {
+		headers map[string]string
+		reset   time.Time
+		limited bool
+	}{
+		{headers: map[string]string{"X-RateLimit-Remaining": "10", "X-RateLimit-Reset": "1700003600"}},
+		{headers: map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "1700003600"}, reset: time.Unix(1700003600, 0), limited: true},
+		{headers: map[string]string{"Retry-After": "30", "X-RateLimit-Remaining": "10"}, reset: now.Add(time.Second * 30), limited: true},
+		{headers: map[string]string{"X-RateLimit-Remaining": "0"}},
+	}
+
+	for i, row := range table {
+		header := http.Header{}
+		for k, v := range row.headers {
+			header.Set(k, v)
+		}
+
+		reset, limited := githubRateLimit(header, now)
+		if limited != row.limited || !reset.Equal(row.reset) {
+			t.Errorf("row %d: unexpected rate limit: %s, %v", i, reset, limited)
+		}
+	}
+}
+
+func TestGitHubLabel(t *testing.T) {
+	if label := githubLabel("complainer:a,b"); label != "complainer:a_b" {
+		t.Errorf("unexpected label: %q", label)
+	}
+
+	if label := githubLabel("complainer:" + strings.Repeat("x", 100)); len(label) > githubMaxLabelLength {
+		t.Errorf("label is too long: %q", label)
+	}
+}
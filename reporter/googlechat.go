@@ -0,0 +1,164 @@
+package reporter
+
+import (
+	"context"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+)
+
+func init() {
+	var (
+		webhookURL *string
+		format     *string
+	)
+
+	RegisterReporter("googlechat", Maker{
+		RegisterFlags: func() {
+			webhookURL = flags.String("googlechat.webhook_url", "GOOGLECHAT_WEBHOOK_URL", "", "default google chat incoming webhook url")
+			format = flags.String("googlechat.format", "GOOGLECHAT_FORMAT", "Task {{ .failure.Name }} died with status {{ .failure.State }}", "card subtitle format")
+		},
+
+		Make: func() (Reporter, error) {
+			return newGoogleChatReporter(*webhookURL, *format), nil
+		},
+	})
+}
+
+type googleChatReporter struct {
+	httpRetryable
+
+	webhookURL string
+	format     string
+}
+
+type googleChatMessage struct {
+	Text  string           `json:"text"`
+	Cards []googleChatCard `json:"cards"`
+}
+
+type googleChatCard struct {
+	Header   googleChatHeader    `json:"header"`
+	Sections []googleChatSection `json:"sections"`
+}
+
+type googleChatHeader struct {
+	Title    string `json:"title"`
+	Subtitle string `json:"subtitle"`
+}
+
+type googleChatSection struct {
+	Widgets []googleChatWidget `json:"widgets"`
+}
+
+type googleChatWidget struct {
+	KeyValue *googleChatKeyValue `json:"keyValue,omitempty"`
+	Buttons  []googleChatButton  `json:"buttons,omitempty"`
+}
+
+type googleChatKeyValue struct {
+	TopLabel string `json:"topLabel"`
+	Content  string `json:"content"`
+}
+
+type googleChatButton struct {
+	TextButton googleChatTextButton `json:"textButton"`
+}
+
+type googleChatTextButton struct {
+	Text    string            `json:"text"`
+	OnClick googleChatOnClick `json:"onClick"`
+}
+
+type googleChatOnClick struct {
+	OpenLink googleChatOpenLink `json:"openLink"`
+}
+
+type googleChatOpenLink struct {
+	URL string `json:"url"`
+}
+
+func newGoogleChatReporter(webhookURL, format string) *googleChatReporter {
+	return &googleChatReporter{
+		webhookURL: webhookURL,
+		format:     format,
+	}
+}
+
+func (g *googleChatReporter) Report(ctx context.Context, failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
+	webhookURL := configWithFallback(config, "webhook_url", g.webhookURL)
+	if webhookURL == "" {
+		return nil
+	}
+
+	text, err := fillMessage(failure, config, stdoutURL, stderrURL, g.format)
+	if err != nil {
+		return err
+	}
+
+	message := googleChatMessage{
+		Text: text,
+		Cards: []googleChatCard{
+			{
+				Header: googleChatHeader{
+					Title:    failure.ID,
+					Subtitle: text,
+				},
+				Sections: []googleChatSection{
+					{
+						Widgets: []googleChatWidget{
+							googleChatKeyValueWidget("Host", failure.Slave),
+							googleChatKeyValueWidget("Framework", failure.Framework),
+							googleChatKeyValueWidget("Finished", failure.Finished.Format(time.RFC3339)),
+						},
+					},
+					{
+						Widgets: []googleChatWidget{
+							{
+								Buttons: []googleChatButton{
+									googleChatLinkButton("STDOUT", stdoutURL),
+									googleChatLinkButton("STDERR", stderrURL),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	return postJSON(ctx, webhookURL, message)
+}
+
+func googleChatKeyValueWidget(label, content string) googleChatWidget {
+	return googleChatWidget{
+		KeyValue: &googleChatKeyValue{
+			TopLabel: label,
+			Content:  content,
+		},
+	}
+}
+
+func googleChatLinkButton(text, url string) googleChatButton {
+	return googleChatButton{
+		TextButton: googleChatTextButton{
+			Text: text,
+			OnClick: googleChatOnClick{
+				OpenLink: googleChatOpenLink{
+					URL: url,
+				},
+			},
+		},
+	}
+}
+
+// Preview renders the message without sending it
+func (g *googleChatReporter) Preview(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) (string, error) {
+	return fillMessage(failure, config, stdoutURL, stderrURL, g.format)
+}
+
+// DedupKey returns the webhook url
+func (g *googleChatReporter) DedupKey(config ConfigProvider) string {
+	return configWithFallback(config, "webhook_url", g.webhookURL)
+}
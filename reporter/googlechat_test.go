@@ -0,0 +1,88 @@
+package reporter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestGoogleChatReport(t *testing.T) {
+	var message googleChatMessage
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("key") != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+			t.Errorf("error decoding message: %s", err)
+		}
+	}))
+	defer server.Close()
+
+	g := newGoogleChatReporter(server.URL+"/webhook?key=secret", "Task {{ .failure.Name }} died with status {{ .failure.State }}")
+
+	finished := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	failure := complainer.Failure{ID: "web.1", Name: "web", Framework: "marathon", Slave: "host1", State: "TASK_FAILED", Finished: finished}
+
+	if err := g.Report(context.Background(), failure, func(string) string { return "" }, "http://stdout", "http://stderr"); err != nil {
+		t.Fatal(err)
+	}
+
+	text := "Task web died with status TASK_FAILED"
+	expected := googleChatMessage{
+		Text: text,
+		Cards: []googleChatCard{
+			{
+				Header: googleChatHeader{Title: "web.1", Subtitle: text},
+				Sections: []googleChatSection{
+					{
+						Widgets: []googleChatWidget{
+							googleChatKeyValueWidget("Host", "host1"),
+							googleChatKeyValueWidget("Framework", "marathon"),
+							googleChatKeyValueWidget("Finished", "2017-01-02T03:04:05Z"),
+						},
+					},
+					{
+						Widgets: []googleChatWidget{
+							{
+								Buttons: []googleChatButton{
+									googleChatLinkButton("STDOUT", "http://stdout"),
+									googleChatLinkButton("STDERR", "http://stderr"),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(message, expected) {
+		t.Errorf("unexpected message; expected: %+v, got: %+v", expected, message)
+	}
+
+	config := func(key string) string {
+		if key == "webhook_url" {
+			return server.URL + "/webhook?key=wrong"
+		}
+
+		return ""
+	}
+
+	err := g.Report(context.Background(), failure, config, "http://stdout", "http://stderr")
+	if err == nil {
+		t.Fatal("expected error for non-2xx response")
+	}
+
+	if g.Retryable(err) {
+		t.Errorf("expected client error not to be retryable: %s", err)
+	}
+}
@@ -0,0 +1,145 @@
+package reporter
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+	"github.com/cloudflare/complainer/httpclient"
+)
+
+func init() {
+	var (
+		serverURL *string
+		token     *string
+		priority  *string
+		insecure  *bool
+		title     *string
+		format    *string
+	)
+
+	RegisterReporter("gotify", Maker{
+		RegisterFlags: func() {
+			serverURL = flags.String("gotify.url", "GOTIFY_URL", "", "default gotify server url")
+			token = flags.String("gotify.token", "GOTIFY_TOKEN", "", "default gotify application token")
+			priority = flags.String("gotify.priority", "GOTIFY_PRIORITY", "8", "default gotify message priority")
+			insecure = flags.Bool("gotify.insecure", "GOTIFY_INSECURE", false, "skip verification of gotify server tls certificate")
+			title = flags.String("gotify.title", "GOTIFY_TITLE", "Task {{ .failure.Name }} died", "message title format")
+			format = flags.String("gotify.format", "GOTIFY_FORMAT", "Task {{ .failure.Name }} ({{ .failure.ID }}) died with status {{ .failure.State }} on {{ .failure.Slave }}{{ .nl }}{{ .nl }}stdout: {{ .stdoutURL }}{{ .nl }}stderr: {{ .stderrURL }}", "message format")
+		},
+
+		Make: func() (Reporter, error) {
+			return newGotifyReporter(*serverURL, *token, *priority, *insecure, *title, *format)
+		},
+	})
+}
+
+type gotifyReporter struct {
+	httpRetryable
+
+	serverURL string
+	token     string
+	priority  string
+	insecure  bool
+	title     string
+	format    string
+	// insecureClient skips tls verification for self-signed servers
+	insecureClient *http.Client
+}
+
+type gotifyMessage struct {
+	Title    string `json:"title"`
+	Message  string `json:"message"`
+	Priority int    `json:"priority"`
+}
+
+func newGotifyReporter(serverURL, token, priority string, insecure bool, title, format string) (*gotifyReporter, error) {
+	if _, err := strconv.Atoi(priority); err != nil {
+		return nil, fmt.Errorf("invalid gotify priority %q: %s", priority, err)
+	}
+
+	insecureTransport := httpclient.NewTransport(httpclient.Reporters)
+	insecureTransport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+
+	return &gotifyReporter{
+		serverURL: serverURL,
+		token:     token,
+		priority:  priority,
+		insecure:  insecure,
+		title:     title,
+		format:    format,
+		insecureClient: &http.Client{
+			Transport: httpclient.WithUserAgent(insecureTransport),
+		},
+	}, nil
+}
+
+func (g *gotifyReporter) Report(ctx context.Context, failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
+	serverURL := configWithFallback(config, "url", g.serverURL)
+	token := configWithFallback(config, "token", g.token)
+
+	if serverURL == "" || token == "" {
+		return nil
+	}
+
+	message, err := g.message(failure, config, stdoutURL, stderrURL)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	client := httpclient.Client(httpclient.Reporters)
+	if configWithFallback(config, "insecure", strconv.FormatBool(g.insecure)) == "true" {
+		client = g.insecureClient
+	}
+
+	headers := map[string]string{
+		"X-Gotify-Key": token,
+	}
+
+	_, err = sendWithClient(ctx, client, http.MethodPost, strings.TrimSuffix(serverURL, "/")+"/message", "application/json", headers, body)
+	return err
+}
+
+func (g *gotifyReporter) message(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) (gotifyMessage, error) {
+	priority, err := strconv.Atoi(configWithFallback(config, "priority", g.priority))
+	if err != nil {
+		return gotifyMessage{}, fmt.Errorf("invalid gotify priority: %s", err)
+	}
+
+	title, err := fillTemplate(failure, config, stdoutURL, stderrURL, configWithFallback(config, "title", g.title))
+	if err != nil {
+		return gotifyMessage{}, err
+	}
+
+	message, err := fillMessage(failure, config, stdoutURL, stderrURL, g.format)
+	if err != nil {
+		return gotifyMessage{}, err
+	}
+
+	return gotifyMessage{
+		Title:    title,
+		Message:  message,
+		Priority: priority,
+	}, nil
+}
+
+// Preview renders the message without sending it
+func (g *gotifyReporter) Preview(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) (string, error) {
+	message, err := g.message(failure, config, stdoutURL, stderrURL)
+	if err != nil {
+		return "", err
+	}
+
+	return message.Title + "\n\n" + message.Message, nil
+}
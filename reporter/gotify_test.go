@@ -0,0 +1,65 @@
+package reporter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestGotifyReport(t *testing.T) {
+	var message gotifyMessage
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/message" || r.Header.Get("X-Gotify-Key") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+			t.Errorf("error decoding message: %s", err)
+		}
+	}))
+	defer server.Close()
+
+	g, err := newGotifyReporter(server.URL+"/", "token", "8", false, "Task {{ .failure.Name }} died", "{{ .failure.ID }}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failure := complainer.Failure{ID: "web.1", Name: "web"}
+	labels := map[string]string{"priority": "5"}
+	config := func(key string) string {
+		return labels[key]
+	}
+
+	// Self-signed certificate of the test server is rejected by default
+	if err = g.Report(context.Background(), failure, config, "", ""); err == nil {
+		t.Fatal("expected error for self-signed certificate")
+	}
+
+	labels["insecure"] = "true"
+
+	if err = g.Report(context.Background(), failure, config, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := (gotifyMessage{Title: "Task web died", Message: "web.1", Priority: 5}); message != expected {
+		t.Errorf("unexpected message; expected: %+v, got: %+v", expected, message)
+	}
+
+	labels["token"] = "wrong"
+
+	if err = g.Report(context.Background(), failure, config, "", ""); err == nil {
+		t.Error("expected error for rejected message")
+	}
+}
+
+func TestGotifyInvalidPriority(t *testing.T) {
+	if _, err := newGotifyReporter("", "", "high", false, "", ""); err == nil {
+		t.Error("expected error for invalid priority")
+	}
+}
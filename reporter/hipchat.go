@@ -1,11 +1,14 @@
 package reporter
 
 import (
+	"context"
 	"errors"
 	"net/url"
+	"sync"
 
 	"github.com/cloudflare/complainer"
 	"github.com/cloudflare/complainer/flags"
+	"github.com/cloudflare/complainer/httpclient"
 	"github.com/tbruyelle/hipchat-go/hipchat"
 )
 
@@ -17,7 +20,7 @@ func init() {
 		format  *string
 	)
 
-	registerMaker("hipchat", Maker{
+	RegisterReporter("hipchat", Maker{
 		RegisterFlags: func() {
 			baseURL = flags.String("hipchat.base_url", "HIPCHAT_BASE_URL", "https://api.hipchat.com/v2/", "default hipchat base url")
 			token = flags.String("hipchat.token", "HIPCHAT_TOKEN", "", "default hipchat token")
@@ -36,6 +39,7 @@ type hipchatReporter struct {
 	room     string
 	clients  map[hipchatClientIdentity]*hipchat.Client
 	format   string
+	mu       sync.Mutex
 }
 
 func newHipchatReporter(baseURL, token, room, format string) *hipchatReporter {
@@ -60,6 +64,9 @@ func (h *hipchatReporter) client(baseURL, token string) (*hipchat.Client, error)
 		token:   token,
 	}
 
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
 	if client, ok := h.clients[identity]; ok {
 		return client, nil
 	}
@@ -71,13 +78,14 @@ func (h *hipchatReporter) client(baseURL, token string) (*hipchat.Client, error)
 	}
 
 	client.BaseURL = parsedURL
+	client.SetHTTPClient(httpclient.Client(httpclient.Reporters))
 
 	h.clients[identity] = client
 
 	return client, nil
 }
 
-func (h *hipchatReporter) Report(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
+func (h *hipchatReporter) Report(ctx context.Context, failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
 	baseURL := config("base_url")
 	if baseURL == "" {
 		baseURL = h.identity.baseURL
@@ -102,30 +110,37 @@ func (h *hipchatReporter) Report(failure complainer.Failure, config ConfigProvid
 		return err
 	}
 
-	message, err := fillTemplate(failure, config, stdoutURL, stderrURL, h.format)
+	message, err := fillMessage(failure, config, stdoutURL, stderrURL, h.format)
 	if err != nil {
 		return err
 	}
 
-	resp, err := client.Room.Notification(room, &hipchat.NotificationRequest{
-		MessageFormat: "html",
-		Color:         "red",
-		Notify:        true,
-		Message:       message,
-	})
-
-	if err != nil {
-		defer func() {
-			if resp != nil {
-				_ = resp.Body.Close()
-			}
-		}()
-	}
+	return withContext(ctx, func() error {
+		resp, err := client.Room.Notification(room, &hipchat.NotificationRequest{
+			MessageFormat: "html",
+			Color:         "red",
+			Notify:        true,
+			Message:       message,
+		})
+
+		if err != nil {
+			defer func() {
+				if resp != nil {
+					_ = resp.Body.Close()
+				}
+			}()
+		}
 
-	return err
+		return err
+	})
 }
 
 type hipchatClientIdentity struct {
 	baseURL string
 	token   string
 }
+
+// Preview renders the message without sending it
+func (h *hipchatReporter) Preview(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) (string, error) {
+	return fillMessage(failure, config, stdoutURL, stderrURL, h.format)
+}
@@ -0,0 +1,113 @@
+package reporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+
+	"github.com/cloudflare/complainer/httpclient"
+)
+
+// sendJSON sends the payload encoded as JSON to the url with the requested
+// method and headers, returning the response body. Responses with non-2xx
+// status codes are turned into errors.
+func sendJSON(ctx context.Context, method, url string, headers map[string]string, payload interface{}) ([]byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return send(ctx, method, url, "application/json", headers, body)
+}
+
+// postJSON is a shortcut for sendJSON with POST method and no extra headers
+func postJSON(ctx context.Context, url string, payload interface{}) error {
+	_, err := sendJSON(ctx, http.MethodPost, url, nil, payload)
+	return err
+}
+
+// send sends the body to the url with the requested method, content type
+// and headers, returning the response body. Responses with non-2xx
+// status codes are turned into errors. The request is cancelled
+// when the context is done.
+func send(ctx context.Context, method, url, contentType string, headers map[string]string, body []byte) ([]byte, error) {
+	return sendWithClient(ctx, httpclient.Client(httpclient.Reporters), method, url, contentType, headers, body)
+}
+
+// sendWithClient is send with a custom http client, for example
+// the one trusting self-signed certificates
+func sendWithClient(ctx context.Context, client *http.Client, method, url, contentType string, headers map[string]string, body []byte) ([]byte, error) {
+	respBody, _, err := exchange(ctx, client, method, url, contentType, headers, body)
+	return respBody, err
+}
+
+// exchange is send with a custom http client that also returns response
+// headers, for apis telling about rate limits in them. Headers are
+// returned with errors for non-2xx status codes too.
+func exchange(ctx context.Context, client *http.Client, method, url, contentType string, headers map[string]string, body []byte) ([]byte, http.Header, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req = req.WithContext(ctx)
+
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.Header, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return respBody, resp.Header, &statusError{
+			code:    resp.StatusCode,
+			message: fmt.Sprintf("unexpected response status %d from %s: %s", resp.StatusCode, req.URL.Host, bytes.TrimSpace(respBody)),
+		}
+	}
+
+	return respBody, resp.Header, nil
+}
+
+// statusError is returned when the response has non-2xx status code
+type statusError struct {
+	code    int
+	message string
+}
+
+func (e *statusError) Error() string {
+	return e.message
+}
+
+// httpRetryable implements RetryableReporter for reporters talking http:
+// rate limiting, server and network errors are retried. Other errors,
+// like client errors or broken templates, would fail again, so they are not.
+type httpRetryable struct{}
+
+func (httpRetryable) Retryable(err error) bool {
+	switch e := err.(type) {
+	case *statusError:
+		return e.code == http.StatusTooManyRequests || e.code >= http.StatusInternalServerError
+	case net.Error:
+		// Errors from http client are *url.Error, which covers timeouts too
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,104 @@
+package reporter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestHTTPRetryable(t *testing.T) {
+	table := []struct {
+		status    int
+		err       bool
+		retryable bool
+	}{
+		{
+			status: http.StatusOK,
+		},
+		{
+			status: http.StatusNoContent,
+		},
+		{
+			status:    http.StatusBadRequest,
+			err:       true,
+			retryable: false,
+		},
+		{
+			status:    http.StatusForbidden,
+			err:       true,
+			retryable: false,
+		},
+		{
+			status:    http.StatusTooManyRequests,
+			err:       true,
+			retryable: true,
+		},
+		{
+			status:    http.StatusBadGateway,
+			err:       true,
+			retryable: true,
+		},
+	}
+
+	for _, row := range table {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(row.status)
+		}))
+
+		err := postJSON(context.Background(), server.URL, map[string]string{"hello": "world"})
+		server.Close()
+
+		if (err != nil) != row.err {
+			t.Errorf("unexpected error for status %d: %v", row.status, err)
+			continue
+		}
+
+		if err != nil && (httpRetryable{}).Retryable(err) != row.retryable {
+			t.Errorf("invalid retryable for status %d; expected: %v", row.status, row.retryable)
+		}
+	}
+
+	if err := postJSON(context.Background(), "http://127.0.0.1:1", nil); !(httpRetryable{}).Retryable(err) {
+		t.Errorf("network errors are expected to be retryable: %v", err)
+	}
+
+	if err := postJSON(context.Background(), "http://127.0.0.1:1", func() {}); err == nil || (httpRetryable{}).Retryable(err) {
+		t.Errorf("marshal errors are not expected to be retryable: %v", err)
+	}
+
+	if _, err := fillTemplate(complainer.Failure{}, nil, "", "", "{{ .failure.Missing }}"); err == nil || (httpRetryable{}).Retryable(err) {
+		t.Errorf("template errors are not expected to be retryable: %v", err)
+	}
+
+	if (httpRetryable{}).Retryable(errors.New("slack api error: channel_not_found")) {
+		t.Error("api errors are not expected to be retryable")
+	}
+}
+
+func TestPostJSONCancel(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+
+	// Handler has to be released before the server waits for it
+	defer func() {
+		close(done)
+		server.Close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	if err := postJSON(ctx, server.URL, map[string]string{"hello": "world"}); err == nil {
+		t.Error("expected error for hung endpoint")
+	}
+}
@@ -1,22 +1,67 @@
 package reporter
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"strings"
+	"sync"
 
 	jira "github.com/andygrunwald/go-jira"
 	"github.com/cloudflare/complainer"
 	"github.com/cloudflare/complainer/flags"
+	"github.com/cloudflare/complainer/httpclient"
 )
 
-// jiraReporter holds necessary information to create issues for any failures
+// jiraLabelPrefix starts labels of created issues, the rest of the label
+// is derived from the task name to find open issues of the same task
+const jiraLabelPrefix = "complainer-"
+
+// jiraFieldLabels map labels to fields they override in jira.fields
+var jiraFieldLabels = map[string]string{
+	"project":     "Project",
+	"issue_type":  "Issue Type",
+	"summary":     "Summary",
+	"description": "Description",
+}
+
+// jiraReporter holds necessary information to create issues for any failures,
+// clients and create meta are cached per jira instance, project and issue type
 type jiraReporter struct {
-	client           *jira.Client
-	metaProject      *jira.MetaProject
-	metaIssuetype    *jira.MetaIssueType
-	fieldsConfig     map[string]string
-	closedStatusName string
+	httpRetryable
+
+	url          string
+	username     string
+	password     string
+	apiToken     string
+	fields       string
+	closedStatus string
+
+	mutex   sync.Mutex
+	targets map[string]*jiraTarget
+}
+
+// jiraTarget is authenticated client with create meta of the issue type.
+// Reports to the target are made one at a time, so retries of a report
+// abandoned on timeout do not race it to create the same issue.
+type jiraTarget struct {
+	mutex         sync.Mutex
+	transport     *jiraContextTransport
+	client        *jira.Client
+	metaProject   *jira.MetaProject
+	metaIssuetype *jira.MetaIssueType
+}
+
+// jiraConfig is the config of the reporter instance with labels applied
+type jiraConfig struct {
+	url          string
+	username     string
+	password     string
+	apiToken     string
+	fields       map[string]string
+	closedStatus string
 }
 
 func init() {
@@ -24,84 +69,88 @@ func init() {
 		jiraURL             *string
 		username            *string
 		password            *string
+		apiToken            *string
 		fieldsConfiguration *string
 		closedStatus        *string
 	)
 
-	registerMaker("jira", Maker{
+	RegisterReporter("jira", Maker{
 		RegisterFlags: func() {
 			jiraURL = flags.String("jira.url", "JIRA_URL", "", "Default JIRA instance url")
 			username = flags.String("jira.username", "JIRA_USERNAME", "", "JIRA user to authenticate as")
 			password = flags.String("jira.password", "JIRA_PASSWORD", "", "JIRA password for the user to authenticate")
+			apiToken = flags.String("jira.api_token", "JIRA_API_TOKEN", "", "JIRA api token for the user to authenticate, used instead of password if set")
 			fieldsConfiguration = flags.String("jira.fields", "JIRA_FIELDS", "Project:COMPLAINER;Issue Type:Bug;Summary:Task {{ .failure.Name }} died with status {{ .failure.State }};Description:[stdout|{{ .stdoutURL }}], [stderr|{{ .stderrURL }}], ID={{ .failure.ID }}", "JIRA fields in 'key:value;...' format seperated by ';', this configuration MUST contain 'Project', 'Summary' and 'Issue Type'")
 			closedStatus = flags.String("jira.issue_closed_status", "JIRA_ISSUE_CLOSED_STATUS", "Closed", "The status of JIRA issue when it is considered closed")
 		},
 
 		Make: func() (Reporter, error) {
-			return newJiraReporter(*jiraURL, *username, *password, *fieldsConfiguration, *closedStatus)
+			return newJiraReporter(*jiraURL, *username, *password, *apiToken, *fieldsConfiguration, *closedStatus)
 		},
 	})
 }
 
-func newJiraReporter(jiraURL, username, password, fieldsConfiguration, closedStatus string) (*jiraReporter, error) {
-	err := checkArgsNotNil(jiraURL, username, password, fieldsConfiguration, closedStatus)
-	if err != nil {
-		return nil, err
-	}
-
-	reporter := new(jiraReporter)
-	client, err := createJiraClient(jiraURL, username, password)
-	if err != nil {
+func newJiraReporter(jiraURL, username, password, apiToken, fieldsConfiguration, closedStatus string) (*jiraReporter, error) {
+	// Broken default fields would break every instance, so they fail early
+	if _, err := parseJiraFields(fieldsConfiguration); err != nil {
 		return nil, err
 	}
 
-	reporter.client = client
+	return &jiraReporter{
+		url:          jiraURL,
+		username:     username,
+		password:     password,
+		apiToken:     apiToken,
+		fields:       fieldsConfiguration,
+		closedStatus: closedStatus,
+		targets:      map[string]*jiraTarget{},
+	}, nil
+}
 
-	err = reporter.setFieldsConfig(fieldsConfiguration)
-	if err != nil {
-		return nil, err
+func (j *jiraReporter) Report(ctx context.Context, failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
+	if configWithFallback(config, "url", j.url) == "" {
+		return nil
 	}
 
-	project, found := reporter.fieldsConfig["Project"]
-	if !found {
-		return nil, fmt.Errorf("project is equired in field configuration")
+	c, err := j.config(config)
+	if err != nil {
+		return err
 	}
 
-	issueType, found := reporter.fieldsConfig["Issue Type"]
-	if !found {
-		return nil, fmt.Errorf("issue type is required in field configuration")
+	target, err := j.target(ctx, c)
+	if err != nil {
+		return err
 	}
 
-	reporter.closedStatusName = closedStatus
+	target.mutex.Lock()
+	defer target.mutex.Unlock()
 
-	// get create meta information
-	metaProject, err := createMetaProject(client, project)
-	if err != nil {
-		return nil, err
-	}
+	// go-jira does not take contexts, requests get them from the transport
+	target.transport.setContext(ctx)
+	defer target.transport.setContext(nil)
 
-	reporter.metaProject = metaProject
+	return j.report(c, target, failure, config, stdoutURL, stderrURL)
+}
 
-	// get right issue within project
-	metaIssuetype, err := createMetaIssueType(metaProject, issueType)
-	if err != nil {
-		return nil, err
+// Validate authenticates in jira and checks fields against create meta
+func (j *jiraReporter) Validate(ctx context.Context, config ConfigProvider) error {
+	if configWithFallback(config, "url", j.url) == "" {
+		return nil
 	}
 
-	// check if the given fields completes the mandatory fields and all listed fields are available
-	complete, err := metaIssuetype.CheckCompleteAndAvailable(reporter.fieldsConfig)
-	if !complete {
-		return nil, err
+	c, err := j.config(config)
+	if err != nil {
+		return err
 	}
 
-	reporter.metaIssuetype = metaIssuetype
-	return reporter, nil
+	_, err = j.target(ctx, c)
+	return err
 }
 
-func (j *jiraReporter) Report(failure complainer.Failure, config ConfigProvider, stdoutURL, stderrURL string) error {
+func (j *jiraReporter) report(c jiraConfig, target *jiraTarget, failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
 	renderedFields := make(map[string]string)
 	// render all values as they can be tempaltes
-	for field, templatedValue := range j.fieldsConfig {
+	for field, templatedValue := range c.fields {
 		rendered, err := fillTemplate(failure, config, stdoutURL, stderrURL, templatedValue)
 		if err != nil {
 			return fmt.Errorf("rendering value of %s as tempalte failed: %s", field, err)
@@ -109,11 +158,13 @@ func (j *jiraReporter) Report(failure complainer.Failure, config ConfigProvider,
 		renderedFields[field] = rendered
 	}
 
-	// generate jql with exact match for summary, project and status
-	query := fmt.Sprintf(`summary ~ "\"%s\"" AND project = %s AND status != %s`, renderedFields["Summary"], renderedFields["Project"], j.closedStatusName)
-	results, resp, err := j.client.Issue.Search(query, nil)
+	label := jiraLabel(failure.Name)
+
+	// look for issues of the same task that are not closed yet
+	query := fmt.Sprintf(`project = "%s" AND labels = "%s" AND status != "%s"`, jqlEscape(target.metaProject.Key), label, jqlEscape(c.closedStatus))
+	results, resp, err := target.client.Issue.Search(query, nil)
 	if err != nil {
-		return fmt.Errorf(readJiraReponse(resp))
+		return j.apiError(c, "search for open issues", resp, err)
 	}
 
 	if len(results) != 0 {
@@ -122,33 +173,171 @@ func (j *jiraReporter) Report(failure complainer.Failure, config ConfigProvider,
 		return nil
 	}
 
-	issue, err := jira.InitIssueWithMetaAndFields(j.metaProject, j.metaIssuetype, renderedFields)
+	issue, err := jira.InitIssueWithMetaAndFields(target.metaProject, target.metaIssuetype, renderedFields)
 	if err != nil {
 		return fmt.Errorf("could not initialize issue: %s", err)
 	}
 
-	_, resp, err = j.client.Issue.Create(issue)
+	// labels from jira.fields end up in unknowns and override the struct field
+	if labels, ok := issue.Fields.Unknowns["labels"].([]string); ok {
+		issue.Fields.Unknowns["labels"] = append(labels, label)
+	} else {
+		issue.Fields.Labels = []string{label}
+	}
+
+	_, resp, err = target.client.Issue.Create(issue)
 	if err != nil {
-		return fmt.Errorf(readJiraReponse(resp))
+		return j.apiError(c, "create issue", resp, err)
 	}
 
 	return nil
 }
 
-// setFieldsConfig gets the fields string in format key:value;key2:value;...
+// config returns the config of the instance, labels take precedence over flags
+func (j *jiraReporter) config(config ConfigProvider) (jiraConfig, error) {
+	c := jiraConfig{
+		url:          configWithFallback(config, "url", j.url),
+		username:     configWithFallback(config, "username", j.username),
+		password:     configWithFallback(config, "password", j.password),
+		apiToken:     configWithFallback(config, "api_token", j.apiToken),
+		closedStatus: configWithFallback(config, "issue_closed_status", j.closedStatus),
+	}
+
+	if c.url == "" || c.username == "" || (c.password == "" && c.apiToken == "") {
+		return c, errors.New("jira url, username and either password or api token are required")
+	}
+
+	fields, err := parseJiraFields(configWithFallback(config, "fields", j.fields))
+	if err != nil {
+		return c, err
+	}
+
+	for key, field := range jiraFieldLabels {
+		if value := config(key); value != "" {
+			fields[field] = value
+		}
+	}
+
+	if fields["Project"] == "" {
+		return c, errors.New("project is required in field configuration")
+	}
+
+	if fields["Issue Type"] == "" {
+		return c, errors.New("issue type is required in field configuration")
+	}
+
+	c.fields = fields
+
+	return c, nil
+}
+
+// target returns cached client and create meta for the config,
+// authenticating and fetching create meta on the first use
+func (j *jiraReporter) target(ctx context.Context, c jiraConfig) (*jiraTarget, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	key := c.key()
+
+	target, ok := j.targets[key]
+	if !ok {
+		transport := &jiraContextTransport{transport: httpclient.Transport(httpclient.Reporters)}
+
+		transport.setContext(ctx)
+		defer transport.setContext(nil)
+
+		client, err := createJiraClient(c.url, c.username, c.password, c.apiToken, transport)
+		if err != nil {
+			return nil, err
+		}
+
+		// get create meta information
+		metaProject, err := createMetaProject(client, c.fields["Project"])
+		if err != nil {
+			return nil, err
+		}
+
+		// get right issue within project
+		metaIssuetype, err := createMetaIssueType(metaProject, c.fields["Issue Type"])
+		if err != nil {
+			return nil, err
+		}
+
+		target = &jiraTarget{
+			transport:     transport,
+			client:        client,
+			metaProject:   metaProject,
+			metaIssuetype: metaIssuetype,
+		}
+
+		j.targets[key] = target
+	}
+
+	// check if the given fields completes the mandatory fields and all listed fields are available
+	if complete, err := target.metaIssuetype.CheckCompleteAndAvailable(c.fields); !complete {
+		return nil, err
+	}
+
+	return target, nil
+}
+
+// apiError returns the error with the response body from jira,
+// cached client is dropped on 401 so the next report authenticates again
+func (j *jiraReporter) apiError(c jiraConfig, action string, resp *jira.Response, err error) error {
+	if resp == nil {
+		return fmt.Errorf("could not %s in jira: %s", action, err)
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		j.mutex.Lock()
+		delete(j.targets, c.key())
+		j.mutex.Unlock()
+	}
+
+	return &statusError{
+		code:    resp.StatusCode,
+		message: fmt.Sprintf("could not %s in jira, status %d: %s", action, resp.StatusCode, readJiraResponse(resp)),
+	}
+}
+
+// key identifies the client and create meta the config needs
+func (c jiraConfig) key() string {
+	return strings.Join([]string{c.url, c.username, c.password, c.apiToken, c.fields["Project"], c.fields["Issue Type"]}, "\x00")
+}
+
+// parseJiraFields gets the fields string in format key:value;key2:value;...
 // Seperate them and create a map.
-func (j *jiraReporter) setFieldsConfig(fieldsConfiguration string) error {
+func parseJiraFields(fieldsConfiguration string) (map[string]string, error) {
 	fields := strings.Split(fieldsConfiguration, ";")
 	templateConfig := make(map[string]string)
 	for _, directive := range fields {
-		keyValueArr := strings.Split(directive, ":")
+		keyValueArr := strings.SplitN(directive, ":", 2)
 		if len(keyValueArr) != 2 {
-			return fmt.Errorf("invalid field configuration: expected in key:value format, not %s", directive)
+			return nil, fmt.Errorf("invalid field configuration: expected in key:value format, not %s", directive)
 		}
 		templateConfig[keyValueArr[0]] = keyValueArr[1]
 	}
-	j.fieldsConfig = templateConfig
-	return nil
+	return templateConfig, nil
+}
+
+// jiraLabel returns the label of issues created for the task,
+// jira labels cannot have spaces, so other characters are replaced
+func jiraLabel(name string) string {
+	label := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		}
+
+		return '_'
+	}, name)
+
+	return jiraLabelPrefix + strings.Trim(label, "_")
+}
+
+// jqlEscape escapes the value for use in a quoted jql string
+func jqlEscape(value string) string {
+	return strings.Replace(strings.Replace(value, `\`, `\\`, -1), `"`, `\"`, -1)
 }
 
 func getAllIssueTypeNames(project *jira.MetaProject) []string {
@@ -159,18 +348,11 @@ func getAllIssueTypeNames(project *jira.MetaProject) []string {
 	return foundIssueTypes
 }
 
-func checkArgsNotNil(args ...string) error {
-	for _, value := range args {
-		if value == "" {
-			return fmt.Errorf("all fields are necessary. Some of them are unfulfilled")
-		}
-	}
-	return nil
-}
-
-func readJiraReponse(resp *jira.Response) string {
-	if resp == nil || resp.Body == nil {
-		return fmt.Sprintf("nil response or response body")
+// readJiraResponse returns the body of the error response,
+// which has error messages explaining what went wrong
+func readJiraResponse(resp *jira.Response) string {
+	if resp.Body == nil {
+		return "empty response body"
 	}
 
 	defer func() {
@@ -179,14 +361,81 @@ func readJiraReponse(resp *jira.Response) string {
 
 	rawBody, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Sprintf("could not read response body. %s", err)
+		return fmt.Sprintf("could not read response body: %s", err)
+	}
+
+	return strings.TrimSpace(string(rawBody))
+}
+
+// jiraBasicAuth authenticates every request with api token, which
+// jira cloud accepts instead of session cookies
+type jiraBasicAuth struct {
+	username  string
+	apiToken  string
+	transport http.RoundTripper
+}
+
+func (a jiraBasicAuth) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Round trippers must not modify the request they are given
+	clone := new(http.Request)
+	*clone = *req
+
+	clone.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		clone.Header[k] = v
+	}
+
+	clone.SetBasicAuth(a.username, a.apiToken)
+
+	return a.transport.RoundTrip(clone)
+}
+
+// jiraContextTransport bounds requests with the context of the current
+// report, which go-jira cannot pass itself
+type jiraContextTransport struct {
+	mutex     sync.Mutex
+	ctx       context.Context
+	transport http.RoundTripper
+}
+
+func (t *jiraContextTransport) setContext(ctx context.Context) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.ctx = ctx
+}
+
+func (t *jiraContextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mutex.Lock()
+	ctx := t.ctx
+	t.mutex.Unlock()
+
+	if ctx != nil {
+		req = req.WithContext(ctx)
 	}
 
-	return fmt.Sprintf("could not create issue. Detailed information: %s", string(rawBody))
+	return t.transport.RoundTrip(req)
 }
 
-func createJiraClient(url, username, password string) (*jira.Client, error) {
-	jiraClient, err := jira.NewClient(nil, url)
+func createJiraClient(url, username, password, apiToken string, transport http.RoundTripper) (*jira.Client, error) {
+	if apiToken != "" {
+		client := &http.Client{
+			Transport: jiraBasicAuth{
+				username:  username,
+				apiToken:  apiToken,
+				transport: transport,
+			},
+		}
+
+		jiraClient, err := jira.NewClient(client, url)
+		if err != nil {
+			return nil, fmt.Errorf("could not create client: %s", err)
+		}
+
+		return jiraClient, nil
+	}
+
+	jiraClient, err := jira.NewClient(&http.Client{Transport: transport}, url)
 	if err != nil {
 		return nil, fmt.Errorf("could not create client: %s", err)
 	}
@@ -204,9 +453,16 @@ func createJiraClient(url, username, password string) (*jira.Client, error) {
 }
 
 func createMetaProject(c *jira.Client, project string) (*jira.MetaProject, error) {
-	meta, _, err := c.Issue.GetCreateMeta(project)
+	meta, resp, err := c.Issue.GetCreateMeta(project)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get create meta : %s", err)
+		if resp != nil {
+			return nil, &statusError{
+				code:    resp.StatusCode,
+				message: fmt.Sprintf("failed to get create meta, status %d: %s", resp.StatusCode, readJiraResponse(resp)),
+			}
+		}
+
+		return nil, fmt.Errorf("failed to get create meta: %s", err)
 	}
 
 	// get right project
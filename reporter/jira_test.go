@@ -0,0 +1,245 @@
+package reporter
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+const jiraTestCreateMeta = `{"projects":[{"id":"1","key":"OPS","name":"Ops","issuetypes":[{"id":"1","name":"Bug","fields":{
+	"project":{"required":true,"name":"Project","schema":{"type":"project"}},
+	"issuetype":{"required":true,"name":"Issue Type","schema":{"type":"issuetype"}},
+	"summary":{"required":true,"name":"Summary","schema":{"type":"string"}},
+	"description":{"required":false,"name":"Description","schema":{"type":"string"}}
+}}]}]}`
+
+// jiraTestServer fakes jira api, open is the number of open issues
+// search returns after the search delay and created has bodies
+// of created issues
+type jiraTestServer struct {
+	mu          sync.Mutex
+	open        int
+	searchDelay time.Duration
+	queries     []string
+	created     []string
+}
+
+func (s *jiraTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if username, token, ok := r.BasicAuth(); !ok || username != "bot@example.com" || token != "token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"errorMessages":["not authenticated"]}`))
+		return
+	}
+
+	switch r.URL.Path {
+	case "/rest/api/2/issue/createmeta":
+		_, _ = w.Write([]byte(jiraTestCreateMeta))
+	case "/rest/api/2/search":
+		select {
+		case <-time.After(s.searchDelay):
+		case <-r.Context().Done():
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.queries = append(s.queries, r.URL.Query().Get("jql"))
+		_, _ = w.Write([]byte(`{"issues":[` + strings.TrimSuffix(strings.Repeat(`{"key":"OPS-1"},`, s.open), ",") + `]}`))
+	case "/rest/api/2/issue/":
+		body, _ := ioutil.ReadAll(r.Body)
+		if strings.Contains(string(body), "TASK_ERROR") {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors":{"summary":"summary is too long"}}`))
+			return
+		}
+
+		s.mu.Lock()
+		s.created = append(s.created, string(body))
+		s.mu.Unlock()
+
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id":"10","key":"OPS-10"}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestJiraReport(t *testing.T) {
+	fake := &jiraTestServer{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	j, err := newJiraReporter("", "bot@example.com", "", "token", "Project:COMPLAINER;Issue Type:Bug;Summary:Task {{ .failure.Name }} died with status {{ .failure.State }}", "Closed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	labels := map[string]string{
+		"url":         server.URL,
+		"project":     "OPS",
+		"description": "Logs: {{ .stdoutURL }}",
+	}
+
+	config := func(key string) string {
+		return labels[key]
+	}
+
+	if err = j.Validate(context.Background(), config); err != nil {
+		t.Fatalf("error validating: %s", err)
+	}
+
+	failure := complainer.Failure{ID: "web.1", Name: "/apps/web", State: "TASK_FAILED"}
+
+	if err = j.Report(context.Background(), failure, config, "http://stdout", "http://stderr"); err != nil {
+		t.Fatalf("error reporting: %s", err)
+	}
+
+	if expected := `project = "OPS" AND labels = "complainer-apps_web" AND status != "Closed"`; len(fake.queries) != 1 || fake.queries[0] != expected {
+		t.Errorf("unexpected queries: %q", fake.queries)
+	}
+
+	if len(fake.created) != 1 {
+		t.Fatalf("expected 1 created issue, got %d", len(fake.created))
+	}
+
+	issue := struct {
+		Fields struct {
+			Summary     string   `json:"summary"`
+			Description string   `json:"description"`
+			Labels      []string `json:"labels"`
+		} `json:"fields"`
+	}{}
+
+	if err = json.Unmarshal([]byte(fake.created[0]), &issue); err != nil {
+		t.Fatal(err)
+	}
+
+	if issue.Fields.Summary != "Task /apps/web died with status TASK_FAILED" || issue.Fields.Description != "Logs: http://stdout" {
+		t.Errorf("unexpected issue fields: %+v", issue.Fields)
+	}
+
+	if len(issue.Fields.Labels) != 1 || issue.Fields.Labels[0] != "complainer-apps_web" {
+		t.Errorf("unexpected issue labels: %q", issue.Fields.Labels)
+	}
+
+	// Open issue of the same task prevents duplicates
+	fake.open = 1
+
+	if err = j.Report(context.Background(), failure, config, "http://stdout", "http://stderr"); err != nil {
+		t.Fatalf("error reporting: %s", err)
+	}
+
+	if len(fake.created) != 1 {
+		t.Errorf("expected no duplicate issue, got %d created", len(fake.created))
+	}
+
+	fake.open = 0
+	failure.State = "TASK_ERROR"
+
+	err = j.Report(context.Background(), failure, config, "http://stdout", "http://stderr")
+	if err == nil || !strings.Contains(err.Error(), "status 400") || !strings.Contains(err.Error(), "summary is too long") {
+		t.Errorf("expected api error to be surfaced, got: %v", err)
+	}
+
+	if j.Retryable(err) {
+		t.Error("rejected issues should not be retried")
+	}
+}
+
+func TestJiraConfig(t *testing.T) {
+	j, err := newJiraReporter("https://jira.example.com", "bot", "", "", "Project:OPS;Issue Type:Bug;Summary:Failed at {{ .failure.Finished.Format \"15:04\" }}", "Closed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	labels := map[string]string{}
+	config := func(key string) string {
+		return labels[key]
+	}
+
+	if _, err = j.config(config); err == nil {
+		t.Error("expected error without password or api token")
+	}
+
+	labels["api_token"] = "token"
+
+	c, err := j.config(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.fields["Summary"] != `Failed at {{ .failure.Finished.Format "15:04" }}` {
+		t.Errorf("unexpected summary: %q", c.fields["Summary"])
+	}
+
+	labels["fields"] = "Summary:x"
+
+	if _, err = j.config(config); err == nil {
+		t.Error("expected error without project and issue type")
+	}
+
+	if _, err = newJiraReporter("", "", "", "", "Project", ""); err == nil {
+		t.Error("expected error for broken default fields")
+	}
+}
+
+func TestJiraUnauthorized(t *testing.T) {
+	server := httptest.NewServer(&jiraTestServer{})
+	defer server.Close()
+
+	j, err := newJiraReporter(server.URL, "bot@example.com", "", "wrong", "Project:OPS;Issue Type:Bug;Summary:x", "Closed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = j.Validate(context.Background(), func(string) string { return "" })
+	if err == nil || !strings.Contains(err.Error(), "status 401") || !strings.Contains(err.Error(), "not authenticated") {
+		t.Errorf("expected authentication error to be surfaced, got: %v", err)
+	}
+}
+
+func TestJiraReportTimeout(t *testing.T) {
+	fake := &jiraTestServer{searchDelay: time.Millisecond * 200}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	j, err := newJiraReporter(server.URL, "bot@example.com", "", "token", "Project:OPS;Issue Type:Bug;Summary:{{ .failure.ID }}", "Closed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := func(key string) string {
+		return ""
+	}
+
+	// Create meta is fetched without the delay
+	if err = j.Validate(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+
+	if err = j.Report(ctx, complainer.Failure{ID: "web.1", Name: "web"}, config, "", ""); err == nil {
+		t.Fatal("expected error for timed out report")
+	}
+
+	// Abandoned report must not create the issue after the timeout
+	time.Sleep(fake.searchDelay * 2)
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if len(fake.created) != 0 {
+		t.Errorf("expected no issues created by the timed out report, got %d", len(fake.created))
+	}
+}
@@ -0,0 +1,140 @@
+package reporter
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+)
+
+func init() {
+	var (
+		brokers       *string
+		topic         *string
+		tlsEnabled    *string
+		tlsSkipVerify *string
+		saslUsername  *string
+		saslPassword  *string
+		timeout       *time.Duration
+	)
+
+	RegisterReporter("kafka", Maker{
+		RegisterFlags: func() {
+			brokers = flags.String("kafka.brokers", "KAFKA_BROKERS", "", "default comma separated list of kafka brokers (ex: kafka1:9092,kafka2:9092)")
+			topic = flags.String("kafka.topic", "KAFKA_TOPIC", "", "default kafka topic")
+			tlsEnabled = flags.String("kafka.tls", "KAFKA_TLS", "false", "whether to connect to kafka brokers with tls")
+			tlsSkipVerify = flags.String("kafka.tls_insecure_skip_verify", "KAFKA_TLS_INSECURE_SKIP_VERIFY", "false", "whether to skip verification of kafka broker certificates")
+			saslUsername = flags.String("kafka.sasl_username", "KAFKA_SASL_USERNAME", "", "default kafka sasl plain username")
+			saslPassword = flags.String("kafka.sasl_password", "KAFKA_SASL_PASSWORD", "", "default kafka sasl plain password")
+			timeout = flags.Duration("kafka.timeout", "KAFKA_TIMEOUT", time.Second*10, "timeout for kafka requests")
+		},
+
+		Make: func() (Reporter, error) {
+			return newKafkaReporter(kafkaReporterConfig{
+				brokers:       *brokers,
+				topic:         *topic,
+				tls:           *tlsEnabled,
+				tlsSkipVerify: *tlsSkipVerify,
+				saslUsername:  *saslUsername,
+				saslPassword:  *saslPassword,
+				timeout:       *timeout,
+			}), nil
+		},
+	})
+}
+
+type kafkaReporter struct {
+	config kafkaReporterConfig
+}
+
+type kafkaReporterConfig struct {
+	brokers       string
+	topic         string
+	tls           string
+	tlsSkipVerify string
+	saslUsername  string
+	saslPassword  string
+	timeout       time.Duration
+}
+
+type kafkaEvent struct {
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Host       string            `json:"host"`
+	Framework  string            `json:"framework"`
+	Image      string            `json:"image"`
+	State      string            `json:"state"`
+	Reason     string            `json:"reason"`
+	Message    string            `json:"message"`
+	Started    time.Time         `json:"started"`
+	Finished   time.Time         `json:"finished"`
+	Labels     map[string]string `json:"labels"`
+	StdoutURL  string            `json:"stdout_url"`
+	StderrURL  string            `json:"stderr_url"`
+	Complainer string            `json:"complainer"`
+}
+
+func newKafkaReporter(config kafkaReporterConfig) *kafkaReporter {
+	return &kafkaReporter{
+		config: config,
+	}
+}
+
+func (k *kafkaReporter) Report(ctx context.Context, failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
+	brokers := splitBrokers(configWithFallback(config, "brokers", k.config.brokers))
+	topic := configWithFallback(config, "topic", k.config.topic)
+
+	if len(brokers) == 0 || topic == "" {
+		return nil
+	}
+
+	value, err := json.Marshal(kafkaEvent{
+		ID:         failure.ID,
+		Name:       failure.Name,
+		Host:       failure.Slave,
+		Framework:  failure.Framework,
+		Image:      failure.Image,
+		State:      failure.State,
+		Reason:     failure.Reason,
+		Message:    failure.Message,
+		Started:    failure.Started,
+		Finished:   failure.Finished,
+		Labels:     failure.Labels,
+		StdoutURL:  stdoutURL,
+		StderrURL:  stderrURL,
+		Complainer: failure.Complainer,
+	})
+	if err != nil {
+		return err
+	}
+
+	clientConfig := kafkaConfig{
+		saslUsername: configWithFallback(config, "sasl_username", k.config.saslUsername),
+		saslPassword: configWithFallback(config, "sasl_password", k.config.saslPassword),
+		timeout:      k.config.timeout,
+	}
+
+	if configWithFallback(config, "tls", k.config.tls) == "true" {
+		clientConfig.tls = &tls.Config{
+			InsecureSkipVerify: configWithFallback(config, "tls_insecure_skip_verify", k.config.tlsSkipVerify) == "true",
+		}
+	}
+
+	// Task name is the key, so failures of the same task are ordered
+	return kafkaProduce(ctx, brokers, clientConfig, topic, []byte(failure.Name), value)
+}
+
+func splitBrokers(brokers string) []string {
+	result := []string{}
+	for _, broker := range strings.Split(brokers, ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			result = append(result, broker)
+		}
+	}
+
+	return result
+}
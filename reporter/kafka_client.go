@@ -0,0 +1,569 @@
+package reporter
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Minimal Kafka producer speaking the wire protocol directly:
+// Metadata v1 to find partition leaders and Produce v3 with record
+// batches v2 to publish, which brokers from 0.11 onwards understand.
+const (
+	kafkaAPIProduce          = 0
+	kafkaAPIMetadata         = 3
+	kafkaAPISaslHandshake    = 17
+	kafkaAPISaslAuthenticate = 36
+
+	kafkaClientID = "complainer"
+)
+
+var errKafkaShortResponse = errors.New("kafka response is too short")
+
+var kafkaCastagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// kafkaErrors has descriptions of the most common error codes
+var kafkaErrors = map[int16]string{
+	3:  "unknown topic or partition",
+	5:  "leader not available",
+	6:  "not leader for partition",
+	7:  "request timed out",
+	10: "message too large",
+	19: "not enough replicas",
+	29: "topic authorization failed",
+	33: "unsupported sasl mechanism",
+	58: "sasl authentication failed",
+}
+
+type kafkaError int16
+
+func (e kafkaError) Error() string {
+	if description, ok := kafkaErrors[int16(e)]; ok {
+		return fmt.Sprintf("kafka error %d: %s", int16(e), description)
+	}
+
+	return fmt.Sprintf("kafka error %d", int16(e))
+}
+
+type kafkaConfig struct {
+	tls          *tls.Config
+	saslUsername string
+	saslPassword string
+	timeout      time.Duration
+}
+
+type kafkaConn struct {
+	conn          net.Conn
+	timeout       time.Duration
+	deadline      time.Time
+	correlationID int32
+}
+
+type kafkaPartition struct {
+	id     int32
+	leader int32
+}
+
+type kafkaMetadata struct {
+	brokers    map[int32]string
+	partitions []kafkaPartition
+}
+
+// kafkaProduce publishes a single message to the topic, choosing
+// the partition by the key, trying brokers in order for metadata.
+// Only failures before producing move on to the next broker, since
+// the message may be written even if producing fails. Requests never
+// outlive the deadline of the context.
+func kafkaProduce(ctx context.Context, brokers []string, config kafkaConfig, topic string, key, value []byte) error {
+	var err error
+
+	for _, broker := range brokers {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var conn *kafkaConn
+		conn, err = dialKafka(ctx, broker, config)
+		if err != nil {
+			continue
+		}
+
+		var leader *kafkaConn
+		var partition int32
+		leader, partition, err = conn.leader(ctx, broker, config, topic, key)
+		if err != nil {
+			conn.close()
+			continue
+		}
+
+		err = leader.produce(topic, partition, key, value)
+
+		if leader != conn {
+			leader.close()
+		}
+
+		conn.close()
+
+		return err
+	}
+
+	if err == nil {
+		err = errors.New("no kafka brokers configured")
+	}
+
+	return err
+}
+
+// leader returns the connection to the leader of the partition for the key
+// and the partition id, the connection is c if the broker is the leader
+func (c *kafkaConn) leader(ctx context.Context, broker string, config kafkaConfig, topic string, key []byte) (*kafkaConn, int32, error) {
+	metadata, err := c.metadata(topic)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(metadata.partitions) == 0 {
+		return nil, 0, fmt.Errorf("no partitions found for kafka topic %q", topic)
+	}
+
+	partition := metadata.partitions[kafkaPartitionIndex(key, len(metadata.partitions))]
+
+	leader, ok := metadata.brokers[partition.leader]
+	if !ok {
+		return nil, 0, kafkaError(5)
+	}
+
+	if leader == broker {
+		return c, partition.id, nil
+	}
+
+	conn, err := dialKafka(ctx, leader, config)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return conn, partition.id, nil
+}
+
+func dialKafka(ctx context.Context, addr string, config kafkaConfig) (*kafkaConn, error) {
+	deadline, _ := ctx.Deadline()
+	dialer := &net.Dialer{Timeout: config.timeout, Deadline: deadline}
+
+	var conn net.Conn
+	var err error
+	if config.tls != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, config.tls)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	c := &kafkaConn{conn: conn, timeout: config.timeout, deadline: deadline}
+
+	if config.saslUsername != "" {
+		if err = c.authenticate(config.saslUsername, config.saslPassword); err != nil {
+			c.close()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+func (c *kafkaConn) close() {
+	_ = c.conn.Close()
+}
+
+// authenticate performs sasl plain authentication
+func (c *kafkaConn) authenticate(username, password string) error {
+	e := &kafkaEncoder{}
+	e.string("PLAIN")
+
+	d, err := c.request(kafkaAPISaslHandshake, 1, e.buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	if code := d.int16(); code != 0 {
+		return kafkaError(code)
+	}
+
+	e = &kafkaEncoder{}
+	e.bytes([]byte("\x00" + username + "\x00" + password))
+
+	d, err = c.request(kafkaAPISaslAuthenticate, 0, e.buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	if code := d.int16(); code != 0 {
+		if message := d.nullableString(); message != "" {
+			return fmt.Errorf("%s: %s", kafkaError(code), message)
+		}
+
+		return kafkaError(code)
+	}
+
+	return d.err
+}
+
+func (c *kafkaConn) metadata(topic string) (*kafkaMetadata, error) {
+	e := &kafkaEncoder{}
+	e.int32(1)
+	e.string(topic)
+
+	d, err := c.request(kafkaAPIMetadata, 1, e.buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := &kafkaMetadata{brokers: map[int32]string{}}
+
+	for i := d.int32(); i > 0 && d.err == nil; i-- {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.nullableString() // rack
+
+		metadata.brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+
+	d.int32() // controller id
+
+	for i := d.int32(); i > 0 && d.err == nil; i-- {
+		code := d.int16()
+		name := d.string()
+		d.int8() // is internal
+
+		for j := d.int32(); j > 0 && d.err == nil; j-- {
+			d.int16() // partition error code
+			partition := kafkaPartition{id: d.int32(), leader: d.int32()}
+			d.skipInt32Array() // replicas
+			d.skipInt32Array() // in sync replicas
+
+			if name == topic {
+				metadata.partitions = append(metadata.partitions, partition)
+			}
+		}
+
+		if name == topic && code != 0 {
+			return nil, kafkaError(code)
+		}
+	}
+
+	// Partitions are picked by index in the list sorted by id like java
+	// client does, brokers do not list them in any particular order
+	sort.Slice(metadata.partitions, func(i, j int) bool {
+		return metadata.partitions[i].id < metadata.partitions[j].id
+	})
+
+	return metadata, d.err
+}
+
+func (c *kafkaConn) produce(topic string, partition int32, key, value []byte) error {
+	batch := kafkaRecordBatch(key, value, time.Now())
+
+	e := &kafkaEncoder{}
+	e.int16(-1) // null transactional id
+	e.int16(-1) // acks from all in sync replicas
+	e.int32(int32(c.timeout / time.Millisecond))
+	e.int32(1)
+	e.string(topic)
+	e.int32(1)
+	e.int32(partition)
+	e.bytes(batch)
+
+	d, err := c.request(kafkaAPIProduce, 3, e.buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	for i := d.int32(); i > 0 && d.err == nil; i-- {
+		d.string()
+
+		for j := d.int32(); j > 0 && d.err == nil; j-- {
+			d.int32()
+			if code := d.int16(); code != 0 {
+				return kafkaError(code)
+			}
+
+			d.int64() // base offset
+			d.int64() // log append time
+		}
+	}
+
+	return d.err
+}
+
+// request sends the request and returns decoder for the response body
+func (c *kafkaConn) request(apiKey, apiVersion int16, body []byte) (*kafkaDecoder, error) {
+	c.correlationID++
+
+	e := &kafkaEncoder{}
+	e.int16(apiKey)
+	e.int16(apiVersion)
+	e.int32(c.correlationID)
+	e.string(kafkaClientID)
+	e.buf.Write(body)
+
+	frame := &kafkaEncoder{}
+	frame.bytes(e.buf.Bytes())
+
+	deadline := c.deadline
+	if c.timeout > 0 {
+		if timeout := time.Now().Add(c.timeout); deadline.IsZero() || timeout.Before(deadline) {
+			deadline = timeout
+		}
+	}
+
+	if !deadline.IsZero() {
+		_ = c.conn.SetDeadline(deadline)
+	}
+
+	if _, err := c.conn.Write(frame.buf.Bytes()); err != nil {
+		return nil, err
+	}
+
+	size := make([]byte, 4)
+	if _, err := io.ReadFull(c.conn, size); err != nil {
+		return nil, err
+	}
+
+	resp := make([]byte, binary.BigEndian.Uint32(size))
+	if _, err := io.ReadFull(c.conn, resp); err != nil {
+		return nil, err
+	}
+
+	d := &kafkaDecoder{data: resp}
+	if id := d.int32(); d.err == nil && id != c.correlationID {
+		return nil, fmt.Errorf("unexpected kafka correlation id %d, expected %d", id, c.correlationID)
+	}
+
+	return d, d.err
+}
+
+// kafkaRecordBatch encodes a record batch v2 with a single record
+func kafkaRecordBatch(key, value []byte, ts time.Time) []byte {
+	record := &kafkaEncoder{}
+	record.int8(0)   // attributes
+	record.varint(0) // timestamp delta
+	record.varint(0) // offset delta
+	record.varbytes(key)
+	record.varbytes(value)
+	record.varint(0) // headers
+
+	// Everything after crc is covered by crc
+	tail := &kafkaEncoder{}
+	tail.int16(0) // attributes
+	tail.int32(0) // last offset delta
+	tail.int64(ts.UnixNano() / int64(time.Millisecond))
+	tail.int64(ts.UnixNano() / int64(time.Millisecond))
+	tail.int64(-1) // producer id
+	tail.int16(-1) // producer epoch
+	tail.int32(-1) // base sequence
+	tail.int32(1)  // number of records
+	tail.varint(int64(record.buf.Len()))
+	tail.buf.Write(record.buf.Bytes())
+
+	batch := &kafkaEncoder{}
+	batch.int64(0)                         // base offset
+	batch.int32(int32(tail.buf.Len() + 9)) // batch length after this field
+	batch.int32(-1)                        // partition leader epoch
+	batch.int8(2)                          // magic
+	batch.int32(int32(crc32.Checksum(tail.buf.Bytes(), kafkaCastagnoli)))
+	batch.buf.Write(tail.buf.Bytes())
+
+	return batch.buf.Bytes()
+}
+
+// kafkaPartitionIndex picks the partition the same way
+// as the default partitioner of the java client does
+func kafkaPartitionIndex(key []byte, partitions int) int {
+	return int(murmur2(key)&0x7fffffff) % partitions
+}
+
+func murmur2(data []byte) int32 {
+	const (
+		seed = uint32(0x9747b28c)
+		m    = uint32(0x5bd1e995)
+		r    = 24
+	)
+
+	length := len(data)
+	h := seed ^ uint32(length)
+
+	for i := 0; i+4 <= length; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i : i+4])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+
+	tail := data[length&^3:]
+	switch len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+
+	return int32(h)
+}
+
+type kafkaEncoder struct {
+	buf bytes.Buffer
+}
+
+func (e *kafkaEncoder) int8(v int8) {
+	e.buf.WriteByte(byte(v))
+}
+
+func (e *kafkaEncoder) int16(v int16) {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, uint16(v))
+	e.buf.Write(b)
+}
+
+func (e *kafkaEncoder) int32(v int32) {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(v))
+	e.buf.Write(b)
+}
+
+func (e *kafkaEncoder) int64(v int64) {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(v))
+	e.buf.Write(b)
+}
+
+func (e *kafkaEncoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.buf.WriteString(s)
+}
+
+func (e *kafkaEncoder) bytes(b []byte) {
+	e.int32(int32(len(b)))
+	e.buf.Write(b)
+}
+
+// varint writes zigzag encoded variable length integer
+func (e *kafkaEncoder) varint(v int64) {
+	b := make([]byte, binary.MaxVarintLen64)
+	e.buf.Write(b[:binary.PutVarint(b, v)])
+}
+
+func (e *kafkaEncoder) varbytes(b []byte) {
+	if b == nil {
+		e.varint(-1)
+		return
+	}
+
+	e.varint(int64(len(b)))
+	e.buf.Write(b)
+}
+
+// kafkaDecoder reads values until the first error,
+// returning zero values after that
+type kafkaDecoder struct {
+	data []byte
+	err  error
+}
+
+func (d *kafkaDecoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+
+	if n < 0 || len(d.data) < n {
+		d.err = errKafkaShortResponse
+		return nil
+	}
+
+	b := d.data[:n]
+	d.data = d.data[n:]
+
+	return b
+}
+
+func (d *kafkaDecoder) int8() int8 {
+	if b := d.next(1); b != nil {
+		return int8(b[0])
+	}
+
+	return 0
+}
+
+func (d *kafkaDecoder) int16() int16 {
+	if b := d.next(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+
+	return 0
+}
+
+func (d *kafkaDecoder) int32() int32 {
+	if b := d.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+
+	return 0
+}
+
+func (d *kafkaDecoder) int64() int64 {
+	if b := d.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+
+	return 0
+}
+
+func (d *kafkaDecoder) string() string {
+	return string(d.next(int(d.int16())))
+}
+
+func (d *kafkaDecoder) nullableString() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+
+	return string(d.next(int(n)))
+}
+
+func (d *kafkaDecoder) bytes() []byte {
+	n := d.int32()
+	if n < 0 {
+		return nil
+	}
+
+	return d.next(int(n))
+}
+
+func (d *kafkaDecoder) skipInt32Array() {
+	if n := d.int32(); n > 0 {
+		d.next(int(n) * 4)
+	}
+}
@@ -0,0 +1,230 @@
+package reporter
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestMurmur2(t *testing.T) {
+	// Values from the java client tests
+	table := map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	}
+
+	for input, expected := range table {
+		if got := murmur2([]byte(input)); got != expected {
+			t.Errorf("invalid murmur2 of %q; expected: %d, got: %d", input, expected, got)
+		}
+	}
+}
+
+type kafkaProduced struct {
+	partition int32
+	key       string
+	value     []byte
+}
+
+// fakeKafkaBroker answers metadata and produce requests, sending
+// produced records into the channel and answering with the error code.
+// Partitions are listed in reverse order, like brokers are free to.
+func fakeKafkaBroker(t *testing.T, topic string, partitions int32, produced chan<- kafkaProduced, produceError int16) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host, portString, _ := net.SplitHostPort(l.Addr().String())
+	port, _ := strconv.Atoi(portString)
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn) {
+				defer func() {
+					_ = conn.Close()
+				}()
+
+				for {
+					size := make([]byte, 4)
+					if _, err := io.ReadFull(conn, size); err != nil {
+						return
+					}
+
+					req := make([]byte, binary.BigEndian.Uint32(size))
+					if _, err := io.ReadFull(conn, req); err != nil {
+						return
+					}
+
+					d := &kafkaDecoder{data: req}
+					apiKey := d.int16()
+					d.int16()
+					correlationID := d.int32()
+					d.string()
+
+					e := &kafkaEncoder{}
+					e.int32(correlationID)
+
+					switch apiKey {
+					case kafkaAPIMetadata:
+						e.int32(1)
+						e.int32(1)
+						e.string(host)
+						e.int32(int32(port))
+						e.int16(-1)
+						e.int32(1)
+						e.int32(1)
+						e.int16(0)
+						e.string(topic)
+						e.int8(0)
+						e.int32(partitions)
+						for i := partitions - 1; i >= 0; i-- {
+							e.int16(0)
+							e.int32(i)
+							e.int32(1)
+							e.int32(0)
+							e.int32(0)
+						}
+					case kafkaAPIProduce:
+						d.nullableString()
+						d.int16()
+						d.int32()
+						d.int32()
+						name := d.string()
+						d.int32()
+						partition := d.int32()
+						batch := &kafkaDecoder{data: d.bytes()}
+
+						batch.int64()
+						batch.int32()
+						batch.int32()
+						batch.int8()
+						crc := uint32(batch.int32())
+						if crc32.Checksum(batch.data, kafkaCastagnoli) != crc {
+							t.Errorf("invalid record batch crc")
+						}
+
+						batch.next(2 + 4 + 8 + 8 + 8 + 2 + 4 + 4)
+
+						record := batch.data
+						_, n := binary.Varint(record) // length
+						record = record[n+1:]         // attributes
+						_, n = binary.Varint(record)  // timestamp delta
+						record = record[n:]
+						_, n = binary.Varint(record) // offset delta
+						record = record[n:]
+						keyLength, n := binary.Varint(record)
+						key := string(record[n : n+int(keyLength)])
+						record = record[n+int(keyLength):]
+						valueLength, n := binary.Varint(record)
+						value := record[n : n+int(valueLength)]
+
+						produced <- kafkaProduced{partition: partition, key: key, value: value}
+
+						e.int32(1)
+						e.string(name)
+						e.int32(1)
+						e.int32(partition)
+						e.int16(produceError)
+						e.int64(0)
+						e.int64(-1)
+						e.int32(0)
+					default:
+						return
+					}
+
+					frame := &kafkaEncoder{}
+					frame.bytes(e.buf.Bytes())
+					if _, err := conn.Write(frame.buf.Bytes()); err != nil {
+						return
+					}
+				}
+			}(conn)
+		}
+	}()
+
+	return l
+}
+
+func TestKafkaReport(t *testing.T) {
+	produced := make(chan kafkaProduced, 1)
+
+	l := fakeKafkaBroker(t, "failures", 8, produced, 0)
+	defer func() {
+		_ = l.Close()
+	}()
+
+	k := newKafkaReporter(kafkaReporterConfig{
+		brokers: "127.0.0.1:1," + l.Addr().String(),
+		topic:   "failures",
+		timeout: time.Second * 5,
+	})
+
+	config := func(key string) string {
+		return ""
+	}
+
+	failure := complainer.Failure{ID: "web.1", Name: "web", Framework: "marathon", State: "TASK_FAILED", Complainer: "default"}
+
+	if err := k.Report(context.Background(), failure, config, "http://stdout", "http://stderr"); err != nil {
+		t.Fatalf("error reporting: %s", err)
+	}
+
+	p := <-produced
+
+	if p.key != "web" {
+		t.Errorf("unexpected key: %q", p.key)
+	}
+
+	if expected := int32(kafkaPartitionIndex([]byte("web"), 8)); p.partition != expected {
+		t.Errorf("unexpected partition; expected: %d, got: %d", expected, p.partition)
+	}
+
+	event := kafkaEvent{}
+	if err := json.Unmarshal(p.value, &event); err != nil {
+		t.Fatalf("error decoding event: %s", err)
+	}
+
+	if event.ID != "web.1" || event.StderrURL != "http://stderr" || event.Complainer != "default" {
+		t.Errorf("unexpected event: %+v", event)
+	}
+}
+
+func TestKafkaProduceNotRepeated(t *testing.T) {
+	produced := make(chan kafkaProduced, 2)
+
+	// Both brokers claim to be the leader, the second one must not get
+	// the message after the first one fails to acknowledge it
+	first := fakeKafkaBroker(t, "failures", 8, produced, 7)
+	second := fakeKafkaBroker(t, "failures", 8, produced, 0)
+	defer func() {
+		_ = first.Close()
+		_ = second.Close()
+	}()
+
+	err := kafkaProduce(context.Background(), []string{first.Addr().String(), second.Addr().String()}, kafkaConfig{timeout: time.Second * 5}, "failures", []byte("web"), []byte("{}"))
+	if err != kafkaError(7) {
+		t.Errorf("expected request timed out error, got: %v", err)
+	}
+
+	if n := len(produced); n != 1 {
+		t.Errorf("expected message to be produced once, got %d", n)
+	}
+}
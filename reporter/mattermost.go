@@ -0,0 +1,210 @@
+package reporter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+)
+
+func init() {
+	var (
+		hookURL  *string
+		username *string
+		channel  *string
+		iconURL  *string
+		color    *string
+		actions  *string
+		format   *string
+	)
+
+	RegisterReporter("mattermost", Maker{
+		RegisterFlags: func() {
+			hookURL = flags.String("mattermost.hook_url", "MATTERMOST_HOOK_URL", "", "default mattermost webhook url")
+			username = flags.String("mattermost.username", "MATTERMOST_USERNAME", "", "default mattermost username")
+			channel = flags.String("mattermost.channel", "MATTERMOST_CHANNEL", "", "default mattermost channel")
+			iconURL = flags.String("mattermost.icon_url", "MATTERMOST_ICON_URL", "", "default mattermost user icon url")
+			color = flags.String("mattermost.color", "MATTERMOST_COLOR", "#d70000", "default mattermost attachment color")
+			actions = flags.String("mattermost.actions", "MATTERMOST_ACTIONS", "", "default mattermost message actions in 'name:integration url;...' format, urls are templates")
+			format = flags.String("mattermost.format", "MATTERMOST_FORMAT", "Task {{ .failure.Name }} ({{ .failure.ID }}) died with status {{ .failure.State }}", "log format")
+		},
+
+		Make: func() (Reporter, error) {
+			return newMattermostReporter(*hookURL, *username, *channel, *iconURL, *color, *actions, *format), nil
+		},
+	})
+}
+
+type mattermostReporter struct {
+	httpRetryable
+
+	hookURL  string
+	username string
+	channel  string
+	iconURL  string
+	color    string
+	actions  string
+	format   string
+}
+
+type mattermostMessage struct {
+	Channel     string                 `json:"channel,omitempty"`
+	Username    string                 `json:"username,omitempty"`
+	IconURL     string                 `json:"icon_url,omitempty"`
+	Attachments []mattermostAttachment `json:"attachments"`
+}
+
+type mattermostAttachment struct {
+	Fallback string             `json:"fallback"`
+	Color    string             `json:"color"`
+	Title    string             `json:"title"`
+	Text     string             `json:"text"`
+	Fields   []mattermostField  `json:"fields"`
+	Actions  []mattermostAction `json:"actions,omitempty"`
+}
+
+type mattermostField struct {
+	Short bool   `json:"short"`
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+// mattermostAction is a message button, clicking it makes mattermost
+// call the integration url with the context of the failure
+type mattermostAction struct {
+	ID          string                `json:"id"`
+	Name        string                `json:"name"`
+	Integration mattermostIntegration `json:"integration"`
+}
+
+type mattermostIntegration struct {
+	URL     string            `json:"url"`
+	Context map[string]string `json:"context"`
+}
+
+func newMattermostReporter(hookURL, username, channel, iconURL, color, actions, format string) *mattermostReporter {
+	return &mattermostReporter{
+		hookURL:  hookURL,
+		username: username,
+		channel:  channel,
+		iconURL:  iconURL,
+		color:    color,
+		actions:  actions,
+		format:   format,
+	}
+}
+
+func (m *mattermostReporter) Report(ctx context.Context, failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
+	hookURL := configWithFallback(config, "hook_url", m.hookURL)
+	if hookURL == "" {
+		return nil
+	}
+
+	text, err := fillMessage(failure, config, stdoutURL, stderrURL, m.format)
+	if err != nil {
+		return err
+	}
+
+	actions, err := mattermostActions(failure, config, stdoutURL, stderrURL, configWithFallback(config, "actions", m.actions))
+	if err != nil {
+		return err
+	}
+
+	message := mattermostMessage{
+		Channel:  configWithFallback(config, "channel", m.channel),
+		Username: configWithFallback(config, "username", m.username),
+		IconURL:  configWithFallback(config, "icon_url", m.iconURL),
+		Attachments: []mattermostAttachment{
+			{
+				Fallback: text,
+				Color:    configWithFallback(config, "color", m.color),
+				Title:    failure.ID,
+				Text:     text,
+				Fields: []mattermostField{
+					{Short: true, Title: "Framework", Value: failure.Framework},
+					{Short: true, Title: "Host", Value: failure.Slave},
+					{Short: true, Title: "State", Value: failure.State},
+					{Short: true, Title: "Finished", Value: failure.Finished.Format(time.RFC3339)},
+					{Short: false, Title: "Logs", Value: fmt.Sprintf("[stdout](%s), [stderr](%s)", stdoutURL, stderrURL)},
+				},
+				Actions: actions,
+			},
+		},
+	}
+
+	return postJSON(ctx, hookURL, message)
+}
+
+// mattermostActions parses actions in "name:url;..." format, urls are
+// rendered as templates, so integrations can get task specific urls
+func mattermostActions(failure complainer.Failure, config ConfigProvider, stdoutURL, stderrURL, actions string) ([]mattermostAction, error) {
+	result := []mattermostAction{}
+
+	for _, action := range strings.Split(actions, ";") {
+		if strings.TrimSpace(action) == "" {
+			continue
+		}
+
+		parts := strings.SplitN(action, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid mattermost action %q, expected name:url", action)
+		}
+
+		name := strings.TrimSpace(parts[0])
+
+		url, err := fillTemplate(failure, config, stdoutURL, stderrURL, strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("rendering url of mattermost action %s failed: %s", name, err)
+		}
+
+		result = append(result, mattermostAction{
+			ID:   mattermostActionID(name),
+			Name: name,
+			Integration: mattermostIntegration{
+				URL: url,
+				Context: map[string]string{
+					"id":        failure.ID,
+					"name":      failure.Name,
+					"framework": failure.Framework,
+					"host":      failure.Slave,
+					"state":     failure.State,
+				},
+			},
+		})
+	}
+
+	return result, nil
+}
+
+// mattermostActionID makes action id out of the name,
+// mattermost only accepts letters and numbers in ids
+func mattermostActionID(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+
+		return -1
+	}, name)
+}
+
+// Preview renders the message without sending it
+func (m *mattermostReporter) Preview(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) (string, error) {
+	return fillMessage(failure, config, stdoutURL, stderrURL, m.format)
+}
+
+// DedupKey returns the hook url with the channel
+func (m *mattermostReporter) DedupKey(config ConfigProvider) string {
+	hookURL := configWithFallback(config, "hook_url", m.hookURL)
+	if hookURL == "" {
+		return ""
+	}
+
+	return hookURL + "|" + configWithFallback(config, "channel", m.channel)
+}
@@ -0,0 +1,99 @@
+package reporter
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestMattermostReport(t *testing.T) {
+	var posted []byte
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posted, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	m := newMattermostReporter(server.URL, "mesos", "alerts", "", "#d70000", "Restart:https://ops.example.com/restart/{{ .failure.Name }}; Silence Alerts:https://ops.example.com/silence", "Task {{ .failure.Name }} died")
+
+	config := func(string) string {
+		return ""
+	}
+
+	failure := complainer.Failure{
+		ID:        "web.1",
+		Name:      "web",
+		Slave:     "agent1",
+		Framework: "marathon",
+		State:     "TASK_FAILED",
+		Finished:  time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC),
+	}
+
+	if err := m.Report(context.Background(), failure, config, "http://stdout", "http://stderr"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{
+		"channel": "alerts",
+		"username": "mesos",
+		"attachments": [{
+			"fallback": "Task web died",
+			"color": "#d70000",
+			"title": "web.1",
+			"text": "Task web died",
+			"fields": [
+				{"short": true, "title": "Framework", "value": "marathon"},
+				{"short": true, "title": "Host", "value": "agent1"},
+				{"short": true, "title": "State", "value": "TASK_FAILED"},
+				{"short": true, "title": "Finished", "value": "2024-01-10T00:00:00Z"},
+				{"short": false, "title": "Logs", "value": "[stdout](http://stdout), [stderr](http://stderr)"}
+			],
+			"actions": [
+				{
+					"id": "restart",
+					"name": "Restart",
+					"integration": {
+						"url": "https://ops.example.com/restart/web",
+						"context": {"id": "web.1", "name": "web", "framework": "marathon", "host": "agent1", "state": "TASK_FAILED"}
+					}
+				},
+				{
+					"id": "silencealerts",
+					"name": "Silence Alerts",
+					"integration": {
+						"url": "https://ops.example.com/silence",
+						"context": {"id": "web.1", "name": "web", "framework": "marathon", "host": "agent1", "state": "TASK_FAILED"}
+					}
+				}
+			]
+		}]
+	}`
+
+	var got, want interface{}
+	if err := json.Unmarshal(posted, &got); err != nil {
+		t.Fatalf("error decoding posted message %q: %s", posted, err)
+	}
+
+	if err := json.Unmarshal([]byte(expected), &want); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected message posted: %s", posted)
+	}
+}
+
+func TestMattermostInvalidAction(t *testing.T) {
+	m := newMattermostReporter("http://127.0.0.1:1", "", "", "", "", "Restart", "")
+
+	if err := m.Report(context.Background(), complainer.Failure{}, func(string) string { return "" }, "", ""); err == nil {
+		t.Error("expected error for action without url")
+	}
+}
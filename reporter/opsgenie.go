@@ -0,0 +1,162 @@
+package reporter
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+)
+
+// opsgenieMaxMessageLength is the maximum alert message length accepted by Opsgenie
+const opsgenieMaxMessageLength = 130
+
+func init() {
+	var (
+		apiURL      *string
+		apiKey      *string
+		message     *string
+		description *string
+	)
+
+	RegisterReporter("opsgenie", Maker{
+		RegisterFlags: func() {
+			apiURL = flags.String("opsgenie.api_url", "OPSGENIE_API_URL", "https://api.opsgenie.com", "default opsgenie api url")
+			apiKey = flags.String("opsgenie.api_key", "OPSGENIE_API_KEY", "", "default opsgenie api key")
+			message = flags.String("opsgenie.message", "OPSGENIE_MESSAGE", "Task {{ .failure.Name }} died with status {{ .failure.State }}", "alert message format")
+			description = flags.String("opsgenie.description", "OPSGENIE_DESCRIPTION", "Task {{ .failure.Name }} ({{ .failure.ID }}) died with status {{ .failure.State }}:{{ .nl }}  * {{ .stdoutURL }}{{ .nl }}  * {{ .stderrURL }}{{ .nl }}", "alert description format")
+		},
+
+		Make: func() (Reporter, error) {
+			return newOpsgenieReporter(*apiURL, *apiKey, *message, *description), nil
+		},
+	})
+}
+
+type opsgenieReporter struct {
+	httpRetryable
+
+	apiURL      string
+	apiKey      string
+	message     string
+	description string
+}
+
+type opsgenieAlert struct {
+	Message     string            `json:"message"`
+	Alias       string            `json:"alias"`
+	Description string            `json:"description"`
+	Tags        []string          `json:"tags"`
+	Details     map[string]string `json:"details"`
+	Source      string            `json:"source"`
+}
+
+func newOpsgenieReporter(apiURL, apiKey, message, description string) *opsgenieReporter {
+	return &opsgenieReporter{
+		apiURL:      apiURL,
+		apiKey:      apiKey,
+		message:     message,
+		description: description,
+	}
+}
+
+func (o *opsgenieReporter) Report(ctx context.Context, failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
+	apiURL := config("api_url")
+	if apiURL == "" {
+		apiURL = o.apiURL
+	}
+
+	apiKey := config("api_key")
+	if apiKey == "" {
+		apiKey = o.apiKey
+	}
+
+	if apiURL == "" || apiKey == "" {
+		return nil
+	}
+
+	messageFormat := config("message")
+	if messageFormat == "" {
+		messageFormat = o.message
+	}
+
+	message, err := fillTemplate(failure, config, stdoutURL, stderrURL, messageFormat)
+	if err != nil {
+		return err
+	}
+
+	descriptionFormat := config("description")
+	if descriptionFormat == "" {
+		descriptionFormat = o.description
+	}
+
+	description, err := fillMessage(failure, config, stdoutURL, stderrURL, descriptionFormat)
+	if err != nil {
+		return err
+	}
+
+	alert := opsgenieAlert{
+		Message:     truncate(message, opsgenieMaxMessageLength),
+		Alias:       failure.ID,
+		Description: description,
+		Tags:        []string{failure.Framework, failure.Slave},
+		Details: map[string]string{
+			"task.id":          failure.ID,
+			"task.state":       failure.State,
+			"timings.finished": failure.Finished.Format(time.RFC3339),
+			"logs.stdout":      stdoutURL,
+			"logs.stderr":      stderrURL,
+			"container.image":  failure.Image,
+		},
+		Source: "complainer",
+	}
+
+	headers := map[string]string{
+		"Authorization": "GenieKey " + apiKey,
+	}
+
+	_, err = sendJSON(ctx, http.MethodPost, strings.TrimSuffix(apiURL, "/")+"/v2/alerts", headers, alert)
+	return err
+}
+
+type opsgenieClose struct {
+	Source string `json:"source"`
+	Note   string `json:"note"`
+}
+
+// Resolve closes the alert of the failure
+func (o *opsgenieReporter) Resolve(ctx context.Context, failure complainer.Failure, config ConfigProvider) error {
+	apiURL := configWithFallback(config, "api_url", o.apiURL)
+	apiKey := configWithFallback(config, "api_key", o.apiKey)
+
+	if apiURL == "" || apiKey == "" {
+		return nil
+	}
+
+	headers := map[string]string{
+		"Authorization": "GenieKey " + apiKey,
+	}
+
+	closeURL := strings.TrimSuffix(apiURL, "/") + "/v2/alerts/" + url.PathEscape(failure.ID) + "/close?identifierType=alias"
+
+	_, err := sendJSON(ctx, http.MethodPost, closeURL, headers, opsgenieClose{Source: "complainer", Note: "Task " + failure.Name + " recovered"})
+	return err
+}
+
+// Preview renders the message without sending it
+func (o *opsgenieReporter) Preview(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) (string, error) {
+	message, err := fillTemplate(failure, config, stdoutURL, stderrURL, configWithFallback(config, "message", o.message))
+	if err != nil {
+		return "", err
+	}
+
+	description, err := fillMessage(failure, config, stdoutURL, stderrURL, configWithFallback(config, "description", o.description))
+	if err != nil {
+		return "", err
+	}
+
+	return message + "\n\n" + description, nil
+}
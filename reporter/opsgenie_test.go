@@ -0,0 +1,124 @@
+package reporter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestOpsgenieResolve(t *testing.T) {
+	var closed opsgenieClose
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/alerts/web.1/close" || r.URL.Query().Get("identifierType") != "alias" || r.Header.Get("Authorization") != "GenieKey key" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&closed); err != nil {
+			t.Errorf("error decoding close request: %s", err)
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	o := newOpsgenieReporter(server.URL, "key", "", "")
+
+	if err := o.Resolve(context.Background(), complainer.Failure{ID: "web.1", Name: "web"}, func(string) string { return "" }); err != nil {
+		t.Fatal(err)
+	}
+
+	if closed.Source != "complainer" || closed.Note != "Task web recovered" {
+		t.Errorf("unexpected close request: %+v", closed)
+	}
+}
+
+func TestOpsgenieReport(t *testing.T) {
+	var alert opsgenieAlert
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/alerts" || r.Header.Get("Authorization") != "GenieKey key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			t.Errorf("error decoding alert: %s", err)
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	o := newOpsgenieReporter(server.URL+"/", "key", "Task {{ .failure.Name }} died "+strings.Repeat("!", 200), "{{ .failure.ID }}: {{ .stderrURL }}")
+
+	finished := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	failure := complainer.Failure{ID: "web.1", Name: "web", Framework: "marathon", Slave: "host1", State: "TASK_FAILED", Image: "web:1", Finished: finished}
+
+	if err := o.Report(context.Background(), failure, func(string) string { return "" }, "http://stdout", "http://stderr"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := opsgenieAlert{
+		Message:     truncate("Task web died "+strings.Repeat("!", 200), opsgenieMaxMessageLength),
+		Alias:       "web.1",
+		Description: "web.1: http://stderr",
+		Tags:        []string{"marathon", "host1"},
+		Details: map[string]string{
+			"task.id":          "web.1",
+			"task.state":       "TASK_FAILED",
+			"timings.finished": "2017-01-02T03:04:05Z",
+			"logs.stdout":      "http://stdout",
+			"logs.stderr":      "http://stderr",
+			"container.image":  "web:1",
+		},
+		Source: "complainer",
+	}
+
+	if !reflect.DeepEqual(alert, expected) {
+		t.Errorf("unexpected alert; expected: %+v, got: %+v", expected, alert)
+	}
+
+	if len(alert.Message) > opsgenieMaxMessageLength {
+		t.Errorf("expected message to be cut to %d bytes, got %d", opsgenieMaxMessageLength, len(alert.Message))
+	}
+}
+
+func TestOpsgenieErrors(t *testing.T) {
+	for _, row := range []struct {
+		status    int
+		retryable bool
+	}{
+		{status: http.StatusTooManyRequests, retryable: true},
+		{status: http.StatusUnprocessableEntity, retryable: false},
+		{status: http.StatusUnauthorized, retryable: false},
+		{status: http.StatusServiceUnavailable, retryable: true},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(row.status)
+			_, _ = w.Write([]byte(`{"message":"request failed"}`))
+		}))
+
+		o := newOpsgenieReporter(server.URL, "key", "{{ .failure.ID }}", "")
+
+		err := o.Report(context.Background(), complainer.Failure{ID: "web.1"}, func(string) string { return "" }, "", "")
+		server.Close()
+
+		if err == nil || !strings.Contains(err.Error(), "request failed") {
+			t.Errorf("expected error with response for status %d, got: %v", row.status, err)
+			continue
+		}
+
+		if o.Retryable(err) != row.retryable {
+			t.Errorf("unexpected retryable for status %d; expected: %v, got: %v", row.status, row.retryable, o.Retryable(err))
+		}
+	}
+}
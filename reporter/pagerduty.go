@@ -0,0 +1,153 @@
+package reporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+)
+
+// pagerdutyEventsURL is the url of PagerDuty Events API v2
+var pagerdutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+var pagerdutySeverities = map[string]bool{
+	"critical": true,
+	"error":    true,
+	"warning":  true,
+	"info":     true,
+}
+
+func init() {
+	var (
+		routingKey *string
+		severity   *string
+		format     *string
+	)
+
+	RegisterReporter("pagerduty", Maker{
+		RegisterFlags: func() {
+			routingKey = flags.String("pagerduty.routing_key", "PAGERDUTY_ROUTING_KEY", "", "default pagerduty events v2 routing key")
+			severity = flags.String("pagerduty.severity", "PAGERDUTY_SEVERITY", "error", "default pagerduty severity (critical, error, warning, info)")
+			format = flags.String("pagerduty.format", "PAGERDUTY_FORMAT", "Task {{ .failure.Name }} ({{ .failure.ID }}) died with status {{ .failure.State }}", "incident summary format")
+		},
+
+		Make: func() (Reporter, error) {
+			return newPagerdutyReporter(*routingKey, *severity, *format)
+		},
+	})
+}
+
+type pagerdutyReporter struct {
+	httpRetryable
+
+	routingKey string
+	severity   string
+	format     string
+}
+
+type pagerdutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerdutyPayload `json:"payload,omitempty"`
+}
+
+type pagerdutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Timestamp     string            `json:"timestamp"`
+	Component     string            `json:"component"`
+	CustomDetails map[string]string `json:"custom_details"`
+}
+
+func newPagerdutyReporter(routingKey, severity, format string) (*pagerdutyReporter, error) {
+	if !pagerdutySeverities[severity] {
+		return nil, fmt.Errorf("invalid pagerduty severity: %q", severity)
+	}
+
+	return &pagerdutyReporter{
+		routingKey: routingKey,
+		severity:   severity,
+		format:     format,
+	}, nil
+}
+
+// Validate checks that the routing key is set
+func (p *pagerdutyReporter) Validate(ctx context.Context, config ConfigProvider) error {
+	if configWithFallback(config, "routing_key", p.routingKey) == "" {
+		return errors.New("pagerduty routing key is not set")
+	}
+
+	return nil
+}
+
+func (p *pagerdutyReporter) Report(ctx context.Context, failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
+	routingKey := config("routing_key")
+	if routingKey == "" {
+		routingKey = p.routingKey
+	}
+
+	if routingKey == "" {
+		return nil
+	}
+
+	severity := config("severity")
+	if severity == "" {
+		severity = p.severity
+	}
+
+	if !pagerdutySeverities[severity] {
+		return fmt.Errorf("invalid pagerduty severity: %q", severity)
+	}
+
+	summary, err := fillMessage(failure, config, stdoutURL, stderrURL, p.format)
+	if err != nil {
+		return err
+	}
+
+	event := pagerdutyEvent{
+		RoutingKey:  routingKey,
+		EventAction: "trigger",
+		DedupKey:    failure.ID,
+		Payload: &pagerdutyPayload{
+			Summary:   summary,
+			Source:    failure.Slave,
+			Severity:  severity,
+			Timestamp: failure.Finished.Format(time.RFC3339),
+			Component: failure.Framework,
+			CustomDetails: map[string]string{
+				"task.id":         failure.ID,
+				"task.state":      failure.State,
+				"logs.stdout":     stdoutURL,
+				"logs.stderr":     stderrURL,
+				"container.image": failure.Image,
+			},
+		},
+	}
+
+	// Rate limiting (429) is reported as an error as well, so it gets logged
+	return postJSON(ctx, pagerdutyEventsURL, event)
+}
+
+// Resolve resolves the incident of the failure
+func (p *pagerdutyReporter) Resolve(ctx context.Context, failure complainer.Failure, config ConfigProvider) error {
+	routingKey := configWithFallback(config, "routing_key", p.routingKey)
+	if routingKey == "" {
+		return nil
+	}
+
+	return postJSON(ctx, pagerdutyEventsURL, pagerdutyEvent{
+		RoutingKey:  routingKey,
+		EventAction: "resolve",
+		DedupKey:    failure.ID,
+	})
+}
+
+// Preview renders the message without sending it
+func (p *pagerdutyReporter) Preview(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) (string, error) {
+	return fillMessage(failure, config, stdoutURL, stderrURL, p.format)
+}
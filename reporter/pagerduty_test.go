@@ -0,0 +1,182 @@
+package reporter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestPagerdutyResolve(t *testing.T) {
+	var events []map[string]interface{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event := map[string]interface{}{}
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("error decoding event: %s", err)
+		}
+
+		events = append(events, event)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	defer func(u string) {
+		pagerdutyEventsURL = u
+	}(pagerdutyEventsURL)
+	pagerdutyEventsURL = server.URL
+
+	p, err := newPagerdutyReporter("key", "error", "{{ .failure.ID }}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := func(string) string {
+		return ""
+	}
+
+	failure := complainer.Failure{ID: "web.1", Name: "web"}
+
+	if err = p.Report(context.Background(), failure, config, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = p.Resolve(context.Background(), failure, config); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got: %v", events)
+	}
+
+	if events[0]["event_action"] != "trigger" || events[1]["event_action"] != "resolve" || events[1]["dedup_key"] != events[0]["dedup_key"] {
+		t.Errorf("expected resolve event for the triggered incident, got: %v", events)
+	}
+
+	if _, ok := events[1]["payload"]; ok {
+		t.Errorf("expected resolve event without payload, got: %v", events[1])
+	}
+}
+
+func TestPagerdutyReport(t *testing.T) {
+	var events []pagerdutyEvent
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event := pagerdutyEvent{}
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("error decoding event: %s", err)
+		}
+
+		events = append(events, event)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	defer func(u string) {
+		pagerdutyEventsURL = u
+	}(pagerdutyEventsURL)
+	pagerdutyEventsURL = server.URL
+
+	p, err := newPagerdutyReporter("key", "error", "Task {{ .failure.Name }} died")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	labels := map[string]string{"severity": "critical"}
+	config := func(key string) string {
+		return labels[key]
+	}
+
+	finished := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	failure := complainer.Failure{ID: "web.1", Name: "web", Framework: "marathon", Slave: "host1", State: "TASK_FAILED", Image: "web:1", Finished: finished}
+
+	if err = p.Report(context.Background(), failure, config, "http://stdout", "http://stderr"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []pagerdutyEvent{
+		{
+			RoutingKey:  "key",
+			EventAction: "trigger",
+			DedupKey:    "web.1",
+			Payload: &pagerdutyPayload{
+				Summary:   "Task web died",
+				Source:    "host1",
+				Severity:  "critical",
+				Timestamp: "2017-01-02T03:04:05Z",
+				Component: "marathon",
+				CustomDetails: map[string]string{
+					"task.id":         "web.1",
+					"task.state":      "TASK_FAILED",
+					"logs.stdout":     "http://stdout",
+					"logs.stderr":     "http://stderr",
+					"container.image": "web:1",
+				},
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("unexpected events; expected: %+v, got: %+v", expected, events)
+	}
+
+	// Invalid severity from labels is rejected before sending
+	labels["severity"] = "fatal"
+
+	if err = p.Report(context.Background(), failure, config, "http://stdout", "http://stderr"); err == nil || !strings.Contains(err.Error(), "fatal") {
+		t.Errorf("expected invalid severity error, got: %v", err)
+	}
+
+	if len(events) != 1 {
+		t.Errorf("expected no event with invalid severity, got %d events", len(events))
+	}
+
+	if _, err = newPagerdutyReporter("key", "fatal", ""); err == nil {
+		t.Error("expected invalid default severity to be rejected")
+	}
+}
+
+func TestPagerdutyErrors(t *testing.T) {
+	defer func(u string) {
+		pagerdutyEventsURL = u
+	}(pagerdutyEventsURL)
+
+	for _, row := range []struct {
+		status    int
+		retryable bool
+	}{
+		{status: http.StatusTooManyRequests, retryable: true},
+		{status: http.StatusBadRequest, retryable: false},
+		{status: http.StatusInternalServerError, retryable: true},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(row.status)
+			_, _ = w.Write([]byte(`{"status":"invalid event"}`))
+		}))
+
+		pagerdutyEventsURL = server.URL
+
+		p, err := newPagerdutyReporter("key", "error", "{{ .failure.ID }}")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = p.Report(context.Background(), complainer.Failure{ID: "web.1"}, func(string) string { return "" }, "", "")
+		server.Close()
+
+		if err == nil {
+			t.Errorf("expected error for status %d", row.status)
+			continue
+		}
+
+		if p.Retryable(err) != row.retryable {
+			t.Errorf("unexpected retryable for status %d; expected: %v, got: %v", row.status, row.retryable, p.Retryable(err))
+		}
+	}
+}
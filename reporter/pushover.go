@@ -0,0 +1,167 @@
+package reporter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+)
+
+const (
+	// pushoverEmergencyPriority requires users to acknowledge the notification
+	pushoverEmergencyPriority = 2
+	// pushoverMinRetry is the minimum retry interval of emergency notifications in seconds
+	pushoverMinRetry = 30
+	// pushoverMaxExpire is the maximum expiration of emergency notifications in seconds
+	pushoverMaxExpire = 10800
+	// pushoverMaxMessageLength is the maximum message length accepted by Pushover
+	pushoverMaxMessageLength = 1024
+)
+
+func init() {
+	var (
+		apiURL   *string
+		token    *string
+		user     *string
+		priority *string
+		retry    *string
+		expire   *string
+		title    *string
+		format   *string
+	)
+
+	RegisterReporter("pushover", Maker{
+		RegisterFlags: func() {
+			apiURL = flags.String("pushover.api_url", "PUSHOVER_API_URL", "https://api.pushover.net", "default pushover api url")
+			token = flags.String("pushover.token", "PUSHOVER_TOKEN", "", "default pushover application token")
+			user = flags.String("pushover.user", "PUSHOVER_USER", "", "default pushover user or group key")
+			priority = flags.String("pushover.priority", "PUSHOVER_PRIORITY", "0", "default pushover priority (-2 to 2)")
+			retry = flags.String("pushover.retry", "PUSHOVER_RETRY", "60", "seconds between retries of emergency notifications")
+			expire = flags.String("pushover.expire", "PUSHOVER_EXPIRE", "3600", "seconds to retry emergency notifications for")
+			title = flags.String("pushover.title", "PUSHOVER_TITLE", "Task {{ .failure.Name }} died", "notification title format")
+			format = flags.String("pushover.format", "PUSHOVER_FORMAT", "Task {{ .failure.Name }} ({{ .failure.ID }}) died with status {{ .failure.State }} on {{ .failure.Slave }}", "notification message format")
+		},
+
+		Make: func() (Reporter, error) {
+			return newPushoverReporter(*apiURL, *token, *user, *priority, *retry, *expire, *title, *format)
+		},
+	})
+}
+
+type pushoverReporter struct {
+	httpRetryable
+
+	apiURL   string
+	token    string
+	user     string
+	priority string
+	retry    string
+	expire   string
+	title    string
+	format   string
+}
+
+func newPushoverReporter(apiURL, token, user, priority, retry, expire, title, format string) (*pushoverReporter, error) {
+	if _, err := pushoverPriority(priority, retry, expire); err != nil {
+		return nil, err
+	}
+
+	return &pushoverReporter{
+		apiURL:   apiURL,
+		token:    token,
+		user:     user,
+		priority: priority,
+		retry:    retry,
+		expire:   expire,
+		title:    title,
+		format:   format,
+	}, nil
+}
+
+// pushoverPriority validates priority and returns form values for it,
+// emergency priority needs retry and expire parameters
+func pushoverPriority(priority, retry, expire string) (url.Values, error) {
+	p, err := strconv.Atoi(priority)
+	if err != nil || p < -2 || p > pushoverEmergencyPriority {
+		return nil, fmt.Errorf("invalid pushover priority: %q", priority)
+	}
+
+	values := url.Values{"priority": {priority}}
+	if p != pushoverEmergencyPriority {
+		return values, nil
+	}
+
+	r, err := strconv.Atoi(retry)
+	if err != nil || r < pushoverMinRetry {
+		return nil, fmt.Errorf("invalid pushover retry %q, must be at least %d seconds", retry, pushoverMinRetry)
+	}
+
+	e, err := strconv.Atoi(expire)
+	if err != nil || e < 1 || e > pushoverMaxExpire {
+		return nil, fmt.Errorf("invalid pushover expire %q, must be at most %d seconds", expire, pushoverMaxExpire)
+	}
+
+	values.Set("retry", retry)
+	values.Set("expire", expire)
+
+	return values, nil
+}
+
+func (p *pushoverReporter) Report(ctx context.Context, failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
+	token := configWithFallback(config, "token", p.token)
+	user := configWithFallback(config, "user", p.user)
+
+	if token == "" || user == "" {
+		return nil
+	}
+
+	values, err := pushoverPriority(configWithFallback(config, "priority", p.priority), configWithFallback(config, "retry", p.retry), configWithFallback(config, "expire", p.expire))
+	if err != nil {
+		return err
+	}
+
+	title, err := fillTemplate(failure, config, stdoutURL, stderrURL, configWithFallback(config, "title", p.title))
+	if err != nil {
+		return err
+	}
+
+	message, err := fillMessage(failure, config, stdoutURL, stderrURL, p.format)
+	if err != nil {
+		return err
+	}
+
+	values.Set("token", token)
+	values.Set("user", user)
+	values.Set("title", title)
+	values.Set("message", truncate(message, pushoverMaxMessageLength))
+	values.Set("url", stderrURL)
+	values.Set("url_title", "stderr")
+	values.Set("timestamp", strconv.FormatInt(failure.Finished.Unix(), 10))
+
+	_, err = send(ctx, http.MethodPost, strings.TrimSuffix(configWithFallback(config, "api_url", p.apiURL), "/")+"/1/messages.json", "application/x-www-form-urlencoded", nil, []byte(values.Encode()))
+	if e, ok := err.(*statusError); ok && e.code == http.StatusTooManyRequests {
+		return &statusError{code: e.code, message: "pushover monthly message limit of the application is reached: " + e.message}
+	}
+
+	return err
+}
+
+// Preview renders the message without sending it
+func (p *pushoverReporter) Preview(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) (string, error) {
+	title, err := fillTemplate(failure, config, stdoutURL, stderrURL, configWithFallback(config, "title", p.title))
+	if err != nil {
+		return "", err
+	}
+
+	message, err := fillMessage(failure, config, stdoutURL, stderrURL, p.format)
+	if err != nil {
+		return "", err
+	}
+
+	return title + "\n\n" + message, nil
+}
@@ -0,0 +1,114 @@
+package reporter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestPushoverReport(t *testing.T) {
+	var form url.Values
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/1/messages.json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("error parsing form: %s", err)
+		}
+
+		form = r.PostForm
+		_, _ = w.Write([]byte(`{"status":1}`))
+	}))
+	defer server.Close()
+
+	p, err := newPushoverReporter(server.URL, "token", "user", "0", "60", "3600", "Task {{ .failure.Name }} died", "{{ .failure.ID }} on {{ .failure.Slave }}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := func(key string) string {
+		if key == "priority" {
+			return "2"
+		}
+
+		return ""
+	}
+
+	failure := complainer.Failure{ID: "web.1", Name: "web", Slave: "host1", Finished: time.Unix(1480000000, 0)}
+
+	if err = p.Report(context.Background(), failure, config, "https://logs/stdout", "https://logs/stderr"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"token":     "token",
+		"user":      "user",
+		"title":     "Task web died",
+		"message":   "web.1 on host1",
+		"url":       "https://logs/stderr",
+		"priority":  "2",
+		"retry":     "60",
+		"expire":    "3600",
+		"timestamp": "1480000000",
+	}
+
+	for k, v := range expected {
+		if form.Get(k) != v {
+			t.Errorf("unexpected %s; expected: %q, got: %q", k, v, form.Get(k))
+		}
+	}
+}
+
+func TestPushoverRateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	p, err := newPushoverReporter(server.URL, "token", "user", "0", "", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p.Report(context.Background(), complainer.Failure{ID: "web.1"}, func(string) string { return "" }, "", "")
+	if err == nil || !strings.Contains(err.Error(), "limit") {
+		t.Fatalf("expected rate limit error, got: %v", err)
+	}
+
+	if !p.Retryable(err) {
+		t.Errorf("expected rate limit error to be retryable: %s", err)
+	}
+}
+
+func TestPushoverPriority(t *testing.T) {
+	table := []struct {
+		priority string
+		retry    string
+		expire   string
+		err      bool
+	}{
+		{priority: "-2"},
+		{priority: "1"},
+		{priority: "3", err: true},
+		{priority: "high", err: true},
+		{priority: "2", retry: "30", expire: "10800"},
+		{priority: "2", retry: "10", expire: "3600", err: true},
+		{priority: "2", retry: "60", expire: "86400", err: true},
+		{priority: "2", err: true},
+	}
+
+	for _, row := range table {
+		if _, err := pushoverPriority(row.priority, row.retry, row.expire); (err != nil) != row.err {
+			t.Errorf("unexpected error for %+v: %v", row, err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package reporter
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/cloudflare/complainer"
@@ -21,7 +22,14 @@ func RegisterFlags() {
 	}
 }
 
-func registerMaker(name string, reporterMaker Maker) {
+// RegisterReporter registers reporter maker by name, reporters compiled
+// into complainer register themselves in init, so their flags are known
+// before flags are parsed. Registering the same name twice panics.
+func RegisterReporter(name string, reporterMaker Maker) {
+	if _, ok := makers[name]; ok {
+		panic(fmt.Sprintf("reporter maker %q is already registered", name))
+	}
+
 	makers[name] = reporterMaker
 }
 
@@ -34,7 +42,66 @@ func MakerByName(name string) (Maker, error) {
 	return Maker{}, fmt.Errorf("unknown reporter maker: %q", name)
 }
 
-// Reporter is responsible for reporting failures to external systems
+// NewReporter makes reporter registered by name from parsed flags
+func NewReporter(name string) (Reporter, error) {
+	rm, err := MakerByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return rm.Make()
+}
+
+// Reporter is responsible for reporting failures to external systems,
+// reporting should stop when the context is done
 type Reporter interface {
-	Report(failure complainer.Failure, config ConfigProvider, stdoutURL, stderrURL string) error
+	Report(ctx context.Context, failure complainer.Failure, config ConfigProvider, stdoutURL, stderrURL string) error
+}
+
+// RetryableReporter is implemented by reporters that can tell
+// whether the error returned from Report is worth retrying
+type RetryableReporter interface {
+	Retryable(err error) bool
+}
+
+// Previewer is implemented by reporters that can render the message
+// they would send without sending it, which is used in dry-run mode
+type Previewer interface {
+	Preview(failure complainer.Failure, config ConfigProvider, stdoutURL, stderrURL string) (string, error)
+}
+
+// Validator is implemented by reporters that can check config
+// of the instance at startup, so broken credentials are noticed
+// before the first failure needs to be reported
+type Validator interface {
+	Validate(ctx context.Context, config ConfigProvider) error
+}
+
+// Resolver is implemented by reporters that can mark the reported
+// failure as resolved, once the task is seen healthy again
+type Resolver interface {
+	Resolve(ctx context.Context, failure complainer.Failure, config ConfigProvider) error
+}
+
+// Deduplicator is implemented by reporters that can tell where the report
+// is delivered, instances of the reporter with the same non-empty key
+// resolve to the same destination and only one of them is used
+type Deduplicator interface {
+	DedupKey(config ConfigProvider) string
+}
+
+// withContext runs fn for libraries without context support, returning
+// early if the context is done first while fn keeps running in background
+func withContext(ctx context.Context, fn func() error) error {
+	ch := make(chan error, 1)
+	go func() {
+		ch <- fn()
+	}()
+
+	select {
+	case err := <-ch:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
@@ -0,0 +1,42 @@
+package reporter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudflare/complainer"
+)
+
+type customReporter struct{}
+
+func (customReporter) Report(ctx context.Context, failure complainer.Failure, config ConfigProvider, stdoutURL, stderrURL string) error {
+	return nil
+}
+
+func TestRegisterReporter(t *testing.T) {
+	defer delete(makers, "custom")
+
+	RegisterReporter("custom", Maker{
+		RegisterFlags: func() {},
+
+		Make: func() (Reporter, error) {
+			return customReporter{}, nil
+		},
+	})
+
+	if _, err := NewReporter("custom"); err != nil {
+		t.Errorf("error making registered reporter: %s", err)
+	}
+
+	if _, err := NewReporter("missing"); err == nil {
+		t.Error("expected error making unknown reporter")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected duplicate registration to panic")
+		}
+	}()
+
+	RegisterReporter("custom", Maker{})
+}
@@ -0,0 +1,146 @@
+package reporter
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+)
+
+func init() {
+	var (
+		apiURL      *string
+		accessToken *string
+		environment *string
+		title       *string
+		format      *string
+	)
+
+	RegisterReporter("rollbar", Maker{
+		RegisterFlags: func() {
+			apiURL = flags.String("rollbar.api_url", "ROLLBAR_API_URL", "https://api.rollbar.com", "default rollbar api url")
+			accessToken = flags.String("rollbar.access_token", "ROLLBAR_ACCESS_TOKEN", "", "default rollbar project access token with post_server_item scope")
+			environment = flags.String("rollbar.environment", "ROLLBAR_ENVIRONMENT", "production", "default rollbar environment")
+			title = flags.String("rollbar.title", "ROLLBAR_TITLE", "Task {{ .failure.Name }} died with status {{ .failure.State }}", "item title format")
+			format = flags.String("rollbar.format", "ROLLBAR_FORMAT", "Task {{ .failure.Name }} ({{ .failure.ID }}) died with status {{ .failure.State }}{{ if .failure.Message }}: {{ .failure.Message }}{{ end }}", "item message format")
+		},
+
+		Make: func() (Reporter, error) {
+			return newRollbarReporter(*apiURL, *accessToken, *environment, *title, *format), nil
+		},
+	})
+}
+
+type rollbarReporter struct {
+	httpRetryable
+
+	apiURL      string
+	accessToken string
+	environment string
+	title       string
+	format      string
+}
+
+type rollbarPayload struct {
+	Data rollbarItem `json:"data"`
+}
+
+type rollbarItem struct {
+	Environment string            `json:"environment"`
+	Level       string            `json:"level"`
+	Timestamp   int64             `json:"timestamp"`
+	Title       string            `json:"title"`
+	Fingerprint string            `json:"fingerprint"`
+	Platform    string            `json:"platform"`
+	Body        rollbarBody       `json:"body"`
+	Server      rollbarServer     `json:"server"`
+	Custom      map[string]string `json:"custom"`
+}
+
+type rollbarBody struct {
+	Message rollbarMessage `json:"message"`
+}
+
+type rollbarMessage struct {
+	Body string `json:"body"`
+}
+
+type rollbarServer struct {
+	Host string `json:"host"`
+}
+
+func newRollbarReporter(apiURL, accessToken, environment, title, format string) *rollbarReporter {
+	return &rollbarReporter{
+		apiURL:      apiURL,
+		accessToken: accessToken,
+		environment: environment,
+		title:       title,
+		format:      format,
+	}
+}
+
+func (r *rollbarReporter) Report(ctx context.Context, failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
+	accessToken := configWithFallback(config, "access_token", r.accessToken)
+	if accessToken == "" {
+		return nil
+	}
+
+	title, err := fillTemplate(failure, config, stdoutURL, stderrURL, configWithFallback(config, "title", r.title))
+	if err != nil {
+		return err
+	}
+
+	message, err := fillMessage(failure, config, stdoutURL, stderrURL, r.format)
+	if err != nil {
+		return err
+	}
+
+	// Failures of the same task are grouped into a single item
+	payload := rollbarPayload{
+		Data: rollbarItem{
+			Environment: configWithFallback(config, "environment", r.environment),
+			Level:       "error",
+			Timestamp:   failure.Finished.Unix(),
+			Title:       title,
+			Fingerprint: failure.Framework + ":" + failure.Name,
+			Platform:    "mesos",
+			Body: rollbarBody{
+				Message: rollbarMessage{Body: message},
+			},
+			Server: rollbarServer{Host: failure.Slave},
+			Custom: map[string]string{
+				"task.id":         failure.ID,
+				"task.state":      failure.State,
+				"framework":       failure.Framework,
+				"host":            failure.Slave,
+				"logs.stdout":     stdoutURL,
+				"logs.stderr":     stderrURL,
+				"container.image": failure.Image,
+			},
+		},
+	}
+
+	headers := map[string]string{
+		"X-Rollbar-Access-Token": accessToken,
+	}
+
+	_, err = sendJSON(ctx, http.MethodPost, strings.TrimSuffix(configWithFallback(config, "api_url", r.apiURL), "/")+"/api/1/item/", headers, payload)
+	return err
+}
+
+// Preview renders the message without sending it
+func (r *rollbarReporter) Preview(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) (string, error) {
+	title, err := fillTemplate(failure, config, stdoutURL, stderrURL, configWithFallback(config, "title", r.title))
+	if err != nil {
+		return "", err
+	}
+
+	message, err := fillMessage(failure, config, stdoutURL, stderrURL, r.format)
+	if err != nil {
+		return "", err
+	}
+
+	return title + "\n\n" + message, nil
+}
@@ -0,0 +1,81 @@
+package reporter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestRollbarReport(t *testing.T) {
+	var payload rollbarPayload
+	var token string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/1/item/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		token = r.Header.Get("X-Rollbar-Access-Token")
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("error decoding item: %s", err)
+		}
+	}))
+	defer server.Close()
+
+	r := newRollbarReporter(server.URL, "token", "production", "Task {{ .failure.Name }} died", "{{ .failure.ID }}")
+
+	config := func(key string) string {
+		if key == "environment" {
+			return "staging"
+		}
+
+		return ""
+	}
+
+	failure := complainer.Failure{ID: "web.1", Name: "web", Framework: "marathon", Slave: "host1"}
+
+	if err := r.Report(context.Background(), failure, config, "https://logs/stdout", "https://logs/stderr"); err != nil {
+		t.Fatal(err)
+	}
+
+	if token != "token" {
+		t.Errorf("unexpected access token: %q", token)
+	}
+
+	item := payload.Data
+	if item.Environment != "staging" || item.Level != "error" || item.Title != "Task web died" || item.Body.Message.Body != "web.1" {
+		t.Errorf("unexpected item: %+v", item)
+	}
+
+	if item.Fingerprint != "marathon:web" {
+		t.Errorf("unexpected fingerprint: %s", item.Fingerprint)
+	}
+
+	if item.Custom["logs.stderr"] != "https://logs/stderr" || item.Custom["host"] != "host1" {
+		t.Errorf("unexpected custom data: %v", item.Custom)
+	}
+}
+
+func TestRollbarError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"err":1,"message":"invalid access token"}`))
+	}))
+	defer server.Close()
+
+	r := newRollbarReporter(server.URL, "token", "production", "", "")
+
+	err := r.Report(context.Background(), complainer.Failure{ID: "web.1"}, func(string) string { return "" }, "", "")
+	if err == nil {
+		t.Fatal("expected error for rejected item")
+	}
+
+	if r.Retryable(err) {
+		t.Errorf("expected client error not to be retryable: %s", err)
+	}
+}
@@ -1,43 +1,74 @@
 package reporter
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"net/http"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/certifi/gocertifi"
 	"github.com/cloudflare/complainer"
 	"github.com/cloudflare/complainer/flags"
+	"github.com/cloudflare/complainer/httpclient"
 	"github.com/getsentry/raven-go"
 )
 
 func init() {
 	var (
-		dsn *string
+		dsn         *string
+		level       *string
+		fingerprint *string
 	)
 
-	registerMaker("sentry", Maker{
+	RegisterReporter("sentry", Maker{
 		RegisterFlags: func() {
 			dsn = flags.String("sentry.dsn", "SENTRY_DSN", "", "sentry dsn")
+			level = flags.String("sentry.level", "SENTRY_LEVEL", string(raven.ERROR), "sentry event level (debug, info, warning, error, fatal)")
+			fingerprint = flags.String("sentry.fingerprint", "SENTRY_FINGERPRINT", "", "comma separated sentry fingerprint template for event grouping")
 		},
 
 		Make: func() (Reporter, error) {
-			return newSentryReporter(*dsn), nil
+			return newSentryReporter(*dsn, *level, *fingerprint)
 		},
 	})
 }
 
+var sentryLevels = map[string]bool{
+	string(raven.DEBUG):   true,
+	string(raven.INFO):    true,
+	string(raven.WARNING): true,
+	string(raven.ERROR):   true,
+	string(raven.FATAL):   true,
+}
+
 type sentryReporter struct {
-	dsn     string
-	clients map[string]*raven.Client
+	dsn         string
+	level       string
+	fingerprint string
+	clients     map[string]*raven.Client
+	mu          sync.Mutex
 }
 
-func newSentryReporter(dsn string) *sentryReporter {
-	return &sentryReporter{
-		dsn:     dsn,
-		clients: map[string]*raven.Client{},
+func newSentryReporter(dsn, level, fingerprint string) (*sentryReporter, error) {
+	if !sentryLevels[level] {
+		return nil, fmt.Errorf("invalid sentry level: %q", level)
 	}
+
+	return &sentryReporter{
+		dsn:         dsn,
+		level:       level,
+		fingerprint: fingerprint,
+		clients:     map[string]*raven.Client{},
+	}, nil
 }
 
 func (s *sentryReporter) client(dsn string) (*raven.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if client, ok := s.clients[dsn]; ok {
 		return client, nil
 	}
@@ -47,12 +78,15 @@ func (s *sentryReporter) client(dsn string) (*raven.Client, error) {
 		return client, err
 	}
 
+	// Default transport of raven ignores proxies
+	client.Transport = &raven.HTTPTransport{Client: sentryHTTPClient()}
+
 	s.clients[dsn] = client
 
 	return client, nil
 }
 
-func (s *sentryReporter) Report(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
+func (s *sentryReporter) Report(ctx context.Context, failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
 	dsn := config("dsn")
 	if dsn == "" {
 		dsn = s.dsn
@@ -62,6 +96,16 @@ func (s *sentryReporter) Report(failure complainer.Failure, config ConfigProvide
 		return nil
 	}
 
+	level := configWithFallback(config, "level", s.level)
+	if !sentryLevels[level] {
+		return fmt.Errorf("invalid sentry level: %q", level)
+	}
+
+	fingerprint, err := s.renderFingerprint(failure, config, stdoutURL, stderrURL)
+	if err != nil {
+		return err
+	}
+
 	client, err := s.client(dsn)
 	if err != nil {
 		return err
@@ -69,6 +113,8 @@ func (s *sentryReporter) Report(failure complainer.Failure, config ConfigProvide
 
 	extra := map[string]interface{}{
 		"task.id":          failure.ID,
+		"task.reason":      failure.Reason,
+		"task.message":     failure.Message,
 		"timings.lifetime": failure.Finished.Sub(failure.Started).String(),
 		"timings.started":  failure.Started.Format(time.RFC3339),
 		"timings.finished": failure.Finished.Format(time.RFC3339),
@@ -87,17 +133,79 @@ func (s *sentryReporter) Report(failure complainer.Failure, config ConfigProvide
 
 		Message: fmt.Sprintf("Task %s died with status %s", failure.Name, failure.State),
 
+		Level: raven.Severity(level),
+
+		Fingerprint: fingerprint,
+
 		Tags: raven.Tags{
 			{
 				Key:   "task_state",
 				Value: failure.State,
 			},
+			{
+				Key:   "framework",
+				Value: failure.Framework,
+			},
+			{
+				Key:   "complainer",
+				Value: failure.Complainer,
+			},
 		},
 
 		Extra: extra,
 	}
 
+	if failure.Reason != "" {
+		packet.Tags = append(packet.Tags, raven.Tag{
+			Key:   "task_reason",
+			Value: failure.Reason,
+		})
+	}
+
 	_, ch := client.Capture(packet, nil)
 
-	return <-ch
+	// Raven has no cancellation, the event is still sent in background
+	select {
+	case err := <-ch:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// renderFingerprint renders the comma separated fingerprint template,
+// nil fingerprint means default grouping of sentry
+func (s *sentryReporter) renderFingerprint(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) ([]string, error) {
+	format := configWithFallback(config, "fingerprint", s.fingerprint)
+	if format == "" {
+		return nil, nil
+	}
+
+	rendered, err := fillTemplate(failure, config, stdoutURL, stderrURL, format)
+	if err != nil {
+		return nil, err
+	}
+
+	var fingerprint []string
+	for _, part := range strings.Split(rendered, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			fingerprint = append(fingerprint, part)
+		}
+	}
+
+	return fingerprint, nil
+}
+
+// sentryHTTPClient returns the client for sentry, trusting root certificates
+// bundled with raven like its own transport does, for hosts without them
+func sentryHTTPClient() *http.Client {
+	rootCAs, err := gocertifi.CACerts()
+	if err != nil {
+		return httpclient.Client(httpclient.Reporters)
+	}
+
+	transport := httpclient.NewTransport(httpclient.Reporters)
+	transport.TLSClientConfig = &tls.Config{RootCAs: rootCAs}
+
+	return &http.Client{Transport: httpclient.WithUserAgent(transport)}
 }
@@ -1,26 +1,51 @@
 package reporter
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/cloudflare/complainer"
 	"github.com/cloudflare/complainer/flags"
 )
 
+// slackAPIURL is the base url of Slack Web API
+var slackAPIURL = "https://slack.com/api"
+
+const (
+	slackMaxBlocks      = 50
+	slackMaxSectionText = 3000
+	slackMaxFieldText   = 2000
+	slackMaxPlainText   = 75
+	slackDefaultBlocks  = `[{"type":"section","text":{"type":"mrkdwn","text":{{ json (printf "Task *%s* (%s) died with status %s" .failure.Name .failure.ID .failure.State) }}}},` +
+		`{"type":"context","elements":[{"type":"mrkdwn","text":{{ json (printf "Framework %s on %s" .failure.Framework .failure.Slave) }}}]},` +
+		`{"type":"actions","elements":[{"type":"button","text":{"type":"plain_text","text":"stdout"},"url":{{ json .stdoutURL }}},` +
+		`{"type":"button","text":{"type":"plain_text","text":"stderr"},"url":{{ json .stderrURL }}}]}]`
+)
+
 func init() {
 	var (
-		hookURL   *string
-		username  *string
-		channel   *string
-		iconEmoji *string
-		iconURL   *string
-		format    *string
+		hookURL       *string
+		username      *string
+		channel       *string
+		iconEmoji     *string
+		iconURL       *string
+		format        *string
+		token         *string
+		thread        *string
+		threadWindow  *time.Duration
+		layout        *string
+		blocks        *string
+		resolveFormat *string
 	)
 
-	registerMaker("slack", Maker{
+	RegisterReporter("slack", Maker{
 		RegisterFlags: func() {
 			hookURL = flags.String("slack.hook_url", "SLACK_HOOK_URL", "", "default slack webhook url")
 			username = flags.String("slack.username", "SLACK_USERNAME", "", "default slack username")
@@ -28,49 +53,119 @@ func init() {
 			iconEmoji = flags.String("slack.icon_emoji", "SLACK_ICON_EMOJI", "", "default slack user icon emoji")
 			iconURL = flags.String("slack.icon_url", "SLACK_ICON_URL", "", "default slack user icon url")
 			format = flags.String("slack.format", "SLACK_FORMAT", "Task {{ .failure.Name }} ({{ .failure.ID }}) died with status {{ .failure.State }} [<{{ .stdoutURL }}|stdout>, <{{ .stderrURL }}|stderr>]", "log format")
+			token = flags.String("slack.token", "SLACK_TOKEN", "", "default slack web api token, needed for threads")
+			thread = flags.String("slack.thread", "SLACK_THREAD", "false", "whether to post repeated failures of tasks as thread replies")
+			threadWindow = flags.Duration("slack.thread_window", "SLACK_THREAD_WINDOW", time.Hour, "how long repeated failures are posted into the thread")
+			layout = flags.String("slack.layout", "SLACK_LAYOUT", "text", "message layout: text or blocks")
+			blocks = flags.String("slack.blocks", "SLACK_BLOCKS", slackDefaultBlocks, "block kit template producing json array of blocks")
+			resolveFormat = flags.String("slack.resolve_format", "SLACK_RESOLVE_FORMAT", "Task {{ .failure.Name }} ({{ .failure.ID }}) recovered", "resolution message format")
 		},
 
 		Make: func() (Reporter, error) {
-			return newSlackReporter(*hookURL, *username, *channel, *iconEmoji, *iconURL, *format)
+			return newSlackReporter(slackConfig{
+				hookURL:       *hookURL,
+				username:      *username,
+				channel:       *channel,
+				iconEmoji:     *iconEmoji,
+				iconURL:       *iconURL,
+				format:        *format,
+				token:         *token,
+				thread:        *thread,
+				threadWindow:  *threadWindow,
+				layout:        *layout,
+				blocks:        *blocks,
+				resolveFormat: *resolveFormat,
+			})
 		},
 	})
 }
 
 type slackReporter struct {
-	hookURL   *url.URL
-	channel   string
-	username  string
-	iconEmoji string
-	iconURL   string
-	format    string
+	httpRetryable
+
+	hookURL       *url.URL
+	channel       string
+	username      string
+	iconEmoji     string
+	iconURL       string
+	format        string
+	token         string
+	thread        string
+	threadWindow  time.Duration
+	layout        string
+	blocks        string
+	threads       map[string]slackThread
+	mu            sync.Mutex
+	resolveFormat string
+}
+
+type slackConfig struct {
+	hookURL       string
+	username      string
+	channel       string
+	iconEmoji     string
+	iconURL       string
+	format        string
+	token         string
+	thread        string
+	threadWindow  time.Duration
+	layout        string
+	blocks        string
+	resolveFormat string
 }
 
 type slackMessage struct {
-	Channel   string `json:"channel"`
-	Username  string `json:"username"`
-	Text      string `json:"text"`
-	IconEmoji string `json:"icon_emoji"`
-	IconURL   string `json:"icon_url"`
+	Channel   string                   `json:"channel"`
+	Username  string                   `json:"username"`
+	Text      string                   `json:"text"`
+	IconEmoji string                   `json:"icon_emoji"`
+	IconURL   string                   `json:"icon_url"`
+	ThreadTS  string                   `json:"thread_ts,omitempty"`
+	Blocks    []map[string]interface{} `json:"blocks,omitempty"`
 }
 
-func newSlackReporter(hookURL, username, channel, iconEmoji, iconURL, format string) (*slackReporter, error) {
-	u, err := url.Parse(hookURL)
-	if err != nil {
-		return nil, err
+// slackThread is the parent message of the thread for repeated failures
+type slackThread struct {
+	ts      string
+	started time.Time
+}
+
+type slackAPIResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+	TS    string `json:"ts"`
+}
+
+func newSlackReporter(c slackConfig) (*slackReporter, error) {
+	var u *url.URL
+	if c.hookURL != "" {
+		parsed, err := url.Parse(c.hookURL)
+		if err != nil {
+			return nil, err
+		}
+
+		u = parsed
 	}
 
 	return &slackReporter{
-		hookURL:   u,
-		username:  username,
-		channel:   channel,
-		iconEmoji: iconEmoji,
-		iconURL:   iconURL,
-		format:    format,
+		hookURL:       u,
+		username:      c.username,
+		channel:       c.channel,
+		iconEmoji:     c.iconEmoji,
+		iconURL:       c.iconURL,
+		format:        c.format,
+		token:         c.token,
+		thread:        c.thread,
+		threadWindow:  c.threadWindow,
+		layout:        c.layout,
+		blocks:        c.blocks,
+		threads:       map[string]slackThread{},
+		resolveFormat: c.resolveFormat,
 	}, nil
 }
 
-func (s *slackReporter) Report(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
-	text, err := fillTemplate(failure, config, stdoutURL, stderrURL, s.format)
+func (s *slackReporter) Report(ctx context.Context, failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
+	text, err := fillMessage(failure, config, stdoutURL, stderrURL, s.format)
 	if err != nil {
 		return err
 	}
@@ -79,8 +174,93 @@ func (s *slackReporter) Report(failure complainer.Failure, config ConfigProvider
 		Text: text,
 	}
 
+	// Fill and overwrite configuration values
+	s.fillConfigValues(m, config)
+
+	// Text is still sent with blocks to be used in notifications
+	if configWithFallback(config, "layout", s.layout) == "blocks" {
+		m.Blocks, err = s.renderBlocks(failure, config, stdoutURL, stderrURL)
+		if err != nil {
+			return err
+		}
+	}
+
+	return eachSlackChannel(m, func(m *slackMessage) error {
+		// Threads are only possible with Web API, incoming webhooks
+		// do not return timestamps of posted messages
+		if configWithFallback(config, "thread", s.thread) == "true" {
+			if token := configWithFallback(config, "token", s.token); token != "" && m.Channel != "" {
+				return s.postThreaded(ctx, failure, token, m)
+			}
+		}
+
+		return s.postHook(ctx, config, m)
+	})
+}
+
+// slackChannelsError combines errors of posting to several channels
+type slackChannelsError struct {
+	failed []string
+	errs   []error
+	posted int
+}
+
+func (e *slackChannelsError) Error() string {
+	messages := []string{}
+	for i, channel := range e.failed {
+		messages = append(messages, fmt.Sprintf("%s: %s", channel, e.errs[i]))
+	}
+
+	return fmt.Sprintf("cannot post to %d of %d slack channels: %s", len(e.failed), len(e.failed)+e.posted, strings.Join(messages, "; "))
+}
+
+// eachSlackChannel posts the message with post to every channel of the
+// comma separated list in the message channel, combining errors
+func eachSlackChannel(m *slackMessage, post func(*slackMessage) error) error {
+	if !strings.Contains(m.Channel, ",") {
+		return post(m)
+	}
+
+	e := &slackChannelsError{}
+	for _, channel := range strings.Split(m.Channel, ",") {
+		if channel = strings.TrimSpace(channel); channel == "" {
+			continue
+		}
+
+		copied := *m
+		copied.Channel = channel
+
+		if err := post(&copied); err != nil {
+			e.failed = append(e.failed, channel)
+			e.errs = append(e.errs, err)
+			continue
+		}
+
+		e.posted++
+	}
+
+	if len(e.errs) > 0 {
+		return e
+	}
+
+	return nil
+}
+
+// Retryable retries posting to several channels only if none of them got
+// the message, so channels that got it do not get it again on retry
+func (s *slackReporter) Retryable(err error) bool {
+	if e, ok := err.(*slackChannelsError); ok {
+		return e.posted == 0 && s.httpRetryable.Retryable(e.errs[0])
+	}
+
+	return s.httpRetryable.Retryable(err)
+}
+
+// postHook posts the message with the incoming webhook
+func (s *slackReporter) postHook(ctx context.Context, config ConfigProvider, m *slackMessage) error {
 	var hookURL *url.URL
 	if u := config("hook_url"); len(u) > 0 {
+		var err error
 		hookURL, err = url.Parse(u)
 		if err != nil {
 			return err
@@ -99,25 +279,192 @@ func (s *slackReporter) Report(failure complainer.Failure, config ConfigProvider
 		return nil
 	}
 
-	// Fill and overwrite configuration values
-	s.fillConfigValues(m, config)
+	// Webhooks answer errors like channel_not_found with non-2xx status
+	return postJSON(ctx, hookURL.String(), m)
+}
 
-	jsonMessage, err := json.Marshal(m)
+// renderBlocks renders block kit template and cuts blocks
+// to fit into slack limits, so messages are not rejected
+func (s *slackReporter) renderBlocks(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) ([]map[string]interface{}, error) {
+	rendered, err := fillTemplate(failure, config, stdoutURL, stderrURL, configWithFallback(config, "blocks", s.blocks))
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := []map[string]interface{}{}
+	if err = json.Unmarshal([]byte(rendered), &blocks); err != nil {
+		return nil, fmt.Errorf("cannot decode slack blocks: %s", err)
+	}
+
+	if len(blocks) > slackMaxBlocks {
+		blocks = blocks[:slackMaxBlocks]
+	}
+
+	for _, block := range blocks {
+		truncateSlackText(block["text"], slackMaxSectionText)
+
+		if fields, ok := block["fields"].([]interface{}); ok {
+			for _, field := range fields {
+				truncateSlackText(field, slackMaxFieldText)
+			}
+		}
+
+		if elements, ok := block["elements"].([]interface{}); ok {
+			for _, element := range elements {
+				truncateSlackText(element, slackMaxSectionText)
+
+				if e, ok := element.(map[string]interface{}); ok {
+					truncateSlackText(e["text"], slackMaxPlainText)
+				}
+			}
+		}
+	}
+
+	return blocks, nil
+}
+
+// truncateSlackText cuts text of the text object if it is too long
+func truncateSlackText(object interface{}, max int) {
+	o, ok := object.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	if text, ok := o["text"].(string); ok {
+		o["text"] = truncate(text, max)
+	}
+}
+
+// postThreaded posts the message with Web API, replying in the thread
+// of the previous failure of the same task if it was recent enough
+func (s *slackReporter) postThreaded(ctx context.Context, failure complainer.Failure, token string, m *slackMessage) error {
+	key := m.Channel + "/" + failure.Name
+	now := time.Now()
+
+	s.mu.Lock()
+	for k, thread := range s.threads {
+		if now.Sub(thread.started) > s.threadWindow {
+			delete(s.threads, k)
+		}
+	}
+
+	if thread, ok := s.threads[key]; ok {
+		m.ThreadTS = thread.ts
+	}
+	s.mu.Unlock()
+
+	ts, err := postSlackMessage(ctx, token, m)
 	if err != nil {
 		return err
 	}
 
-	body := bytes.NewReader(jsonMessage)
-	resp, err := http.Post(hookURL.String(), "application/json", body)
+	if m.ThreadTS == "" {
+		s.mu.Lock()
+		s.threads[key] = slackThread{ts: ts, started: now}
+		s.mu.Unlock()
+	}
+
+	return nil
+}
+
+// Validate checks that the instance can post messages,
+// the token is checked with auth.test method of Web API
+func (s *slackReporter) Validate(ctx context.Context, config ConfigProvider) error {
+	hookURL := config("hook_url")
+	if hookURL == "" && s.hookURL != nil {
+		hookURL = s.hookURL.String()
+	}
+
+	token := configWithFallback(config, "token", s.token)
+
+	if hookURL == "" && token == "" {
+		return errors.New("neither slack hook url nor token is set")
+	}
+
+	if hookURL != "" {
+		if u, err := url.Parse(hookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid slack hook url: %q", hookURL)
+		}
+	}
+
+	if token == "" {
+		return nil
+	}
+
+	body, err := sendJSON(ctx, http.MethodPost, slackAPIURL+"/auth.test", map[string]string{"Authorization": "Bearer " + token}, struct{}{})
 	if err != nil {
-		defer func() {
-			if resp != nil {
-				_ = resp.Body.Close()
-			}
-		}()
+		return err
+	}
+
+	resp := slackAPIResponse{}
+	if err = json.Unmarshal(body, &resp); err != nil {
+		return err
+	}
+
+	if !resp.OK {
+		return fmt.Errorf("slack api error: %s", resp.Error)
+	}
+
+	return nil
+}
+
+// postSlackMessage posts the message with Web API, returning its timestamp
+func postSlackMessage(ctx context.Context, token string, m *slackMessage) (string, error) {
+	headers := map[string]string{
+		"Authorization": "Bearer " + token,
+	}
+
+	body, err := sendJSON(ctx, http.MethodPost, slackAPIURL+"/chat.postMessage", headers, m)
+	if err != nil {
+		return "", err
+	}
+
+	resp := slackAPIResponse{}
+	if err = json.Unmarshal(body, &resp); err != nil {
+		return "", err
+	}
+
+	if !resp.OK {
+		return "", fmt.Errorf("slack api error: %s", resp.Error)
 	}
 
-	return err
+	return resp.TS, nil
+}
+
+// Resolve posts the resolution message, as a reply in the thread
+// of the failure if threads are enabled and the thread is known
+func (s *slackReporter) Resolve(ctx context.Context, failure complainer.Failure, config ConfigProvider) error {
+	text, err := fillTemplate(failure, config, "", "", configWithFallback(config, "resolve_format", s.resolveFormat))
+	if err != nil {
+		return err
+	}
+
+	m := &slackMessage{
+		Text: text,
+	}
+
+	s.fillConfigValues(m, config)
+
+	return eachSlackChannel(m, func(m *slackMessage) error {
+		if configWithFallback(config, "thread", s.thread) == "true" {
+			if token := configWithFallback(config, "token", s.token); token != "" && m.Channel != "" {
+				key := m.Channel + "/" + failure.Name
+
+				// The next failure starts a new thread
+				s.mu.Lock()
+				if thread, ok := s.threads[key]; ok {
+					m.ThreadTS = thread.ts
+					delete(s.threads, key)
+				}
+				s.mu.Unlock()
+
+				_, err := postSlackMessage(ctx, token, m)
+				return err
+			}
+		}
+
+		return s.postHook(ctx, config, m)
+	})
 }
 
 func (s *slackReporter) fillConfigValues(m *slackMessage, config ConfigProvider) {
@@ -149,3 +496,31 @@ func (s *slackReporter) fillConfigValues(m *slackMessage, config ConfigProvider)
 		m.IconURL = s.iconURL
 	}
 }
+
+// Preview renders the message without sending it
+func (s *slackReporter) Preview(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) (string, error) {
+	return fillMessage(failure, config, stdoutURL, stderrURL, s.format)
+}
+
+// DedupKey returns the hook or the api token with the channel
+func (s *slackReporter) DedupKey(config ConfigProvider) string {
+	m := &slackMessage{}
+	s.fillConfigValues(m, config)
+
+	if configWithFallback(config, "thread", s.thread) == "true" {
+		if token := configWithFallback(config, "token", s.token); token != "" && m.Channel != "" {
+			return token + "|" + m.Channel
+		}
+	}
+
+	hookURL := config("hook_url")
+	if hookURL == "" && s.hookURL != nil {
+		hookURL = s.hookURL.String()
+	}
+
+	if hookURL == "" {
+		return ""
+	}
+
+	return hookURL + "|" + m.Channel
+}
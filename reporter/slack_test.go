@@ -0,0 +1,459 @@
+package reporter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestSlackThreads(t *testing.T) {
+	var posted []slackMessage
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat.postMessage" || r.Header.Get("Authorization") != "Bearer xoxb-token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		m := slackMessage{}
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		posted = append(posted, m)
+
+		_ = json.NewEncoder(w).Encode(slackAPIResponse{OK: true, TS: strconv.Itoa(len(posted))})
+	}))
+	defer api.Close()
+
+	defer func(u string) {
+		slackAPIURL = u
+	}(slackAPIURL)
+	slackAPIURL = api.URL
+
+	s, err := newSlackReporter(slackConfig{
+		channel:      "#mesos",
+		format:       "{{ .failure.ID }}",
+		token:        "xoxb-token",
+		thread:       "true",
+		threadWindow: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := func(string) string {
+		return ""
+	}
+
+	for _, failure := range []complainer.Failure{
+		{ID: "web.1", Name: "web"},
+		{ID: "web.2", Name: "web"},
+		{ID: "worker.1", Name: "worker"},
+		{ID: "web.3", Name: "web"},
+	} {
+		if err := s.Report(context.Background(), failure, config, "", ""); err != nil {
+			t.Fatalf("error reporting %s: %s", failure.ID, err)
+		}
+	}
+
+	expected := []slackMessage{
+		{Channel: "#mesos", Text: "web.1"},
+		{Channel: "#mesos", Text: "web.2", ThreadTS: "1"},
+		{Channel: "#mesos", Text: "worker.1"},
+		{Channel: "#mesos", Text: "web.3", ThreadTS: "1"},
+	}
+
+	if len(posted) != len(expected) {
+		t.Fatalf("expected %d messages, got %d: %+v", len(expected), len(posted), posted)
+	}
+
+	for i, m := range expected {
+		if !reflect.DeepEqual(posted[i], m) {
+			t.Errorf("unexpected message #%d; expected: %+v, got: %+v", i, m, posted[i])
+		}
+	}
+}
+
+func TestSlackChannels(t *testing.T) {
+	var posted []slackMessage
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := slackMessage{}
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if m.Channel == "#down" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		posted = append(posted, m)
+
+		_ = json.NewEncoder(w).Encode(slackAPIResponse{OK: true, TS: strconv.Itoa(len(posted))})
+	}))
+	defer api.Close()
+
+	defer func(u string) {
+		slackAPIURL = u
+	}(slackAPIURL)
+	slackAPIURL = api.URL
+
+	s, err := newSlackReporter(slackConfig{
+		format:       "{{ .failure.ID }}",
+		token:        "xoxb-token",
+		thread:       "true",
+		threadWindow: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channels := "#mesos, #ops"
+	config := func(key string) string {
+		if key == "channel" {
+			return channels
+		}
+
+		return ""
+	}
+
+	for _, id := range []string{"web.1", "web.2"} {
+		if err = s.Report(context.Background(), complainer.Failure{ID: id, Name: "web"}, config, "", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Every channel has its own thread
+	expected := []slackMessage{
+		{Channel: "#mesos", Text: "web.1"},
+		{Channel: "#ops", Text: "web.1"},
+		{Channel: "#mesos", Text: "web.2", ThreadTS: "1"},
+		{Channel: "#ops", Text: "web.2", ThreadTS: "2"},
+	}
+
+	if !reflect.DeepEqual(posted, expected) {
+		t.Errorf("unexpected messages; expected: %+v, got: %+v", expected, posted)
+	}
+
+	for _, row := range []struct {
+		channels  string
+		retryable bool
+	}{
+		{channels: "#mesos,#down", retryable: false},
+		{channels: "#down,#down", retryable: true},
+	} {
+		channels = row.channels
+
+		err = s.Report(context.Background(), complainer.Failure{ID: "worker.1", Name: "worker"}, config, "", "")
+		if err == nil || !strings.Contains(err.Error(), "#down") {
+			t.Errorf("expected error for #down channel in %s, got: %v", row.channels, err)
+			continue
+		}
+
+		if s.Retryable(err) != row.retryable {
+			t.Errorf("unexpected retryable for %s; expected: %v, got: %v", row.channels, row.retryable, s.Retryable(err))
+		}
+	}
+}
+
+func TestSlackHookChannels(t *testing.T) {
+	var posted []string
+
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := slackMessage{}
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch m.Channel {
+		case "#gone":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("channel_not_found"))
+			return
+		case "#down":
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		posted = append(posted, m.Channel)
+
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer hook.Close()
+
+	s, err := newSlackReporter(slackConfig{format: "{{ .failure.ID }}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, row := range []struct {
+		channels  string
+		posted    []string
+		failed    string
+		retryable bool
+	}{
+		{channels: "#mesos,#ops", posted: []string{"#mesos", "#ops"}},
+		{channels: "#mesos,#gone", posted: []string{"#mesos"}, failed: "channel_not_found"},
+		{channels: "#gone", failed: "channel_not_found"},
+		{channels: "#down,#down", failed: "#down", retryable: true},
+	} {
+		posted = nil
+
+		config := func(key string) string {
+			switch key {
+			case "hook_url":
+				return hook.URL
+			case "channel":
+				return row.channels
+			}
+
+			return ""
+		}
+
+		err = s.Report(context.Background(), complainer.Failure{ID: "web.1", Name: "web"}, config, "", "")
+
+		if !reflect.DeepEqual(posted, row.posted) {
+			t.Errorf("unexpected channels posted to for %s; expected: %v, got: %v", row.channels, row.posted, posted)
+		}
+
+		if row.failed == "" {
+			if err != nil {
+				t.Errorf("unexpected error for %s: %s", row.channels, err)
+			}
+
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), row.failed) {
+			t.Errorf("expected error with %q for %s, got: %v", row.failed, row.channels, err)
+			continue
+		}
+
+		if s.Retryable(err) != row.retryable {
+			t.Errorf("unexpected retryable for %s; expected: %v, got: %v", row.channels, row.retryable, s.Retryable(err))
+		}
+	}
+}
+
+func TestSlackResolve(t *testing.T) {
+	var posted []slackMessage
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := slackMessage{}
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		posted = append(posted, m)
+
+		_ = json.NewEncoder(w).Encode(slackAPIResponse{OK: true, TS: strconv.Itoa(len(posted))})
+	}))
+	defer api.Close()
+
+	defer func(u string) {
+		slackAPIURL = u
+	}(slackAPIURL)
+	slackAPIURL = api.URL
+
+	s, err := newSlackReporter(slackConfig{
+		channel:       "#mesos",
+		format:        "{{ .failure.ID }}",
+		token:         "xoxb-token",
+		thread:        "true",
+		threadWindow:  time.Hour,
+		resolveFormat: "{{ .failure.ID }} recovered",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := func(string) string {
+		return ""
+	}
+
+	failure := complainer.Failure{ID: "web.1", Name: "web"}
+
+	if err = s.Report(context.Background(), failure, config, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Resolve(context.Background(), failure, config); err != nil {
+		t.Fatal(err)
+	}
+
+	// Failure after resolution starts a new thread
+	if err = s.Report(context.Background(), complainer.Failure{ID: "web.2", Name: "web"}, config, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []slackMessage{
+		{Channel: "#mesos", Text: "web.1"},
+		{Channel: "#mesos", Text: "web.1 recovered", ThreadTS: "1"},
+		{Channel: "#mesos", Text: "web.2"},
+	}
+
+	if !reflect.DeepEqual(posted, expected) {
+		t.Errorf("unexpected messages; expected: %+v, got: %+v", expected, posted)
+	}
+
+	// Without threads resolution is posted with the webhook
+	var hooked []slackMessage
+
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := slackMessage{}
+		_ = json.NewDecoder(r.Body).Decode(&m)
+		hooked = append(hooked, m)
+	}))
+	defer hook.Close()
+
+	s, err = newSlackReporter(slackConfig{hookURL: hook.URL, resolveFormat: "{{ .failure.Name }} recovered"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Resolve(context.Background(), failure, config); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hooked) != 1 || hooked[0].Text != "web recovered" {
+		t.Errorf("unexpected webhook messages: %+v", hooked)
+	}
+}
+
+func TestSlackBlocks(t *testing.T) {
+	s, err := newSlackReporter(slackConfig{
+		format: "{{ .failure.ID }}",
+		layout: "blocks",
+		blocks: slackDefaultBlocks,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := func(key string) string {
+		if key == "blocks" {
+			return `[{"type":"section","text":{"type":"mrkdwn","text":{{ json .failure.Message }}}}]`
+		}
+
+		return ""
+	}
+
+	failure := complainer.Failure{ID: "web.1", Name: "web", Message: strings.Repeat("x", slackMaxSectionText*2)}
+
+	blocks, err := s.renderBlocks(failure, config, "https://logs/stdout", "https://logs/stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := blocks[0]["text"].(map[string]interface{})["text"].(string)
+	if len(text) > slackMaxSectionText {
+		t.Errorf("expected section text to be truncated to %d bytes, got %d", slackMaxSectionText, len(text))
+	}
+
+	blocks, err = s.renderBlocks(failure, func(string) string { return "" }, "https://logs/stdout", "https://logs/stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(blocks) != 3 || blocks[2]["type"] != "actions" {
+		t.Errorf("unexpected default blocks: %+v", blocks)
+	}
+}
+
+func TestSlackDedupKey(t *testing.T) {
+	s, err := newSlackReporter(slackConfig{hookURL: "https://hooks.slack.com/default", channel: "#ops", token: "xoxb"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := []struct {
+		config   map[string]string
+		expected string
+	}{
+		{config: map[string]string{}, expected: "https://hooks.slack.com/default|#ops"},
+		{config: map[string]string{"channel": "#dev"}, expected: "https://hooks.slack.com/default|#dev"},
+		{config: map[string]string{"hook_url": "https://hooks.slack.com/other"}, expected: "https://hooks.slack.com/other|#ops"},
+		{config: map[string]string{"thread": "true"}, expected: "xoxb|#ops"},
+	}
+
+	for _, row := range table {
+		config := func(key string) string {
+			return row.config[key]
+		}
+
+		if key := s.DedupKey(config); key != row.expected {
+			t.Errorf("unexpected dedup key for %v; expected: %s, got: %s", row.config, row.expected, key)
+		}
+	}
+
+	unconfigured, err := newSlackReporter(slackConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if key := unconfigured.DedupKey(func(string) string { return "" }); key != "" {
+		t.Errorf("expected empty dedup key without destination, got: %s", key)
+	}
+}
+
+func TestSlackValidate(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/auth.test" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer xoxb-token" {
+			_ = json.NewEncoder(w).Encode(slackAPIResponse{Error: "invalid_auth"})
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(slackAPIResponse{OK: true})
+	}))
+	defer api.Close()
+
+	defer func(u string) {
+		slackAPIURL = u
+	}(slackAPIURL)
+	slackAPIURL = api.URL
+
+	s, err := newSlackReporter(slackConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := []struct {
+		labels map[string]string
+		err    bool
+	}{
+		{labels: map[string]string{}, err: true},
+		{labels: map[string]string{"hook_url": "https://hooks.slack.com/services/T/B/X"}},
+		{labels: map[string]string{"hook_url": "hooks.slack.com"}, err: true},
+		{labels: map[string]string{"token": "xoxb-token"}},
+		{labels: map[string]string{"token": "xoxb-revoked"}, err: true},
+	}
+
+	for i, row := range table {
+		config := func(key string) string {
+			return row.labels[key]
+		}
+
+		if err := s.Validate(context.Background(), config); (err != nil) != row.err {
+			t.Errorf("row %d: unexpected validation result: %v", i, err)
+		}
+	}
+}
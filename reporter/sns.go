@@ -0,0 +1,203 @@
+package reporter
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+	"github.com/cloudflare/complainer/httpclient"
+)
+
+// snsMaxSubjectLength is the limit imposed by SNS on email subjects
+const snsMaxSubjectLength = 100
+
+func init() {
+	var (
+		accessKey *string
+		secretKey *string
+		region    *string
+		endpoint  *string
+		topicARN  *string
+		subject   *string
+		format    *string
+	)
+
+	RegisterReporter("sns", Maker{
+		RegisterFlags: func() {
+			accessKey = flags.String("sns.access_key", "SNS_ACCESS_KEY", "", "access key for sns, default aws credential chain is used if empty")
+			secretKey = flags.String("sns.secret_key", "SNS_SECRET_KEY", "", "secret key for sns")
+			region = flags.String("sns.region", "SNS_REGION", "", "default sns region, taken from topic arn if empty")
+			endpoint = flags.String("sns.endpoint", "SNS_ENDPOINT", "", "sns endpoint for sns compatible apis")
+			topicARN = flags.String("sns.topic_arn", "SNS_TOPIC_ARN", "", "default sns topic arn")
+			subject = flags.String("sns.subject", "SNS_SUBJECT", "Task {{ .failure.Name }} died with status {{ .failure.State }}", "subject format for email subscriptions")
+			format = flags.String("sns.format", "SNS_FORMAT", "Task {{ .failure.Name }} ({{ .failure.ID }}) died with status {{ .failure.State }}:{{ .nl }}  * {{ .stdoutURL }}{{ .nl }}  * {{ .stderrURL }}{{ .nl }}", "message format")
+		},
+
+		Make: func() (Reporter, error) {
+			return newSNSReporter(snsConfig{
+				accessKey: *accessKey,
+				secretKey: *secretKey,
+				region:    *region,
+				endpoint:  *endpoint,
+				topicARN:  *topicARN,
+				subject:   *subject,
+				format:    *format,
+			}), nil
+		},
+	})
+}
+
+type snsReporter struct {
+	config snsConfig
+
+	mutex   sync.Mutex
+	clients map[string]*sns.SNS
+}
+
+type snsConfig struct {
+	accessKey string
+	secretKey string
+	region    string
+	endpoint  string
+	topicARN  string
+	subject   string
+	format    string
+}
+
+func newSNSReporter(config snsConfig) *snsReporter {
+	return &snsReporter{
+		config:  config,
+		clients: map[string]*sns.SNS{},
+	}
+}
+
+func (s *snsReporter) Report(ctx context.Context, failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
+	topicARN := configWithFallback(config, "topic_arn", s.config.topicARN)
+	if topicARN == "" {
+		return nil
+	}
+
+	region := configWithFallback(config, "region", s.config.region)
+	if region == "" {
+		region = snsRegionFromARN(topicARN)
+	}
+
+	subject, err := fillTemplate(failure, config, stdoutURL, stderrURL, configWithFallback(config, "subject", s.config.subject))
+	if err != nil {
+		return err
+	}
+
+	message, err := fillMessage(failure, config, stdoutURL, stderrURL, configWithFallback(config, "format", s.config.format))
+	if err != nil {
+		return err
+	}
+
+	// Attributes allow subscriptions to filter, empty values are rejected
+	attributes := map[string]*sns.MessageAttributeValue{}
+	for name, value := range map[string]string{"framework": failure.Framework, "host": failure.Slave} {
+		if value != "" {
+			attributes[name] = &sns.MessageAttributeValue{
+				DataType:    aws.String("String"),
+				StringValue: aws.String(value),
+			}
+		}
+	}
+
+	input := &sns.PublishInput{
+		TopicArn:          aws.String(topicARN),
+		Message:           aws.String(message),
+		MessageAttributes: attributes,
+	}
+
+	if subject = snsSubject(subject); subject != "" {
+		input.Subject = aws.String(subject)
+	}
+
+	req, _ := s.client(region).PublishRequest(input)
+	req.HTTPRequest = req.HTTPRequest.WithContext(ctx)
+
+	return req.Send()
+}
+
+// Retryable tells if publishing should be retried: throttling
+// and server errors are retried, other request errors are not
+func (s *snsReporter) Retryable(err error) bool {
+	if re, ok := err.(awserr.RequestFailure); ok {
+		return re.StatusCode() == http.StatusTooManyRequests || re.StatusCode() >= http.StatusInternalServerError || re.Code() == "Throttling"
+	}
+
+	return true
+}
+
+// client returns sns client for the region, creating it if needed
+func (s *snsReporter) client(region string) *sns.SNS {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if client, ok := s.clients[region]; ok {
+		return client
+	}
+
+	config := &aws.Config{
+		Region:     aws.String(region),
+		HTTPClient: httpclient.Client(httpclient.Reporters),
+	}
+
+	// Default credential chain covers env, shared config and instance roles
+	if s.config.accessKey != "" {
+		config.Credentials = credentials.NewStaticCredentials(s.config.accessKey, s.config.secretKey, "")
+	}
+
+	if s.config.endpoint != "" {
+		config.Endpoint = aws.String(s.config.endpoint)
+	}
+
+	client := sns.New(session.New(config))
+	s.clients[region] = client
+
+	return client
+}
+
+// snsRegionFromARN extracts region from arn:aws:sns:region:account:topic
+func snsRegionFromARN(arn string) string {
+	parts := strings.Split(arn, ":")
+	if len(parts) < 6 {
+		return ""
+	}
+
+	return parts[3]
+}
+
+// snsSubject makes subject acceptable for sns: single line
+// of printable ascii characters, no longer than the limit
+func snsSubject(subject string) string {
+	subject = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' || r == '\r' || r == '\t':
+			return ' '
+		case r < ' ' || r > '~':
+			return '?'
+		}
+
+		return r
+	}, strings.TrimSpace(subject))
+
+	if len(subject) > snsMaxSubjectLength {
+		subject = subject[:snsMaxSubjectLength]
+	}
+
+	return subject
+}
+
+// Preview renders the message without sending it
+func (s *snsReporter) Preview(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) (string, error) {
+	return fillMessage(failure, config, stdoutURL, stderrURL, configWithFallback(config, "format", s.config.format))
+}
@@ -0,0 +1,97 @@
+package reporter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestSNSReport(t *testing.T) {
+	forms := make(chan url.Values, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("error parsing form: %s", err)
+		}
+
+		forms <- r.PostForm
+
+		if r.PostForm.Get("TopicArn") == "arn:aws:sns:us-east-1:123456789012:missing" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`<ErrorResponse><Error><Type>Sender</Type><Code>NotFound</Code><Message>Topic does not exist</Message></Error><RequestId>1</RequestId></ErrorResponse>`))
+			return
+		}
+
+		_, _ = w.Write([]byte(`<PublishResponse><PublishResult><MessageId>1</MessageId></PublishResult><ResponseMetadata><RequestId>1</RequestId></ResponseMetadata></PublishResponse>`))
+	}))
+	defer server.Close()
+
+	s := newSNSReporter(snsConfig{
+		accessKey: "access",
+		secretKey: "secret",
+		endpoint:  server.URL,
+		topicARN:  "arn:aws:sns:us-east-1:123456789012:failures",
+		subject:   "Task {{ .failure.Name }} died{{ .nl }}",
+		format:    "{{ .failure.ID }} {{ .stderrURL }}",
+	})
+
+	failure := complainer.Failure{ID: "web.1", Name: "web", Framework: "marathon"}
+
+	if err := s.Report(context.Background(), failure, func(string) string { return "" }, "http://stdout", "http://stderr"); err != nil {
+		t.Fatalf("error reporting: %s", err)
+	}
+
+	form := <-forms
+
+	expected := map[string]string{
+		"Action":                         "Publish",
+		"TopicArn":                       "arn:aws:sns:us-east-1:123456789012:failures",
+		"Subject":                        "Task web died",
+		"Message":                        "web.1 http://stderr",
+		"MessageAttributes.entry.1.Name": "framework",
+		"MessageAttributes.entry.1.Value.StringValue": "marathon",
+	}
+
+	for key, value := range expected {
+		if form.Get(key) != value {
+			t.Errorf("unexpected %s; expected: %q, got: %q", key, value, form.Get(key))
+		}
+	}
+
+	if form.Get("MessageAttributes.entry.2.Name") != "" {
+		t.Errorf("empty host attribute is not expected to be sent")
+	}
+
+	config := func(key string) string {
+		if key == "topic_arn" {
+			return "arn:aws:sns:us-east-1:123456789012:missing"
+		}
+
+		return ""
+	}
+
+	err := s.Report(context.Background(), failure, config, "http://stdout", "http://stderr")
+	<-forms
+
+	if err == nil {
+		t.Fatal("expected error for missing topic")
+	}
+
+	if s.Retryable(err) {
+		t.Errorf("missing topic is not expected to be retryable: %s", err)
+	}
+}
+
+func TestSNSRegionFromARN(t *testing.T) {
+	if region := snsRegionFromARN("arn:aws:sns:eu-west-1:123456789012:failures"); region != "eu-west-1" {
+		t.Errorf("unexpected region: %q", region)
+	}
+
+	if region := snsRegionFromARN("failures"); region != "" {
+		t.Errorf("unexpected region: %q", region)
+	}
+}
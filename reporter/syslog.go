@@ -0,0 +1,175 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package reporter
+
+import (
+	"context"
+	"fmt"
+	"log/syslog"
+	"strings"
+	"sync"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+)
+
+var syslogFacilities = map[string]syslog.Priority{
+	"kern":     syslog.LOG_KERN,
+	"user":     syslog.LOG_USER,
+	"mail":     syslog.LOG_MAIL,
+	"daemon":   syslog.LOG_DAEMON,
+	"auth":     syslog.LOG_AUTH,
+	"syslog":   syslog.LOG_SYSLOG,
+	"lpr":      syslog.LOG_LPR,
+	"news":     syslog.LOG_NEWS,
+	"uucp":     syslog.LOG_UUCP,
+	"cron":     syslog.LOG_CRON,
+	"authpriv": syslog.LOG_AUTHPRIV,
+	"ftp":      syslog.LOG_FTP,
+	"local0":   syslog.LOG_LOCAL0,
+	"local1":   syslog.LOG_LOCAL1,
+	"local2":   syslog.LOG_LOCAL2,
+	"local3":   syslog.LOG_LOCAL3,
+	"local4":   syslog.LOG_LOCAL4,
+	"local5":   syslog.LOG_LOCAL5,
+	"local6":   syslog.LOG_LOCAL6,
+	"local7":   syslog.LOG_LOCAL7,
+}
+
+var syslogSeverities = map[string]syslog.Priority{
+	"emerg":   syslog.LOG_EMERG,
+	"alert":   syslog.LOG_ALERT,
+	"crit":    syslog.LOG_CRIT,
+	"err":     syslog.LOG_ERR,
+	"warning": syslog.LOG_WARNING,
+	"notice":  syslog.LOG_NOTICE,
+	"info":    syslog.LOG_INFO,
+	"debug":   syslog.LOG_DEBUG,
+}
+
+func init() {
+	var (
+		network  *string
+		address  *string
+		facility *string
+		severity *string
+		tag      *string
+		format   *string
+	)
+
+	RegisterReporter("syslog", Maker{
+		RegisterFlags: func() {
+			network = flags.String("syslog.network", "SYSLOG_NETWORK", "", "syslog network: udp, tcp or empty for local syslog")
+			address = flags.String("syslog.address", "SYSLOG_ADDRESS", "", "syslog address for udp and tcp (ex: syslog.example.com:514)")
+			facility = flags.String("syslog.facility", "SYSLOG_FACILITY", "daemon", "syslog facility")
+			severity = flags.String("syslog.severity", "SYSLOG_SEVERITY", "err", "syslog severity")
+			tag = flags.String("syslog.tag", "SYSLOG_TAG", "complainer", "syslog tag")
+			format = flags.String("syslog.format", "SYSLOG_FORMAT", `Task {{ .failure.Name }} died with status {{ .failure.State }} task_id={{ .failure.ID }} framework={{ .failure.Framework }} host={{ .failure.Slave }} stdout={{ .stdoutURL }} stderr={{ .stderrURL }}`, "log format")
+		},
+
+		Make: func() (Reporter, error) {
+			return newSyslogReporter(*network, *address, *facility, *severity, *tag, *format)
+		},
+	})
+}
+
+type syslogReporter struct {
+	network  string
+	address  string
+	facility string
+	severity string
+	tag      string
+	format   string
+	writers  map[string]*syslog.Writer
+	mu       sync.Mutex
+}
+
+func newSyslogReporter(network, address, facility, severity, tag, format string) (*syslogReporter, error) {
+	if _, err := syslogPriority(facility, severity); err != nil {
+		return nil, err
+	}
+
+	return &syslogReporter{
+		network:  network,
+		address:  address,
+		facility: facility,
+		severity: severity,
+		tag:      tag,
+		format:   format,
+		writers:  map[string]*syslog.Writer{},
+	}, nil
+}
+
+func (s *syslogReporter) Report(ctx context.Context, failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
+	network := configWithFallback(config, "network", s.network)
+	address := configWithFallback(config, "address", s.address)
+
+	if network != "" && address == "" {
+		return nil
+	}
+
+	priority, err := syslogPriority(configWithFallback(config, "facility", s.facility), configWithFallback(config, "severity", s.severity))
+	if err != nil {
+		return err
+	}
+
+	message, err := fillMessage(failure, config, stdoutURL, stderrURL, configWithFallback(config, "format", s.format))
+	if err != nil {
+		return err
+	}
+
+	// Messages are single lines in syslog
+	message = strings.Replace(message, "\n", " ", -1)
+
+	return s.write(network, address, priority, configWithFallback(config, "tag", s.tag), message)
+}
+
+// write sends the message with the cached connection, reconnecting
+// once if the connection is broken
+func (s *syslogReporter) write(network, address string, priority syslog.Priority, tag, message string) error {
+	key := fmt.Sprintf("%s/%s/%d/%s", network, address, priority, tag)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		writer, ok := s.writers[key]
+		if !ok {
+			var err error
+			writer, err = syslog.Dial(network, address, priority, tag)
+			if err != nil {
+				return err
+			}
+
+			s.writers[key] = writer
+		}
+
+		_, err := writer.Write([]byte(message))
+		if err == nil || attempt > 0 {
+			return err
+		}
+
+		_ = writer.Close()
+		delete(s.writers, key)
+	}
+}
+
+// Preview renders the message without sending it
+func (s *syslogReporter) Preview(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) (string, error) {
+	return fillMessage(failure, config, stdoutURL, stderrURL, configWithFallback(config, "format", s.format))
+}
+
+func syslogPriority(facility, severity string) (syslog.Priority, error) {
+	f, ok := syslogFacilities[facility]
+	if !ok {
+		return 0, fmt.Errorf("invalid syslog facility: %q", facility)
+	}
+
+	s, ok := syslogSeverities[severity]
+	if !ok {
+		return 0, fmt.Errorf("invalid syslog severity: %q", severity)
+	}
+
+	return f | s, nil
+}
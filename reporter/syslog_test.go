@@ -0,0 +1,74 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package reporter
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestSyslog(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	s, err := newSyslogReporter("", "", "local0", "err", "complainer", "Task {{ .failure.Name }} died{{ .nl }}task_id={{ .failure.ID }}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := func(key string) string {
+		switch key {
+		case "network":
+			return "udp"
+		case "address":
+			return conn.LocalAddr().String()
+		}
+
+		return ""
+	}
+
+	if err := s.Report(context.Background(), complainer.Failure{ID: "web.1", Name: "web"}, config, "", ""); err != nil {
+		t.Fatalf("error reporting: %s", err)
+	}
+
+	buf := make([]byte, 1024)
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("error reading syslog message: %s", err)
+	}
+
+	message := string(buf[:n])
+
+	// local0 (16) * 8 + err (3)
+	if !strings.HasPrefix(message, "<131>") {
+		t.Errorf("unexpected priority in message: %q", message)
+	}
+
+	if !strings.HasSuffix(strings.TrimSpace(message), "]: Task web died task_id=web.1") {
+		t.Errorf("unexpected message: %q", message)
+	}
+}
+
+func TestSyslogInvalidPriority(t *testing.T) {
+	if _, err := newSyslogReporter("", "", "nope", "err", "complainer", ""); err == nil {
+		t.Error("expected error for invalid facility")
+	}
+
+	if _, err := newSyslogReporter("", "", "daemon", "nope", "complainer", ""); err == nil {
+		t.Error("expected error for invalid severity")
+	}
+}
@@ -0,0 +1,134 @@
+package reporter
+
+import (
+	"context"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+)
+
+func init() {
+	var (
+		webhookURL *string
+		title      *string
+	)
+
+	RegisterReporter("teams", Maker{
+		RegisterFlags: func() {
+			webhookURL = flags.String("teams.webhook_url", "TEAMS_WEBHOOK_URL", "", "default teams incoming webhook url")
+			title = flags.String("teams.title", "TEAMS_TITLE", "Task {{ .failure.Name }} died with status {{ .failure.State }}", "card title format")
+		},
+
+		Make: func() (Reporter, error) {
+			return newTeamsReporter(*webhookURL, *title), nil
+		},
+	})
+}
+
+type teamsReporter struct {
+	httpRetryable
+
+	webhookURL string
+	title      string
+}
+
+type teamsMessageCard struct {
+	Type            string         `json:"@type"`
+	Context         string         `json:"@context"`
+	ThemeColor      string         `json:"themeColor"`
+	Summary         string         `json:"summary"`
+	Title           string         `json:"title"`
+	Sections        []teamsSection `json:"sections"`
+	PotentialAction []teamsAction  `json:"potentialAction"`
+}
+
+type teamsSection struct {
+	Facts []teamsFact `json:"facts"`
+}
+
+type teamsFact struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type teamsAction struct {
+	Type    string        `json:"@type"`
+	Name    string        `json:"name"`
+	Targets []teamsTarget `json:"targets"`
+}
+
+type teamsTarget struct {
+	OS  string `json:"os"`
+	URI string `json:"uri"`
+}
+
+func newTeamsReporter(webhookURL, title string) *teamsReporter {
+	return &teamsReporter{
+		webhookURL: webhookURL,
+		title:      title,
+	}
+}
+
+func (t *teamsReporter) Report(ctx context.Context, failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
+	webhookURL := config("webhook_url")
+	if webhookURL == "" {
+		webhookURL = t.webhookURL
+	}
+
+	if webhookURL == "" {
+		return nil
+	}
+
+	title, err := fillMessage(failure, config, stdoutURL, stderrURL, t.title)
+	if err != nil {
+		return err
+	}
+
+	card := teamsMessageCard{
+		Type:       "MessageCard",
+		Context:    "http://schema.org/extensions",
+		ThemeColor: "D70000",
+		Summary:    title,
+		Title:      title,
+		Sections: []teamsSection{
+			{
+				Facts: []teamsFact{
+					{Name: "Task ID", Value: failure.ID},
+					{Name: "Framework", Value: failure.Framework},
+					{Name: "Host", Value: failure.Slave},
+					{Name: "Finished", Value: failure.Finished.Format(time.RFC3339)},
+				},
+			},
+		},
+		PotentialAction: []teamsAction{
+			teamsOpenURIAction("stdout", stdoutURL),
+			teamsOpenURIAction("stderr", stderrURL),
+		},
+	}
+
+	return postJSON(ctx, webhookURL, card)
+}
+
+func teamsOpenURIAction(name, uri string) teamsAction {
+	return teamsAction{
+		Type: "OpenUri",
+		Name: name,
+		Targets: []teamsTarget{
+			{
+				OS:  "default",
+				URI: uri,
+			},
+		},
+	}
+}
+
+// Preview renders the message without sending it
+func (t *teamsReporter) Preview(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) (string, error) {
+	return fillMessage(failure, config, stdoutURL, stderrURL, t.title)
+}
+
+// DedupKey returns the webhook url
+func (t *teamsReporter) DedupKey(config ConfigProvider) string {
+	return configWithFallback(config, "webhook_url", t.webhookURL)
+}
@@ -0,0 +1,82 @@
+package reporter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestTeamsReport(t *testing.T) {
+	var card teamsMessageCard
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/webhook" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&card); err != nil {
+			t.Errorf("error decoding card: %s", err)
+		}
+	}))
+	defer server.Close()
+
+	tr := newTeamsReporter(server.URL+"/webhook", "Task {{ .failure.Name }} died with status {{ .failure.State }}")
+
+	finished := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	failure := complainer.Failure{ID: "web.1", Name: "web", Framework: "marathon", Slave: "host1", State: "TASK_FAILED", Finished: finished}
+
+	if err := tr.Report(context.Background(), failure, func(string) string { return "" }, "http://stdout", "http://stderr"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := teamsMessageCard{
+		Type:       "MessageCard",
+		Context:    "http://schema.org/extensions",
+		ThemeColor: "D70000",
+		Summary:    "Task web died with status TASK_FAILED",
+		Title:      "Task web died with status TASK_FAILED",
+		Sections: []teamsSection{
+			{
+				Facts: []teamsFact{
+					{Name: "Task ID", Value: "web.1"},
+					{Name: "Framework", Value: "marathon"},
+					{Name: "Host", Value: "host1"},
+					{Name: "Finished", Value: "2017-01-02T03:04:05Z"},
+				},
+			},
+		},
+		PotentialAction: []teamsAction{
+			teamsOpenURIAction("stdout", "http://stdout"),
+			teamsOpenURIAction("stderr", "http://stderr"),
+		},
+	}
+
+	if !reflect.DeepEqual(card, expected) {
+		t.Errorf("unexpected card; expected: %+v, got: %+v", expected, card)
+	}
+
+	// Webhook url from labels takes precedence over the flag
+	config := func(key string) string {
+		if key == "webhook_url" {
+			return server.URL + "/missing"
+		}
+
+		return ""
+	}
+
+	err := tr.Report(context.Background(), failure, config, "http://stdout", "http://stderr")
+	if err == nil {
+		t.Fatal("expected error for non-2xx response")
+	}
+
+	if tr.Retryable(err) {
+		t.Errorf("expected client error not to be retryable: %s", err)
+	}
+}
@@ -0,0 +1,140 @@
+package reporter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+)
+
+func init() {
+	var (
+		apiURL *string
+		token  *string
+		chatID *string
+		format *string
+	)
+
+	RegisterReporter("telegram", Maker{
+		RegisterFlags: func() {
+			apiURL = flags.String("telegram.api_url", "TELEGRAM_API_URL", "https://api.telegram.org", "default telegram bot api url")
+			token = flags.String("telegram.token", "TELEGRAM_TOKEN", "", "default telegram bot token")
+			chatID = flags.String("telegram.chat_id", "TELEGRAM_CHAT_ID", "", "default telegram chat id")
+			format = flags.String("telegram.format", "TELEGRAM_FORMAT", "Task <b>{{ html .failure.Name }}</b> (<code>{{ html .failure.ID }}</code>) died with status {{ html .failure.State }} on {{ html .failure.Slave }} [<a href=\"{{ html .stdoutURL }}\">stdout</a>, <a href=\"{{ html .stderrURL }}\">stderr</a>]", "log format in telegram html")
+		},
+
+		Make: func() (Reporter, error) {
+			return newTelegramReporter(*apiURL, *token, *chatID, *format), nil
+		},
+	})
+}
+
+type telegramReporter struct {
+	httpRetryable
+
+	apiURL string
+	token  string
+	chatID string
+	format string
+}
+
+type telegramMessage struct {
+	ChatID                string `json:"chat_id"`
+	Text                  string `json:"text"`
+	ParseMode             string `json:"parse_mode"`
+	DisableWebPagePreview bool   `json:"disable_web_page_preview"`
+}
+
+type telegramResponse struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+}
+
+func newTelegramReporter(apiURL, token, chatID, format string) *telegramReporter {
+	return &telegramReporter{
+		apiURL: apiURL,
+		token:  token,
+		chatID: chatID,
+		format: format,
+	}
+}
+
+func (t *telegramReporter) Report(ctx context.Context, failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
+	apiURL := configWithFallback(config, "api_url", t.apiURL)
+	token := configWithFallback(config, "token", t.token)
+	chatID := configWithFallback(config, "chat_id", t.chatID)
+
+	if apiURL == "" || token == "" || chatID == "" {
+		return nil
+	}
+
+	text, err := fillMessage(failure, config, stdoutURL, stderrURL, t.format)
+	if err != nil {
+		return err
+	}
+
+	message := telegramMessage{
+		ChatID:                chatID,
+		Text:                  text,
+		ParseMode:             "HTML",
+		DisableWebPagePreview: true,
+	}
+
+	endpoint := fmt.Sprintf("%s/bot%s/sendMessage", strings.TrimSuffix(apiURL, "/"), token)
+
+	// Errors from http client include the url, which contains the token,
+	// the url is redacted keeping the error a net.Error to be retried
+	body, err := sendJSON(ctx, http.MethodPost, endpoint, nil, message)
+	if err != nil && len(body) == 0 {
+		if urlErr, ok := err.(*url.Error); ok {
+			return &url.Error{Op: urlErr.Op, URL: strings.Replace(urlErr.URL, token, "<token>", -1), Err: urlErr.Err}
+		}
+
+		return err
+	}
+
+	// Telegram responds with a description of the problem for both
+	// non-2xx status codes and successful responses with ok=false
+	resp := telegramResponse{}
+	if decodeErr := json.Unmarshal(body, &resp); decodeErr != nil {
+		// Proxies in front of the api answer with pages of their own
+		if _, ok := err.(*statusError); ok {
+			return err
+		}
+
+		return fmt.Errorf("cannot decode telegram response: %s", decodeErr)
+	}
+
+	if !resp.OK {
+		message := fmt.Sprintf("telegram rejected the message: %s", resp.Description)
+		if se, ok := err.(*statusError); ok {
+			return &statusError{code: se.code, message: message}
+		}
+
+		return errors.New(message)
+	}
+
+	return nil
+}
+
+// Preview renders the message without sending it
+func (t *telegramReporter) Preview(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) (string, error) {
+	return fillMessage(failure, config, stdoutURL, stderrURL, t.format)
+}
+
+// DedupKey returns the bot token with the chat
+func (t *telegramReporter) DedupKey(config ConfigProvider) string {
+	token := configWithFallback(config, "token", t.token)
+	chatID := configWithFallback(config, "chat_id", t.chatID)
+	if token == "" || chatID == "" {
+		return ""
+	}
+
+	return configWithFallback(config, "api_url", t.apiURL) + "|" + token + "|" + chatID
+}
@@ -0,0 +1,99 @@
+package reporter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestTelegramReport(t *testing.T) {
+	var message telegramMessage
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/botsecret/sendMessage" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+			t.Errorf("error decoding message: %s", err)
+		}
+
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	tg := newTelegramReporter(server.URL+"/", "secret", "42", "<b>{{ html .failure.Name }}</b>")
+
+	failure := complainer.Failure{ID: "web.1", Name: "web<&>"}
+	if err := tg.Report(context.Background(), failure, func(string) string { return "" }, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := telegramMessage{ChatID: "42", Text: "<b>web&lt;&amp;&gt;</b>", ParseMode: "HTML", DisableWebPagePreview: true}
+	if message != expected {
+		t.Errorf("unexpected message; expected: %+v, got: %+v", expected, message)
+	}
+}
+
+func TestTelegramNetworkError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+
+	tg := newTelegramReporter(server.URL, "secret", "42", "{{ .failure.ID }}")
+
+	err := tg.Report(context.Background(), complainer.Failure{ID: "web.1"}, func(string) string { return "" }, "", "")
+	if err == nil {
+		t.Fatal("expected error for closed server")
+	}
+
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("expected token to be redacted, got: %s", err)
+	}
+
+	if !tg.Retryable(err) {
+		t.Errorf("expected connection error to be retryable: %s", err)
+	}
+}
+
+func TestTelegramErrors(t *testing.T) {
+	table := []struct {
+		status    int
+		body      string
+		message   string
+		retryable bool
+	}{
+		{status: http.StatusOK, body: `{"ok":false,"description":"Bad Request: chat not found"}`, message: "chat not found"},
+		{status: http.StatusBadRequest, body: `{"ok":false,"description":"Bad Request: can't parse entities"}`, message: "can't parse entities"},
+		{status: http.StatusTooManyRequests, body: `{"ok":false,"description":"Too Many Requests: retry after 5"}`, message: "retry after 5", retryable: true},
+		{status: http.StatusInternalServerError, body: `{"ok":false,"description":"Internal Server Error"}`, message: "Internal Server Error", retryable: true},
+		{status: http.StatusBadGateway, body: "<html><body>502 Bad Gateway</body></html>", message: "502", retryable: true},
+		{status: http.StatusOK, body: "<html></html>", message: "cannot decode telegram response"},
+	}
+
+	for _, row := range table {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(row.status)
+			_, _ = w.Write([]byte(row.body))
+		}))
+
+		tg := newTelegramReporter(server.URL, "secret", "42", "{{ .failure.ID }}")
+
+		err := tg.Report(context.Background(), complainer.Failure{ID: "web.1"}, func(string) string { return "" }, "", "")
+		server.Close()
+
+		if err == nil || !strings.Contains(err.Error(), row.message) {
+			t.Errorf("expected error with %q for status %d, got: %v", row.message, row.status, err)
+			continue
+		}
+
+		if tg.Retryable(err) != row.retryable {
+			t.Errorf("unexpected retryable for status %d; expected: %v, got: %v", row.status, row.retryable, tg.Retryable(err))
+		}
+	}
+}
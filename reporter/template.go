@@ -2,19 +2,112 @@ package reporter
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 	"text/template"
+	"time"
 
 	"github.com/cloudflare/complainer"
 )
 
+// templateCacheSize limits the number of cached templates, formats
+// come from labels as well, so the cache is reset once it is full
+const templateCacheSize = 1024
+
+// templateCache keeps parsed templates by their format
+var templateCache = struct {
+	sync.Mutex
+	templates map[string]*template.Template
+}{templates: map[string]*template.Template{}}
+
+// templateFuncs are functions available in templates, "config"
+// is replaced with the config of the instance on execution
+var templateFuncs = map[string]interface{}{
+	"config":     ConfigProvider(func(string) string { return "" }),
+	"json":       jsonString,
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"default":    defaultValue,
+	"truncate":   truncateValue,
+	"trimPrefix": trimPrefix,
+	"trimSuffix": trimSuffix,
+	"replace":    replace,
+	"formatTime": formatTime,
+	"ago":        ago,
+	"ordinal":    ordinal,
+}
+
+// templateLocation is the timezone of times formatted in templates
+var templateLocation = time.UTC
+
+// timeLayouts are named layouts available to formatTime
+var timeLayouts = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Kitchen":     time.Kitchen,
+	"Stamp":       time.Stamp,
+	"DateTime":    "2006-01-02 15:04:05",
+}
+
+// SetTemplateTimezone sets the timezone of times formatted in templates
+func SetTemplateTimezone(name string) error {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return err
+	}
+
+	templateLocation = loc
+
+	return nil
+}
+
+// parseTemplate returns the parsed template for the format,
+// templates are only parsed the first time they are used
+func parseTemplate(format string) (*template.Template, error) {
+	templateCache.Lock()
+	defer templateCache.Unlock()
+
+	if tmpl, ok := templateCache.templates[format]; ok {
+		return tmpl, nil
+	}
+
+	tmpl, err := template.New("").Funcs(templateFuncs).Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %s", err)
+	}
+
+	if len(templateCache.templates) >= templateCacheSize {
+		templateCache.templates = map[string]*template.Template{}
+	}
+
+	templateCache.templates[format] = tmpl
+
+	return tmpl, nil
+}
+
 func fillTemplate(failure complainer.Failure, config ConfigProvider, stdoutURL, stderrURL, format string) (string, error) {
-	tmpl, err := template.New("").Funcs(map[string]interface{}{
-		"config": config,
-	}).Parse(format)
+	parsed, err := parseTemplate(format)
+	if err != nil {
+		return "", err
+	}
+
+	// Cached templates are shared, so config is bound to a clone
+	tmpl, err := parsed.Clone()
 	if err != nil {
 		return "", err
 	}
 
+	tmpl.Funcs(map[string]interface{}{"config": config})
+
 	buf := bytes.NewBuffer([]byte{})
 
 	err = tmpl.Execute(buf, map[string]interface{}{
@@ -23,7 +116,119 @@ func fillTemplate(failure complainer.Failure, config ConfigProvider, stdoutURL,
 		"failure":   failure,
 		"stdoutURL": stdoutURL,
 		"stderrURL": stderrURL,
+		"version":   complainer.Version,
 	})
 
 	return string(buf.Bytes()), err
 }
+
+// Condition evaluates the "condition" template of the instance, which
+// must produce true or false, ex: {{ eq .failure.TaskLabels.env "prod" }}.
+// Instances without condition report every failure.
+func Condition(failure complainer.Failure, config ConfigProvider, stdoutURL, stderrURL string) (bool, error) {
+	format := config("condition")
+	if format == "" {
+		return true, nil
+	}
+
+	rendered, err := fillTemplate(failure, config, stdoutURL, stderrURL, format)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := strconv.ParseBool(strings.TrimSpace(rendered))
+	if err != nil {
+		return false, fmt.Errorf("condition must produce true or false, got %q", rendered)
+	}
+
+	return result, nil
+}
+
+// jsonString returns JSON representation of the value to embed into templates
+func jsonString(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// defaultValue returns fallback if value is empty, arguments are ordered
+// to allow pipelines: {{ config "team" | default "unknown" }}
+func defaultValue(fallback string, value interface{}) string {
+	if value == nil {
+		return fallback
+	}
+
+	if s := fmt.Sprint(value); s != "" {
+		return s
+	}
+
+	return fallback
+}
+
+// truncateValue shortens the string to at most max bytes
+func truncateValue(max int, s string) string {
+	return truncate(s, max)
+}
+
+// formatTime formats the time in the template timezone, layout is either
+// a name like "RFC3339" or Go layout: {{ .failure.Finished | formatTime "RFC3339" }}
+func formatTime(layout string, t time.Time) string {
+	if named, ok := timeLayouts[layout]; ok {
+		layout = named
+	}
+
+	return t.In(templateLocation).Format(layout)
+}
+
+// ago returns how long ago the time was, ex: "5m ago"
+func ago(t time.Time) string {
+	return agoSince(t, time.Now())
+}
+
+func agoSince(t, now time.Time) string {
+	d := now.Sub(t)
+
+	switch {
+	case d < time.Second:
+		return "just now"
+	case d < time.Minute:
+		return fmt.Sprintf("%ds ago", int(d/time.Second))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d/time.Minute))
+	case d < time.Hour*24:
+		return fmt.Sprintf("%dh ago", int(d/time.Hour))
+	default:
+		return fmt.Sprintf("%dd ago", int(d/(time.Hour*24)))
+	}
+}
+
+// ordinal returns the number with english ordinal suffix, ex: "3rd"
+func ordinal(n int) string {
+	suffix := "th"
+
+	switch n % 10 {
+	case 1:
+		suffix = "st"
+	case 2:
+		suffix = "nd"
+	case 3:
+		suffix = "rd"
+	}
+
+	if n%100 >= 11 && n%100 <= 13 {
+		suffix = "th"
+	}
+
+	return fmt.Sprintf("%d%s", n, suffix)
+}
+
+func trimPrefix(prefix, s string) string {
+	return strings.TrimPrefix(s, prefix)
+}
+
+func trimSuffix(suffix, s string) string {
+	return strings.TrimSuffix(s, suffix)
+}
+
+func replace(old, new, s string) string {
+	return strings.Replace(s, old, new, -1)
+}
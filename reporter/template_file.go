@@ -0,0 +1,74 @@
+package reporter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+// templateFiles keeps contents of template files by path
+var templateFiles = struct {
+	sync.Mutex
+	reload time.Duration
+	files  map[string]templateFile
+}{files: map[string]templateFile{}}
+
+type templateFile struct {
+	format string
+	read   time.Time
+}
+
+// SetTemplateReloadInterval sets how often template files are read again,
+// with zero interval they are only read again after ReloadTemplateFiles
+func SetTemplateReloadInterval(interval time.Duration) {
+	templateFiles.Lock()
+	defer templateFiles.Unlock()
+
+	templateFiles.reload = interval
+}
+
+// ReloadTemplateFiles makes template files read again on the next use
+func ReloadTemplateFiles() {
+	templateFiles.Lock()
+	defer templateFiles.Unlock()
+
+	templateFiles.files = map[string]templateFile{}
+}
+
+// readTemplateFile returns the template from the file, files are only
+// read again once the reload interval passes since they were last read
+func readTemplateFile(path string) (string, error) {
+	templateFiles.Lock()
+	defer templateFiles.Unlock()
+
+	if f, ok := templateFiles.files[path]; ok {
+		if templateFiles.reload <= 0 || time.Since(f.read) < templateFiles.reload {
+			return f.format, nil
+		}
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot read template file: %s", err)
+	}
+
+	templateFiles.files[path] = templateFile{format: string(b), read: time.Now()}
+
+	return string(b), nil
+}
+
+// fillMessage fills the message template of the reporter, which is read
+// from the file in "template_file" config if it is set instead
+func fillMessage(failure complainer.Failure, config ConfigProvider, stdoutURL, stderrURL, format string) (string, error) {
+	if path := config("template_file"); path != "" {
+		var err error
+		if format, err = readTemplateFile(path); err != nil {
+			return "", err
+		}
+	}
+
+	return fillTemplate(failure, config, stdoutURL, stderrURL, format)
+}
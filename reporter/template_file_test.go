@@ -0,0 +1,134 @@
+package reporter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestFillMessageTemplateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "complainer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "message.tmpl")
+	if err = ioutil.WriteFile(path, []byte("Task {{ .failure.Name }} died"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer ReloadTemplateFiles()
+
+	failure := complainer.Failure{Name: "web"}
+
+	inline := func(key string) string { return "" }
+	fromFile := func(key string) string {
+		if key == "template_file" {
+			return path
+		}
+
+		return ""
+	}
+
+	check := func(config ConfigProvider, expected string) {
+		message, err := fillMessage(failure, config, "", "", "Inline {{ .failure.Name }}")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if message != expected {
+			t.Errorf("unexpected message; expected: %q, got: %q", expected, message)
+		}
+	}
+
+	check(inline, "Inline web")
+	check(fromFile, "Task web died")
+
+	// Changes are only picked up on reload
+	if err = ioutil.WriteFile(path, []byte("Task {{ .failure.Name }} failed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	check(fromFile, "Task web died")
+
+	ReloadTemplateFiles()
+	check(fromFile, "Task web failed")
+
+	SetTemplateReloadInterval(time.Nanosecond)
+	defer SetTemplateReloadInterval(0)
+
+	if err = ioutil.WriteFile(path, []byte("Task {{ .failure.Name }} crashed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Millisecond)
+	check(fromFile, "Task web crashed")
+
+	if err = os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+
+	ReloadTemplateFiles()
+	if _, err = fillMessage(failure, fromFile, "", "", ""); err == nil {
+		t.Error("expected error for missing template file")
+	}
+}
+
+func TestPreviewTemplateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "complainer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "message.tmpl")
+	if err = ioutil.WriteFile(path, []byte("Task {{ .failure.Name }} died"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer ReloadTemplateFiles()
+
+	failure := complainer.Failure{Name: "web"}
+
+	config := func(key string) string {
+		if key == "template_file" {
+			return path
+		}
+
+		return ""
+	}
+
+	type row struct {
+		name     string
+		reporter Reporter
+		expected string
+	}
+
+	rows := []row{
+		{name: "opsgenie", reporter: newOpsgenieReporter("", "key", "Message {{ .failure.Name }}", "Inline {{ .failure.Name }}"), expected: "Message web\n\nTask web died"},
+		{name: "teams", reporter: newTeamsReporter("", "Inline {{ .failure.Name }}"), expected: "Task web died"},
+	}
+
+	for _, r := range rows {
+		previewer, ok := r.reporter.(Previewer)
+		if !ok {
+			t.Fatalf("%s reporter does not implement Previewer", r.name)
+		}
+
+		preview, err := previewer.Preview(failure, config, "", "")
+		if err != nil {
+			t.Fatalf("error previewing %s: %s", r.name, err)
+		}
+
+		if preview != r.expected {
+			t.Errorf("unexpected %s preview; expected: %q, got: %q", r.name, r.expected, preview)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package reporter
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestFillTemplate(t *testing.T) {
+	failure := complainer.Failure{
+		ID:        "prod.web.9d7a3f2c-8c5b-11e6-9d2b-0242ac110003",
+		Name:      "prod.web",
+		Framework: "marathon",
+	}
+
+	config := func(key string) string {
+		if key == "team" {
+			return "infra"
+		}
+
+		return ""
+	}
+
+	table := []struct {
+		format   string
+		expected string
+	}{
+		{format: `{{ upper .failure.Framework }}`, expected: "MARATHON"},
+		{format: `{{ lower "MARATHON" }}`, expected: "marathon"},
+		{format: `{{ config "team" | default "unknown" }}`, expected: "infra"},
+		{format: `{{ config "owner" | default "unknown" }}`, expected: "unknown"},
+		{format: `{{ .failure.Labels.owner | default "unknown" }}`, expected: "unknown"},
+		{format: `{{ truncate 12 .failure.ID }}`, expected: "prod.web.…"},
+		{format: `{{ trimPrefix "prod." .failure.Name }}`, expected: "web"},
+		{format: `{{ trimSuffix ".web" .failure.Name }}`, expected: "prod"},
+		{format: `{{ replace "." "/" .failure.Name }}`, expected: "prod/web"},
+		{format: `{{ .version }}`, expected: complainer.Version},
+	}
+
+	for _, row := range table {
+		got, err := fillTemplate(failure, config, "", "", row.format)
+		if err != nil {
+			t.Errorf("error filling template %q: %s", row.format, err)
+			continue
+		}
+
+		if got != row.expected {
+			t.Errorf("invalid result for template %q; expected: %q, got: %q", row.format, row.expected, got)
+		}
+	}
+
+	for _, format := range []string{`{{ upper }`, `{{ nope .failure.Name }}`, `{{ truncate "x" .failure.ID }}`} {
+		if _, err := fillTemplate(failure, config, "", "", format); err == nil {
+			t.Errorf("expected error for template %q", format)
+		}
+	}
+}
+
+func TestFillTemplateCache(t *testing.T) {
+	format := `{{ config "team" }}/{{ .failure.ID }}`
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func(team string) {
+			defer wg.Done()
+
+			config := func(key string) string {
+				return team
+			}
+
+			for j := 0; j < 10; j++ {
+				got, err := fillTemplate(complainer.Failure{ID: "web.1"}, config, "", "", format)
+				if err != nil {
+					t.Errorf("error filling template: %s", err)
+					return
+				}
+
+				if expected := team + "/web.1"; got != expected {
+					t.Errorf("cached template used wrong config; expected: %q, got: %q", expected, got)
+				}
+			}
+		}(fmt.Sprintf("team%d", i))
+	}
+
+	wg.Wait()
+
+	templateCache.Lock()
+	_, ok := templateCache.templates[format]
+	templateCache.Unlock()
+
+	if !ok {
+		t.Error("expected parsed template to be cached")
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	defer func(loc *time.Location) {
+		templateLocation = loc
+	}(templateLocation)
+
+	if err := SetTemplateTimezone("America/New_York"); err != nil {
+		t.Fatal(err)
+	}
+
+	failure := complainer.Failure{Finished: time.Date(2024, time.January, 10, 17, 4, 5, 0, time.UTC)}
+	config := func(string) string {
+		return ""
+	}
+
+	for format, expected := range map[string]string{
+		`{{ .failure.Finished | formatTime "RFC3339" }}`:          "2024-01-10T12:04:05-05:00",
+		`{{ .failure.Finished | formatTime "Kitchen" }}`:          "12:04PM",
+		`{{ .failure.Finished | formatTime "2006-01-02 15:04" }}`: "2024-01-10 12:04",
+	} {
+		got, err := fillTemplate(failure, config, "", "", format)
+		if err != nil {
+			t.Errorf("error filling template %q: %s", format, err)
+			continue
+		}
+
+		if got != expected {
+			t.Errorf("invalid result for template %q; expected: %q, got: %q", format, expected, got)
+		}
+	}
+
+	if err := SetTemplateTimezone("Nowhere/Special"); err == nil {
+		t.Error("expected error for unknown timezone")
+	}
+}
+
+func TestAgo(t *testing.T) {
+	now := time.Date(2024, time.January, 10, 17, 4, 5, 0, time.UTC)
+
+	for d, expected := range map[time.Duration]string{
+		0:                    "just now",
+		time.Second * 45:     "45s ago",
+		time.Minute * 5:      "5m ago",
+		time.Hour*3 + 59:     "3h ago",
+		time.Hour * 24 * 2:   "2d ago",
+		-time.Minute * 5:     "just now",
+		time.Minute*59 + 999: "59m ago",
+	} {
+		if got := agoSince(now.Add(-d), now); got != expected {
+			t.Errorf("invalid ago for %s; expected: %q, got: %q", d, expected, got)
+		}
+	}
+}
+
+func TestOrdinal(t *testing.T) {
+	for n, expected := range map[int]string{
+		0:   "0th",
+		1:   "1st",
+		2:   "2nd",
+		3:   "3rd",
+		4:   "4th",
+		11:  "11th",
+		12:  "12th",
+		13:  "13th",
+		21:  "21st",
+		102: "102nd",
+		111: "111th",
+	} {
+		if got := ordinal(n); got != expected {
+			t.Errorf("invalid ordinal for %d; expected: %q, got: %q", n, expected, got)
+		}
+	}
+}
+
+func TestCondition(t *testing.T) {
+	failure := complainer.Failure{Name: "web", TaskLabels: map[string]string{"env": "production"}}
+
+	table := []struct {
+		condition string
+		report    bool
+		err       bool
+	}{
+		{condition: "", report: true},
+		{condition: `{{ eq .failure.TaskLabels.env "production" }}`, report: true},
+		{condition: `{{ eq .failure.TaskLabels.env "staging" }}`, report: false},
+		{condition: ` {{ ne .failure.Name "web" }}` + "\n", report: false},
+		{condition: `{{ .failure.Name }}`, err: true},
+		{condition: `{{ .failure.Name`, err: true},
+	}
+
+	for _, row := range table {
+		config := func(key string) string {
+			if key == "condition" {
+				return row.condition
+			}
+
+			return ""
+		}
+
+		report, err := Condition(failure, config, "", "")
+		if (err != nil) != row.err {
+			t.Errorf("unexpected error for condition %q: %v", row.condition, err)
+			continue
+		}
+
+		if report != row.report {
+			t.Errorf("unexpected result of condition %q; expected: %v, got: %v", row.condition, row.report, report)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package reporter
+
+import "unicode/utf8"
+
+// truncate shortens the string to at most max bytes without breaking
+// multi-byte characters, appending ellipsis if anything was cut
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+
+	const ellipsis = "…"
+
+	cut := max - len(ellipsis)
+	if cut < 0 {
+		cut = 0
+	}
+
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+
+	return s[:cut] + ellipsis
+}
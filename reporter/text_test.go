@@ -0,0 +1,44 @@
+package reporter
+
+import "testing"
+
+func TestTruncate(t *testing.T) {
+	table := []struct {
+		input    string
+		max      int
+		expected string
+	}{
+		{
+			input:    "short",
+			max:      10,
+			expected: "short",
+		},
+		{
+			input:    "exactly10!",
+			max:      10,
+			expected: "exactly10!",
+		},
+		{
+			input:    "this is too long",
+			max:      10,
+			expected: "this is…",
+		},
+		{
+			input:    "привет мир",
+			max:      10,
+			expected: "при…",
+		},
+		{
+			input:    "oops",
+			max:      1,
+			expected: "…",
+		},
+	}
+
+	for _, row := range table {
+		got := truncate(row.input, row.max)
+		if got != row.expected {
+			t.Errorf("invalid truncation of %q to %d; expected: %q, got: %q", row.input, row.max, row.expected, got)
+		}
+	}
+}
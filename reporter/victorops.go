@@ -0,0 +1,121 @@
+package reporter
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+)
+
+var victoropsMessageTypes = map[string]bool{
+	"CRITICAL": true,
+	"WARNING":  true,
+	"INFO":     true,
+}
+
+func init() {
+	var (
+		apiURL      *string
+		apiKey      *string
+		routingKey  *string
+		messageType *string
+		format      *string
+	)
+
+	RegisterReporter("victorops", Maker{
+		RegisterFlags: func() {
+			apiURL = flags.String("victorops.api_url", "VICTOROPS_API_URL", "https://alert.victorops.com/integrations/generic/20131114/alert", "victorops rest integration endpoint")
+			apiKey = flags.String("victorops.api_key", "VICTOROPS_API_KEY", "", "default victorops rest integration api key")
+			routingKey = flags.String("victorops.routing_key", "VICTOROPS_ROUTING_KEY", "", "default victorops routing key")
+			messageType = flags.String("victorops.message_type", "VICTOROPS_MESSAGE_TYPE", "CRITICAL", "default victorops message type (CRITICAL, WARNING, INFO)")
+			format = flags.String("victorops.format", "VICTOROPS_FORMAT", "Task {{ .failure.Name }} ({{ .failure.ID }}) died with status {{ .failure.State }}", "incident message format")
+		},
+
+		Make: func() (Reporter, error) {
+			return newVictoropsReporter(*apiURL, *apiKey, *routingKey, *messageType, *format)
+		},
+	})
+}
+
+type victoropsReporter struct {
+	httpRetryable
+
+	apiURL      string
+	apiKey      string
+	routingKey  string
+	messageType string
+	format      string
+}
+
+type victoropsAlert struct {
+	MessageType       string `json:"message_type"`
+	EntityID          string `json:"entity_id"`
+	EntityDisplayName string `json:"entity_display_name"`
+	StateMessage      string `json:"state_message"`
+	StateStartTime    int64  `json:"state_start_time"`
+	MonitoringTool    string `json:"monitoring_tool"`
+	Host              string `json:"host"`
+	Framework         string `json:"framework"`
+	State             string `json:"task_state"`
+	StdoutURL         string `json:"stdout_url"`
+	StderrURL         string `json:"stderr_url"`
+}
+
+func newVictoropsReporter(apiURL, apiKey, routingKey, messageType, format string) (*victoropsReporter, error) {
+	if !victoropsMessageTypes[messageType] {
+		return nil, fmt.Errorf("invalid victorops message type: %q", messageType)
+	}
+
+	return &victoropsReporter{
+		apiURL:      apiURL,
+		apiKey:      apiKey,
+		routingKey:  routingKey,
+		messageType: messageType,
+		format:      format,
+	}, nil
+}
+
+func (v *victoropsReporter) Report(ctx context.Context, failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
+	apiKey := configWithFallback(config, "api_key", v.apiKey)
+	routingKey := configWithFallback(config, "routing_key", v.routingKey)
+
+	if apiKey == "" || routingKey == "" {
+		return nil
+	}
+
+	messageType := strings.ToUpper(configWithFallback(config, "message_type", v.messageType))
+	if !victoropsMessageTypes[messageType] {
+		return fmt.Errorf("invalid victorops message type: %q", messageType)
+	}
+
+	message, err := fillMessage(failure, config, stdoutURL, stderrURL, v.format)
+	if err != nil {
+		return err
+	}
+
+	alert := victoropsAlert{
+		MessageType:       messageType,
+		EntityID:          failure.ID,
+		EntityDisplayName: failure.Name,
+		StateMessage:      message,
+		StateStartTime:    failure.Finished.Unix(),
+		MonitoringTool:    "complainer",
+		Host:              failure.Slave,
+		Framework:         failure.Framework,
+		State:             failure.State,
+		StdoutURL:         stdoutURL,
+		StderrURL:         stderrURL,
+	}
+
+	endpoint := strings.TrimSuffix(configWithFallback(config, "api_url", v.apiURL), "/") + "/" + url.PathEscape(apiKey) + "/" + url.PathEscape(routingKey)
+
+	return postJSON(ctx, endpoint, alert)
+}
+
+// Preview renders the message without sending it
+func (v *victoropsReporter) Preview(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) (string, error) {
+	return fillMessage(failure, config, stdoutURL, stderrURL, v.format)
+}
@@ -0,0 +1,94 @@
+package reporter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestVictoropsReport(t *testing.T) {
+	var path string
+	var alert victoropsAlert
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			t.Errorf("error decoding alert: %s", err)
+		}
+
+		_, _ = w.Write([]byte(`{"result":"success"}`))
+	}))
+	defer server.Close()
+
+	v, err := newVictoropsReporter(server.URL+"/alert", "key", "ops", "CRITICAL", "Task {{ .failure.Name }} died")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := func(key string) string {
+		if key == "message_type" {
+			return "warning"
+		}
+
+		return ""
+	}
+
+	failure := complainer.Failure{ID: "web.1", Name: "web", Finished: time.Unix(1480000000, 0)}
+
+	if err = v.Report(context.Background(), failure, config, "https://logs/stdout", "https://logs/stderr"); err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/alert/key/ops" {
+		t.Errorf("unexpected path: %s", path)
+	}
+
+	expected := victoropsAlert{
+		MessageType:       "WARNING",
+		EntityID:          "web.1",
+		EntityDisplayName: "web",
+		StateMessage:      "Task web died",
+		StateStartTime:    1480000000,
+		MonitoringTool:    "complainer",
+		StdoutURL:         "https://logs/stdout",
+		StderrURL:         "https://logs/stderr",
+	}
+
+	if alert != expected {
+		t.Errorf("unexpected alert; expected: %+v, got: %+v", expected, alert)
+	}
+}
+
+func TestVictoropsErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	if _, err := newVictoropsReporter(server.URL, "key", "ops", "PANIC", ""); err == nil {
+		t.Error("expected error for invalid message type")
+	}
+
+	v, err := newVictoropsReporter(server.URL, "key", "ops", "CRITICAL", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = v.Report(context.Background(), complainer.Failure{ID: "web.1"}, func(string) string { return "" }, "", ""); err == nil {
+		t.Error("expected error for non-2xx response")
+	}
+
+	unconfigured, err := newVictoropsReporter(server.URL, "", "", "CRITICAL", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = unconfigured.Report(context.Background(), complainer.Failure{ID: "web.1"}, func(string) string { return "" }, "", ""); err != nil {
+		t.Errorf("expected unconfigured reporter to skip silently, got: %s", err)
+	}
+}
@@ -0,0 +1,159 @@
+package reporter
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+)
+
+func init() {
+	var (
+		url     *string
+		method  *string
+		headers *string
+		format  *string
+		secret  *string
+		header  *string
+	)
+
+	RegisterReporter("webhook", Maker{
+		RegisterFlags: func() {
+			url = flags.String("webhook.url", "WEBHOOK_URL", "", "default webhook url")
+			method = flags.String("webhook.method", "WEBHOOK_METHOD", http.MethodPost, "default webhook http method")
+			headers = flags.String("webhook.headers", "WEBHOOK_HEADERS", "", "default webhook headers in 'name:value;...' format")
+			secret = flags.String("webhook.secret", "WEBHOOK_SECRET", "", "default shared secret to sign webhook bodies with")
+			header = flags.String("webhook.signature_header", "WEBHOOK_SIGNATURE_HEADER", DefaultWebhookSignatureHeader, "default header with webhook body signature")
+			format = flags.String("webhook.format", "WEBHOOK_FORMAT", `{"id":{{ json .failure.ID }},"name":{{ json .failure.Name }},"slave":{{ json .failure.Slave }},"framework":{{ json .failure.Framework }},"image":{{ json .failure.Image }},"state":{{ json .failure.State }},"started":{{ json .failure.Started }},"finished":{{ json .failure.Finished }},"stdout":{{ json .stdoutURL }},"stderr":{{ json .stderrURL }}}`, "webhook body format")
+		},
+
+		Make: func() (Reporter, error) {
+			return newWebhookReporter(*url, *method, *headers, *format, *secret, *header)
+		},
+	})
+}
+
+// DefaultWebhookSignatureHeader is the default header with webhook body signature
+const DefaultWebhookSignatureHeader = "X-Complainer-Signature"
+
+// webhookSignaturePrefix is the prefix of webhook signatures
+const webhookSignaturePrefix = "sha256="
+
+type webhookReporter struct {
+	httpRetryable
+
+	url     string
+	method  string
+	headers map[string]string
+	format  string
+	secret  string
+	header  string
+}
+
+func newWebhookReporter(url, method, headers, format, secret, header string) (*webhookReporter, error) {
+	parsedHeaders, err := parseWebhookHeaders(headers)
+	if err != nil {
+		return nil, err
+	}
+
+	return &webhookReporter{
+		url:     url,
+		method:  method,
+		headers: parsedHeaders,
+		format:  format,
+		secret:  secret,
+		header:  header,
+	}, nil
+}
+
+func (w *webhookReporter) Report(ctx context.Context, failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) error {
+	url := configWithFallback(config, "url", w.url)
+	if url == "" {
+		return nil
+	}
+
+	body, err := fillMessage(failure, config, stdoutURL, stderrURL, configWithFallback(config, "format", w.format))
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{}
+	for k, v := range w.headers {
+		headers[k] = v
+	}
+
+	// Headers from labels are listed in the "headers" key,
+	// values are taken from "header_${name}" keys
+	for _, name := range strings.Split(config("headers"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			headers[name] = config("header_" + name)
+		}
+	}
+
+	if secret := configWithFallback(config, "secret", w.secret); secret != "" {
+		headers[configWithFallback(config, "signature_header", w.header)] = SignWebhook(secret, []byte(body))
+	}
+
+	_, err = send(ctx, configWithFallback(config, "method", w.method), url, "application/json", headers, []byte(body))
+	return err
+}
+
+// Validate checks that the webhook url is set and valid
+func (w *webhookReporter) Validate(ctx context.Context, config ConfigProvider) error {
+	u := configWithFallback(config, "url", w.url)
+	if u == "" {
+		return errors.New("webhook url is not set")
+	}
+
+	if parsed, err := neturl.Parse(u); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return fmt.Errorf("invalid webhook url: %q", u)
+	}
+
+	return nil
+}
+
+// SignWebhook returns the signature of the webhook body with the shared
+// secret as sent by webhook reporter: "sha256=" and hex encoded HMAC-SHA256
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	return webhookSignaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature checks the signature of the webhook body
+// with the shared secret, receivers of webhooks can use it
+func VerifyWebhookSignature(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(SignWebhook(secret, body)), []byte(signature))
+}
+
+// parseWebhookHeaders parses headers in "name:value;name:value" format
+func parseWebhookHeaders(headers string) (map[string]string, error) {
+	result := map[string]string{}
+	if headers == "" {
+		return result, nil
+	}
+
+	for _, header := range strings.Split(headers, ";") {
+		parts := strings.SplitN(header, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid webhook header: expected in name:value format, not %s", header)
+		}
+
+		result[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	return result, nil
+}
+
+// Preview renders the message without sending it
+func (w *webhookReporter) Preview(failure complainer.Failure, config ConfigProvider, stdoutURL string, stderrURL string) (string, error) {
+	return fillMessage(failure, config, stdoutURL, stderrURL, configWithFallback(config, "format", w.format))
+}
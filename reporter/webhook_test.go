@@ -0,0 +1,72 @@
+package reporter
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestWebhookSignature(t *testing.T) {
+	table := []struct {
+		labels map[string]string
+		header string
+		secret string
+	}{
+		{
+			header: DefaultWebhookSignatureHeader,
+			secret: "flag",
+		},
+		{
+			labels: map[string]string{"secret": "label", "signature_header": "X-Signature"},
+			header: "X-Signature",
+			secret: "label",
+		},
+	}
+
+	for i, row := range table {
+		var body []byte
+		var signature string
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ = ioutil.ReadAll(r.Body)
+			signature = r.Header.Get(row.header)
+		}))
+
+		w, err := newWebhookReporter(server.URL, http.MethodPost, "", `{"id":{{ json .failure.ID }}}`, "flag", DefaultWebhookSignatureHeader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		config := func(key string) string {
+			return row.labels[key]
+		}
+
+		err = w.Report(context.Background(), complainer.Failure{ID: "web.1"}, config, "", "")
+		server.Close()
+
+		if err != nil {
+			t.Errorf("row %d: error reporting: %s", i, err)
+			continue
+		}
+
+		if !VerifyWebhookSignature(row.secret, body, signature) {
+			t.Errorf("row %d: invalid signature %q of body %q", i, signature, body)
+		}
+
+		if VerifyWebhookSignature("wrong", body, signature) {
+			t.Errorf("row %d: signature is valid with wrong secret", i)
+		}
+	}
+}
+
+func TestSignWebhook(t *testing.T) {
+	// echo -n '{}' | openssl dgst -sha256 -hmac secret
+	expected := "sha256=77325902caca812dc259733aacd046b73817372c777b8d95b402647474516e13"
+	if signature := SignWebhook("secret", []byte("{}")); signature != expected {
+		t.Errorf("unexpected signature; expected: %s, got: %s", expected, signature)
+	}
+}
@@ -0,0 +1,64 @@
+package state
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileStore persists seen failures in a json file
+type FileStore struct {
+	path string
+}
+
+// NewFileStore creates a new file store with the provided file path
+func NewFileStore(path string) *FileStore {
+	return &FileStore{
+		path: path,
+	}
+}
+
+// Load returns seen failures from the file, nil map is returned
+// if the file does not exist yet
+func (s *FileStore) Load() (map[string]time.Time, error) {
+	b, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	recent := map[string]time.Time{}
+
+	return recent, json.Unmarshal(b, &recent)
+}
+
+// Save writes seen failures to the file, replacing it atomically
+func (s *FileStore) Save(recent map[string]time.Time) error {
+	b, err := json.Marshal(recent)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.Write(b); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return err
+	}
+
+	if err = f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), s.path)
+}
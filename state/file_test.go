@@ -0,0 +1,50 @@
+package state
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "complainer-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	store := NewFileStore(filepath.Join(dir, "state.json"))
+
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("error loading missing state: %s", err)
+	}
+
+	if loaded != nil {
+		t.Errorf("expected nil state before saving, got %v", loaded)
+	}
+
+	recent := map[string]time.Time{
+		"foo.1": time.Unix(1480000000, 0).UTC(),
+		"bar.2": time.Unix(1480000042, 0).UTC(),
+	}
+
+	if err = store.Save(recent); err != nil {
+		t.Fatalf("error saving state: %s", err)
+	}
+
+	loaded, err = store.Load()
+	if err != nil {
+		t.Fatalf("error loading state: %s", err)
+	}
+
+	if !reflect.DeepEqual(loaded, recent) {
+		t.Errorf("loaded state is not equal. Got %+v, expected %+v", loaded, recent)
+	}
+}
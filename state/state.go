@@ -0,0 +1,12 @@
+package state
+
+import "time"
+
+// Store is responsible for persisting seen failures across restarts
+type Store interface {
+	// Load returns seen failures by task ID with their finish time,
+	// nil map is returned if nothing has been saved yet
+	Load() (map[string]time.Time, error)
+	// Save persists seen failures by task ID with their finish time
+	Save(recent map[string]time.Time) error
+}
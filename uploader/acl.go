@@ -0,0 +1,25 @@
+package uploader
+
+import "fmt"
+
+// cannedACLs is the list of supported s3 canned acls for uploaded logs
+var cannedACLs = map[string]bool{
+	"private":                   true,
+	"public-read":               true,
+	"authenticated-read":        true,
+	"bucket-owner-read":         true,
+	"bucket-owner-full-control": true,
+}
+
+// cannedACL validates s3 canned acl, falling back to private if empty
+func cannedACL(acl string) (string, error) {
+	if acl == "" {
+		return "private", nil
+	}
+
+	if !cannedACLs[acl] {
+		return "", fmt.Errorf("unsupported s3 canned acl: %q", acl)
+	}
+
+	return acl, nil
+}
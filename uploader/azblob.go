@@ -0,0 +1,299 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+	"github.com/cloudflare/complainer/httpclient"
+)
+
+const (
+	azblobVersion          = "2019-12-12"
+	azblobDefaultSuffix    = "core.windows.net"
+	azblobDefaultScheme    = "https"
+	azblobErrorNoContainer = "ContainerNotFound"
+	azblobSASPermissions   = "r"
+)
+
+func init() {
+	var (
+		accountName      *string
+		accountKey       *string
+		connectionString *string
+		container        *string
+		prefix           *string
+		expiry           *time.Duration
+	)
+
+	RegisterUploader("azblob", Maker{
+		RegisterFlags: func() {
+			accountName = flags.String("azblob.account_name", "AZBLOB_ACCOUNT_NAME", "", "azure storage account name")
+			accountKey = flags.String("azblob.account_key", "AZBLOB_ACCOUNT_KEY", "", "azure storage account key")
+			connectionString = flags.String("azblob.connection_string", "AZBLOB_CONNECTION_STRING", "", "azure storage connection string, overrides account name and key")
+			container = flags.String("azblob.container", "AZBLOB_CONTAINER", "", "azure blob container to use")
+			prefix = flags.String("azblob.prefix", "AZBLOB_PREFIX", defaultPrefix, "azure blob path template to use")
+			expiry = flags.Duration("azblob.sas_expiry", "AZBLOB_SAS_EXPIRY", time.Hour*24*7, "expiry for azure blob sas urls")
+		},
+
+		Make: func() (Uploader, error) {
+			return newAzblobUploader(*accountName, *accountKey, *connectionString, *container, *prefix, *expiry)
+		},
+	})
+}
+
+type azblobUploader struct {
+	accountName string
+	accountKey  []byte
+	endpoint    string
+	container   string
+	prefix      *template.Template
+	expiry      time.Duration
+	client      http.Client
+}
+
+type azblobError struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func newAzblobUploader(accountName, accountKey, connectionString, container, prefix string, expiry time.Duration) (*azblobUploader, error) {
+	endpoint := ""
+
+	if connectionString != "" {
+		var err error
+		accountName, accountKey, endpoint, err = parseAzblobConnectionString(connectionString)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if accountName == "" || accountKey == "" || container == "" {
+		return nil, errors.New("azure blob configuration is incomplete")
+	}
+
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("%s://%s.blob.%s", azblobDefaultScheme, accountName, azblobDefaultSuffix)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(accountKey)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode azure storage account key: %s", err)
+	}
+
+	tmpl, err := parsePrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return &azblobUploader{
+		accountName: accountName,
+		accountKey:  key,
+		endpoint:    strings.TrimSuffix(endpoint, "/"),
+		container:   container,
+		prefix:      tmpl,
+		expiry:      expiry,
+		client: http.Client{
+			Transport: httpclient.Transport(httpclient.Uploaders),
+			Timeout:   time.Minute,
+		},
+	}, nil
+}
+
+func (u *azblobUploader) Upload(ctx context.Context, failure complainer.Failure, stdoutURL, stderrURL string) (string, string, error) {
+	prefix, err := renderPrefix(u.prefix, failure)
+	if err != nil {
+		return "", "", err
+	}
+
+	stdout, err := download(ctx, stdoutURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	sasStdoutURL, err := u.upload(ctx, path.Join(prefix, "stdout"), stdout)
+	if err != nil {
+		return "", "", err
+	}
+
+	stderr, err := download(ctx, stderrURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	sasStderrURL, err := u.upload(ctx, path.Join(prefix, "stderr"), stderr)
+	if err != nil {
+		return "", "", err
+	}
+
+	return sasStdoutURL, sasStderrURL, nil
+}
+
+func (u *azblobUploader) upload(ctx context.Context, name string, data []byte) (string, error) {
+	blobURL := u.endpoint + u.blobPath(name)
+
+	req, err := http.NewRequest(http.MethodPut, blobURL, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", azblobVersion)
+	req.Header.Set("Authorization", "SharedKey "+u.accountName+":"+u.sign(u.sharedKeyStringToSign(req, len(data))))
+
+	resp, err := u.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		azErr := azblobError{}
+		if xml.Unmarshal(body, &azErr) == nil && azErr.Code == azblobErrorNoContainer {
+			return "", fmt.Errorf("azure blob container %q does not exist in account %q", u.container, u.accountName)
+		}
+
+		return "", fmt.Errorf("cannot upload %s to azure blob, status %d: %s", name, resp.StatusCode, body)
+	}
+
+	return blobURL + "?" + u.sas(name, time.Now().Add(u.expiry)).Encode(), nil
+}
+
+// sharedKeyStringToSign builds the string to sign for Shared Key authorization:
+// https://docs.microsoft.com/en-us/rest/api/storageservices/authorize-with-shared-key
+func (u *azblobUploader) sharedKeyStringToSign(req *http.Request, length int) string {
+	contentLength := ""
+	if length > 0 {
+		contentLength = strconv.Itoa(length)
+	}
+
+	var msHeaders []string
+	for name := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-ms-") {
+			msHeaders = append(msHeaders, lower)
+		}
+	}
+
+	sort.Strings(msHeaders)
+
+	canonicalizedHeaders := ""
+	for _, name := range msHeaders {
+		canonicalizedHeaders += name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n"
+	}
+
+	return strings.Join([]string{
+		req.Method,
+		"", // Content-Encoding
+		"", // Content-Language
+		contentLength,
+		"", // Content-MD5
+		req.Header.Get("Content-Type"),
+		"", // Date
+		"", // If-Modified-Since
+		"", // If-Match
+		"", // If-None-Match
+		"", // If-Unmodified-Since
+		"", // Range
+		canonicalizedHeaders + "/" + u.accountName + req.URL.EscapedPath(),
+	}, "\n")
+}
+
+// sas returns query parameters of read only service SAS for the blob:
+// https://docs.microsoft.com/en-us/rest/api/storageservices/create-service-sas
+func (u *azblobUploader) sas(name string, expires time.Time) url.Values {
+	expiry := expires.UTC().Format("2006-01-02T15:04:05Z")
+
+	stringToSign := strings.Join([]string{
+		azblobSASPermissions,
+		"", // signed start
+		expiry,
+		"/blob/" + u.accountName + "/" + u.container + "/" + name,
+		"", // signed identifier
+		"", // signed ip
+		"", // signed protocol
+		azblobVersion,
+		"b", // signed resource
+		"",  // signed snapshot time
+		"",  // rscc
+		"",  // rscd
+		"",  // rsce
+		"",  // rscl
+		"",  // rsct
+	}, "\n")
+
+	return url.Values{
+		"sv":  {azblobVersion},
+		"sr":  {"b"},
+		"sp":  {azblobSASPermissions},
+		"se":  {expiry},
+		"sig": {u.sign(stringToSign)},
+	}
+}
+
+func (u *azblobUploader) sign(stringToSign string) string {
+	mac := hmac.New(sha256.New, u.accountKey)
+	_, _ = mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (u *azblobUploader) blobPath(name string) string {
+	return (&url.URL{Path: "/" + u.container + "/" + name}).EscapedPath()
+}
+
+// parseAzblobConnectionString returns account name, account key
+// and blob endpoint from the azure storage connection string
+func parseAzblobConnectionString(connectionString string) (string, string, string, error) {
+	values := map[string]string{}
+	for _, part := range strings.Split(connectionString, ";") {
+		if part == "" {
+			continue
+		}
+
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return "", "", "", errors.New("invalid azure storage connection string")
+		}
+
+		values[kv[0]] = kv[1]
+	}
+
+	endpoint := values["BlobEndpoint"]
+	if endpoint == "" && values["AccountName"] != "" {
+		scheme := values["DefaultEndpointsProtocol"]
+		if scheme == "" {
+			scheme = azblobDefaultScheme
+		}
+
+		suffix := values["EndpointSuffix"]
+		if suffix == "" {
+			suffix = azblobDefaultSuffix
+		}
+
+		endpoint = fmt.Sprintf("%s://%s.blob.%s", scheme, values["AccountName"], suffix)
+	}
+
+	return values["AccountName"], values["AccountKey"], endpoint, nil
+}
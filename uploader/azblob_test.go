@@ -0,0 +1,47 @@
+package uploader
+
+import "testing"
+
+func TestParseAzblobConnectionString(t *testing.T) {
+	table := []struct {
+		connectionString string
+		accountName      string
+		accountKey       string
+		endpoint         string
+	}{
+		{
+			connectionString: "DefaultEndpointsProtocol=https;AccountName=logs;AccountKey=c2VjcmV0;EndpointSuffix=core.windows.net",
+			accountName:      "logs",
+			accountKey:       "c2VjcmV0",
+			endpoint:         "https://logs.blob.core.windows.net",
+		},
+		{
+			connectionString: "AccountName=logs;AccountKey=c2VjcmV0==;EndpointSuffix=core.chinacloudapi.cn;",
+			accountName:      "logs",
+			accountKey:       "c2VjcmV0==",
+			endpoint:         "https://logs.blob.core.chinacloudapi.cn",
+		},
+		{
+			connectionString: "DefaultEndpointsProtocol=http;AccountName=dev;AccountKey=a2V5;BlobEndpoint=http://127.0.0.1:10000/dev",
+			accountName:      "dev",
+			accountKey:       "a2V5",
+			endpoint:         "http://127.0.0.1:10000/dev",
+		},
+	}
+
+	for _, row := range table {
+		accountName, accountKey, endpoint, err := parseAzblobConnectionString(row.connectionString)
+		if err != nil {
+			t.Errorf("error parsing %q: %s", row.connectionString, err)
+			continue
+		}
+
+		if accountName != row.accountName || accountKey != row.accountKey || endpoint != row.endpoint {
+			t.Errorf("invalid result for %q; expected: (%q, %q, %q), got: (%q, %q, %q)", row.connectionString, row.accountName, row.accountKey, row.endpoint, accountName, accountKey, endpoint)
+		}
+	}
+
+	if _, _, _, err := parseAzblobConnectionString("AccountName"); err == nil {
+		t.Error("expected error for malformed connection string")
+	}
+}
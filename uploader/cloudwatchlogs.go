@@ -0,0 +1,305 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+	"github.com/cloudflare/complainer/httpclient"
+)
+
+const (
+	// defaultCloudWatchStream is the default log stream name template,
+	// streams of stdout and stderr have /stdout and /stderr appended
+	defaultCloudWatchStream = "{{ .failure.Name }}/{{ .failure.ID }}"
+
+	// Limits of PutLogEvents, every event counts 26 bytes on top of the message
+	cloudWatchEventOverhead  = 26
+	cloudWatchMaxEventBytes  = 262144 - cloudWatchEventOverhead
+	cloudWatchMaxBatchBytes  = 1048576
+	cloudWatchMaxBatchEvents = 10000
+
+	// Error codes of cloudwatch logs api, not exported by the sdk
+	cloudWatchAlreadyExists   = "ResourceAlreadyExistsException"
+	cloudWatchAlreadyAccepted = "DataAlreadyAcceptedException"
+	cloudWatchInvalidToken    = "InvalidSequenceTokenException"
+)
+
+func init() {
+	var (
+		accessKey *string
+		secretKey *string
+		region    *string
+		endpoint  *string
+		logGroup  *string
+		stream    *string
+	)
+
+	RegisterUploader("cloudwatchlogs", Maker{
+		RegisterFlags: func() {
+			accessKey = flags.String("cloudwatchlogs.access_key", "CLOUDWATCH_LOGS_ACCESS_KEY", "", "access key for cloudwatch logs, default aws credential chain is used if empty")
+			secretKey = flags.String("cloudwatchlogs.secret_key", "CLOUDWATCH_LOGS_SECRET_KEY", "", "secret key for cloudwatch logs")
+			region = flags.String("cloudwatchlogs.region", "CLOUDWATCH_LOGS_REGION", "", "cloudwatch logs region to use")
+			endpoint = flags.String("cloudwatchlogs.endpoint", "CLOUDWATCH_LOGS_ENDPOINT", "", "cloudwatch logs endpoint for compatible apis")
+			logGroup = flags.String("cloudwatchlogs.log_group", "CLOUDWATCH_LOGS_LOG_GROUP", "", "cloudwatch logs group to write log streams to")
+			stream = flags.String("cloudwatchlogs.stream", "CLOUDWATCH_LOGS_STREAM", defaultCloudWatchStream, "log stream name template, /stdout and /stderr are appended")
+		},
+
+		Make: func() (Uploader, error) {
+			return newCloudWatchLogsUploader(cloudWatchLogsConfig{
+				accessKey: *accessKey,
+				secretKey: *secretKey,
+				region:    *region,
+				endpoint:  *endpoint,
+				logGroup:  *logGroup,
+				stream:    *stream,
+			})
+		},
+	})
+}
+
+type cloudWatchLogsUploader struct {
+	client   *cloudwatchlogs.CloudWatchLogs
+	region   string
+	logGroup string
+	stream   *template.Template
+}
+
+type cloudWatchLogsConfig struct {
+	accessKey string
+	secretKey string
+	region    string
+	endpoint  string
+	logGroup  string
+	stream    string
+}
+
+func newCloudWatchLogsUploader(c cloudWatchLogsConfig) (*cloudWatchLogsUploader, error) {
+	if c.region == "" || c.logGroup == "" {
+		return nil, errors.New("cloudwatch logs configuration is incomplete")
+	}
+
+	if c.stream == "" {
+		c.stream = defaultCloudWatchStream
+	}
+
+	tmpl, err := template.New("").Parse(c.stream)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &aws.Config{
+		Region:     aws.String(c.region),
+		HTTPClient: httpclient.Client(httpclient.Uploaders),
+	}
+
+	// Default credential chain covers env, shared config and instance roles
+	if c.accessKey != "" {
+		config.Credentials = credentials.NewStaticCredentials(c.accessKey, c.secretKey, "")
+	}
+
+	if c.endpoint != "" {
+		config.Endpoint = aws.String(c.endpoint)
+	}
+
+	return &cloudWatchLogsUploader{
+		client:   cloudwatchlogs.New(session.New(config)),
+		region:   c.region,
+		logGroup: c.logGroup,
+		stream:   tmpl,
+	}, nil
+}
+
+func (u *cloudWatchLogsUploader) Upload(ctx context.Context, failure complainer.Failure, stdoutURL, stderrURL string) (string, string, error) {
+	stream, err := renderPrefix(u.stream, failure)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Events are stamped with the time of the failure, so they line up with it
+	timestamp := failure.Finished
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	urls := []string{}
+	for _, log := range []struct {
+		url  string
+		name string
+	}{{stdoutURL, "stdout"}, {stderrURL, "stderr"}} {
+		data, err := download(ctx, log.url)
+		if err != nil {
+			return "", "", err
+		}
+
+		name := stream + "/" + log.name
+		if err := u.upload(ctx, name, cloudWatchBatches(data, timestamp)); err != nil {
+			return "", "", fmt.Errorf("cannot write %s to cloudwatch logs stream %s: %s", log.name, name, err)
+		}
+
+		urls = append(urls, u.url(name))
+	}
+
+	return urls[0], urls[1], nil
+}
+
+// upload creates the log stream and puts batches of events into it,
+// passing the sequence token of every call to the next one
+func (u *cloudWatchLogsUploader) upload(ctx context.Context, stream string, batches [][]*cloudwatchlogs.InputLogEvent) error {
+	token, err := u.createStream(ctx, stream)
+	if err != nil {
+		return err
+	}
+
+	for _, batch := range batches {
+		if token, err = u.put(ctx, stream, token, batch); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createStream creates the log stream, returning the sequence token
+// to continue with if the stream exists already for a repeated failure
+func (u *cloudWatchLogsUploader) createStream(ctx context.Context, stream string) (string, error) {
+	req, _ := u.client.CreateLogStreamRequest(&cloudwatchlogs.CreateLogStreamInput{
+		LogGroupName:  aws.String(u.logGroup),
+		LogStreamName: aws.String(stream),
+	})
+	req.HTTPRequest = req.HTTPRequest.WithContext(ctx)
+
+	err := req.Send()
+	if ae, ok := err.(awserr.Error); ok && ae.Code() == cloudWatchAlreadyExists {
+		return u.sequenceToken(ctx, stream)
+	}
+
+	return "", err
+}
+
+// put puts the batch of events into the stream and returns the next
+// sequence token. If the token is rejected, because something else
+// wrote into the stream, the current one is looked up and used instead.
+func (u *cloudWatchLogsUploader) put(ctx context.Context, stream, token string, batch []*cloudwatchlogs.InputLogEvent) (string, error) {
+	for attempt := 0; ; attempt++ {
+		input := &cloudwatchlogs.PutLogEventsInput{
+			LogGroupName:  aws.String(u.logGroup),
+			LogStreamName: aws.String(stream),
+			LogEvents:     batch,
+		}
+
+		if token != "" {
+			input.SequenceToken = aws.String(token)
+		}
+
+		req, output := u.client.PutLogEventsRequest(input)
+		req.HTTPRequest = req.HTTPRequest.WithContext(ctx)
+
+		err := req.Send()
+		if err == nil {
+			return aws.StringValue(output.NextSequenceToken), nil
+		}
+
+		ae, ok := err.(awserr.Error)
+		if !ok || attempt > 0 {
+			return "", err
+		}
+
+		switch ae.Code() {
+		case cloudWatchAlreadyAccepted:
+			// The batch made it with the previous attempt
+			return u.sequenceToken(ctx, stream)
+		case cloudWatchInvalidToken:
+			if token, err = u.sequenceToken(ctx, stream); err != nil {
+				return "", err
+			}
+		default:
+			return "", err
+		}
+	}
+}
+
+// sequenceToken returns the current upload sequence token of the stream
+func (u *cloudWatchLogsUploader) sequenceToken(ctx context.Context, stream string) (string, error) {
+	req, output := u.client.DescribeLogStreamsRequest(&cloudwatchlogs.DescribeLogStreamsInput{
+		LogGroupName:        aws.String(u.logGroup),
+		LogStreamNamePrefix: aws.String(stream),
+	})
+	req.HTTPRequest = req.HTTPRequest.WithContext(ctx)
+
+	if err := req.Send(); err != nil {
+		return "", err
+	}
+
+	for _, s := range output.LogStreams {
+		if aws.StringValue(s.LogStreamName) == stream {
+			return aws.StringValue(s.UploadSequenceToken), nil
+		}
+	}
+
+	return "", fmt.Errorf("log stream %s is not found", stream)
+}
+
+// url returns the link to the log stream in the aws console
+func (u *cloudWatchLogsUploader) url(stream string) string {
+	return fmt.Sprintf("https://%s.console.aws.amazon.com/cloudwatch/home?region=%s#logsV2:log-groups/log-group/%s/log-events/%s", u.region, u.region, cloudWatchConsoleEscape(u.logGroup), cloudWatchConsoleEscape(stream))
+}
+
+// cloudWatchConsoleEscape escapes names the way the aws console expects
+// them in fragments: url encoded with % replaced by $25
+func cloudWatchConsoleEscape(s string) string {
+	return strings.Replace(strings.Replace(url.QueryEscape(s), "+", "%20", -1), "%", "$25", -1)
+}
+
+// cloudWatchBatches splits logs into events by lines and groups them into
+// batches within limits of a single PutLogEvents call. Lines longer than
+// the maximum event size are split, empty lines are not accepted as events.
+func cloudWatchBatches(data []byte, at time.Time) [][]*cloudwatchlogs.InputLogEvent {
+	timestamp := aws.Int64(at.UnixNano() / int64(time.Millisecond))
+
+	batches := [][]*cloudwatchlogs.InputLogEvent{}
+	batch := []*cloudwatchlogs.InputLogEvent{}
+	size := 0
+
+	for _, line := range strings.Split(string(data), "\n") {
+		for line != "" {
+			n := len(line)
+			if n > cloudWatchMaxEventBytes {
+				n = cloudWatchMaxEventBytes
+				for n > 0 && !utf8.RuneStart(line[n]) {
+					n--
+				}
+			}
+
+			message := line[:n]
+			line = line[n:]
+
+			if len(batch) == cloudWatchMaxBatchEvents || size+len(message)+cloudWatchEventOverhead > cloudWatchMaxBatchBytes {
+				batches = append(batches, batch)
+				batch = []*cloudwatchlogs.InputLogEvent{}
+				size = 0
+			}
+
+			batch = append(batch, &cloudwatchlogs.InputLogEvent{Message: aws.String(message), Timestamp: timestamp})
+			size += len(message) + cloudWatchEventOverhead
+		}
+	}
+
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+
+	return batches
+}
@@ -0,0 +1,191 @@
+package uploader
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/cloudflare/complainer"
+)
+
+// cloudWatchTestServer is a fake of cloudwatch logs api keeping streams in memory
+type cloudWatchTestServer struct {
+	mu      sync.Mutex
+	streams map[string]*cloudWatchTestStream
+}
+
+type cloudWatchTestStream struct {
+	token  int
+	events []string
+}
+
+func (s *cloudWatchTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	input := struct {
+		LogStreamName       string `json:"logStreamName"`
+		LogStreamNamePrefix string `json:"logStreamNamePrefix"`
+		SequenceToken       string `json:"sequenceToken"`
+		LogEvents           []struct {
+			Message string `json:"message"`
+		} `json:"logEvents"`
+	}{}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fail := func(code string) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"__type":"` + code + `","message":"` + code + `"}`))
+	}
+
+	switch strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "Logs_20140328.") {
+	case "CreateLogStream":
+		if _, ok := s.streams[input.LogStreamName]; ok {
+			fail(cloudWatchAlreadyExists)
+			return
+		}
+
+		s.streams[input.LogStreamName] = &cloudWatchTestStream{}
+		_, _ = w.Write([]byte(`{}`))
+	case "PutLogEvents":
+		stream := s.streams[input.LogStreamName]
+		if stream == nil {
+			fail("ResourceNotFoundException")
+			return
+		}
+
+		if (stream.token == 0 && input.SequenceToken != "") || (stream.token > 0 && input.SequenceToken != strconv.Itoa(stream.token)) {
+			fail(cloudWatchInvalidToken)
+			return
+		}
+
+		for _, event := range input.LogEvents {
+			stream.events = append(stream.events, event.Message)
+		}
+
+		stream.token++
+		_, _ = w.Write([]byte(`{"nextSequenceToken":"` + strconv.Itoa(stream.token) + `"}`))
+	case "DescribeLogStreams":
+		streams := []map[string]string{}
+		for name, stream := range s.streams {
+			if strings.HasPrefix(name, input.LogStreamNamePrefix) {
+				description := map[string]string{"logStreamName": name}
+				if stream.token > 0 {
+					description["uploadSequenceToken"] = strconv.Itoa(stream.token)
+				}
+
+				streams = append(streams, description)
+			}
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"logStreams": streams})
+	default:
+		http.Error(w, "unknown target", http.StatusBadRequest)
+	}
+}
+
+func TestCloudWatchLogsUpload(t *testing.T) {
+	logs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Replace(strings.TrimPrefix(r.URL.Path, "/"), "-", "\n", -1)))
+	}))
+	defer logs.Close()
+
+	fake := &cloudWatchTestServer{streams: map[string]*cloudWatchTestStream{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	u, err := newCloudWatchLogsUploader(cloudWatchLogsConfig{
+		accessKey: "access",
+		secretKey: "secret",
+		region:    "us-east-1",
+		endpoint:  server.URL,
+		logGroup:  "/mesos/tasks",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failure := complainer.Failure{ID: "web.1", Name: "web", Finished: time.Now()}
+
+	stdoutURL, stderrURL, err := u.Upload(context.Background(), failure, logs.URL+"/out1-out2", logs.URL+"/err")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "https://us-east-1.console.aws.amazon.com/cloudwatch/home?region=us-east-1#logsV2:log-groups/log-group/$252Fmesos$252Ftasks/log-events/web$252Fweb.1$252Fstdout"; stdoutURL != expected {
+		t.Errorf("unexpected stdout url; expected: %s, got: %s", expected, stdoutURL)
+	}
+
+	if !strings.HasSuffix(stderrURL, "/log-events/web$252Fweb.1$252Fstderr") {
+		t.Errorf("unexpected stderr url: %s", stderrURL)
+	}
+
+	// Something else writing into the stream invalidates the known token
+	fake.streams["web/web.1/stdout"].token++
+
+	// Repeated failure with the same id continues existing streams
+	if _, _, err = u.Upload(context.Background(), failure, logs.URL+"/out3", logs.URL+"/err"); err != nil {
+		t.Fatal(err)
+	}
+
+	if events := strings.Join(fake.streams["web/web.1/stdout"].events, ","); events != "out1,out2,out3" {
+		t.Errorf("unexpected stdout events: %s", events)
+	}
+
+	if events := strings.Join(fake.streams["web/web.1/stderr"].events, ","); events != "err,err" {
+		t.Errorf("unexpected stderr events: %s", events)
+	}
+}
+
+func TestCloudWatchBatches(t *testing.T) {
+	at := time.Unix(1500000000, 0)
+
+	long := strings.Repeat("x", cloudWatchMaxEventBytes*2+10)
+
+	batches := cloudWatchBatches([]byte(long+"\n\nshort\n"+long), at)
+
+	events := 0
+	for _, batch := range batches {
+		size := 0
+		for _, event := range batch {
+			if len(aws.StringValue(event.Message)) > cloudWatchMaxEventBytes || aws.StringValue(event.Message) == "" {
+				t.Errorf("invalid event size: %d", len(aws.StringValue(event.Message)))
+			}
+
+			if aws.Int64Value(event.Timestamp) != 1500000000000 {
+				t.Errorf("unexpected event timestamp: %d", aws.Int64Value(event.Timestamp))
+			}
+
+			size += len(aws.StringValue(event.Message)) + cloudWatchEventOverhead
+		}
+
+		if size > cloudWatchMaxBatchBytes {
+			t.Errorf("batch is too big: %d bytes", size)
+		}
+
+		events += len(batch)
+	}
+
+	if events != 7 {
+		t.Errorf("expected long lines to be split into 7 events, got %d", events)
+	}
+
+	if batches = cloudWatchBatches([]byte(strings.Repeat("line\n", cloudWatchMaxBatchEvents+1)), at); len(batches) != 2 || len(batches[1]) != 1 {
+		t.Errorf("expected events to be split by count into 2 batches, got %d", len(batches))
+	}
+
+	if batches = cloudWatchBatches([]byte(strings.Repeat("é", cloudWatchMaxEventBytes)), at); !strings.HasSuffix(aws.StringValue(batches[0][0].Message), "é") {
+		t.Error("expected long lines to be split on rune boundaries")
+	}
+}
@@ -0,0 +1,34 @@
+package uploader
+
+import (
+	"bytes"
+	"compress/gzip"
+)
+
+// compressedSuffix is added to names of gzip compressed logs
+const compressedSuffix = ".log.gz"
+
+// logName returns the name of the uploaded log file
+func logName(file string, compress bool) string {
+	if compress {
+		return file + compressedSuffix
+	}
+
+	return file
+}
+
+// compressLog gzips log content
+func compressLog(data []byte) ([]byte, error) {
+	buf := bytes.NewBuffer([]byte{})
+
+	w := gzip.NewWriter(buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
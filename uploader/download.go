@@ -1,20 +1,101 @@
 package uploader
 
 import (
+	"context"
+	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
+	"sync"
+
+	"github.com/cloudflare/complainer/httpclient"
+	"github.com/cloudflare/complainer/logging"
 )
 
-func download(url string) ([]byte, error) {
-	resp, err := http.Get(url)
+var downloader = httpDownload
+
+// SetDownloader sets the function used by uploaders to download logs
+// from sandbox urls, default is a plain http request
+func SetDownloader(fn func(ctx context.Context, url string) ([]byte, error)) {
+	downloader = fn
+}
+
+// Download returns the content of the log by the sandbox url, logs shared
+// with WithLogs are only downloaded once. Custom uploaders should use it.
+func Download(ctx context.Context, url string) ([]byte, error) {
+	return download(ctx, url)
+}
+
+func download(ctx context.Context, url string) ([]byte, error) {
+	if logs, ok := ctx.Value(logsKey{}).(*Logs); ok {
+		return logs.Download(ctx, url)
+	}
+
+	return downloader(ctx, url)
+}
+
+type logsKey struct{}
+
+// Logs keeps downloaded logs of a single failure, so the uploader and
+// everything else needing the content of logs download them only once
+type Logs struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+// NewLogs returns empty logs of a failure
+func NewLogs() *Logs {
+	return &Logs{data: map[string][]byte{}}
+}
+
+// WithLogs returns the context sharing logs with downloads in uploaders
+func WithLogs(ctx context.Context, logs *Logs) context.Context {
+	return context.WithValue(ctx, logsKey{}, logs)
+}
+
+// Download returns the content of the log, downloading it on the first use.
+// Errors are not kept, so retries download the log again.
+func (l *Logs) Download(ctx context.Context, url string) ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if data, ok := l.data[url]; ok {
+		return data, nil
+	}
+
+	data, err := downloader(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	l.data[url] = data
+
+	return data, nil
+}
+
+// Downloaded returns the content of the log if it is downloaded already
+func (l *Logs) Downloaded(url string) ([]byte, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	data, ok := l.data[url]
+
+	return data, ok
+}
+
+func httpDownload(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpclient.Client(httpclient.Mesos).Do(req.WithContext(ctx))
 	if err != nil {
 		return nil, err
 	}
 
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
-			log.Printf("Error closing response body for %s: %s", url, err)
+			logging.Error(fmt.Sprintf("Error closing response body for %s: %s", url, err), logging.Fields{"error": err})
 		}
 	}()
 
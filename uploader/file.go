@@ -0,0 +1,214 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+	"github.com/cloudflare/complainer/logging"
+)
+
+func init() {
+	var (
+		dir       *string
+		listen    *string
+		baseURL   *string
+		retention *time.Duration
+		compress  *bool
+	)
+
+	RegisterUploader("file", Maker{
+		RegisterFlags: func() {
+			dir = flags.String("file.dir", "FILE_DIR", "", "directory to store logs in")
+			listen = flags.String("file.listen", "FILE_LISTEN", "", "http listen address to serve stored logs on")
+			baseURL = flags.String("file.base_url", "FILE_BASE_URL", "", "base url of the stored logs (ex: http://complainer.example.com:8080)")
+			retention = flags.Duration("file.retention", "FILE_RETENTION", time.Hour*24*7, "retention period for stored logs, zero keeps logs forever")
+			compress = flags.Bool("file.compress", "FILE_COMPRESS", false, "whether to gzip stored logs")
+		},
+
+		Make: func() (Uploader, error) {
+			return newFileUploader(*dir, *listen, *baseURL, *retention, *compress)
+		},
+	})
+}
+
+type fileUploader struct {
+	dir       string
+	baseURL   string
+	retention time.Duration
+	compress  bool
+}
+
+func newFileUploader(dir, listen, baseURL string, retention time.Duration, compress bool) (*fileUploader, error) {
+	if dir == "" {
+		return nil, errors.New("file uploader directory is not set")
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	if listen != "" {
+		l, err := net.Listen("tcp", listen)
+		if err != nil {
+			return nil, err
+		}
+
+		if baseURL == "" {
+			baseURL = listenURL(l.Addr().(*net.TCPAddr))
+		}
+
+		go func() {
+			logging.Info(fmt.Sprintf("Serving uploaded logs on %s", listen), nil)
+			if err := http.Serve(l, noListing(gzipEncoding(http.FileServer(http.Dir(dir))))); err != nil {
+				logging.Error(fmt.Sprintf("Error serving uploaded logs: %s", err), logging.Fields{"error": err})
+			}
+		}()
+	}
+
+	return &fileUploader{
+		dir:       dir,
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		retention: retention,
+		compress:  compress,
+	}, nil
+}
+
+func (u *fileUploader) Upload(ctx context.Context, failure complainer.Failure, stdoutURL, stderrURL string) (string, string, error) {
+	u.prune()
+
+	name, err := fileDirName(failure)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := os.MkdirAll(filepath.Join(u.dir, name), 0755); err != nil {
+		return "", "", err
+	}
+
+	storedStdoutURL, err := u.store(ctx, name, "stdout", stdoutURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	storedStderrURL, err := u.store(ctx, name, "stderr", stderrURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	return storedStdoutURL, storedStderrURL, nil
+}
+
+func (u *fileUploader) store(ctx context.Context, name, file, sourceURL string) (string, error) {
+	data, err := download(ctx, sourceURL)
+	if err != nil {
+		return "", err
+	}
+
+	if u.compress {
+		if data, err = compressLog(data); err != nil {
+			return "", err
+		}
+
+		file = logName(file, u.compress)
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(u.dir, name, file), data, 0644); err != nil {
+		return "", err
+	}
+
+	if u.baseURL == "" {
+		return (&url.URL{Scheme: "file", Path: filepath.Join(u.dir, name, file)}).String(), nil
+	}
+
+	return u.baseURL + (&url.URL{Path: "/" + name + "/" + file}).EscapedPath(), nil
+}
+
+// fileDirName returns the name of the directory for logs of the failure,
+// finish time keeps logs of repeated failures with the same id apart
+func fileDirName(failure complainer.Failure) (string, error) {
+	// Task ids are not supposed to have slashes, but better safe than sorry
+	id := strings.NewReplacer("/", "_", "\\", "_").Replace(failure.ID)
+	if id == "" || id == "." || id == ".." {
+		return "", fmt.Errorf("invalid task id for file uploader: %q", failure.ID)
+	}
+
+	return id + "-" + failure.Finished.UTC().Format("20060102T150405Z"), nil
+}
+
+// noListing responds with 404 to directory requests, so only
+// logs with known urls can be read, not the whole storage
+func noListing(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// gzipEncoding serves compressed logs as text with gzip Content-Encoding,
+// so browsers decompress them transparently
+func gzipEncoding(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, compressedSuffix) {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Set("Content-Encoding", "gzip")
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// prune removes stored logs older than retention period
+func (u *fileUploader) prune() {
+	if u.retention == 0 {
+		return
+	}
+
+	entries, err := ioutil.ReadDir(u.dir)
+	if err != nil {
+		logging.Error(fmt.Sprintf("Error listing uploaded logs in %s: %s", u.dir, err), logging.Fields{"error": err})
+		return
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || time.Since(entry.ModTime()) < u.retention {
+			continue
+		}
+
+		if err := os.RemoveAll(filepath.Join(u.dir, entry.Name())); err != nil {
+			logging.Error(fmt.Sprintf("Error pruning uploaded logs in %s: %s", entry.Name(), err), logging.Fields{"error": err})
+		}
+	}
+}
+
+// listenURL returns http url for the listen address, replacing
+// unspecified address with the hostname of the machine
+func listenURL(addr *net.TCPAddr) string {
+	host := addr.IP.String()
+	if addr.IP.IsUnspecified() {
+		if hostname, err := os.Hostname(); err == nil {
+			host = hostname
+		}
+	}
+
+	return fmt.Sprintf("http://%s", net.JoinHostPort(host, fmt.Sprintf("%d", addr.Port)))
+}
@@ -0,0 +1,230 @@
+package uploader
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+)
+
+func fileTestUploader(t *testing.T, baseURL string, retention time.Duration) (*fileUploader, func()) {
+	dir, err := ioutil.TempDir("", "complainer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := newFileUploader(dir, "", baseURL, retention, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return u, func() {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func fileTestLogs() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.TrimPrefix(r.URL.Path, "/")))
+	}))
+}
+
+func TestFileUpload(t *testing.T) {
+	logs := fileTestLogs()
+	defer logs.Close()
+
+	failure := complainer.Failure{ID: "web.1", Finished: time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC)}
+
+	u, cleanup := fileTestUploader(t, "http://logs.example.com/", 0)
+	defer cleanup()
+
+	stdoutURL, stderrURL, err := u.Upload(context.Background(), failure, logs.URL+"/out", logs.URL+"/err")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stdoutURL != "http://logs.example.com/web.1-20240110T000000Z/stdout" || stderrURL != "http://logs.example.com/web.1-20240110T000000Z/stderr" {
+		t.Errorf("unexpected urls: %s, %s", stdoutURL, stderrURL)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(u.dir, "web.1-20240110T000000Z", "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "err" {
+		t.Errorf("unexpected stored stderr: %q", b)
+	}
+
+	// Repeated failure with the same id must not overwrite earlier logs
+	failure.Finished = failure.Finished.Add(time.Minute)
+	if _, _, err = u.Upload(context.Background(), failure, logs.URL+"/out", logs.URL+"/err"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ioutil.ReadDir(u.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 {
+		t.Errorf("expected 2 stored failures, got %d", len(entries))
+	}
+}
+
+func TestFileUploadFileURLs(t *testing.T) {
+	logs := fileTestLogs()
+	defer logs.Close()
+
+	u, cleanup := fileTestUploader(t, "", 0)
+	defer cleanup()
+
+	stdoutURL, _, err := u.Upload(context.Background(), complainer.Failure{ID: "web.1", Finished: time.Unix(0, 0)}, logs.URL+"/out", logs.URL+"/err")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "file://" + filepath.Join(u.dir, "web.1-19700101T000000Z", "stdout"); stdoutURL != expected {
+		t.Errorf("unexpected url; expected: %s, got: %s", expected, stdoutURL)
+	}
+}
+
+func TestFileUploadCompress(t *testing.T) {
+	logs := fileTestLogs()
+	defer logs.Close()
+
+	u, cleanup := fileTestUploader(t, "http://logs.example.com", 0)
+	defer cleanup()
+
+	u.compress = true
+
+	stdoutURL, _, err := u.Upload(context.Background(), complainer.Failure{ID: "web.1", Finished: time.Unix(0, 0)}, logs.URL+"/out", logs.URL+"/err")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stdoutURL != "http://logs.example.com/web.1-19700101T000000Z/stdout.log.gz" {
+		t.Errorf("unexpected url: %s", stdoutURL)
+	}
+
+	server := httptest.NewServer(gzipEncoding(http.FileServer(http.Dir(u.dir))))
+	defer server.Close()
+
+	// Transport decompresses responses transparently like browsers do
+	resp, err := http.Get(server.URL + "/web.1-19700101T000000Z/stdout.log.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "out" || !resp.Uncompressed {
+		t.Errorf("unexpected served stdout: %q [uncompressed=%v]", b, resp.Uncompressed)
+	}
+
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("unexpected content type: %s", ct)
+	}
+}
+
+func TestFileHostileIDs(t *testing.T) {
+	logs := fileTestLogs()
+	defer logs.Close()
+
+	u, cleanup := fileTestUploader(t, "", 0)
+	defer cleanup()
+
+	for _, id := range []string{"", ".", ".."} {
+		if _, _, err := u.Upload(context.Background(), complainer.Failure{ID: id}, logs.URL+"/out", logs.URL+"/err"); err == nil {
+			t.Errorf("expected error for task id %q", id)
+		}
+	}
+
+	for _, id := range []string{"../escape", "..\\escape", "/etc/passwd"} {
+		stdoutURL, _, err := u.Upload(context.Background(), complainer.Failure{ID: id}, logs.URL+"/out", logs.URL+"/err")
+		if err != nil {
+			t.Errorf("error uploading task id %q: %s", id, err)
+			continue
+		}
+
+		if !strings.HasPrefix(stdoutURL, "file://"+u.dir+"/") || strings.Count(strings.TrimPrefix(stdoutURL, "file://"+u.dir+"/"), "/") != 1 {
+			t.Errorf("task id %q escaped storage directory: %s", id, stdoutURL)
+		}
+	}
+}
+
+func TestFilePrune(t *testing.T) {
+	logs := fileTestLogs()
+	defer logs.Close()
+
+	u, cleanup := fileTestUploader(t, "", time.Hour)
+	defer cleanup()
+
+	old := filepath.Join(u.dir, "old.1-20240110T000000Z")
+	if err := os.MkdirAll(old, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := time.Now().Add(-time.Hour * 2)
+	if err := os.Chtimes(old, ts, ts); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := u.Upload(context.Background(), complainer.Failure{ID: "web.1", Finished: time.Now()}, logs.URL+"/out", logs.URL+"/err"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("expected old logs to be pruned, got: %v", err)
+	}
+
+	entries, err := ioutil.ReadDir(u.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 {
+		t.Errorf("expected only fresh logs to stay, got %d entries", len(entries))
+	}
+}
+
+func TestFileNoListing(t *testing.T) {
+	u, cleanup := fileTestUploader(t, "", 0)
+	defer cleanup()
+
+	if err := os.MkdirAll(filepath.Join(u.dir, "web.1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(u.dir, "web.1", "stdout"), []byte("out"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(noListing(http.FileServer(http.Dir(u.dir))))
+	defer server.Close()
+
+	for path, status := range map[string]int{"/": http.StatusNotFound, "/web.1/": http.StatusNotFound, "/web.1": http.StatusNotFound, "/web.1/stdout": http.StatusOK} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != status {
+			t.Errorf("unexpected status for %s; expected: %d, got: %d", path, status, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+	"github.com/cloudflare/complainer/googleauth"
+	"github.com/cloudflare/complainer/httpclient"
+)
+
+const (
+	gcsBaseURL = "https://storage.googleapis.com"
+	gcsScope   = "https://www.googleapis.com/auth/devstorage.read_write"
+)
+
+func init() {
+	var (
+		bucket       *string
+		credentials  *string
+		prefix       *string
+		signedURLTTL *time.Duration
+	)
+
+	RegisterUploader("gcs", Maker{
+		RegisterFlags: func() {
+			bucket = flags.String("gcs.bucket", "GCS_BUCKET", "", "gcs bucket to use")
+			credentials = flags.String("gcs.credentials", "GOOGLE_APPLICATION_CREDENTIALS", "", "path to service account json, metadata server is used if empty")
+			prefix = flags.String("gcs.prefix", "GCS_PREFIX", defaultPrefix, "gcs path template to use")
+			signedURLTTL = flags.Duration("gcs.signed_url_ttl", "GCS_SIGNED_URL_TTL", 0, "ttl for signed gcs urls, public urls are returned if zero")
+		},
+
+		Make: func() (Uploader, error) {
+			return newGCSUploader(*bucket, *credentials, *prefix, *signedURLTTL)
+		},
+	})
+}
+
+type gcsUploader struct {
+	bucket       string
+	account      *googleauth.ServiceAccount
+	tokens       *googleauth.TokenSource
+	prefix       *template.Template
+	signedURLTTL time.Duration
+	client       http.Client
+}
+
+func newGCSUploader(bucket, credentials, prefix string, signedURLTTL time.Duration) (*gcsUploader, error) {
+	if bucket == "" {
+		return nil, errors.New("gcs configuration is incomplete")
+	}
+
+	var account *googleauth.ServiceAccount
+	if credentials != "" {
+		var err error
+		if account, err = googleauth.ReadServiceAccount(credentials); err != nil {
+			return nil, err
+		}
+	}
+
+	if signedURLTTL > 0 && account == nil {
+		return nil, errors.New("gcs signed urls require service account credentials")
+	}
+
+	tmpl, err := parsePrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gcsUploader{
+		bucket:       bucket,
+		account:      account,
+		tokens:       googleauth.NewTokenSource(account, gcsScope, httpclient.Uploaders),
+		prefix:       tmpl,
+		signedURLTTL: signedURLTTL,
+		client: http.Client{
+			Transport: httpclient.Transport(httpclient.Uploaders),
+			Timeout:   time.Minute,
+		},
+	}, nil
+}
+
+func (u *gcsUploader) Upload(ctx context.Context, failure complainer.Failure, stdoutURL, stderrURL string) (string, string, error) {
+	prefix, err := renderPrefix(u.prefix, failure)
+	if err != nil {
+		return "", "", err
+	}
+
+	stdout, err := download(ctx, stdoutURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	uploadedStdoutURL, err := u.upload(ctx, path.Join(prefix, "stdout"), stdout)
+	if err != nil {
+		return "", "", err
+	}
+
+	stderr, err := download(ctx, stderrURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	uploadedStderrURL, err := u.upload(ctx, path.Join(prefix, "stderr"), stderr)
+	if err != nil {
+		return "", "", err
+	}
+
+	return uploadedStdoutURL, uploadedStderrURL, nil
+}
+
+func (u *gcsUploader) upload(ctx context.Context, name string, data []byte) (string, error) {
+	token, err := u.tokens.Token()
+	if err != nil {
+		return "", err
+	}
+
+	uploadURL := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=media&name=%s", gcsBaseURL, url.QueryEscape(u.bucket), url.QueryEscape(name))
+
+	req, err := http.NewRequest(http.MethodPost, uploadURL, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "text/plain")
+
+	resp, err := u.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("cannot upload %s to gcs, status %d: %s", name, resp.StatusCode, body)
+	}
+
+	if u.signedURLTTL > 0 {
+		return u.signedURL(name, time.Now().Add(u.signedURLTTL))
+	}
+
+	return gcsBaseURL + u.objectPath(name), nil
+}
+
+// signedURL returns V2 signed url for the object
+func (u *gcsUploader) signedURL(name string, expires time.Time) (string, error) {
+	objectPath := u.objectPath(name)
+	expiresUnix := strconv.FormatInt(expires.Unix(), 10)
+
+	signature, err := u.account.Sign([]byte("GET\n\n\n" + expiresUnix + "\n" + objectPath))
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{
+		"GoogleAccessId": {u.account.ClientEmail},
+		"Expires":        {expiresUnix},
+		"Signature":      {base64.StdEncoding.EncodeToString(signature)},
+	}
+
+	return gcsBaseURL + objectPath + "?" + query.Encode(), nil
+}
+
+func (u *gcsUploader) objectPath(name string) string {
+	return (&url.URL{Path: "/" + u.bucket + "/" + name}).EscapedPath()
+}
@@ -0,0 +1,145 @@
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+	"github.com/cloudflare/complainer/httpclient"
+)
+
+func init() {
+	var (
+		putURL  *string
+		getURL  *string
+		headers *string
+	)
+
+	RegisterUploader("http", Maker{
+		RegisterFlags: func() {
+			putURL = flags.String("http.url", "HTTP_URL", "", "url template to put logs to (ex: https://artifacts.example.com/complainer/{{ .failure.ID }}/{{ .file }})")
+			getURL = flags.String("http.get_url", "HTTP_GET_URL", "", "url template to get uploaded logs from, put url is used if empty")
+			headers = flags.String("http.headers", "HTTP_HEADERS", "", "extra put request headers in 'name:value;...' format")
+		},
+
+		Make: func() (Uploader, error) {
+			return newHTTPUploader(*putURL, *getURL, *headers)
+		},
+	})
+}
+
+type httpUploader struct {
+	putURL  *template.Template
+	getURL  *template.Template
+	headers map[string]string
+	client  http.Client
+}
+
+func newHTTPUploader(putURL, getURL, headers string) (*httpUploader, error) {
+	if putURL == "" {
+		return nil, errors.New("http uploader url is not set")
+	}
+
+	if getURL == "" {
+		getURL = putURL
+	}
+
+	putTmpl, err := template.New("").Parse(putURL)
+	if err != nil {
+		return nil, err
+	}
+
+	getTmpl, err := template.New("").Parse(getURL)
+	if err != nil {
+		return nil, err
+	}
+
+	parsedHeaders := map[string]string{}
+	if headers != "" {
+		for _, header := range strings.Split(headers, ";") {
+			parts := strings.SplitN(header, ":", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("invalid http uploader header: expected in name:value format, not %s", header)
+			}
+
+			parsedHeaders[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+
+	return &httpUploader{
+		putURL:  putTmpl,
+		getURL:  getTmpl,
+		headers: parsedHeaders,
+		client: http.Client{
+			Transport: httpclient.Transport(httpclient.Uploaders),
+			Timeout:   time.Minute,
+		},
+	}, nil
+}
+
+func (u *httpUploader) Upload(ctx context.Context, failure complainer.Failure, stdoutURL, stderrURL string) (string, string, error) {
+	uploadedStdoutURL, err := u.upload(ctx, failure, "stdout", stdoutURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	uploadedStderrURL, err := u.upload(ctx, failure, "stderr", stderrURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	return uploadedStdoutURL, uploadedStderrURL, nil
+}
+
+func (u *httpUploader) upload(ctx context.Context, failure complainer.Failure, file, sourceURL string) (string, error) {
+	data, err := download(ctx, sourceURL)
+	if err != nil {
+		return "", err
+	}
+
+	vars := map[string]interface{}{
+		"failure": failure,
+		"file":    file,
+	}
+
+	putURL, err := executeTemplate(u.putURL, vars)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, putURL, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+
+	req = req.WithContext(ctx)
+
+	req.Header.Set("Content-Type", "text/plain")
+	for k, v := range u.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("cannot put %s to %s, status %d: %s", file, req.URL.Host, resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	return executeTemplate(u.getURL, vars)
+}
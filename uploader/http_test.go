@@ -0,0 +1,114 @@
+package uploader
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestHTTPUpload(t *testing.T) {
+	logs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.TrimPrefix(r.URL.Path, "/")))
+	}))
+	defer logs.Close()
+
+	stored := map[string]string{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.Header.Get("Authorization") != "Bearer token" || r.Header.Get("X-Team") != "ops" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		b, _ := ioutil.ReadAll(r.Body)
+		stored[r.URL.Path] = string(b)
+
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	u, err := newHTTPUploader(server.URL+"/{{ .failure.Name }}/{{ .failure.ID }}/{{ .file }}", "https://logs.example.com/{{ .failure.ID }}/{{ .file }}", "Authorization: Bearer token; X-Team:ops")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdoutURL, stderrURL, err := u.Upload(context.Background(), complainer.Failure{ID: "web.1", Name: "web"}, logs.URL+"/out", logs.URL+"/err")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stdoutURL != "https://logs.example.com/web.1/stdout" || stderrURL != "https://logs.example.com/web.1/stderr" {
+		t.Errorf("unexpected urls: %s, %s", stdoutURL, stderrURL)
+	}
+
+	if stored["/web/web.1/stdout"] != "out" || stored["/web/web.1/stderr"] != "err" {
+		t.Errorf("unexpected stored logs: %v", stored)
+	}
+}
+
+func TestHTTPUploadGetURLDefault(t *testing.T) {
+	logs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer logs.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	u, err := newHTTPUploader(server.URL+"/{{ .failure.ID }}/{{ .file }}", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdoutURL, _, err := u.Upload(context.Background(), complainer.Failure{ID: "web.1"}, logs.URL, logs.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stdoutURL != server.URL+"/web.1/stdout" {
+		t.Errorf("expected put url to be returned, got: %s", stdoutURL)
+	}
+}
+
+func TestHTTPUploadStatus(t *testing.T) {
+	logs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer logs.Close()
+
+	for _, status := range []int{http.StatusOK, http.StatusNoContent, http.StatusBadRequest, http.StatusForbidden, http.StatusInternalServerError, http.StatusBadGateway} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}))
+
+		u, err := newHTTPUploader(server.URL+"/{{ .file }}", "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, err = u.Upload(context.Background(), complainer.Failure{ID: "web.1"}, logs.URL, logs.URL)
+		server.Close()
+
+		if ok := status >= 200 && status < 300; (err == nil) != ok {
+			t.Errorf("unexpected result for status %d: %v", status, err)
+		}
+	}
+}
+
+func TestNewHTTPUploaderErrors(t *testing.T) {
+	for _, row := range []struct {
+		putURL  string
+		getURL  string
+		headers string
+	}{
+		{putURL: ""},
+		{putURL: "https://logs.example.com/{{ .file"},
+		{putURL: "https://logs.example.com/{{ .file }}", getURL: "{{"},
+		{putURL: "https://logs.example.com/{{ .file }}", headers: "Authorization"},
+	} {
+		if _, err := newHTTPUploader(row.putURL, row.getURL, row.headers); err == nil {
+			t.Errorf("expected error for %+v", row)
+		}
+	}
+}
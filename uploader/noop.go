@@ -1,19 +1,28 @@
 package uploader
 
-import "github.com/cloudflare/complainer"
+import (
+	"context"
+
+	"github.com/cloudflare/complainer"
+)
 
 func init() {
-	registerMaker("noop", Maker{
+	maker := Maker{
 		RegisterFlags: func() {},
 
 		Make: func() (Uploader, error) {
 			return noopUploader{}, nil
 		},
-	})
+	}
+
+	RegisterUploader("noop", maker)
+	RegisterUploader("passthrough", maker)
 }
 
+// noopUploader keeps logs in Mesos sandboxes and gives their URLs
+// to reporters unchanged, it is the simplest possible uploader
 type noopUploader struct{}
 
-func (n noopUploader) Upload(failure complainer.Failure, stdoutURL, stderrURL string) (string, string, error) {
+func (n noopUploader) Upload(ctx context.Context, failure complainer.Failure, stdoutURL, stderrURL string) (string, string, error) {
 	return stdoutURL, stderrURL, nil
 }
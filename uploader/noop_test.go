@@ -0,0 +1,26 @@
+package uploader
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudflare/complainer"
+)
+
+func TestNoopUpload(t *testing.T) {
+	for _, name := range []string{"noop", "passthrough"} {
+		u, err := NewUploader(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stdoutURL, stderrURL, err := u.Upload(context.Background(), complainer.Failure{ID: "web.1"}, "http://agent1:5051/files/download?path=/sandbox/stdout", "http://agent1:5051/files/download?path=/sandbox/stderr")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if stdoutURL != "http://agent1:5051/files/download?path=/sandbox/stdout" || stderrURL != "http://agent1:5051/files/download?path=/sandbox/stderr" {
+			t.Errorf("%s: expected mesos urls to be unchanged, got: %s, %s", name, stdoutURL, stderrURL)
+		}
+	}
+}
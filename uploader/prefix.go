@@ -0,0 +1,32 @@
+package uploader
+
+import (
+	"bytes"
+	"text/template"
+
+	"github.com/cloudflare/complainer"
+)
+
+// defaultPrefix is the default path template for uploaded logs
+const defaultPrefix = "complainer/{{ .failure.Finished.UTC.Format \"2006-01-02\" }}/{{ .failure.Name }}/{{ .failure.Finished.UTC.Format \"2006-01-02T15:04:05.000\" }}-{{ .failure.ID }}"
+
+// parsePrefix parses path template for uploaded logs,
+// falling back to the default one if prefix is empty
+func parsePrefix(prefix string) (*template.Template, error) {
+	if prefix == "" {
+		prefix = defaultPrefix
+	}
+
+	return template.New("").Parse(prefix)
+}
+
+// renderPrefix renders path template for the failure
+func renderPrefix(tmpl *template.Template, failure complainer.Failure) (string, error) {
+	return executeTemplate(tmpl, map[string]interface{}{"failure": failure})
+}
+
+func executeTemplate(tmpl *template.Template, vars map[string]interface{}) (string, error) {
+	buf := bytes.NewBuffer([]byte{})
+	err := tmpl.Execute(buf, vars)
+	return string(buf.Bytes()), err
+}
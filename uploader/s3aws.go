@@ -2,7 +2,9 @@ package uploader
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"path"
 	"text/template"
 	"time"
@@ -13,83 +15,162 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/cloudflare/complainer"
 	"github.com/cloudflare/complainer/flags"
+	"github.com/cloudflare/complainer/httpclient"
 )
 
 func init() {
 	var (
-		accessKey *string
-		secretKey *string
-		region    *string
-		bucket    *string
-		prefix    *string
-		timeout   *time.Duration
+		accessKey      *string
+		secretKey      *string
+		region         *string
+		endpoint       *string
+		forcePathStyle *bool
+		disableSSL     *bool
+		bucket         *string
+		prefix         *string
+		timeout        *time.Duration
+		sse            *string
+		kmsKeyID       *string
+		acl            *string
+		compress       *bool
 	)
 
-	registerMaker("s3aws", Maker{
+	RegisterUploader("s3aws", Maker{
 		RegisterFlags: func() {
 			accessKey = flags.String("s3aws.access_key", "S3_ACCESS_KEY", "", "access key for s3")
 			secretKey = flags.String("s3aws.secret_key", "S3_SECRET_KEY", "", "secret key for s3")
 			region = flags.String("s3aws.region", "S3_REGION", "", "s3 region to use")
+			endpoint = flags.String("s3aws.endpoint", "S3_ENDPOINT", "", "s3 endpoint for s3 compatible apis (ex: https://minio.example.com:9000)")
+			forcePathStyle = flags.Bool("s3aws.force_path_style", "S3_FORCE_PATH_STYLE", false, "whether to use path style s3 urls instead of virtual hosted")
+			disableSSL = flags.Bool("s3aws.disable_ssl", "S3_DISABLE_SSL", false, "whether to disable ssl when talking to s3")
 			bucket = flags.String("s3aws.bucket", "S3_BUCKET", "", "s3 bucket to use")
-			prefix = flags.String("s3aws.prefix", "S3_PREFIX", "complainer/{{ .failure.Finished.UTC.Format \"2006-01-02\" }}/{{ .failure.Name }}/{{ .failure.Finished.UTC.Format \"2006-01-02T15:04:05.000\" }}-{{ .failure.ID }}", "s3 path template to use")
+			prefix = flags.String("s3aws.prefix", "S3_PREFIX", defaultPrefix, "s3 path template to use")
 			timeout = flags.Duration("s3aws.timeout", "S3_TIMEOUT", time.Hour*24*7, "timeout for signed s3 urls")
+			sse = flags.String("s3aws.sse", "S3_SSE", "", "s3 server-side encryption to use (AES256, aws:kms)")
+			kmsKeyID = flags.String("s3aws.kms_key_id", "S3_KMS_KEY_ID", "", "kms key id for aws:kms server-side encryption")
+			acl = flags.String("s3aws.acl", "S3_ACL", s3.ObjectCannedACLPrivate, "s3 canned acl for uploaded logs (private, public-read)")
+			compress = flags.Bool("s3aws.compress", "S3_COMPRESS", false, "whether to gzip logs before upload")
 		},
 
 		Make: func() (Uploader, error) {
-			return newS3AwsUploader(*accessKey, *secretKey, *region, *bucket, *prefix, *timeout)
+			return newS3AwsUploader(s3AwsConfig{
+				accessKey:      *accessKey,
+				secretKey:      *secretKey,
+				region:         *region,
+				endpoint:       *endpoint,
+				forcePathStyle: *forcePathStyle,
+				disableSSL:     *disableSSL,
+				bucket:         *bucket,
+				prefix:         *prefix,
+				timeout:        *timeout,
+				sse:            *sse,
+				kmsKeyID:       *kmsKeyID,
+				acl:            *acl,
+				compress:       *compress,
+			})
 		},
 	})
 }
 
 type s3AwsUploader struct {
-	s3      *s3.S3
-	bucket  string
-	prefix  *template.Template
-	timeout time.Duration
+	s3       *s3.S3
+	bucket   string
+	prefix   *template.Template
+	timeout  time.Duration
+	sse      string
+	kmsKeyID string
+	acl      string
+	compress bool
 }
 
-func newS3AwsUploader(accessKey, secretKey, region, bucket, prefix string, timeout time.Duration) (*s3AwsUploader, error) {
-	if accessKey == "" || secretKey == "" || region == "" || bucket == "" {
+type s3AwsConfig struct {
+	accessKey      string
+	secretKey      string
+	region         string
+	endpoint       string
+	forcePathStyle bool
+	disableSSL     bool
+	bucket         string
+	prefix         string
+	timeout        time.Duration
+	sse            string
+	kmsKeyID       string
+	acl            string
+	compress       bool
+}
+
+func newS3AwsUploader(c s3AwsConfig) (*s3AwsUploader, error) {
+	if c.accessKey == "" || c.secretKey == "" || c.region == "" || c.bucket == "" {
 		return nil, errors.New("s3 configuration is incomplete")
 	}
 
-	tmpl, err := template.New("").Parse(prefix)
+	switch c.sse {
+	case "", s3.ServerSideEncryptionAes256:
+		if c.kmsKeyID != "" {
+			return nil, fmt.Errorf("s3 kms key id requires %s server-side encryption", s3.ServerSideEncryptionAwsKms)
+		}
+	case s3.ServerSideEncryptionAwsKms:
+	default:
+		return nil, fmt.Errorf("unknown s3 server-side encryption: %q", c.sse)
+	}
+
+	acl, err := cannedACL(c.acl)
 	if err != nil {
 		return nil, err
 	}
 
+	tmpl, err := parsePrefix(c.prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &aws.Config{
+		Region:           aws.String(c.region),
+		Credentials:      credentials.NewStaticCredentials(c.accessKey, c.secretKey, ""),
+		S3ForcePathStyle: aws.Bool(c.forcePathStyle),
+		DisableSSL:       aws.Bool(c.disableSSL),
+		HTTPClient:       httpclient.Client(httpclient.Uploaders),
+	}
+
+	// Custom endpoints are needed for s3 compatible apis like minio
+	if c.endpoint != "" {
+		config.Endpoint = aws.String(c.endpoint)
+	}
+
 	return &s3AwsUploader{
-		s3: s3.New(session.New(&aws.Config{
-			Region:      aws.String(region),
-			Credentials: credentials.NewStaticCredentials(accessKey, secretKey, ""),
-		})),
-		bucket:  bucket,
-		timeout: timeout,
-		prefix:  tmpl,
+		s3:       s3.New(session.New(config)),
+		bucket:   c.bucket,
+		timeout:  c.timeout,
+		prefix:   tmpl,
+		sse:      c.sse,
+		kmsKeyID: c.kmsKeyID,
+		acl:      acl,
+		compress: c.compress,
 	}, nil
 }
 
-func (u *s3AwsUploader) Upload(failure complainer.Failure, stdoutURL, stderrURL string) (string, string, error) {
-	buf := bytes.NewBuffer([]byte{})
-	err := u.prefix.Execute(buf, map[string]interface{}{"failure": failure})
-	prefix := string(buf.Bytes())
+func (u *s3AwsUploader) Upload(ctx context.Context, failure complainer.Failure, stdoutURL, stderrURL string) (string, string, error) {
+	prefix, err := renderPrefix(u.prefix, failure)
+	if err != nil {
+		return "", "", err
+	}
 
-	stdout, err := download(stdoutURL)
+	stdout, err := download(ctx, stdoutURL)
 	if err != nil {
 		return "", "", err
 	}
 
-	signedStdoutURL, err := u.upload(path.Join(prefix, "stdout"), stdout)
+	signedStdoutURL, err := u.upload(ctx, path.Join(prefix, logName("stdout", u.compress)), stdout)
 	if err != nil {
 		return "", "", err
 	}
 
-	stderr, err := download(stderrURL)
+	stderr, err := download(ctx, stderrURL)
 	if err != nil {
 		return "", "", err
 	}
 
-	signedStderrURL, err := u.upload(path.Join(prefix, "stderr"), stderr)
+	signedStderrURL, err := u.upload(ctx, path.Join(prefix, logName("stderr", u.compress)), stderr)
 	if err != nil {
 		return "", "", err
 	}
@@ -97,19 +178,19 @@ func (u *s3AwsUploader) Upload(failure complainer.Failure, stdoutURL, stderrURL
 	return signedStdoutURL, signedStderrURL, nil
 }
 
-func (u *s3AwsUploader) upload(key string, data []byte) (string, error) {
-	_, err := u.s3.PutObject(&s3.PutObjectInput{
-		ACL:           aws.String(s3.ObjectCannedACLPrivate),
-		Body:          bytes.NewReader(data),
-		Bucket:        aws.String(u.bucket),
-		ContentType:   aws.String("text/plain"),
-		ContentLength: aws.Int64(int64(len(data))),
-		Key:           aws.String(key),
-	})
+func (u *s3AwsUploader) upload(ctx context.Context, key string, data []byte) (string, error) {
+	input, err := u.putObjectInput(key, data)
 	if err != nil {
 		return "", err
 	}
 
+	req, _ := u.s3.PutObjectRequest(input)
+	req.HTTPRequest = req.HTTPRequest.WithContext(ctx)
+
+	if err := req.Send(); err != nil {
+		return "", err
+	}
+
 	r, _ := u.s3.GetObjectRequest(&s3.GetObjectInput{
 		Bucket: aws.String(u.bucket),
 		Key:    aws.String(key),
@@ -117,3 +198,39 @@ func (u *s3AwsUploader) upload(key string, data []byte) (string, error) {
 
 	return r.Presign(u.timeout)
 }
+
+func (u *s3AwsUploader) putObjectInput(key string, data []byte) (*s3.PutObjectInput, error) {
+	// S3 serves compressed logs with Content-Encoding,
+	// so browsers decompress them transparently
+	if u.compress {
+		compressed, err := compressLog(data)
+		if err != nil {
+			return nil, err
+		}
+
+		data = compressed
+	}
+
+	input := &s3.PutObjectInput{
+		ACL:           aws.String(u.acl),
+		Body:          bytes.NewReader(data),
+		Bucket:        aws.String(u.bucket),
+		ContentType:   aws.String("text/plain"),
+		ContentLength: aws.Int64(int64(len(data))),
+		Key:           aws.String(key),
+	}
+
+	if u.sse != "" {
+		input.ServerSideEncryption = aws.String(u.sse)
+	}
+
+	if u.kmsKeyID != "" {
+		input.SSEKMSKeyId = aws.String(u.kmsKeyID)
+	}
+
+	if u.compress {
+		input.ContentEncoding = aws.String("gzip")
+	}
+
+	return input, nil
+}
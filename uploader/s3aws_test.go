@@ -0,0 +1,130 @@
+package uploader
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestS3AwsPutObjectInputSSE(t *testing.T) {
+	table := []struct {
+		sse      string
+		kmsKeyID string
+	}{
+		{
+			sse:      "",
+			kmsKeyID: "",
+		},
+		{
+			sse:      s3.ServerSideEncryptionAes256,
+			kmsKeyID: "",
+		},
+		{
+			sse:      s3.ServerSideEncryptionAwsKms,
+			kmsKeyID: "",
+		},
+		{
+			sse:      s3.ServerSideEncryptionAwsKms,
+			kmsKeyID: "arn:aws:kms:us-east-1:123456789012:key/complainer",
+		},
+	}
+
+	for _, row := range table {
+		u, err := newS3AwsUploader(s3AwsConfig{
+			accessKey: "access",
+			secretKey: "secret",
+			region:    "us-east-1",
+			bucket:    "logs",
+			sse:       row.sse,
+			kmsKeyID:  row.kmsKeyID,
+		})
+		if err != nil {
+			t.Errorf("error creating uploader [sse=%q, kms_key_id=%q]: %s", row.sse, row.kmsKeyID, err)
+			continue
+		}
+
+		input, err := u.putObjectInput("stdout", []byte("hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := aws.StringValue(input.ServerSideEncryption); got != row.sse {
+			t.Errorf("invalid server-side encryption; expected: %q, got: %q", row.sse, got)
+		}
+
+		if got := aws.StringValue(input.SSEKMSKeyId); got != row.kmsKeyID {
+			t.Errorf("invalid kms key id; expected: %q, got: %q", row.kmsKeyID, got)
+		}
+	}
+}
+
+func TestS3AwsPutObjectInputCompress(t *testing.T) {
+	u, err := newS3AwsUploader(s3AwsConfig{
+		accessKey: "access",
+		secretKey: "secret",
+		region:    "us-east-1",
+		bucket:    "logs",
+		compress:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input, err := u.putObjectInput("stdout.log.gz", []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := aws.StringValue(input.ContentEncoding); got != "gzip" {
+		t.Errorf("invalid content encoding; expected: %q, got: %q", "gzip", got)
+	}
+
+	r, err := gzip.NewReader(input.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "hello" {
+		t.Errorf("unexpected decompressed body: %q", b)
+	}
+}
+
+func TestS3AwsInvalidSSE(t *testing.T) {
+	table := []struct {
+		sse      string
+		kmsKeyID string
+	}{
+		{
+			sse: "rot13",
+		},
+		{
+			sse:      s3.ServerSideEncryptionAes256,
+			kmsKeyID: "key",
+		},
+		{
+			kmsKeyID: "key",
+		},
+	}
+
+	for _, row := range table {
+		_, err := newS3AwsUploader(s3AwsConfig{
+			accessKey: "access",
+			secretKey: "secret",
+			region:    "us-east-1",
+			bucket:    "logs",
+			sse:       row.sse,
+			kmsKeyID:  row.kmsKeyID,
+		})
+		if err == nil {
+			t.Errorf("expected error for [sse=%q, kms_key_id=%q]", row.sse, row.kmsKeyID)
+		}
+	}
+}
@@ -1,7 +1,7 @@
 package uploader
 
 import (
-	"bytes"
+	"context"
 	"errors"
 	"path"
 	"text/template"
@@ -9,6 +9,7 @@ import (
 
 	"github.com/cloudflare/complainer"
 	"github.com/cloudflare/complainer/flags"
+	"github.com/cloudflare/complainer/httpclient"
 	"github.com/goamz/goamz/aws"
 	"github.com/goamz/goamz/s3"
 )
@@ -21,31 +22,37 @@ func init() {
 		bucket    *string
 		prefix    *string
 		timeout   *time.Duration
+		acl       *string
+		compress  *bool
 	)
 
-	registerMaker("s3goamz", Maker{
+	RegisterUploader("s3goamz", Maker{
 		RegisterFlags: func() {
 			accessKey = flags.String("s3goamz.access_key", "S3_ACCESS_KEY", "", "access key for s3")
 			secretKey = flags.String("s3goamz.secret_key", "S3_SECRET_KEY", "", "secret key for s3")
 			endpoint = flags.String("s3goamz.endpoint", "S3_ENDPOINT", "", "s3 endpoint (ex: https://complainer.s3.example.com)")
 			bucket = flags.String("s3goamz.bucket", "S3_BUCKET", "", "s3 bucket to use")
-			prefix = flags.String("s3goamz.prefix", "S3_PREFIX", "complainer/{{ .failure.Finished.UTC.Format \"2006-01-02\" }}/{{ .failure.Name }}/{{ .failure.Finished.UTC.Format \"2006-01-02T15:04:05.000\" }}-{{ .failure.ID }}", "s3 path template to use")
+			prefix = flags.String("s3goamz.prefix", "S3_PREFIX", defaultPrefix, "s3 path template to use")
 			timeout = flags.Duration("s3goamz.timeout", "S3_TIMEOUT", time.Hour*24*7, "timeout for signed s3 urls")
+			acl = flags.String("s3goamz.acl", "S3_ACL", string(s3.Private), "s3 canned acl for uploaded logs (private, public-read)")
+			compress = flags.Bool("s3goamz.compress", "S3_COMPRESS", false, "whether to gzip logs before upload")
 		},
 
 		Make: func() (Uploader, error) {
-			return newS3Uploader(*accessKey, *secretKey, *endpoint, *bucket, *prefix, *timeout)
+			return newS3Uploader(*accessKey, *secretKey, *endpoint, *bucket, *prefix, *timeout, *acl, *compress)
 		},
 	})
 }
 
 type s3Uploader struct {
-	bucket  *s3.Bucket
-	timeout time.Duration
-	prefix  *template.Template
+	bucket   *s3.Bucket
+	timeout  time.Duration
+	prefix   *template.Template
+	acl      s3.ACL
+	compress bool
 }
 
-func newS3Uploader(accessKey, secretKey, endpoint, bucket, prefix string, timeout time.Duration) (*s3Uploader, error) {
+func newS3Uploader(accessKey, secretKey, endpoint, bucket, prefix string, timeout time.Duration, acl string, compress bool) (*s3Uploader, error) {
 	if accessKey == "" || secretKey == "" || endpoint == "" || bucket == "" {
 		return nil, errors.New("s3 configuration is incomplete")
 	}
@@ -59,46 +66,65 @@ func newS3Uploader(accessKey, secretKey, endpoint, bucket, prefix string, timeou
 		S3BucketEndpoint: endpoint,
 	}
 
-	tmpl, err := template.New("").Parse(prefix)
+	canned, err := cannedACL(acl)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := parsePrefix(prefix)
 	if err != nil {
 		return nil, err
 	}
 
 	return &s3Uploader{
-		bucket:  s3.New(auth, region).Bucket(bucket),
-		timeout: timeout,
-		prefix:  tmpl,
+		bucket:   s3.New(auth, region, httpclient.Client(httpclient.Uploaders)).Bucket(bucket),
+		timeout:  timeout,
+		prefix:   tmpl,
+		acl:      s3.ACL(canned),
+		compress: compress,
 	}, nil
 }
 
-func (u *s3Uploader) Upload(failure complainer.Failure, stdoutURL, stderrURL string) (string, string, error) {
-	buf := bytes.NewBuffer([]byte{})
-	err := u.prefix.Execute(buf, map[string]interface{}{"failure": failure})
-	prefix := string(buf.Bytes())
-
-	stdout, err := download(stdoutURL)
+func (u *s3Uploader) Upload(ctx context.Context, failure complainer.Failure, stdoutURL, stderrURL string) (string, string, error) {
+	prefix, err := renderPrefix(u.prefix, failure)
 	if err != nil {
 		return "", "", err
 	}
 
-	stdoutPath := path.Join(prefix, "stdout")
-	err = u.bucket.Put(stdoutPath, stdout, "text/plain", s3.Private, s3.Options{})
+	stdout, err := download(ctx, stdoutURL)
 	if err != nil {
 		return "", "", err
 	}
 
-	stderr, err := download(stderrURL)
-	if err != nil {
+	stdoutPath := path.Join(prefix, logName("stdout", u.compress))
+	if err = u.put(stdoutPath, stdout); err != nil {
 		return "", "", err
 	}
 
-	stderrPath := path.Join(prefix, "stderr")
-	err = u.bucket.Put(stderrPath, stderr, "text/plain", s3.Private, s3.Options{})
+	stderr, err := download(ctx, stderrURL)
 	if err != nil {
 		return "", "", err
 	}
 
+	stderrPath := path.Join(prefix, logName("stderr", u.compress))
+	if err = u.put(stderrPath, stderr); err != nil {
+		return "", "", err
+	}
+
 	expires := time.Now().Add(u.timeout)
 
 	return u.bucket.SignedURL(stdoutPath, expires), u.bucket.SignedURL(stderrPath, expires), nil
 }
+
+func (u *s3Uploader) put(path string, data []byte) error {
+	if !u.compress {
+		return u.bucket.Put(path, data, "text/plain", u.acl, s3.Options{})
+	}
+
+	compressed, err := compressLog(data)
+	if err != nil {
+		return err
+	}
+
+	return u.bucket.Put(path, compressed, "text/plain", u.acl, s3.Options{ContentEncoding: "gzip"})
+}
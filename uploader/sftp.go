@@ -0,0 +1,213 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/cloudflare/complainer/flags"
+	"github.com/cloudflare/complainer/logging"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func init() {
+	var (
+		host       *string
+		port       *string
+		user       *string
+		password   *string
+		privateKey *string
+		knownHosts *string
+		dir        *string
+		prefix     *string
+		baseURL    *string
+	)
+
+	RegisterUploader("sftp", Maker{
+		RegisterFlags: func() {
+			host = flags.String("sftp.host", "SFTP_HOST", "", "sftp host")
+			port = flags.String("sftp.port", "SFTP_PORT", "22", "sftp port")
+			user = flags.String("sftp.user", "SFTP_USER", "", "sftp user")
+			password = flags.String("sftp.password", "SFTP_PASSWORD", "", "sftp password")
+			privateKey = flags.String("sftp.private_key", "SFTP_PRIVATE_KEY", "", "path to sftp private key")
+			knownHosts = flags.String("sftp.known_hosts", "SFTP_KNOWN_HOSTS", "", "path to known_hosts file to verify host key, verification is disabled if empty")
+			dir = flags.String("sftp.dir", "SFTP_DIR", "", "remote directory to upload logs into")
+			prefix = flags.String("sftp.prefix", "SFTP_PREFIX", defaultPrefix, "sftp path template to use")
+			baseURL = flags.String("sftp.base_url", "SFTP_BASE_URL", "", "base http url that maps to the remote directory, sftp urls are returned if empty")
+		},
+
+		Make: func() (Uploader, error) {
+			return newSFTPUploader(*host, *port, *user, *password, *privateKey, *knownHosts, *dir, *prefix, *baseURL)
+		},
+	})
+}
+
+type sftpUploader struct {
+	addr    string
+	config  *ssh.ClientConfig
+	dir     string
+	prefix  *template.Template
+	baseURL string
+}
+
+func newSFTPUploader(host, port, user, password, privateKey, knownHostsFile, dir, prefix, baseURL string) (*sftpUploader, error) {
+	if host == "" || user == "" || (password == "" && privateKey == "") {
+		return nil, errors.New("sftp configuration is incomplete")
+	}
+
+	auth := []ssh.AuthMethod{}
+
+	if privateKey != "" {
+		key, err := ioutil.ReadFile(privateKey)
+		if err != nil {
+			return nil, err
+		}
+
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+
+	if password != "" {
+		auth = append(auth, ssh.Password(password))
+	}
+
+	hostKeyCallback := ssh.InsecureIgnoreHostKey()
+	if knownHostsFile != "" {
+		callback, err := knownhosts.New(knownHostsFile)
+		if err != nil {
+			return nil, err
+		}
+
+		hostKeyCallback = callback
+	} else {
+		logging.Warning("Warning: sftp host key verification is disabled, set known_hosts to enable it", nil)
+	}
+
+	tmpl, err := parsePrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sftpUploader{
+		addr: net.JoinHostPort(host, port),
+		config: &ssh.ClientConfig{
+			User:            user,
+			Auth:            auth,
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         time.Second * 30,
+		},
+		dir:     dir,
+		prefix:  tmpl,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}, nil
+}
+
+func (u *sftpUploader) Upload(ctx context.Context, failure complainer.Failure, stdoutURL, stderrURL string) (string, string, error) {
+	prefix, err := renderPrefix(u.prefix, failure)
+	if err != nil {
+		return "", "", err
+	}
+
+	stdout, err := download(ctx, stdoutURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	stderr, err := download(ctx, stderrURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	conn, err := ssh.Dial("tcp", u.addr, u.config)
+	if err != nil {
+		return "", "", err
+	}
+
+	defer func() {
+		if err := conn.Close(); err != nil {
+			logging.Error(fmt.Sprintf("Error closing ssh connection to %s: %s", u.addr, err), logging.Fields{"error": err})
+		}
+	}()
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		return "", "", err
+	}
+
+	defer func() {
+		_ = client.Close()
+	}()
+
+	if err = client.MkdirAll(path.Join(u.dir, prefix)); err != nil {
+		return "", "", err
+	}
+
+	uploadedStdoutURL, err := u.upload(client, path.Join(prefix, "stdout"), stdout)
+	if err != nil {
+		return "", "", err
+	}
+
+	uploadedStderrURL, err := u.upload(client, path.Join(prefix, "stderr"), stderr)
+	if err != nil {
+		return "", "", err
+	}
+
+	return uploadedStdoutURL, uploadedStderrURL, nil
+}
+
+// Validate checks that complainer can log into the server
+func (u *sftpUploader) Validate(ctx context.Context) error {
+	conn, err := ssh.Dial("tcp", u.addr, u.config)
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
+
+func (u *sftpUploader) upload(client *sftp.Client, name string, data []byte) (string, error) {
+	f, err := client.Create(path.Join(u.dir, name))
+	if err != nil {
+		return "", err
+	}
+
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+		return "", err
+	}
+
+	if err = f.Close(); err != nil {
+		return "", err
+	}
+
+	return u.url(name), nil
+}
+
+// url returns the url of the uploaded file, base url maps to the remote
+// directory, so the name relative to it is appended to the base url
+func (u *sftpUploader) url(name string) string {
+	if u.baseURL != "" {
+		return u.baseURL + (&url.URL{Path: "/" + name}).EscapedPath()
+	}
+
+	return (&url.URL{
+		Scheme: "sftp",
+		User:   url.User(u.config.User),
+		Host:   u.addr,
+		Path:   path.Join("/", u.dir, name),
+	}).String()
+}
@@ -0,0 +1,248 @@
+package uploader
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/complainer"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func sftpTestSigner(t *testing.T) (ssh.Signer, []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signer, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+func sftpTestDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "sftp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func TestNewSFTPUploaderConfig(t *testing.T) {
+	dir := sftpTestDir(t)
+	defer os.RemoveAll(dir)
+
+	_, keyPEM := sftpTestSigner(t)
+
+	keyFile := filepath.Join(dir, "id_rsa")
+	if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	table := []struct {
+		host       string
+		user       string
+		password   string
+		privateKey string
+		knownHosts string
+		err        bool
+		auth       int
+	}{
+		{user: "logs", password: "secret", err: true},
+		{host: "sftp.example.com", password: "secret", err: true},
+		{host: "sftp.example.com", user: "logs", err: true},
+		{host: "sftp.example.com", user: "logs", password: "secret", auth: 1},
+		{host: "sftp.example.com", user: "logs", privateKey: keyFile, auth: 1},
+		{host: "sftp.example.com", user: "logs", password: "secret", privateKey: keyFile, auth: 2},
+		{host: "sftp.example.com", user: "logs", privateKey: filepath.Join(dir, "missing"), err: true},
+		{host: "sftp.example.com", user: "logs", password: "secret", knownHosts: filepath.Join(dir, "missing"), err: true},
+	}
+
+	for i, row := range table {
+		u, err := newSFTPUploader(row.host, "22", row.user, row.password, row.privateKey, row.knownHosts, "/logs", defaultPrefix, "")
+		if (err != nil) != row.err {
+			t.Errorf("row %d: unexpected error: %v", i, err)
+			continue
+		}
+
+		if err == nil && len(u.config.Auth) != row.auth {
+			t.Errorf("row %d: expected %d auth methods, got %d", i, row.auth, len(u.config.Auth))
+		}
+	}
+}
+
+func TestSFTPKnownHosts(t *testing.T) {
+	dir := sftpTestDir(t)
+	defer os.RemoveAll(dir)
+
+	known, _ := sftpTestSigner(t)
+	unknown, _ := sftpTestSigner(t)
+
+	file := filepath.Join(dir, "known_hosts")
+	if err := ioutil.WriteFile(file, []byte(knownhosts.Line([]string{"sftp.example.com"}, known.PublicKey())+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := newSFTPUploader("sftp.example.com", "22", "logs", "secret", "", file, "/logs", defaultPrefix, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 22}
+
+	if err = u.config.HostKeyCallback("sftp.example.com:22", addr, known.PublicKey()); err != nil {
+		t.Errorf("expected known host key to be accepted: %s", err)
+	}
+
+	if err = u.config.HostKeyCallback("sftp.example.com:22", addr, unknown.PublicKey()); err == nil {
+		t.Error("expected unknown host key to be rejected")
+	}
+}
+
+func TestSFTPURL(t *testing.T) {
+	u, err := newSFTPUploader("sftp.example.com", "2222", "logs", "secret", "", "", "/srv/logs", defaultPrefix, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if url := u.url("web/web.1/stdout"); url != "sftp://logs@sftp.example.com:2222/srv/logs/web/web.1/stdout" {
+		t.Errorf("unexpected sftp url: %s", url)
+	}
+
+	u.baseURL = "https://logs.example.com"
+
+	if url := u.url("web/web 1/stdout"); url != "https://logs.example.com/web/web%201/stdout" {
+		t.Errorf("unexpected base url mapping: %s", url)
+	}
+}
+
+// serveSFTP accepts a single ssh connection with sftp subsystem,
+// closed is closed when the client disconnects
+func serveSFTP(t *testing.T, l net.Listener, hostKey ssh.Signer, closed chan<- struct{}) {
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if c.User() == "logs" && string(password) == "secret" {
+				return nil, nil
+			}
+
+			return nil, io.EOF
+		},
+	}
+
+	config.AddHostKey(hostKey)
+
+	nc, err := l.Accept()
+	if err != nil {
+		return
+	}
+
+	conn, channels, requests, err := ssh.NewServerConn(nc, config)
+	if err != nil {
+		t.Errorf("error accepting ssh connection: %s", err)
+		return
+	}
+
+	go ssh.DiscardRequests(requests)
+
+	go func() {
+		for nch := range channels {
+			ch, reqs, err := nch.Accept()
+			if err != nil {
+				continue
+			}
+
+			go func(reqs <-chan *ssh.Request) {
+				for req := range reqs {
+					_ = req.Reply(req.Type == "subsystem" && string(req.Payload[4:]) == "sftp", nil)
+				}
+			}(reqs)
+
+			server, err := sftp.NewServer(ch)
+			if err != nil {
+				continue
+			}
+
+			go func(ch ssh.Channel) {
+				_ = server.Serve()
+				_ = ch.Close()
+			}(ch)
+		}
+	}()
+
+	_ = conn.Wait()
+	close(closed)
+}
+
+func TestSFTPUpload(t *testing.T) {
+	dir := sftpTestDir(t)
+	defer os.RemoveAll(dir)
+
+	logs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.TrimPrefix(r.URL.Path, "/")))
+	}))
+	defer logs.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer l.Close()
+
+	hostKey, _ := sftpTestSigner(t)
+	closed := make(chan struct{})
+	go serveSFTP(t, l, hostKey, closed)
+
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+
+	u, err := newSFTPUploader(host, port, "logs", "secret", "", "", dir, "{{ .failure.Name }}/{{ .failure.ID }}", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdoutURL, stderrURL, err := u.Upload(context.Background(), complainer.Failure{ID: "web.1", Name: "web"}, logs.URL+"/out", logs.URL+"/err")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "sftp://logs@" + l.Addr().String() + dir + "/web/web.1/stdout"; stdoutURL != expected {
+		t.Errorf("unexpected stdout url; expected: %s, got: %s", expected, stdoutURL)
+	}
+
+	if !strings.HasSuffix(stderrURL, "/web/web.1/stderr") {
+		t.Errorf("unexpected stderr url: %s", stderrURL)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "web", "web.1", "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "out" {
+		t.Errorf("unexpected uploaded stdout: %q", b)
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second * 5):
+		t.Error("ssh connection is not closed after upload")
+	}
+}
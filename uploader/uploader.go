@@ -1,6 +1,7 @@
 package uploader
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/cloudflare/complainer"
@@ -21,7 +22,14 @@ func RegisterFlags() {
 	}
 }
 
-func registerMaker(name string, uploaderMaker Maker) {
+// RegisterUploader registers uploader maker by name, uploaders compiled
+// into complainer register themselves in init, so their flags are known
+// before flags are parsed. Registering the same name twice panics.
+func RegisterUploader(name string, uploaderMaker Maker) {
+	if _, ok := makers[name]; ok {
+		panic(fmt.Sprintf("uploader maker %q is already registered", name))
+	}
+
 	makers[name] = uploaderMaker
 }
 
@@ -34,7 +42,24 @@ func MakerByName(name string) (Maker, error) {
 	return Maker{}, fmt.Errorf("unknown uploader maker: %q", name)
 }
 
-// Uploader is responsible for uploading logs
+// NewUploader makes uploader registered by name from parsed flags
+func NewUploader(name string) (Uploader, error) {
+	um, err := MakerByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return um.Make()
+}
+
+// Validator is implemented by uploaders that can check
+// their config at startup, ex: that credentials are accepted
+type Validator interface {
+	Validate(ctx context.Context) error
+}
+
+// Uploader is responsible for uploading logs,
+// uploading should stop when the context is done
 type Uploader interface {
-	Upload(failure complainer.Failure, stdoutURL, stderrURL string) (string, string, error)
+	Upload(ctx context.Context, failure complainer.Failure, stdoutURL, stderrURL string) (string, string, error)
 }
@@ -0,0 +1,33 @@
+package uploader
+
+import (
+	"testing"
+)
+
+func TestRegisterUploader(t *testing.T) {
+	defer delete(makers, "custom")
+
+	RegisterUploader("custom", Maker{
+		RegisterFlags: func() {},
+
+		Make: func() (Uploader, error) {
+			return noopUploader{}, nil
+		},
+	})
+
+	if _, err := NewUploader("custom"); err != nil {
+		t.Errorf("error making registered uploader: %s", err)
+	}
+
+	if _, err := NewUploader("missing"); err == nil {
+		t.Error("expected error making unknown uploader")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected duplicate registration to panic")
+		}
+	}()
+
+	RegisterUploader("custom", Maker{})
+}